@@ -0,0 +1,47 @@
+package microcache
+
+import (
+	"time"
+)
+
+// adaptiveTTLSize is the number of objects for which change history is retained
+const adaptiveTTLSize = 1e4
+
+// adaptiveState is the change history of a cached object
+type adaptiveState struct {
+	bodyHash uint64
+	ttl      time.Duration
+}
+
+// adaptiveTTL returns the ttl for a backend response to be stored as objHash.
+// The ttl doubles each time the body is unchanged from the previous version and
+// halves each time it has changed, bounded by MinTTL and MaxTTL.
+func (m *microcache) adaptiveTTL(objHash string, res Response, ttl time.Duration) time.Duration {
+	if m.adaptive == nil {
+		return ttl
+	}
+	min, max := ttl, ttl
+	if m.MinTTL > 0 && m.MinTTL < ttl {
+		min = m.MinTTL
+	}
+	if m.MaxTTL > ttl {
+		max = m.MaxTTL
+	}
+	state := adaptiveState{bodyHash: res.bodyDigest(), ttl: ttl}
+	if v, ok := m.adaptive.Get(objHash); ok {
+		prev := v.(adaptiveState)
+		if prev.bodyHash == state.bodyHash {
+			state.ttl = prev.ttl * 2
+		} else {
+			state.ttl = prev.ttl / 2
+		}
+		if state.ttl > max {
+			state.ttl = max
+		}
+		if state.ttl < min {
+			state.ttl = min
+		}
+	}
+	m.adaptive.Add(objHash, state)
+	return state.ttl
+}
@@ -0,0 +1,62 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// AdaptiveTTL lengthens ttl for unchanged objects and shortens it for changed objects
+func TestAdaptiveTTL(t *testing.T) {
+	cache := newMicrocache(Config{
+		TTL:         10 * time.Second,
+		MinTTL:      5 * time.Second,
+		MaxTTL:      40 * time.Second,
+		AdaptiveTTL: true,
+		Driver:      NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	a := Response{body: []byte("a")}
+	b := Response{body: []byte("b")}
+	for i, tc := range []struct {
+		res Response
+		ttl time.Duration
+	}{
+		{a, 10 * time.Second},
+		{a, 20 * time.Second},
+		{a, 40 * time.Second},
+		{a, 40 * time.Second},
+		{b, 20 * time.Second},
+		{a, 10 * time.Second},
+		{b, 5 * time.Second},
+		{a, 5 * time.Second},
+	} {
+		if ttl := cache.adaptiveTTL("obj", tc.res, 10*time.Second); ttl != tc.ttl {
+			t.Fatalf("%d: Adaptive ttl not correct %s != %s", i, ttl, tc.ttl)
+		}
+	}
+}
+
+// AdaptiveTTL extends the expiration of unchanged objects
+func TestAdaptiveTTLExpiration(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	clock := &fakeClock{now: time.Now()}
+	cache := newMicrocache(Config{
+		TTL:         10 * time.Second,
+		MaxTTL:      40 * time.Second,
+		AdaptiveTTL: true,
+		Clock:       clock,
+		Monitor:     testMonitor,
+		Driver:      NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	getResponse(handler, "/")
+	clock.add(11 * time.Second)
+	getResponse(handler, "/")
+	clock.add(15 * time.Second)
+	getResponse(handler, "/")
+	if testMonitor.getMisses() != 2 || testMonitor.getHits() != 1 {
+		t.Fatalf("Adaptive ttl not respected %s", dumpMonitor(testMonitor))
+	}
+}
@@ -0,0 +1,67 @@
+package microcache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash"
+)
+
+const (
+	admissionDepth = 4
+	admissionWidth = 1 << 14
+)
+
+// admission estimates request frequency with a count-min sketch so that objects
+// are only stored once requested MinHitsToCache times. Counters are halved each
+// window so that frequency reflects recent requests (TinyLFU style aging).
+type admission struct {
+	mutex    sync.Mutex
+	counters [admissionDepth][admissionWidth]uint8
+	window   time.Duration
+	aged     time.Time
+}
+
+func newAdmission(window time.Duration) *admission {
+	return &admission{window: window}
+}
+
+// incr increments the estimated frequency of a key and returns the new estimate
+func (a *admission) incr(key string, now time.Time) int {
+	h := xxhash.Sum64String(key)
+	h1, h2 := uint32(h), uint32(h>>32)
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if now.Sub(a.aged) >= a.window {
+		a.age()
+		a.aged = now
+	}
+	min := uint8(255)
+	for i := range a.counters {
+		c := &a.counters[i][(h1+uint32(i)*h2)%admissionWidth]
+		if *c < 255 {
+			*c++
+		}
+		if *c < min {
+			min = *c
+		}
+	}
+	return int(min)
+}
+
+// age halves all counters
+func (a *admission) age() {
+	for i := range a.counters {
+		for j := range a.counters[i] {
+			a.counters[i][j] >>= 1
+		}
+	}
+}
+
+// admit reports whether a new object has been requested often enough to be stored
+func (m *microcache) admit(objHash string) bool {
+	if m.admission == nil {
+		return true
+	}
+	return m.admission.incr(objHash, m.now()) >= m.MinHitsToCache
+}
@@ -0,0 +1,60 @@
+package microcache
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Admission sketch estimates frequency and decays each window
+func TestAdmission(t *testing.T) {
+	a := newAdmission(time.Minute)
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		if n := a.incr("a", now); n != i {
+			t.Fatalf("Frequency estimate %d != %d", n, i)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		a.incr(strconv.Itoa(i), now)
+	}
+	if n := a.incr("b", now); n > 2 {
+		t.Fatalf("Frequency overestimated %d", n)
+	}
+	if n := a.incr("a", now.Add(time.Minute)); n != 2 {
+		t.Fatalf("Frequency not decayed %d != 2", n)
+	}
+}
+
+// MinHitsToCache stores objects only after repeated requests
+func TestMinHitsToCache(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:            30 * time.Second,
+		MinHitsToCache: 2,
+		MinHitsWindow:  10 * time.Second,
+		Monitor:        testMonitor,
+		Driver:         NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{
+		"/a",
+		"/b",
+		"/a",
+		"/a",
+	})
+	if testMonitor.getHits() != 1 || testMonitor.getMisses() != 3 {
+		t.Fatalf("MinHitsToCache not respected %s", dumpMonitor(testMonitor))
+	}
+	// Counts decay over time
+	cache.offsetIncr(11 * time.Second)
+	batchGet(handler, []string{
+		"/b",
+		"/b",
+	})
+	if testMonitor.getHits() != 1 || testMonitor.getMisses() != 5 {
+		t.Fatalf("MinHitsWindow not respected %s", dumpMonitor(testMonitor))
+	}
+}
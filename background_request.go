@@ -3,13 +3,29 @@ package microcache
 import (
 	"context"
 	"net/http"
+	"time"
 )
 
 // newBackgroundRequest clones a request for use in background object revalidation.
 // This prevents a closed foreground request context from prematurely cancelling
-// the background request context.
-func newBackgroundRequest(r *http.Request) *http.Request {
-	return r.Clone(bgContext{r.Context(), make(chan struct{})})
+// the background request context. A timeout greater than zero sets a deadline on
+// the background request context. The returned cancel func must be called once the
+// background request completes.
+// Buffered request bodies are replayed. Requests having bodies which are not
+// buffered must not be cloned (see replayable).
+func newBackgroundRequest(r *http.Request, timeout time.Duration) (*http.Request, context.CancelFunc) {
+	var ctx context.Context = bgContext{r.Context(), make(chan struct{})}
+	cancel := func() {}
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	br := r.Clone(ctx)
+	if r.GetBody != nil {
+		if body, err := r.GetBody(); err == nil {
+			br.Body = body
+		}
+	}
+	return br, cancel
 }
 
 type bgContext struct {
@@ -20,3 +36,11 @@ type bgContext struct {
 func (c bgContext) Done() <-chan struct{} {
 	return c.done
 }
+
+func (c bgContext) Err() error {
+	return nil
+}
+
+func (c bgContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,118 @@
+package benchmarks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kevburnsjr/microcache"
+	microcachesnappy "github.com/kevburnsjr/microcache/compressor/snappy"
+	microcachearc "github.com/kevburnsjr/microcache/driver/arc"
+	microcacheristretto "github.com/kevburnsjr/microcache/driver/ristretto"
+	"github.com/kevburnsjr/microcache/microcachetest"
+)
+
+// capacity is the number of response objects each driver may hold, relative to
+// Workload.Keys, so that eviction policy affects hit rate
+const capacity = 0.1
+
+var drivers = []struct {
+	name string
+	new  func(w Workload) microcache.Driver
+}{
+	{"lru", func(w Workload) microcache.Driver {
+		return microcache.NewDriverLRU(int(float64(w.Keys) * capacity))
+	}},
+	{"arc", func(w Workload) microcache.Driver {
+		return microcachearc.NewDriver(int(float64(w.Keys) * capacity))
+	}},
+	{"lfu", func(w Workload) microcache.Driver {
+		return microcache.NewDriverLFU(int(float64(w.Keys) * capacity))
+	}},
+	{"ristretto", func(w Workload) microcache.Driver {
+		n := int64(float64(w.Keys) * capacity)
+		return microcacheristretto.NewDriver(n, n*int64(w.AvgBodySize()+512))
+	}},
+	{"slab", func(w Workload) microcache.Driver {
+		n := int(float64(w.Keys) * capacity)
+		return microcache.NewDriverSlab(n * (w.AvgBodySize() + 512))
+	}},
+}
+
+var compressors = []struct {
+	name       string
+	compressor microcache.Compressor
+}{
+	{"none", nil},
+	{"snappy", microcachesnappy.Compressor{}},
+	{"gzip", microcache.CompressorGzip{}},
+}
+
+func BenchmarkDrivers(b *testing.B) {
+	for _, w := range Workloads {
+		for _, d := range drivers {
+			b.Run(w.Name+"/"+d.name, func(b *testing.B) {
+				run(b, w, d.new(w), nil)
+			})
+		}
+	}
+}
+
+func BenchmarkCompressors(b *testing.B) {
+	for _, w := range Workloads {
+		for _, c := range compressors {
+			b.Run(w.Name+"/"+c.name, func(b *testing.B) {
+				run(b, w, drivers[0].new(w), c.compressor)
+			})
+		}
+	}
+}
+
+// run replays the workload against a cache and reports hit rate and cache size
+func run(b *testing.B, w Workload, driver microcache.Driver, compressor microcache.Compressor) {
+	monitor := microcachetest.NewMonitor()
+	cache := microcache.MustNew(microcache.Config{
+		TTL:        time.Hour,
+		Driver:     driver,
+		Compressor: compressor,
+		Monitor:    monitor,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(w.Handler())
+	paths := w.Paths(1 << 16)
+	r := httptest.NewRequest("GET", "/", nil)
+	rw := &discardWriter{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.URL.Path = paths[i%len(paths)]
+		handler.ServeHTTP(rw, r)
+	}
+	b.StopTimer()
+	if hits, misses := monitor.Hits(), monitor.Misses(); hits+misses > 0 {
+		b.ReportMetric(100*float64(hits)/float64(hits+misses), "hit%")
+	}
+	if d, ok := driver.(microcache.DriverSizeBytes); ok {
+		if size := driver.GetSize(); size > 0 {
+			b.ReportMetric(float64(d.GetSizeBytes())/float64(size), "bytes/obj")
+		}
+	}
+}
+
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	for k := range w.header {
+		delete(w.header, k)
+	}
+	return w.header
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {}
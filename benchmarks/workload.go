@@ -0,0 +1,95 @@
+// Package benchmarks compares drivers and compressors under standardized workloads
+// to help choose a configuration. Each benchmark reports hit rate, latency, allocations
+// and bytes/obj, the approximate memory retained per cached object including unused
+// slice capacity.
+//
+//	cd benchmarks && go test -run x -bench . -benchmem
+//
+// The benchmarks are a separate module so that the drivers and compressors they compare
+// are not dependencies of microcache. Others (ie. gcache, zstd) can be compared by adding
+// them to the drivers and compressors lists in benchmarks_test.go.
+package benchmarks
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Workload describes a synthetic request distribution
+type Workload struct {
+	Name string
+
+	// Keys is the number of distinct request URIs
+	Keys uint64
+
+	// Skew is the zipf exponent of key popularity (s > 1)
+	// Higher values concentrate requests on fewer keys
+	Skew float64
+
+	// BodySizes are the response body sizes in bytes, assigned to keys round robin
+	BodySizes []int
+
+	// Seed makes request sequences reproducible
+	Seed int64
+}
+
+// Workloads are the standard workloads used by the benchmarks
+var Workloads = []Workload{
+	{Name: "zipf-small", Keys: 10000, Skew: 1.1, BodySizes: []int{512, 1024, 2048}, Seed: 1},
+	{Name: "zipf-large", Keys: 10000, Skew: 1.1, BodySizes: []int{16 << 10, 64 << 10}, Seed: 1},
+	{Name: "zipf-mixed", Keys: 10000, Skew: 1.5, BodySizes: []int{256, 4096, 64 << 10}, Seed: 1},
+	{Name: "uniform", Keys: 10000, Skew: 1.0001, BodySizes: []int{1024}, Seed: 1},
+}
+
+// Paths returns n request paths following the workload's key distribution
+func (w Workload) Paths(n int) []string {
+	rnd := rand.New(rand.NewSource(w.Seed))
+	zipf := rand.NewZipf(rnd, w.Skew, 1, w.Keys-1)
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = "/" + strconv.FormatUint(zipf.Uint64(), 10)
+	}
+	return paths
+}
+
+// Handler returns a backend serving each key with a body of its assigned size
+func (w Workload) Handler() http.Handler {
+	bodies := make([][]byte, len(w.BodySizes))
+	for i, size := range w.BodySizes {
+		bodies[i] = body(size, w.Seed+int64(i))
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		key, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(bodies[key%len(bodies)])
+	})
+}
+
+// AvgBodySize returns the mean response body size
+func (w Workload) AvgBodySize() int {
+	var total int
+	for _, size := range w.BodySizes {
+		total += size
+	}
+	return total / len(w.BodySizes)
+}
+
+var words = strings.Fields(`id name title description created updated status active
+	true false null user account order item price total count page limit next prev`)
+
+// body generates a json-like body of the given size with realistic compressibility
+func body(size int, seed int64) []byte {
+	rnd := rand.New(rand.NewSource(seed))
+	var b strings.Builder
+	b.WriteString("[")
+	for b.Len() < size {
+		b.WriteString(`{"`)
+		b.WriteString(words[rnd.Intn(len(words))])
+		b.WriteString(`":"`)
+		b.WriteString(strconv.FormatInt(rnd.Int63(), 36))
+		b.WriteString(`"},`)
+	}
+	return []byte(b.String()[:size])
+}
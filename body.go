@@ -0,0 +1,42 @@
+package microcache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// hasBody reports whether a request may have a body
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
+
+// replayable reports whether a request can be safely cloned for background
+// revalidation, having either no body or a buffered body and not being marked
+// ForegroundOnly
+func replayable(r *http.Request) bool {
+	return !foregroundOnly(r) && (!hasBody(r) || r.GetBody != nil)
+}
+
+// bufferBody buffers request bodies up to MaxRequestBodyBuffer bytes so that the
+// request can be replayed during background revalidation. Larger bodies are
+// restored unbuffered.
+func (m *microcache) bufferBody(r *http.Request) {
+	limit := m.MaxRequestBodyBuffer
+	if limit <= 0 || replayable(r) || r.ContentLength > limit {
+		return
+	}
+	buf := &bytes.Buffer{}
+	body := r.Body
+	if _, err := io.CopyN(buf, body, limit+1); err != io.EOF {
+		r.Body = readCloser{io.MultiReader(buf, body), body}
+		return
+	}
+	body.Close()
+	b := buf.Bytes()
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+}
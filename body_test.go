@@ -0,0 +1,67 @@
+package microcache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Buffered request bodies are replayed during background revalidation
+func TestMaxRequestBodyBuffer(t *testing.T) {
+	for _, limit := range []int64{0, 1024} {
+		var mutex sync.Mutex
+		var bodies []string
+		cache := newMicrocache(Config{
+			TTL:                  30 * time.Second,
+			StaleWhileRevalidate: 30 * time.Second,
+			MaxRequestBodyBuffer: limit,
+			Driver:               NewDriverLRU(10),
+		})
+		handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			mutex.Lock()
+			bodies = append(bodies, string(b))
+			mutex.Unlock()
+			noopSuccessHandler(w, r)
+		}))
+		get := func(body string) {
+			r := httptest.NewRequest("GET", "/", strings.NewReader(body))
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+		}
+		get("abc")
+		cache.offsetIncr(31 * time.Second)
+		get("abc")
+		time.Sleep(20 * time.Millisecond)
+		mutex.Lock()
+		if limit == 0 && len(bodies) != 1 {
+			t.Fatalf("Request with unbuffered body revalidated %q", bodies)
+		}
+		if limit > 0 && (len(bodies) != 2 || bodies[1] != "abc") {
+			t.Fatalf("Buffered body not replayed %q", bodies)
+		}
+		mutex.Unlock()
+		cache.Stop()
+	}
+}
+
+// Bodies exceeding MaxRequestBodyBuffer are passed through intact
+func TestMaxRequestBodyBufferExceeded(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 2048)
+	r := httptest.NewRequest("GET", "/", bytes.NewReader(body))
+	r.ContentLength = -1
+	cache := newMicrocache(Config{MaxRequestBodyBuffer: 1024})
+	defer cache.Stop()
+	cache.bufferBody(r)
+	if replayable(r) {
+		t.Fatal("Body exceeding limit should not be buffered")
+	}
+	b, _ := ioutil.ReadAll(r.Body)
+	if !bytes.Equal(b, body) {
+		t.Fatal("Body exceeding limit not restored")
+	}
+}
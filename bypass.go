@@ -0,0 +1,64 @@
+package microcache
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// checkBypass reports whether a request asks to bypass the cache with the bypass
+// header or query parameter. The bypass header and query parameter are removed from
+// the returned request so that they are neither hashed nor sent to the backend.
+func (m *microcache) checkBypass(r *http.Request) (bool, *http.Request) {
+	var header, param string
+	if m.BypassHeader != "" {
+		header = r.Header.Get(m.BypassHeader)
+	}
+	if m.BypassQueryParam != "" && strings.Contains(r.URL.RawQuery, m.BypassQueryParam) {
+		param = r.URL.Query().Get(m.BypassQueryParam)
+	}
+	if header == "" && param == "" {
+		return false, r
+	}
+	r = r.Clone(r.Context())
+	if header != "" {
+		r.Header.Del(m.BypassHeader)
+	}
+	if param != "" {
+		r.URL.RawQuery = removeQueryParam(r.URL.RawQuery, m.BypassQueryParam)
+		if r.RequestURI != "" {
+			r.RequestURI = r.URL.RequestURI()
+		}
+	}
+	return m.bypassAuthorized(header) || m.bypassAuthorized(param), r
+}
+
+// bypassAuthorized reports whether a bypass value matches BypassToken
+func (m *microcache) bypassAuthorized(val string) bool {
+	if val == "" {
+		return false
+	}
+	if m.BypassToken == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(val), []byte(m.BypassToken)) == 1
+}
+
+// removeQueryParam removes a parameter from a raw query string, preserving the order
+// and encoding of the remaining parameters
+func removeQueryParam(rawQuery, key string) string {
+	parts := strings.Split(rawQuery, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		name := part
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name = part[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil && unescaped == key {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	return strings.Join(kept, "&")
+}
@@ -0,0 +1,64 @@
+package microcache
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRemoveQueryParam(t *testing.T) {
+	for _, c := range [][3]string{
+		{"mc_bypass=1", "mc_bypass", ""},
+		{"b=2&mc_bypass=1&a=1", "mc_bypass", "b=2&a=1"},
+		{"mc%5Fbypass=1&a=%20", "mc_bypass", "a=%20"},
+		{"mc_bypass&a=1", "mc_bypass", "a=1"},
+		{"a=mc_bypass", "mc_bypass", "a=mc_bypass"},
+	} {
+		if got := removeQueryParam(c[0], c[1]); got != c[2] {
+			t.Fatalf("removeQueryParam(%q) = %q, expected %q", c[0], got, c[2])
+		}
+	}
+}
+
+// Bypass requests are served by the backend without affecting cached objects
+func TestBypass(t *testing.T) {
+	for _, refresh := range []bool{false, true} {
+		cache := MustNew(Config{
+			TTL:              30 * time.Second,
+			HashQuery:        true,
+			BypassHeader:     "microcache-bypass",
+			BypassQueryParam: "mc_bypass",
+			BypassToken:      "secret",
+			BypassRefresh:    refresh,
+			Driver:           NewDriverLRU(10),
+			Exposed:          true,
+		})
+		var version int64
+		handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("mc_bypass") != "" || r.Header.Get("microcache-bypass") != "" {
+				t.Fatal("Bypass parameters should not be sent to the backend")
+			}
+			w.Write([]byte{byte('0' + atomic.AddInt64(&version, 1))})
+		}))
+		getResponse(handler, "/?a=1")
+		if r := getResponse(handler, "/?a=1&mc_bypass=wrong"); r.Body.String() != "1" {
+			t.Fatal("Bypass with wrong token should be served from cache")
+		}
+		if r := getResponse(handler, "/?a=1&mc_bypass=secret"); r.Body.String() != "2" {
+			t.Fatal("Bypass query parameter should force a backend request")
+		}
+		r := getResponseWithHeader(handler, "/?a=1", http.Header{"Microcache-Bypass": {"secret"}})
+		if r.Body.String() != "3" {
+			t.Fatal("Bypass header should force a backend request")
+		}
+		expected := "1"
+		if refresh {
+			expected = "3"
+		}
+		if r := getResponse(handler, "/?a=1"); r.Body.String() != expected || r.Header().Get("microcache") != "HIT" {
+			t.Fatalf("Expected cached %s (BypassRefresh: %v), got %s", expected, refresh, r.Body.String())
+		}
+		cache.Stop()
+	}
+}
@@ -0,0 +1,57 @@
+package microcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setClientCacheControl sets Cache-Control and Expires headers describing the remaining
+// freshness of obj so that browser caches and CDNs may layer on top of the microcache.
+// Immutable objects and responses marked private or no-store by the backend are untouched.
+func (m *microcache) setClientCacheControl(w http.ResponseWriter, obj Response) {
+	if !m.SetClientCacheControl || !downstreamCacheable(obj) {
+		return
+	}
+	maxAge, expires := m.downstreamFreshness(w, obj)
+	h := w.Header()
+	h.Set("Cache-Control", "public, max-age="+strconv.FormatInt(maxAge, 10))
+	h.Set("Expires", expires.UTC().Format(http.TimeFormat))
+}
+
+// downstreamFreshness returns the max-age in seconds and expiration to advertise for obj.
+// When an Age header is present, max-age is the full freshness lifetime since downstream
+// caches subtract Age themselves. Stale objects are sent with max-age equal to their age.
+func (m *microcache) downstreamFreshness(w http.ResponseWriter, obj Response) (int64, time.Time) {
+	now := m.now()
+	remaining := obj.expires.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	maxAge := int64(remaining / time.Second)
+	if _, ok := w.Header()["Age"]; ok {
+		maxAge += int64((obj.age + now.Sub(obj.date)) / time.Second)
+	}
+	return maxAge, now.Add(remaining)
+}
+
+// downstreamCacheable reports whether freshness headers may be generated for obj.
+// Immutable objects already carry immutableCacheControl.
+func downstreamCacheable(obj Response) bool {
+	return !obj.expires.Equal(immutableExpires) && clientCacheable(obj.header)
+}
+
+// clientCacheable reports whether the backend permits shared caches to store the response
+func clientCacheable(h http.Header) bool {
+	for _, v := range h["Cache-Control"] {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if directive == "private" || directive == "no-store" ||
+				strings.HasPrefix(directive, "private=") {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// SetClientCacheControl emits freshness relative to the cached object
+func TestSetClientCacheControl(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	cache := MustNew(Config{
+		TTL:                   30 * time.Second,
+		StaleWhileRevalidate:  30 * time.Second,
+		SetClientCacheControl: true,
+		Clock:                 clock,
+		Driver:                NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		noopSuccessHandler(w, r)
+	}))
+	w := getResponse(handler, "/")
+	if v := w.Header()["Cache-Control"]; len(v) != 1 || v[0] != "public, max-age=30" {
+		t.Fatalf("Miss Cache-Control not correct %v", v)
+	}
+	clock.add(10 * time.Second)
+	w = getResponse(handler, "/")
+	// Downstream caches subtract Age from max-age
+	if v := w.Header()["Cache-Control"]; len(v) != 1 || v[0] != "public, max-age=30" {
+		t.Fatalf("Hit Cache-Control not correct %v", v)
+	}
+	if w.Header().Get("Age") != "10" {
+		t.Fatalf("Age not correct %q", w.Header().Get("Age"))
+	}
+	exp := clock.Now().Add(20 * time.Second).UTC().Format(http.TimeFormat)
+	if w.Header().Get("Expires") != exp {
+		t.Fatalf("Expires not correct %q != %q", w.Header().Get("Expires"), exp)
+	}
+	clock.add(25 * time.Second)
+	w = getResponse(handler, "/")
+	if v := w.Header().Get("Cache-Control"); v != "public, max-age=35" {
+		t.Fatalf("Stale Cache-Control not correct %q", v)
+	}
+	if w.Header().Get("Expires") != clock.Now().UTC().Format(http.TimeFormat) {
+		t.Fatalf("Stale Expires not correct %q", w.Header().Get("Expires"))
+	}
+	getResponse(handler, "/private")
+	w = getResponse(handler, "/private")
+	if v := w.Header().Get("Cache-Control"); v != "private, max-age=60" {
+		t.Fatalf("Private Cache-Control was replaced %q", v)
+	}
+	if w.Header().Get("Expires") != "" {
+		t.Fatalf("Private Expires was set %q", w.Header().Get("Expires"))
+	}
+}
+
+// Without an Age header max-age is the remaining freshness
+func TestSetClientCacheControlSuppressAge(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	cache := MustNew(Config{
+		TTL:                   30 * time.Second,
+		SuppressAgeHeader:     true,
+		SetClientCacheControl: true,
+		Clock:                 clock,
+		Driver:                NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	getResponse(handler, "/")
+	clock.add(10 * time.Second)
+	w := getResponse(handler, "/")
+	if v := w.Header().Get("Cache-Control"); v != "public, max-age=20" {
+		t.Fatalf("Cache-Control not correct %q", v)
+	}
+}
@@ -0,0 +1,41 @@
+package microcache
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Clock is the interface for the source of the current time
+// A fake clock may be injected to control object expiration in tests
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock reports the system time
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// initialAge returns the corrected initial age of a response per RFC 7234 §4.2.3
+// taking into account any Age received from upstream caches and the time spent
+// waiting on the backend
+func initialAge(header http.Header, requestTime, responseTime time.Time) time.Duration {
+	var apparentAge time.Duration
+	if date, err := http.ParseTime(header.Get("Date")); err == nil {
+		if d := responseTime.Sub(date); d > 0 {
+			apparentAge = d
+		}
+	}
+	ageValue, _ := strconv.ParseInt(header.Get("Age"), 10, 64)
+	if ageValue < 0 {
+		ageValue = 0
+	}
+	correctedAgeValue := time.Duration(ageValue)*time.Second + responseTime.Sub(requestTime)
+	if apparentAge > correctedAgeValue {
+		return apparentAge
+	}
+	return correctedAgeValue
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kevburnsjr/microcache"
+)
+
+// config contains the proxy specific configuration options.
+// Cache options are parsed from the same file into the embedded ConfigSpec.
+type config struct {
+	microcache.ConfigSpec `yaml:",inline"`
+
+	// Listen is the address on which to serve the proxy
+	Listen string `yaml:"listen"`
+
+	// Upstream is the URL of the origin server
+	Upstream string `yaml:"upstream"`
+
+	// MonitorInterval determines how often stats are logged. Zero disables logging.
+	MonitorInterval time.Duration `yaml:"monitor_interval"`
+
+	// HealthPath is the path at which the cache health check is served. Empty disables.
+	HealthPath string `yaml:"health_path"`
+}
+
+func loadConfig(path string) (cfg config, err error) {
+	cfg = config{
+		Listen: ":8080",
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	// Unknown keys are rejected so that misspelled options are not silently ignored
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err = dec.Decode(&cfg); err != nil {
+		return
+	}
+	if cfg.Upstream == "" {
+		err = fmt.Errorf("upstream is required")
+	}
+	return
+}
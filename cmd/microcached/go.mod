@@ -0,0 +1,11 @@
+module github.com/kevburnsjr/microcache/cmd/microcached
+
+go 1.13
+
+require (
+	github.com/kevburnsjr/microcache v1.1.0
+	github.com/kevburnsjr/microcache/compressor/snappy v1.1.0
+	github.com/kevburnsjr/microcache/driver/arc v1.1.0
+	github.com/kevburnsjr/microcache/driver/ristretto v1.1.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,82 @@
+// microcached is a standalone caching reverse proxy using the microcache middleware
+//
+//	microcached -config microcached.yaml
+//
+// See microcached.example.yaml for configuration options.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/kevburnsjr/microcache"
+	_ "github.com/kevburnsjr/microcache/compressor/snappy"
+	_ "github.com/kevburnsjr/microcache/driver/arc"
+	_ "github.com/kevburnsjr/microcache/driver/ristretto"
+)
+
+func main() {
+	path := flag.String("config", "microcached.yaml", "Path to config file")
+	flag.Parse()
+
+	cfg, err := loadConfig(*path)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	upstream, err := url.Parse(cfg.Upstream)
+	if err != nil {
+		log.Fatalf("Invalid upstream: %v", err)
+	}
+	cacheConfig, err := cfg.ConfigSpec.Config()
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if cfg.MonitorInterval > 0 {
+		cacheConfig.Monitor = microcache.MonitorFunc(cfg.MonitorInterval, logStats)
+	}
+
+	cache, err := microcache.New(cacheConfig)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	defer cache.Stop()
+
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+
+	handler := cache.Middleware(proxy)
+	if cfg.HealthPath != "" {
+		handler = withHealthCheck(handler, cfg.HealthPath, cache.HealthHandler())
+	}
+
+	log.Printf("microcached listening on %s proxying to %s", cfg.Listen, upstream)
+	log.Fatal(http.ListenAndServe(cfg.Listen, handler))
+}
+
+func logStats(stats microcache.Stats) {
+	total := stats.Hits + stats.Misses + stats.Stales
+	log.Printf("Size: %d, Bytes: %d, Total: %d, Hits: %d, Misses: %d, Stales: %d, Backend: %d, Errors: %d, Timeouts: %d\n",
+		stats.Size,
+		stats.Bytes,
+		total,
+		stats.Hits,
+		stats.Misses,
+		stats.Stales,
+		stats.Backend,
+		stats.Errors,
+		stats.Timeouts,
+	)
+}
+
+// withHealthCheck serves health checks at path and proxies all other requests
+func withHealthCheck(h http.Handler, path string, health http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == path {
+			health.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,132 @@
+package microcache
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Coalescer deduplicates concurrent backend requests for the same request hash
+// (collapsed forwarding). Custom implementations may widen or narrow the scope of
+// deduplication, ie. coalescing requests per user by deriving a key from r.
+type Coalescer interface {
+
+	// Coalesce blocks while another request for key is in flight, for up to ttl, and
+	// reports whether it waited. done must be called once the request completes, even
+	// if the request gave up waiting.
+	Coalesce(r *http.Request, key string, ttl time.Duration) (waited bool, done func())
+}
+
+// coalesce calls the Coalescer, tracking requests waiting on or holding a key for
+// Stats.Collapsing
+func (m *microcache) coalesce(r *http.Request, key string, ttl time.Duration) (bool, func()) {
+	atomic.AddInt64(&m.counters.collapsing, 1)
+	waited, done := m.coalescer.Coalesce(r, key, ttl)
+	return waited, func() {
+		done()
+		atomic.AddInt64(&m.counters.collapsing, -1)
+	}
+}
+
+// NewLocalCoalescer returns a Coalescer which serializes requests for the same key
+// within a single process. It is the default Coalescer.
+func NewLocalCoalescer() Coalescer {
+	return &localCoalescer{inflight: map[string]*inflightKey{}}
+}
+
+// localCoalescer serializes requests by key using a lock per in-flight key
+type localCoalescer struct {
+	mutex    sync.Mutex
+	inflight map[string]*inflightKey
+}
+
+// inflightKey is the lock of a key, shared by the request holding it and all requests
+// waiting on it. It is removed once the last of them is done.
+type inflightKey struct {
+	lock chan struct{}
+	refs int
+}
+
+// Coalesce waits for the lock on key until it is acquired, ttl elapses or the request
+// is canceled. Requests giving up on the lock proceed without it.
+func (c *localCoalescer) Coalesce(r *http.Request, key string, ttl time.Duration) (bool, func()) {
+	c.mutex.Lock()
+	k, waited := c.inflight[key]
+	if !waited {
+		k = &inflightKey{lock: make(chan struct{}, 1)}
+		c.inflight[key] = k
+	}
+	k.refs++
+	c.mutex.Unlock()
+	var timeout <-chan time.Time
+	if ttl > 0 {
+		timer := time.NewTimer(ttl)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var locked bool
+	select {
+	case k.lock <- struct{}{}:
+		locked = true
+	case <-timeout:
+	case <-r.Context().Done():
+	}
+	return waited, func() {
+		if locked {
+			<-k.lock
+		}
+		c.mutex.Lock()
+		if k.refs--; k.refs == 0 {
+			delete(c.inflight, key)
+		}
+		c.mutex.Unlock()
+	}
+}
+
+// NewDistributedCoalescer returns a Coalescer which deduplicates requests across all
+// instances sharing a DistributedLocker. Lock failures are ignored and the request
+// proceeds without the lock.
+func NewDistributedCoalescer(l DistributedLocker) Coalescer {
+	return distributedCoalescer{locker: l}
+}
+
+// distributedCoalescer polls a distributed lock until it is acquired, ttl elapses
+// or the request is canceled
+type distributedCoalescer struct {
+	locker  DistributedLocker
+	onError func(op string, err error)
+}
+
+func (c distributedCoalescer) Coalesce(r *http.Request, key string, ttl time.Duration) (waited bool, done func()) {
+	deadline := time.Now().Add(ttl)
+	for {
+		token, ok, err := c.locker.TryLock(key, ttl)
+		if err != nil {
+			c.error("TryLock", err)
+			return waited, func() {}
+		}
+		if ok {
+			return waited, func() {
+				if err := c.locker.Unlock(key, token); err != nil {
+					c.error("Unlock", err)
+				}
+			}
+		}
+		waited = true
+		if time.Now().After(deadline) {
+			return waited, func() {}
+		}
+		select {
+		case <-time.After(lockPollInterval):
+		case <-r.Context().Done():
+			return waited, func() {}
+		}
+	}
+}
+
+func (c distributedCoalescer) error(op string, err error) {
+	if c.onError != nil {
+		c.onError(op, err)
+	}
+}
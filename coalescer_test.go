@@ -0,0 +1,141 @@
+package microcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// userCoalescer coalesces requests per user rather than per request hash
+type userCoalescer struct {
+	Coalescer
+	calls int32
+}
+
+func (c *userCoalescer) Coalesce(r *http.Request, key string, ttl time.Duration) (bool, func()) {
+	atomic.AddInt32(&c.calls, 1)
+	return c.Coalescer.Coalesce(r, r.Header.Get("X-User"), ttl)
+}
+
+// A custom Coalescer replaces the built-in collapsed forwarding
+func TestCoalescer(t *testing.T) {
+	coalescer := &userCoalescer{Coalescer: NewLocalCoalescer()}
+	cache := MustNew(Config{
+		TTL:                 30 * time.Second,
+		CollapsedForwarding: true,
+		Coalescer:           coalescer,
+		Driver:              newLockingDriver(),
+	})
+	defer cache.Stop()
+	var concurrent, max int32
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&concurrent, 1)
+		if n > atomic.LoadInt32(&max) {
+			atomic.StoreInt32(&max, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&concurrent, -1)
+		noopSuccessHandler(w, r)
+	}))
+	var wg sync.WaitGroup
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		wg.Add(1)
+		go func(path string) {
+			r, _ := http.NewRequest("GET", path, nil)
+			r.Header.Set("X-User", "1")
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			wg.Done()
+		}(path)
+	}
+	wg.Wait()
+	if atomic.LoadInt32(&coalescer.calls) != 4 || atomic.LoadInt32(&max) != 1 {
+		t.Fatalf("Requests should be coalesced per user, got %d calls and %d concurrent",
+			coalescer.calls, max)
+	}
+}
+
+// NewDistributedCoalescer deduplicates backend requests across instances
+func TestDistributedCoalescer(t *testing.T) {
+	var backends int32
+	driver := newLockingDriver()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backends, 1)
+		time.Sleep(50 * time.Millisecond)
+		noopSuccessHandler(w, r)
+	})
+	var handlers []http.Handler
+	for i := 0; i < 2; i++ {
+		cache := MustNew(Config{
+			TTL:                 30 * time.Second,
+			CollapsedForwarding: true,
+			Coalescer:           NewDistributedCoalescer(driver),
+			Driver:              NewDriverLRU(10),
+		})
+		defer cache.Stop()
+		handlers = append(handlers, cache.Middleware(handler))
+	}
+	getResponse(handlers[0], "/")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(h http.Handler) {
+			getResponse(h, "/")
+			wg.Done()
+		}(handlers[i%2])
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&backends); n != 2 {
+		t.Fatalf("Requests not collapsed across instances %d != 2", n)
+	}
+	if n := driver.held(); n != 0 {
+		t.Fatalf("Locks should be released with their tokens, %d held", n)
+	}
+}
+
+// The local coalescer keeps a key locked until every request sharing it is done and
+// stops waiting after ttl
+func TestLocalCoalescer(t *testing.T) {
+	c := NewLocalCoalescer()
+	r := httptest.NewRequest("GET", "/", nil)
+	waited, doneA := c.Coalesce(r, "key", time.Second)
+	if waited {
+		t.Fatal("First request should not wait")
+	}
+	acquired := make(chan func())
+	go func() {
+		_, done := c.Coalesce(r, "key", time.Second)
+		acquired <- done
+	}()
+	time.Sleep(10 * time.Millisecond)
+	doneA()
+	doneB := <-acquired
+
+	// A third request arriving after the first is done still waits for the second
+	go func() {
+		_, done := c.Coalesce(r, "key", time.Second)
+		acquired <- done
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Request should wait while the key is held")
+	case <-time.After(20 * time.Millisecond):
+	}
+	doneB()
+	(<-acquired)()
+
+	// Waiting is bounded by ttl
+	_, doneD := c.Coalesce(r, "key", time.Second)
+	start := time.Now()
+	waited, doneE := c.Coalesce(r, "key", 10*time.Millisecond)
+	if !waited || time.Since(start) > 500*time.Millisecond {
+		t.Fatal("Request should stop waiting after ttl")
+	}
+	doneE()
+	doneD()
+	if n := len(c.(*localCoalescer).inflight); n != 0 {
+		t.Fatalf("Keys should be removed once done, %d remain", n)
+	}
+}
@@ -0,0 +1,42 @@
+package microcache
+
+import (
+	"net/http"
+)
+
+// writeCanonicalKey writes the unhashed key of a response object. The canonical key
+// is stored with each response object and verified on read so that a hash collision
+// can never serve the wrong resource.
+func (m *microcache) writeCanonicalKey(h *hashBuffer, r *http.Request, req RequestOpts) {
+	m.writeRequestKey(h, r)
+	if key, ok := getPostKeyFromContext(r); ok {
+		h.write("&post:", key)
+	}
+	if r.Method == "OPTIONS" {
+		writePreflightKey(h, r)
+	}
+	req.writeObjectKey(m, h, r)
+}
+
+// canonicalKey returns the canonical key of a response object
+func (m *microcache) canonicalKey(r *http.Request, req RequestOpts) string {
+	h := getHashBuffer()
+	m.writeCanonicalKey(h, r, req)
+	key := string(h.b)
+	h.release()
+	return key
+}
+
+// verifyKey reports whether a cached response object was stored for this request,
+// reporting a collision if it was not
+func (m *microcache) verifyKey(r *http.Request, req RequestOpts, obj Response) bool {
+	h := getHashBuffer()
+	m.writeCanonicalKey(h, r, req)
+	ok := string(h.b) == obj.key
+	h.release()
+	if !ok {
+		m.event(EventCollision, Labels{"path": r.URL.Path})
+		m.logWarn("microcache hash collision", "path", r.URL.Path)
+	}
+	return ok
+}
@@ -4,9 +4,10 @@ package microcache
 type Compressor interface {
 
 	// Compress compresses a response prior to being saved in the cache and returns a clone
-	// usually by compressing the response body
-	Compress(Response) Response
+	// usually by compressing the response body. The returned body must not share memory
+	// with the original, which may be reused once Compress returns.
+	Compress(Response) (Response, error)
 
 	// Expand decompresses a response's body (destructively)
-	Expand(Response) Response
+	Expand(Response) (Response, error)
 }
@@ -0,0 +1,61 @@
+// Package microcachesnappy provides a Snappy compressor for microcache.
+package microcachesnappy
+
+import (
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/kevburnsjr/microcache"
+)
+
+func init() {
+	microcache.RegisterCompressor("snappy", func() microcache.Compressor {
+		return Compressor{}
+	})
+}
+
+// Compressor is a Snappy compressor
+// 14x faster compress than gzip
+// 8x faster expand than gzip
+// ~ 1.5 - 2x larger result (see README)
+//
+//	cache := microcache.MustNew(microcache.Config{
+//		Compressor: microcachesnappy.Compressor{},
+//	})
+type Compressor struct {
+}
+
+var _ microcache.Compressor = Compressor{}
+
+// maxPooledBufferSize is the capacity above which scratch buffers are not pooled
+const maxPooledBufferSize = 1 << 20
+
+var scratchPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 4<<10)
+		return &b
+	},
+}
+
+func (c Compressor) Compress(res microcache.Response) (microcache.Response, error) {
+	body := res.Body()
+	// Encode into pooled scratch space since MaxEncodedLen usually far exceeds the result
+	dst := scratchPool.Get().(*[]byte)
+	if n := snappy.MaxEncodedLen(len(body)); cap(*dst) < n {
+		*dst = make([]byte, n)
+	}
+	encoded := snappy.Encode((*dst)[:cap(*dst)], body)
+	newres := res.WithBody(append([]byte(nil), encoded...))
+	if cap(*dst) <= maxPooledBufferSize {
+		scratchPool.Put(dst)
+	}
+	return newres, nil
+}
+
+func (c Compressor) Expand(res microcache.Response) (microcache.Response, error) {
+	body, err := snappy.Decode(nil, res.Body())
+	if err != nil {
+		return res, err
+	}
+	return res.WithBody(body), nil
+}
@@ -0,0 +1,65 @@
+package microcachesnappy
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kevburnsjr/microcache"
+	"github.com/kevburnsjr/microcache/microcachetest"
+)
+
+var body = bytes.Repeat([]byte(`{"id": 1234, "name": "microcache", "tags": ["a", "b", "c"]}`), 100)
+
+// Compressed responses should expand to the original body
+func TestCompressor(t *testing.T) {
+	var res microcache.Response
+	res = res.WithBody(body)
+	c := Compressor{}
+	crRes, err := c.Compress(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) <= len(crRes.Body()) {
+		t.Fatal("No Compression in Snappy")
+	}
+	exRes, err := c.Expand(crRes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, exRes.Body()) {
+		t.Fatal("Expanded compression does not match in Snappy")
+	}
+	if _, err := c.Expand(res); err == nil {
+		t.Fatal("Snappy should fail to expand uncompressed body")
+	}
+}
+
+// Cached responses should be compressed and expanded by the middleware
+func TestMiddleware(t *testing.T) {
+	cache := microcache.MustNew(microcache.Config{
+		TTL:        30 * time.Second,
+		Compressor: Compressor{},
+		Exposed:    true,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	microcachetest.ExpectMiss(t, handler, "/")
+	if w := microcachetest.ExpectHit(t, handler, "/"); !bytes.Equal(w.Body.Bytes(), body) {
+		t.Fatal("Cached response body does not match")
+	}
+}
+
+// Importing the package registers the compressor for ConfigSpec
+func TestRegister(t *testing.T) {
+	o, err := microcache.ConfigSpec{Compressor: "snappy"}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := o.Compressor.(Compressor); !ok {
+		t.Fatalf("Expected snappy compressor, got %T", o.Compressor)
+	}
+}
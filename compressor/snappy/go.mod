@@ -0,0 +1,8 @@
+module github.com/kevburnsjr/microcache/compressor/snappy
+
+go 1.13
+
+require (
+	github.com/golang/snappy v0.0.1
+	github.com/kevburnsjr/microcache v1.1.0
+)
@@ -3,27 +3,56 @@ package microcache
 import (
 	"bytes"
 	"compress/gzip"
-	"io/ioutil"
+	"io"
+	"sync"
 )
 
 // CompressorGzip is a gzip compressor
 type CompressorGzip struct {
 }
 
-func (c CompressorGzip) Compress(res Response) Response {
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+var gzipReaderPool sync.Pool
+
+func (c CompressorGzip) Compress(res Response) (Response, error) {
 	newres := res.clone()
-	var buf bytes.Buffer
-	zw := gzip.NewWriter(&buf)
-	zw.Write(res.body)
-	zw.Close()
-	newres.body = buf.Bytes()
-	return newres
+	buf := getBuffer()
+	defer putBuffer(buf)
+	zw := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(zw)
+	zw.Reset(buf)
+	if _, err := zw.Write(res.body); err != nil {
+		return newres, err
+	}
+	if err := zw.Close(); err != nil {
+		return newres, err
+	}
+	newres.body = cloneBytes(buf.Bytes())
+	return newres, nil
 }
 
-func (c CompressorGzip) Expand(res Response) Response {
-	buf := bytes.NewBuffer(res.body)
-	zr, _ := gzip.NewReader(buf)
-	res.body, _ = ioutil.ReadAll(zr)
-	zr.Close()
-	return res
+func (c CompressorGzip) Expand(res Response) (Response, error) {
+	var zr *gzip.Reader
+	var err error
+	if pooled, ok := gzipReaderPool.Get().(*gzip.Reader); ok {
+		zr, err = pooled, pooled.Reset(bytes.NewReader(res.body))
+	} else {
+		zr, err = gzip.NewReader(bytes.NewReader(res.body))
+	}
+	if err != nil {
+		return res, err
+	}
+	defer gzipReaderPool.Put(zr)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err = io.Copy(buf, zr); err != nil {
+		return res, err
+	}
+	res.body = cloneBytes(buf.Bytes())
+	return res, zr.Close()
 }
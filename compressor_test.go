@@ -11,26 +11,26 @@ var zipTest = []byte(`{"firstName":"John","lastName":"Smith","isAlive":true,"age
 func TestCompressorGzip(t *testing.T) {
 	res := Response{body: zipTest}
 	c := CompressorGzip{}
-	crRes := c.Compress(res)
+	crRes, err := c.Compress(res)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if len(res.body) <= len(crRes.body) {
 		t.Fatal("No Compression in Gzip")
 	}
-	exRes := c.Expand(crRes)
+	exRes, err := c.Expand(crRes)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if !bytes.Equal(res.body, exRes.body) {
 		t.Fatal("Expanded compression does not match in Gzip")
 	}
 }
 
-// CompressorSnappy
-func TestCompressorSnappy(t *testing.T) {
+// Corrupt bodies should produce expansion errors
+func TestCompressorCorrupt(t *testing.T) {
 	res := Response{body: zipTest}
-	c := CompressorSnappy{}
-	crRes := c.Compress(res)
-	if len(res.body) <= len(crRes.body) {
-		t.Fatal("No Compression in Snappy")
-	}
-	exRes := c.Expand(crRes)
-	if !bytes.Equal(res.body, exRes.body) {
-		t.Fatal("Expanded compression does not match in Snappy")
+	if _, err := (CompressorGzip{}).Expand(res); err == nil {
+		t.Fatal("Gzip should fail to expand uncompressed body")
 	}
 }
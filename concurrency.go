@@ -0,0 +1,44 @@
+package microcache
+
+import (
+	"net/http"
+	"time"
+)
+
+// acquireBackend reserves a backend request slot when MaxBackendConcurrency is set.
+// Foreground requests wait up to MaxBackendWait for a slot to become available.
+// Background requests never wait. Returns false if no slot could be acquired.
+func (m *microcache) acquireBackend(r *http.Request, background bool) bool {
+	if m.backendSlots == nil {
+		return true
+	}
+	select {
+	case m.backendSlots <- struct{}{}:
+		return true
+	default:
+	}
+	if background {
+		return false
+	}
+	var timeout <-chan time.Time
+	if m.MaxBackendWait > 0 {
+		timer := time.NewTimer(m.MaxBackendWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case m.backendSlots <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// releaseBackend releases a backend request slot
+func (m *microcache) releaseBackend() {
+	if m.backendSlots != nil {
+		<-m.backendSlots
+	}
+}
@@ -0,0 +1,64 @@
+package microcache
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// revalidationHeaders are the request headers describing a cached object under
+// revalidation when Config.RevalidationHeaders is enabled
+var revalidationHeaders = []string{
+	"Microcache-Revalidating",
+	"Microcache-Age",
+	"Microcache-Etag",
+}
+
+// conditionalRequest returns a copy of r carrying validators derived from a cached
+// response so that the backend may respond 304 Not Modified if the object is unchanged.
+// Requests which already carry validators are returned unmodified since a 304 is then
+// intended for the client.
+//
+// With RevalidationHeaders, the request also carries the cached object's age and ETag
+// so that handlers may respond 304 Not Modified whether or not the object has validators.
+func (m *microcache) conditionalRequest(r *http.Request, obj Response) (*http.Request, bool) {
+	if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		return r, false
+	}
+	etag := obj.header.Get("Etag")
+	lastModified := obj.header.Get("Last-Modified")
+	if etag == "" && lastModified == "" && !m.RevalidationHeaders {
+		return r, false
+	}
+	cr := r.Clone(r.Context())
+	if etag != "" {
+		cr.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		cr.Header.Set("If-Modified-Since", lastModified)
+	}
+	if m.RevalidationHeaders {
+		age := obj.age + m.now().Sub(obj.date)
+		cr.Header.Set("Microcache-Revalidating", "1")
+		cr.Header.Set("Microcache-Age", strconv.FormatInt(int64(age/time.Second), 10))
+		if etag != "" {
+			cr.Header.Set("Microcache-Etag", etag)
+		}
+	}
+	return cr, true
+}
+
+// stripRevalidationHeaders returns a copy of r without revalidation headers sent by
+// the client so that handlers cannot be induced to respond 304 to a cache miss
+func stripRevalidationHeaders(r *http.Request) *http.Request {
+	for _, header := range revalidationHeaders {
+		if _, ok := r.Header[header]; ok {
+			r = r.Clone(r.Context())
+			for _, header := range revalidationHeaders {
+				r.Header.Del(header)
+			}
+			break
+		}
+	}
+	return r
+}
@@ -0,0 +1,390 @@
+package microcache
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigSpec is the serializable form of Config.
+// Keys are snake case versions of Config field names. Durations are strings parsed by
+// time.ParseDuration. The core module has no YAML dependency so files are decoded
+// into a ConfigSpec by the config/yaml submodule or by the application. Decoders
+// should reject unknown keys so that misspelled options are not silently ignored.
+//
+//	ttl: 30s
+//	stale_while_revalidate: 30s
+//	collapsed_forwarding: true
+//	query_ignore: [utm_source, utm_medium]
+//	driver: lru
+//	driver_size: 10000
+//	compressor: gzip
+type ConfigSpec struct {
+	Nocache               bool          `yaml:"nocache"`
+	Timeout               time.Duration `yaml:"timeout"`
+	TTL                   time.Duration `yaml:"ttl"`
+	MinTTL                time.Duration `yaml:"min_ttl"`
+	MaxTTL                time.Duration `yaml:"max_ttl"`
+	AdaptiveTTL           bool          `yaml:"adaptive_ttl"`
+	StaleIfError          time.Duration `yaml:"stale_if_error"`
+	StaleIfErrorStatus    []int         `yaml:"stale_if_error_status"`
+	StaleRecache          bool          `yaml:"stale_recache"`
+	StaleWhileRevalidate  time.Duration `yaml:"stale_while_revalidate"`
+	RefreshAhead          time.Duration `yaml:"refresh_ahead"`
+	VerifySampleRate      float64       `yaml:"verify_sample_rate"`
+	RevalidateTimeout     time.Duration `yaml:"revalidate_timeout"`
+	RevalidateWorkers     int           `yaml:"revalidate_workers"`
+	RevalidateQueueSize   int           `yaml:"revalidate_queue_size"`
+	MaxRequestBodyBuffer  int64         `yaml:"max_request_body_buffer"`
+	MinHitsToCache        int           `yaml:"min_hits_to_cache"`
+	MinHitsWindow         time.Duration `yaml:"min_hits_window"`
+	CollapsedForwarding   bool          `yaml:"collapsed_forwarding"`
+	MaxBackendConcurrency int           `yaml:"max_backend_concurrency"`
+	MaxBackendWait        time.Duration `yaml:"max_backend_wait"`
+	StreamMisses          bool          `yaml:"stream_misses"`
+	HedgeAfter            time.Duration `yaml:"hedge_after"`
+	ForegroundOnly        bool          `yaml:"foreground_only"`
+	RevalidationHeaders   bool          `yaml:"revalidation_headers"`
+	HashQuery             bool          `yaml:"hash_query"`
+	QueryIgnore           []string      `yaml:"query_ignore"`
+	QueryInclude          []string      `yaml:"query_include"`
+	NormalizeQuery        bool          `yaml:"normalize_query"`
+	HashScheme            bool          `yaml:"hash_scheme"`
+	Vary                  []string      `yaml:"vary"`
+	ImmutablePaths        []string      `yaml:"immutable_paths"`
+	KeyPrefix             string        `yaml:"key_prefix"`
+	DriverTimeout         time.Duration `yaml:"driver_timeout"`
+	RequestOptsCacheSize  int           `yaml:"request_opts_cache_size"`
+	RequestOptsCacheTTL   time.Duration `yaml:"request_opts_cache_ttl"`
+	Exposed               bool          `yaml:"exposed"`
+	ExposedHeaderName     string        `yaml:"exposed_header_name"`
+	ExposedFormat         string        `yaml:"exposed_format"`
+	SuppressAgeHeader     bool          `yaml:"suppress_age_header"`
+	StaleWarning          bool          `yaml:"stale_warning"`
+	SetClientCacheControl bool          `yaml:"set_client_cache_control"`
+	LegacyExpires         bool          `yaml:"legacy_expires"`
+	SurrogateControl      bool          `yaml:"surrogate_control"`
+	SetSurrogateControl   bool          `yaml:"set_surrogate_control"`
+	DebugHeader           string        `yaml:"debug_header"`
+	BypassHeader          string        `yaml:"bypass_header"`
+	BypassQueryParam      string        `yaml:"bypass_query_param"`
+	BypassToken           string        `yaml:"bypass_token"`
+	BypassRefresh         bool          `yaml:"bypass_refresh"`
+	Refresh               bool          `yaml:"refresh"`
+	RefreshToken          string        `yaml:"refresh_token"`
+	RefreshOnNoCache      bool          `yaml:"refresh_on_no_cache"`
+	TopKeys               int           `yaml:"top_keys"`
+	RecoverPanics         bool          `yaml:"recover_panics"`
+	PurgeOnWrite          bool          `yaml:"purge_on_write"`
+	PurgeIndexSize        int           `yaml:"purge_index_size"`
+	ExpiryIndex           bool          `yaml:"expiry_index"`
+	JanitorInterval       time.Duration `yaml:"janitor_interval"`
+	CacheOptions          bool          `yaml:"cache_options"`
+	OptionsTTL            time.Duration `yaml:"options_ttl"`
+	RolloutPercent        int           `yaml:"rollout_percent"`
+	BackendRetries        int           `yaml:"backend_retries"`
+	BackendRetryBackoff   time.Duration `yaml:"backend_retry_backoff"`
+	DigestMinSize         int           `yaml:"digest_min_size"`
+	DigestETag            bool          `yaml:"digest_etag"`
+	WarmKeys              int           `yaml:"warm_keys"`
+	WarmInterval          time.Duration `yaml:"warm_interval"`
+	WarmRate              int           `yaml:"warm_rate"`
+	MaxVariantsPerKey     int           `yaml:"max_variants_per_key"`
+
+	CacheableContentTypes   []string `yaml:"cacheable_content_types"`
+	UncacheableContentTypes []string `yaml:"uncacheable_content_types"`
+	CookieWhitelist         []string `yaml:"cookie_whitelist"`
+	StripSetCookie          bool     `yaml:"strip_set_cookie"`
+	PerRequestHeaders       []string `yaml:"per_request_headers"`
+
+	// Driver is one of lru, lfu, slab, map or a driver registered by an imported
+	// submodule (ie. arc or ristretto)
+	Driver string `yaml:"driver"`
+
+	// DriverSize is the number of items in the cache
+	// or the number of expected items for ristretto
+	// or the maximum number of items for map
+	DriverSize int `yaml:"driver_size"`
+
+	// DriverRequestSize is the number of request options in the cache (lru, lfu and arc)
+	// Default: DriverSize
+	DriverRequestSize int `yaml:"driver_request_size"`
+
+	// DriverBytes is the maximum size of the cache in bytes (ristretto and slab only)
+	DriverBytes int64 `yaml:"driver_bytes"`
+
+	// DriverTTL bounds the lifetime of cache entries (ristretto only)
+	// Default: 0 (no limit)
+	DriverTTL time.Duration `yaml:"driver_ttl"`
+
+	// Compressor is gzip, a compressor registered by an imported submodule (ie. snappy)
+	// or empty for none
+	Compressor string `yaml:"compressor"`
+
+	// EncryptionKey is a base64 encoded 16, 24 or 32 byte AES-GCM key
+	// Responses are stored unencrypted if empty
+	EncryptionKey string `yaml:"encryption_key"`
+
+	// FailureMode is one of open or closed
+	// Default: open
+	FailureMode string `yaml:"failure_mode"`
+
+	// StaleIfErrorPolicy lists the failures served stale, any of 5xx, 4xx or timeout
+	// Default: [5xx, timeout]
+	StaleIfErrorPolicy []string `yaml:"stale_if_error_policy"`
+
+	// Hasher is one of sha1, xxhash or fnv
+	// Default: sha1
+	Hasher string `yaml:"hasher"`
+}
+
+// ConfigFromEnv parses a Config from environment variables.
+// Variable names are upper case versions of ConfigSpec keys prefixed by MICROCACHE_.
+// Lists are comma separated.
+//
+//	MICROCACHE_TTL=30s
+//	MICROCACHE_QUERY_IGNORE=utm_source,utm_medium
+//	MICROCACHE_DRIVER=lru
+//	MICROCACHE_DRIVER_SIZE=10000
+func ConfigFromEnv() (Config, error) {
+	var spec ConfigSpec
+	v := reflect.ValueOf(&spec).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := "MICROCACHE_" + strings.ToUpper(t.Field(i).Tag.Get("yaml"))
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), val); err != nil {
+			return Config{}, fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	return spec.Config()
+}
+
+// setField parses a string into a ConfigSpec field
+func setField(f reflect.Value, val string) error {
+	if f.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.String:
+		f.SetString(val)
+	case reflect.Slice:
+		list := reflect.MakeSlice(f.Type(), 0, 0)
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			switch f.Type().Elem().Kind() {
+			case reflect.String:
+				list = reflect.Append(list, reflect.ValueOf(item))
+			case reflect.Int:
+				n, err := strconv.Atoi(item)
+				if err != nil {
+					return err
+				}
+				list = reflect.Append(list, reflect.ValueOf(n))
+			default:
+				return fmt.Errorf("unsupported field type %s", f.Type())
+			}
+		}
+		f.Set(list)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
+
+// Config converts a ConfigSpec to a Config, constructing the driver and compressor
+func (spec ConfigSpec) Config() (Config, error) {
+	o := Config{
+		Nocache:               spec.Nocache,
+		Timeout:               spec.Timeout,
+		TTL:                   spec.TTL,
+		MinTTL:                spec.MinTTL,
+		MaxTTL:                spec.MaxTTL,
+		AdaptiveTTL:           spec.AdaptiveTTL,
+		StaleIfError:          spec.StaleIfError,
+		StaleIfErrorStatus:    spec.StaleIfErrorStatus,
+		StaleRecache:          spec.StaleRecache,
+		StaleWhileRevalidate:  spec.StaleWhileRevalidate,
+		RefreshAhead:          spec.RefreshAhead,
+		VerifySampleRate:      spec.VerifySampleRate,
+		RevalidateTimeout:     spec.RevalidateTimeout,
+		RevalidateWorkers:     spec.RevalidateWorkers,
+		RevalidateQueueSize:   spec.RevalidateQueueSize,
+		MaxRequestBodyBuffer:  spec.MaxRequestBodyBuffer,
+		MinHitsToCache:        spec.MinHitsToCache,
+		MinHitsWindow:         spec.MinHitsWindow,
+		CollapsedForwarding:   spec.CollapsedForwarding,
+		MaxBackendConcurrency: spec.MaxBackendConcurrency,
+		MaxBackendWait:        spec.MaxBackendWait,
+		StreamMisses:          spec.StreamMisses,
+		HedgeAfter:            spec.HedgeAfter,
+		ForegroundOnly:        spec.ForegroundOnly,
+		RevalidationHeaders:   spec.RevalidationHeaders,
+		HashQuery:             spec.HashQuery,
+		QueryIgnore:           spec.QueryIgnore,
+		QueryInclude:          spec.QueryInclude,
+		NormalizeQuery:        spec.NormalizeQuery,
+		HashScheme:            spec.HashScheme,
+		Vary:                  spec.Vary,
+		ImmutablePaths:        spec.ImmutablePaths,
+		KeyPrefix:             spec.KeyPrefix,
+		DriverTimeout:         spec.DriverTimeout,
+		RequestOptsCacheSize:  spec.RequestOptsCacheSize,
+		RequestOptsCacheTTL:   spec.RequestOptsCacheTTL,
+		Exposed:               spec.Exposed,
+		ExposedHeaderName:     spec.ExposedHeaderName,
+		ExposedFormat:         spec.ExposedFormat,
+		SuppressAgeHeader:     spec.SuppressAgeHeader,
+		StaleWarning:          spec.StaleWarning,
+		SetClientCacheControl: spec.SetClientCacheControl,
+		LegacyExpires:         spec.LegacyExpires,
+		SurrogateControl:      spec.SurrogateControl,
+		SetSurrogateControl:   spec.SetSurrogateControl,
+		DebugHeader:           spec.DebugHeader,
+		BypassHeader:          spec.BypassHeader,
+		BypassQueryParam:      spec.BypassQueryParam,
+		BypassToken:           spec.BypassToken,
+		BypassRefresh:         spec.BypassRefresh,
+		Refresh:               spec.Refresh,
+		RefreshToken:          spec.RefreshToken,
+		RefreshOnNoCache:      spec.RefreshOnNoCache,
+		TopKeys:               spec.TopKeys,
+		RecoverPanics:         spec.RecoverPanics,
+		PurgeOnWrite:          spec.PurgeOnWrite,
+		PurgeIndexSize:        spec.PurgeIndexSize,
+		ExpiryIndex:           spec.ExpiryIndex,
+		JanitorInterval:       spec.JanitorInterval,
+		CacheOptions:          spec.CacheOptions,
+		OptionsTTL:            spec.OptionsTTL,
+		RolloutPercent:        spec.RolloutPercent,
+		BackendRetries:        spec.BackendRetries,
+		BackendRetryBackoff:   spec.BackendRetryBackoff,
+		DigestMinSize:         spec.DigestMinSize,
+		DigestETag:            spec.DigestETag,
+		WarmKeys:              spec.WarmKeys,
+		WarmInterval:          spec.WarmInterval,
+		WarmRate:              spec.WarmRate,
+		MaxVariantsPerKey:     spec.MaxVariantsPerKey,
+
+		CacheableContentTypes:   spec.CacheableContentTypes,
+		UncacheableContentTypes: spec.UncacheableContentTypes,
+		CookieWhitelist:         spec.CookieWhitelist,
+		StripSetCookie:          spec.StripSetCookie,
+		PerRequestHeaders:       spec.PerRequestHeaders,
+	}
+	size := spec.DriverSize
+	if size == 0 {
+		size = 1e4
+	}
+	reqSize := spec.DriverRequestSize
+	if reqSize == 0 {
+		reqSize = size
+	}
+	switch spec.Driver {
+	case "":
+		// Driver options would otherwise be silently replaced by the default driver
+		if spec.DriverSize != 0 || spec.DriverRequestSize != 0 || spec.DriverBytes != 0 || spec.DriverTTL != 0 {
+			return o, fmt.Errorf("driver_size, driver_request_size, driver_bytes and driver_ttl require driver")
+		}
+	case "lru":
+		o.Driver = NewDriverLRU2(reqSize, size)
+	case "lfu":
+		o.Driver = NewDriverLFU2(reqSize, size)
+	case "slab":
+		o.Driver = NewDriverSlab(int(spec.DriverBytes))
+	case "map":
+		o.Driver = NewDriverMap(size)
+	default:
+		f, ok := registeredDriver(spec.Driver)
+		if !ok {
+			return o, fmt.Errorf("unknown driver %q (drivers in submodules must be imported)", spec.Driver)
+		}
+		o.Driver = f(DriverSpec{
+			Size:        size,
+			RequestSize: reqSize,
+			Bytes:       spec.DriverBytes,
+			TTL:         spec.DriverTTL,
+		})
+	}
+	switch spec.Compressor {
+	case "":
+	case "gzip":
+		o.Compressor = CompressorGzip{}
+	default:
+		f, ok := registeredCompressor(spec.Compressor)
+		if !ok {
+			return o, fmt.Errorf("unknown compressor %q (compressors in submodules must be imported)", spec.Compressor)
+		}
+		o.Compressor = f()
+	}
+	if spec.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(spec.EncryptionKey)
+		if err != nil {
+			return o, fmt.Errorf("invalid encryption key: %v", err)
+		}
+		if o.Encryptor, err = NewEncryptorAESGCM(key); err != nil {
+			return o, fmt.Errorf("invalid encryption key: %v", err)
+		}
+	}
+	switch spec.FailureMode {
+	case "", "open":
+	case "closed":
+		o.FailureMode = FailClosed
+	default:
+		return o, fmt.Errorf("unknown failure mode %q", spec.FailureMode)
+	}
+	for _, p := range spec.StaleIfErrorPolicy {
+		switch p {
+		case "5xx":
+			o.StaleIfErrorPolicy |= StaleOn5xx
+		case "4xx":
+			o.StaleIfErrorPolicy |= StaleOn4xx
+		case "timeout":
+			o.StaleIfErrorPolicy |= StaleOnTimeout
+		default:
+			return o, fmt.Errorf("unknown stale if error policy %q", p)
+		}
+	}
+	switch spec.Hasher {
+	case "", "sha1":
+	case "xxhash":
+		o.Hasher = HasherXXHash{}
+	case "fnv":
+		o.Hasher = HasherFNV{}
+	default:
+		return o, fmt.Errorf("unknown hasher %q", spec.Hasher)
+	}
+	return o, nil
+}
@@ -0,0 +1,32 @@
+// Package microcacheyaml parses microcache configuration files so that the core module
+// does not depend on a YAML library.
+//
+//	config, err := microcacheyaml.ConfigFromFile("microcache.yaml")
+package microcacheyaml
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kevburnsjr/microcache"
+)
+
+// ConfigFromFile parses a Config from a YAML or JSON file.
+// See microcache.ConfigSpec for the available keys. Unknown keys return an error.
+func ConfigFromFile(path string) (microcache.Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return microcache.Config{}, err
+	}
+	var spec microcache.ConfigSpec
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	// An empty file is an empty config
+	if err = dec.Decode(&spec); err != nil && err != io.EOF {
+		return microcache.Config{}, err
+	}
+	return spec.Config()
+}
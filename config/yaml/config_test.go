@@ -0,0 +1,62 @@
+package microcacheyaml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kevburnsjr/microcache"
+)
+
+// ConfigFromFile parses YAML and JSON
+func TestConfigFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"config.yaml": "ttl: 30s\nquery_ignore: [a, b]\ndriver: lfu\ndriver_size: 10\nfailure_mode: closed\n",
+		"config.json": `{"ttl": "30s", "query_ignore": ["a", "b"], "driver": "lfu", "driver_size": 10, "failure_mode": "closed"}`,
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, []byte(body), 0644)
+		o, err := ConfigFromFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if o.TTL != 30*time.Second || !reflect.DeepEqual(o.QueryIgnore, []string{"a", "b"}) {
+			t.Fatalf("%s: config not parsed correctly %#v", name, o)
+		}
+		if _, ok := o.Driver.(microcache.DriverLFU); !ok {
+			t.Fatalf("%s: driver not parsed correctly", name)
+		}
+		if o.FailureMode != microcache.FailClosed {
+			t.Fatalf("%s: failure mode not parsed correctly", name)
+		}
+	}
+	for body, msg := range map[string]string{
+		"driver: memcached":         "Unknown driver",
+		"tll: 30s":                  "Unknown key",
+		"driver_size: 10":           "Driver size without driver",
+		"ttl: 30s\ndriver_size: 10": "Driver size without driver",
+	} {
+		path := filepath.Join(dir, "invalid.yaml")
+		ioutil.WriteFile(path, []byte(body), 0644)
+		if _, err := ConfigFromFile(path); err == nil {
+			t.Fatal(msg + " should return error")
+		}
+	}
+	path := filepath.Join(dir, "empty.yaml")
+	ioutil.WriteFile(path, nil, 0644)
+	if _, err := ConfigFromFile(path); err != nil {
+		t.Fatalf("Empty file should be valid: %v", err)
+	}
+	if _, err := ConfigFromFile(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Fatal("Missing file should return error")
+	}
+}
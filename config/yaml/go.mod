@@ -0,0 +1,8 @@
+module github.com/kevburnsjr/microcache/config/yaml
+
+go 1.13
+
+require (
+	github.com/kevburnsjr/microcache v1.1.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,158 @@
+package microcache
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// ConfigSpec builds a Config
+func TestConfigSpec(t *testing.T) {
+	o, err := ConfigSpec{
+		TTL:                30 * time.Second,
+		HashQuery:          true,
+		QueryIgnore:        []string{"a", "b"},
+		Driver:             "lfu",
+		DriverSize:         10,
+		Compressor:         "gzip",
+		Hasher:             "xxhash",
+		FailureMode:        "closed",
+		StaleIfErrorPolicy: []string{"4xx", "timeout"},
+		EncryptionKey:      "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=",
+	}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.TTL != 30*time.Second || !o.HashQuery || !reflect.DeepEqual(o.QueryIgnore, []string{"a", "b"}) {
+		t.Fatalf("config not built correctly %#v", o)
+	}
+	if _, ok := o.Driver.(DriverLFU); !ok {
+		t.Fatal("driver not built correctly")
+	}
+	if _, ok := o.Compressor.(CompressorGzip); !ok {
+		t.Fatal("compressor not built correctly")
+	}
+	if _, ok := o.Hasher.(HasherXXHash); !ok {
+		t.Fatal("hasher not built correctly")
+	}
+	if o.FailureMode != FailClosed {
+		t.Fatal("failure mode not built correctly")
+	}
+	if o.StaleIfErrorPolicy != StaleOn4xx|StaleOnTimeout {
+		t.Fatal("stale if error policy not built correctly")
+	}
+	if _, ok := o.Encryptor.(EncryptorAESGCM); !ok {
+		t.Fatal("encryptor not built correctly")
+	}
+	if _, err := (ConfigSpec{Driver: "memcached"}).Config(); err == nil {
+		t.Fatal("Unknown driver should return error")
+	}
+	if _, err := (ConfigSpec{DriverSize: 10}).Config(); err == nil {
+		t.Fatal("Driver size without driver should return error")
+	}
+	if _, err := (ConfigSpec{StaleIfErrorPolicy: []string{"3xx"}}).Config(); err == nil {
+		t.Fatal("Unknown stale if error policy should return error")
+	}
+	if _, err := (ConfigSpec{EncryptionKey: "c2hvcnQ="}).Config(); err == nil {
+		t.Fatal("Invalid encryption key should return error")
+	}
+}
+
+// ConfigFromEnv parses environment variables
+func TestConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		"MICROCACHE_TTL":                     "500ms",
+		"MICROCACHE_COLLAPSED_FORWARDING":    "true",
+		"MICROCACHE_MAX_BACKEND_CONCURRENCY": "4",
+		"MICROCACHE_VARY":                    "accept-language, accept-encoding",
+		"MICROCACHE_DRIVER":                  "map",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	o, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.TTL != 500*time.Millisecond || !o.CollapsedForwarding || o.MaxBackendConcurrency != 4 ||
+		!reflect.DeepEqual(o.Vary, []string{"accept-language", "accept-encoding"}) {
+		t.Fatalf("Config not parsed correctly %#v", o)
+	}
+	if _, ok := o.Driver.(DriverMap); !ok {
+		t.Fatal("Driver not parsed correctly")
+	}
+	os.Setenv("MICROCACHE_TTL", "30")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("Invalid duration should return error")
+	}
+}
+
+// ConfigFromEnv parses sample rates
+func TestConfigFromEnvFloat(t *testing.T) {
+	os.Setenv("MICROCACHE_VERIFY_SAMPLE_RATE", "0.1")
+	defer os.Unsetenv("MICROCACHE_VERIFY_SAMPLE_RATE")
+	o, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.VerifySampleRate != 0.1 {
+		t.Fatalf("VerifySampleRate not parsed correctly %v", o.VerifySampleRate)
+	}
+	os.Setenv("MICROCACHE_VERIFY_SAMPLE_RATE", "often")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("Invalid float should return error")
+	}
+}
+
+// ConfigFromEnv parses lists of status codes
+func TestConfigFromEnvStatus(t *testing.T) {
+	os.Setenv("MICROCACHE_STALE_IF_ERROR_STATUS", "429, 503")
+	defer os.Unsetenv("MICROCACHE_STALE_IF_ERROR_STATUS")
+	o, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o.StaleIfErrorStatus, []int{429, 503}) {
+		t.Fatalf("StaleIfErrorStatus not parsed correctly %v", o.StaleIfErrorStatus)
+	}
+	os.Setenv("MICROCACHE_STALE_IF_ERROR_STATUS", "429,x")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("Invalid status code should return error")
+	}
+}
+
+// Registered drivers and compressors are available by name
+func TestConfigRegistry(t *testing.T) {
+	var spec DriverSpec
+	RegisterDriver("test", func(s DriverSpec) Driver {
+		spec = s
+		return NewDriverLRU(s.Size)
+	})
+	RegisterCompressor("test", func() Compressor {
+		return CompressorGzip{}
+	})
+	os.Setenv("MICROCACHE_DRIVER", "test")
+	defer os.Unsetenv("MICROCACHE_DRIVER")
+	os.Setenv("MICROCACHE_DRIVER_SIZE", "5")
+	defer os.Unsetenv("MICROCACHE_DRIVER_SIZE")
+	os.Setenv("MICROCACHE_COMPRESSOR", "test")
+	defer os.Unsetenv("MICROCACHE_COMPRESSOR")
+	o, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := o.Driver.(DriverLRU); !ok || spec.Size != 5 || spec.RequestSize != 5 {
+		t.Fatalf("Registered driver not constructed correctly %#v", spec)
+	}
+	if _, ok := o.Compressor.(CompressorGzip); !ok {
+		t.Fatal("Registered compressor not constructed correctly")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Registering a driver twice should panic")
+		}
+	}()
+	RegisterDriver("test", nil)
+}
@@ -0,0 +1,115 @@
+package microcache
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrNegative is returned by Config.Validate for negative durations and sizes
+	ErrNegative = errors.New("must not be negative")
+
+	// ErrOutOfRange is returned by Config.Validate for values outside their valid range
+	ErrOutOfRange = errors.New("out of range")
+
+	// ErrRequiresTTL is returned by Config.Validate for options which have no effect
+	// unless TTL is set
+	ErrRequiresTTL = errors.New("requires TTL")
+
+	// ErrForegroundOnly is returned by Config.Validate for options which require
+	// background work when ForegroundOnly is set
+	ErrForegroundOnly = errors.New("requires background work, incompatible with ForegroundOnly")
+)
+
+// ConfigError is an invalid Config field
+type ConfigError struct {
+	Field string
+	Err   error
+}
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Field, e.Err)
+}
+
+func (e ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigErrors lists every invalid field found by Config.Validate
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "microcache: " + strings.Join(msgs, "; ")
+}
+
+// DriverValidator is an optional interface implemented by drivers able to report
+// misconfiguration. When implemented, it is called by Config.Validate.
+type DriverValidator interface {
+
+	// Validate returns an error if the driver is misconfigured
+	Validate() error
+}
+
+// Validate returns ConfigErrors describing every invalid field, or nil if the config
+// is valid. Validate is called by New.
+func (o Config) Validate() error {
+	var errs ConfigErrors
+	v := reflect.ValueOf(o)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		// Durations and sizes
+		if k := f.Kind(); (k == reflect.Int || k == reflect.Int64) && f.Int() < 0 {
+			errs = append(errs, ConfigError{v.Type().Field(i).Name, ErrNegative})
+		}
+	}
+	if o.StaleWhileRevalidate > 0 && o.TTL == 0 {
+		errs = append(errs, ConfigError{"StaleWhileRevalidate", ErrRequiresTTL})
+	}
+	if o.MinTTL > 0 && o.MaxTTL > 0 && o.MinTTL > o.MaxTTL {
+		errs = append(errs, ConfigError{"MinTTL", fmt.Errorf("%w: greater than MaxTTL", ErrOutOfRange)})
+	}
+	if o.VerifySampleRate < 0 || o.VerifySampleRate > 1 {
+		errs = append(errs, ConfigError{"VerifySampleRate", fmt.Errorf("%w: must be between 0 and 1", ErrOutOfRange)})
+	}
+	if o.RolloutPercent > 100 {
+		errs = append(errs, ConfigError{"RolloutPercent", fmt.Errorf("%w: must be between 0 and 100", ErrOutOfRange)})
+	}
+	for _, status := range o.StaleIfErrorStatus {
+		if status < 100 || status > 599 {
+			errs = append(errs, ConfigError{"StaleIfErrorStatus", fmt.Errorf("%w: %d is not a status code", ErrOutOfRange, status)})
+		}
+	}
+	if o.ForegroundOnly {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"Timeout", o.Timeout > 0},
+			{"StaleWhileRevalidate", o.StaleWhileRevalidate > 0},
+			{"RefreshAhead", o.RefreshAhead > 0},
+			{"HedgeAfter", o.HedgeAfter > 0},
+			{"BackendRetries", o.BackendRetries > 0},
+			{"VerifySampleRate", o.VerifySampleRate > 0},
+			{"WarmKeys", o.WarmKeys > 0},
+		} {
+			if f.set {
+				errs = append(errs, ConfigError{f.name, ErrForegroundOnly})
+			}
+		}
+	}
+	if d, ok := o.Driver.(DriverValidator); ok {
+		if err := d.Validate(); err != nil {
+			errs = append(errs, ConfigError{"Driver", err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
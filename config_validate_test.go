@@ -0,0 +1,48 @@
+package microcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// New should reject invalid configs with typed errors
+func TestConfigValidate(t *testing.T) {
+	for i, c := range []struct {
+		config Config
+		field  string
+		err    error
+	}{
+		{Config{TTL: -time.Second}, "TTL", ErrNegative},
+		{Config{TTL: time.Second, Timeout: -1}, "Timeout", ErrNegative},
+		{Config{MaxBackendConcurrency: -1}, "MaxBackendConcurrency", ErrNegative},
+		{Config{StaleWhileRevalidate: time.Second}, "StaleWhileRevalidate", ErrRequiresTTL},
+		{Config{MinTTL: time.Minute, MaxTTL: time.Second}, "MinTTL", ErrOutOfRange},
+		{Config{VerifySampleRate: 2}, "VerifySampleRate", ErrOutOfRange},
+		{Config{RolloutPercent: 101}, "RolloutPercent", ErrOutOfRange},
+		{Config{StaleIfErrorStatus: []int{429, 1000}}, "StaleIfErrorStatus", ErrOutOfRange},
+		{Config{ForegroundOnly: true, Timeout: time.Second}, "Timeout", ErrForegroundOnly},
+		{Config{ForegroundOnly: true, TTL: time.Second, StaleWhileRevalidate: time.Second}, "StaleWhileRevalidate", ErrForegroundOnly},
+		{Config{ForegroundOnly: true, WarmKeys: 10}, "WarmKeys", ErrForegroundOnly},
+	} {
+		cache, err := New(c.config)
+		errs, ok := err.(ConfigErrors)
+		if cache != nil || !ok || len(errs) != 1 {
+			t.Fatalf("Case %d: expected 1 config error, got %v", i+1, err)
+		}
+		if errs[0].Field != c.field || !errors.Is(errs[0], c.err) {
+			t.Fatalf("Case %d: unexpected error %v", i+1, errs[0])
+		}
+	}
+	cache, err := New(Config{TTL: time.Second, StaleWhileRevalidate: time.Second})
+	if err != nil {
+		t.Fatalf("Valid config rejected: %v", err)
+	}
+	cache.Stop()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("MustNew should panic on an invalid config")
+		}
+	}()
+	MustNew(Config{TTL: -1})
+}
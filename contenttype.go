@@ -0,0 +1,40 @@
+package microcache
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// cacheableContentType reports whether a response may be stored according to
+// CacheableContentTypes and UncacheableContentTypes. The content type of responses
+// without a Content-Type header is sniffed from the body as net/http would.
+func (m *microcache) cacheableContentType(res Response) bool {
+	if m.CacheableContentTypes == nil && m.UncacheableContentTypes == nil {
+		return true
+	}
+	ct := res.header.Get("Content-Type")
+	if ct == "" && len(res.body) > 0 {
+		ct = http.DetectContentType(res.body)
+	}
+	if mt, _, err := mime.ParseMediaType(ct); err == nil {
+		ct = mt
+	} else {
+		ct = strings.ToLower(strings.TrimSpace(ct))
+	}
+	if matchContentType(m.UncacheableContentTypes, ct) {
+		return false
+	}
+	return m.CacheableContentTypes == nil || matchContentType(m.CacheableContentTypes, ct)
+}
+
+// matchContentType reports whether a media type matches any of patterns (ie. text/*)
+func matchContentType(patterns []string, ct string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), ct); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// CacheableContentTypes and UncacheableContentTypes determine whether responses are stored
+func TestContentTypes(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:                     30 * time.Second,
+		CacheableContentTypes:   []string{"text/*", "application/json"},
+		UncacheableContentTypes: []string{"text/event-stream"},
+		Monitor:                 testMonitor,
+		Driver:                  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "Application/JSON; charset=utf-8")
+		case "/stream":
+			w.Header().Set("Content-Type", "text/event-stream")
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+		case "/override":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("microcache-cache", "1")
+		case "/sniffed":
+			w.Write([]byte("<html></html>"))
+			return
+		}
+		w.Write([]byte("body"))
+	}))
+	batchGet(handler, []string{
+		"/json",
+		"/json",
+		"/stream",
+		"/stream",
+		"/binary",
+		"/binary",
+		"/override",
+		"/override",
+		"/sniffed",
+		"/sniffed",
+	})
+	if testMonitor.getHits() != 3 || testMonitor.getMisses() != 7 {
+		t.Fatalf("Content type rules not respected %s", dumpMonitor(testMonitor))
+	}
+}
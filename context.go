@@ -0,0 +1,68 @@
+package microcache
+
+import (
+	"context"
+)
+
+// DriverContext is an optional interface implemented by drivers able to respect
+// context deadlines and cancellation, such as remote drivers. When implemented, reads
+// are bound to the request context and all operations are bound to DriverTimeout so
+// that an unresponsive driver cannot hang requests indefinitely. Errors are handled
+// according to Config.FailureMode.
+type DriverContext interface {
+
+	// SetRequestOptsCtx stores request options in the request cache
+	SetRequestOptsCtx(context.Context, string, RequestOpts) error
+
+	// GetRequestOptsCtx retrieves request options from the request cache
+	GetRequestOptsCtx(context.Context, string) (RequestOpts, error)
+
+	// SetCtx stores a response object in the response cache
+	SetCtx(context.Context, string, Response) error
+
+	// GetCtx retrieves a response object from the response cache
+	GetCtx(context.Context, string) (Response, error)
+
+	// RemoveCtx removes a response object from the response cache
+	RemoveCtx(context.Context, string) error
+}
+
+// driverContext returns a context for a driver operation derived from parent and
+// bound to DriverTimeout
+func (m *microcache) driverContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if m.DriverTimeout > 0 {
+		return context.WithTimeout(parent, m.DriverTimeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// driverSetRequestOpts stores request options in the driver
+func (m *microcache) driverSetRequestOpts(reqHash string, req RequestOpts) error {
+	if d, ok := m.Driver.(DriverContext); ok {
+		// Writes are not bound to the request since they may outlive it
+		ctx, cancel := m.driverContext(context.Background())
+		defer cancel()
+		return d.SetRequestOptsCtx(ctx, reqHash, req)
+	}
+	return m.Driver.SetRequestOpts(reqHash, req)
+}
+
+// driverSet stores a response object in the driver
+func (m *microcache) driverSet(objHash string, obj Response) error {
+	if d, ok := m.Driver.(DriverContext); ok {
+		ctx, cancel := m.driverContext(context.Background())
+		defer cancel()
+		return d.SetCtx(ctx, objHash, obj)
+	}
+	return m.Driver.Set(objHash, obj)
+}
+
+// driverRemove removes a response object from the driver
+func (m *microcache) driverRemove(objHash string) error {
+	if d, ok := m.Driver.(DriverContext); ok {
+		ctx, cancel := m.driverContext(context.Background())
+		defer cancel()
+		return d.RemoveCtx(ctx, objHash)
+	}
+	return m.Driver.Remove(objHash)
+}
@@ -0,0 +1,94 @@
+package microcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// hangingDriver is a DriverLRU whose context aware operations block until the
+// context is done
+type hangingDriver struct {
+	DriverLRU
+}
+
+func (d hangingDriver) SetRequestOptsCtx(ctx context.Context, hash string, req RequestOpts) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (d hangingDriver) GetRequestOptsCtx(ctx context.Context, hash string) (RequestOpts, error) {
+	<-ctx.Done()
+	return RequestOpts{}, ctx.Err()
+}
+
+func (d hangingDriver) SetCtx(ctx context.Context, hash string, res Response) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (d hangingDriver) GetCtx(ctx context.Context, hash string) (Response, error) {
+	<-ctx.Done()
+	return Response{}, ctx.Err()
+}
+
+func (d hangingDriver) RemoveCtx(ctx context.Context, hash string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// An unresponsive driver should fail requests according to FailureMode once
+// DriverTimeout elapses
+func TestDriverTimeout(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:           30 * time.Second,
+		DriverTimeout: 10 * time.Millisecond,
+		FailureMode:   FailClosed,
+		Monitor:       testMonitor,
+		Driver:        hangingDriver{NewDriverLRU(10)},
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	done := make(chan int)
+	go func() {
+		done <- getResponse(handler, "/").Code
+	}()
+	select {
+	case code := <-done:
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("Expected 503, got %d", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Request hung on unresponsive driver")
+	}
+	if testMonitor.getDriverErrors() != 1 {
+		t.Fatal("Driver timeout should be reported as a driver error")
+	}
+}
+
+// Driver reads should be cancelled with the request
+func TestDriverRequestCancel(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:    30 * time.Second,
+		Driver: hangingDriver{NewDriverLRU(10)},
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	ctx, cancel := context.WithCancel(context.Background())
+	r, _ := http.NewRequest("GET", "/", nil)
+	r = r.WithContext(ctx)
+	done := make(chan bool)
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		done <- true
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Request hung after cancellation")
+	}
+}
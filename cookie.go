@@ -0,0 +1,58 @@
+package microcache
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// NormalizeCookies returns a vary normalizer for the Cookie header which discards
+// all cookies other than those named, sorted by name, so that tracking cookies and
+// other noise do not splinter the cache.
+//
+// Applied to Cookie when CookieWhitelist is set.
+func NormalizeCookies(names ...string) func(string) string {
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+	return func(value string) string {
+		cookies := readCookies(value)
+		kept := make([]string, 0, len(cookies))
+		for _, c := range cookies {
+			if allowed[c.Name] {
+				kept = append(kept, c.Name+"="+c.Value)
+			}
+		}
+		sort.Strings(kept)
+		return strings.Join(kept, "; ")
+	}
+}
+
+// readCookies parses the value of a Cookie request header
+func readCookies(value string) []*http.Cookie {
+	if value == "" {
+		return nil
+	}
+	r := http.Request{Header: http.Header{"Cookie": []string{value}}}
+	return r.Cookies()
+}
+
+// writeVaryCookie writes the values of the cookies named by microcache-vary-cookie
+func writeVaryCookie(h *hashBuffer, r *http.Request, names []string) {
+	for _, name := range names {
+		h.write("&cookie:", name, "=")
+		if c, err := r.Cookie(name); err == nil {
+			h.write(c.Value)
+		}
+	}
+}
+
+// stripSetCookie removes Set-Cookie from a response about to be stored unless the
+// route allows it with microcache-set-cookie. Cookies set for one client must not
+// be replayed to every other client served from the cache.
+func (m *microcache) stripSetCookie(obj Response, req RequestOpts) {
+	if m.StripSetCookie && !req.setCookie {
+		obj.header.Del("Set-Cookie")
+	}
+}
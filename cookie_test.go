@@ -0,0 +1,112 @@
+package microcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// NormalizeCookies should discard cookies not named and sort the rest
+func TestNormalizeCookies(t *testing.T) {
+	normalize := NormalizeCookies("session", "lang")
+	for in, exp := range map[string]string{
+		"":                             "",
+		"_ga=123":                      "",
+		"session=abc; _ga=123":         "session=abc",
+		"_ga=1; session=abc; lang=en":  "lang=en; session=abc",
+		"lang=en;session=abc;_gid=456": "lang=en; session=abc",
+	} {
+		if out := normalize(in); out != exp {
+			t.Fatalf("NormalizeCookies(%q) = %q, expected %q", in, out, exp)
+		}
+	}
+}
+
+// Cookies not in CookieWhitelist should not splinter the cache when Cookie is in Vary
+func TestCookieWhitelist(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:             30 * time.Second,
+		Vary:            []string{"Cookie"},
+		CookieWhitelist: []string{"session"},
+		Monitor:         testMonitor,
+		Driver:          NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	for _, cookie := range []string{
+		"session=a; _ga=1",
+		"_ga=2; session=a",
+		"session=a",
+		"session=b; _ga=1",
+		"_ga=3",
+		"",
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Cookie", cookie)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if testMonitor.getHits() != 3 || testMonitor.getMisses() != 3 {
+		t.Fatalf("Cookie whitelist not respected %s", dumpMonitor(testMonitor))
+	}
+}
+
+// microcache-vary-cookie should splinter the cache by the named cookies only
+func TestVaryCookie(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("microcache-vary-cookie", "lang")
+		w.Write([]byte("done\n"))
+	}))
+	for _, cookie := range []string{
+		"lang=en",
+		"lang=en; session=a",
+		"lang=fr",
+		"session=b",
+		"",
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Cookie", cookie)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if testMonitor.getHits() != 2 || testMonitor.getMisses() != 3 {
+		t.Fatalf("microcache-vary-cookie not respected %s", dumpMonitor(testMonitor))
+	}
+}
+
+// StripSetCookie should remove Set-Cookie from stored responses unless allowed by route
+func TestStripSetCookie(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:            30 * time.Second,
+		StripSetCookie: true,
+		Driver:         NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		if r.URL.Path == "/allowed" {
+			w.Header().Set("microcache-set-cookie", "1")
+		}
+		w.Write([]byte("done\n"))
+	}))
+	for path, exp := range map[string]string{
+		"/stripped": "",
+		"/allowed":  "session=abc",
+	} {
+		miss := getResponse(handler, path)
+		if miss.Header().Get("Set-Cookie") != "session=abc" {
+			t.Fatalf("Set-Cookie missing from miss on %s", path)
+		}
+		hit := getResponse(handler, path)
+		if hit.Header().Get("Set-Cookie") != exp {
+			t.Fatalf("Expected Set-Cookie %q on hit for %s, got %q", exp, path, hit.Header().Get("Set-Cookie"))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package microcache
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isDebug determines whether debug headers should be returned for a request
+func (m *microcache) isDebug(r *http.Request) bool {
+	if m.DebugHeader == "" {
+		return false
+	}
+	val := r.Header.Get("microcache-debug")
+	return subtle.ConstantTimeCompare([]byte(val), []byte(m.DebugHeader)) == 1
+}
+
+// setDebugRequestHeaders describes the request hash and the request options
+// found for it. Debug headers are written directly to the client response.
+func setDebugRequestHeaders(w http.ResponseWriter, reqHash string, req RequestOpts) {
+	w.Header().Set("microcache-debug-request-hash", hex.EncodeToString([]byte(reqHash)))
+	w.Header().Set("microcache-debug-request-found", strconv.FormatBool(req.found))
+	if len(req.vary) > 0 {
+		w.Header().Set("microcache-debug-vary", strings.Join(req.vary, ", "))
+	}
+	if len(req.varyQuery) > 0 {
+		w.Header().Set("microcache-debug-vary-query", strings.Join(req.varyQuery, ", "))
+	}
+	if len(req.varyCookie) > 0 {
+		w.Header().Set("microcache-debug-vary-cookie", strings.Join(req.varyCookie, ", "))
+	}
+	if req.found {
+		w.Header().Set("microcache-debug-nocache", strconv.FormatBool(req.nocache))
+	}
+}
+
+// setDebugCollapsedHeader indicates whether the request was collapsed into
+// another in-flight request for the same request hash
+func setDebugCollapsedHeader(w http.ResponseWriter, collapsed bool) {
+	w.Header().Set("microcache-debug-collapsed", strconv.FormatBool(collapsed))
+}
+
+// setDebugObjectHeaders describes the object hash and remaining ttl of the
+// cached response object
+func setDebugObjectHeaders(w http.ResponseWriter, objHash string, obj Response, now time.Time) {
+	w.Header().Set("microcache-debug-object-hash", hex.EncodeToString([]byte(objHash)))
+	w.Header().Set("microcache-debug-object-found", strconv.FormatBool(obj.found))
+	if obj.found {
+		ttl := obj.expires.Sub(now).Round(time.Second) / time.Second
+		w.Header().Set("microcache-debug-ttl", fmt.Sprintf("%d", ttl))
+	}
+}
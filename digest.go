@@ -0,0 +1,39 @@
+package microcache
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/cespare/xxhash"
+)
+
+// setDigest stores the body digest of a backend response at least DigestMinSize
+// bytes in length, and a weak ETag derived from it if DigestETag is set and the
+// backend did not provide one
+func (m *microcache) setDigest(res *Response) {
+	if m.DigestMinSize <= 0 || len(res.body) < m.DigestMinSize {
+		return
+	}
+	res.digest = xxhash.Sum64(res.body)
+	res.digested = true
+	if m.DigestETag && res.header.Get("Etag") == "" {
+		res.header.Set("Etag", `W/"`+strconv.FormatUint(res.digest, 16)+`"`)
+	}
+}
+
+// bodyDigest returns the stored body digest, computing it if not stored
+func (res *Response) bodyDigest() uint64 {
+	if res.digested {
+		return res.digest
+	}
+	return xxhash.Sum64(res.body)
+}
+
+// bodyChanged reports whether two responses have different bodies, comparing
+// digests when either is stored
+func bodyChanged(a, b Response) bool {
+	if a.digested || b.digested {
+		return a.bodyDigest() != b.bodyDigest()
+	}
+	return !bytes.Equal(a.body, b.body)
+}
@@ -0,0 +1,61 @@
+package microcache
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Large responses should carry a weak ETag derived from the stored digest
+func TestDigestETag(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:           30 * time.Second,
+		DigestMinSize: 10,
+		DigestETag:    true,
+		Driver:        NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			w.Write([]byte("done\n"))
+		case "/etag":
+			w.Header().Set("ETag", `"v1"`)
+			fallthrough
+		default:
+			w.Write([]byte(strings.Repeat("large", 10)))
+		}
+	}))
+	miss := getResponse(handler, "/large")
+	etag := miss.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("Expected weak ETag on large response, got %q", etag)
+	}
+	if hit := getResponse(handler, "/large"); hit.Header().Get("ETag") != etag {
+		t.Fatalf("Expected ETag %q on hit, got %q", etag, hit.Header().Get("ETag"))
+	}
+	if w := getResponse(handler, "/small"); w.Header().Get("ETag") != "" {
+		t.Fatalf("Small responses should not be digested, got ETag %q", w.Header().Get("ETag"))
+	}
+	if w := getResponse(handler, "/etag"); w.Header().Get("ETag") != `"v1"` {
+		t.Fatalf("Backend ETag should be preserved, got %q", w.Header().Get("ETag"))
+	}
+}
+
+// bodyChanged should compare digests when either response stores one
+func TestBodyChanged(t *testing.T) {
+	a := Response{body: []byte("body")}
+	b := Response{body: []byte("body")}
+	if bodyChanged(a, b) {
+		t.Fatal("Identical bodies should not be changed")
+	}
+	b.digest, b.digested = b.bodyDigest()+1, true
+	if !bodyChanged(a, b) {
+		t.Fatal("Differing digests should be changed")
+	}
+	b.digest = a.bodyDigest()
+	if bodyChanged(a, b) {
+		t.Fatal("Matching digests should not be changed")
+	}
+}
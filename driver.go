@@ -24,3 +24,31 @@ type Driver interface {
 	// GetSize returns the number of objects stored in the cache
 	GetSize() int
 }
+
+// DriverRemovePrefix is an optional interface implemented by drivers able to remove
+// all request options and response objects having keys beginning with a prefix.
+// Required by PurgeAll.
+type DriverRemovePrefix interface {
+
+	// RemovePrefix removes all keys beginning with prefix. An empty prefix removes all keys.
+	RemovePrefix(prefix string) error
+}
+
+// DriverRejections is an optional interface implemented by drivers whose admission
+// policy may reject writes. When implemented, rejections are reported to the Monitor
+// in Stats.Rejected.
+type DriverRejections interface {
+
+	// GetRejected returns the total number of writes rejected since the driver was created
+	GetRejected() int
+}
+
+// DriverSizeBytes is an optional interface implemented by drivers able to report
+// the approximate number of bytes consumed by cached response objects.
+// When implemented, the result is reported to the Monitor in Stats.Bytes.
+type DriverSizeBytes interface {
+
+	// GetSizeBytes returns the approximate size in bytes of all response objects
+	// stored in the cache (after compression)
+	GetSizeBytes() int
+}
@@ -0,0 +1,117 @@
+// Package microcachearc provides a microcache driver using the Adaptive Replacement
+// Cache from github.com/hashicorp/golang-lru.
+package microcachearc
+
+import (
+	"strings"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/kevburnsjr/microcache"
+)
+
+func init() {
+	microcache.RegisterDriver("arc", func(spec microcache.DriverSpec) microcache.Driver {
+		return NewDriver2(spec.RequestSize, spec.Size)
+	})
+}
+
+// Driver is a driver implementation using github.com/hashicorp/golang-lru
+// ARCCache is a thread-safe fixed size Adaptive Replacement Cache (ARC).
+// It requires more ram and cpu than straight LRU but can be more efficient
+// https://godoc.org/github.com/hashicorp/golang-lru#ARCCache
+//
+//	cache := microcache.MustNew(microcache.Config{
+//		Driver: microcachearc.NewDriver(10000),
+//	})
+type Driver struct {
+	RequestCache  *lru.ARCCache
+	ResponseCache *lru.ARCCache
+}
+
+var _ microcache.Driver = Driver{}
+
+// NewDriver returns an ARC driver.
+// size determines the number of items in the cache.
+// Memory usage should be considered when choosing the appropriate cache size.
+// The amount of memory consumed by the driver will depend upon the response size.
+// Roughly, memory = cacheSize * averageResponseSize / compression ratio
+// ARC caches have additional CPU and memory overhead when compared with LRU
+// ARC does not support eviction monitoring
+func NewDriver(size int) Driver {
+	return NewDriver2(size, size)
+}
+
+// NewDriver2 returns an ARC driver with separate capacities for the request cache
+// and the response cache. Request options are small and numerous so reqSize may be
+// set much larger than resSize at little cost.
+func NewDriver2(reqSize, resSize int) Driver {
+	// golang-lru segfaults when size is zero
+	if reqSize < 1 {
+		reqSize = 1
+	}
+	if resSize < 1 {
+		resSize = 1
+	}
+	reqCache, _ := lru.NewARC(reqSize)
+	resCache, _ := lru.NewARC(resSize)
+	return Driver{
+		reqCache,
+		resCache,
+	}
+}
+
+func (c Driver) SetRequestOpts(hash string, req microcache.RequestOpts) error {
+	c.RequestCache.Add(hash, req)
+	return nil
+}
+
+func (c Driver) GetRequestOpts(hash string) (req microcache.RequestOpts) {
+	obj, success := c.RequestCache.Get(hash)
+	if success {
+		req = obj.(microcache.RequestOpts)
+	}
+	return req
+}
+
+func (c Driver) Set(hash string, res microcache.Response) error {
+	c.ResponseCache.Add(hash, res)
+	return nil
+}
+
+func (c Driver) Get(hash string) (res microcache.Response) {
+	obj, success := c.ResponseCache.Get(hash)
+	if success {
+		res = obj.(microcache.Response)
+	}
+	return res
+}
+
+func (c Driver) Remove(hash string) error {
+	c.ResponseCache.Remove(hash)
+	return nil
+}
+
+func (c Driver) RemovePrefix(prefix string) error {
+	for _, cache := range []*lru.ARCCache{c.RequestCache, c.ResponseCache} {
+		for _, key := range cache.Keys() {
+			if strings.HasPrefix(key.(string), prefix) {
+				cache.Remove(key)
+			}
+		}
+	}
+	return nil
+}
+
+func (c Driver) GetSize() int {
+	return c.ResponseCache.Len()
+}
+
+func (c Driver) GetSizeBytes() int {
+	var size int
+	for _, key := range c.ResponseCache.Keys() {
+		if obj, ok := c.ResponseCache.Peek(key); ok {
+			size += obj.(microcache.Response).Size()
+		}
+	}
+	return size
+}
@@ -0,0 +1,67 @@
+package microcachearc
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kevburnsjr/microcache"
+	"github.com/kevburnsjr/microcache/microcachetest"
+)
+
+// Driver should respect TTL
+func TestDriver(t *testing.T) {
+	clock := microcachetest.NewClock(time.Now())
+	driver := NewDriver(10)
+	cache := microcache.MustNew(microcache.Config{
+		TTL:     30 * time.Second,
+		Driver:  driver,
+		Clock:   clock,
+		Exposed: true,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	microcachetest.ExpectMiss(t, handler, "/")
+	microcachetest.ExpectHit(t, handler, "/")
+	clock.Advance(30 * time.Second)
+	microcachetest.ExpectMiss(t, handler, "/")
+	if driver.GetSize() != 1 || driver.GetSizeBytes() == 0 {
+		t.Fatal("Driver reports inaccurate size")
+	}
+}
+
+// PurgeAll should remove only keys having the cache's prefix
+func TestRemovePrefix(t *testing.T) {
+	driver := NewDriver(10)
+	handler := func(prefix string) (microcache.Microcache, http.Handler) {
+		cache := microcache.MustNew(microcache.Config{
+			TTL:       30 * time.Second,
+			Driver:    driver,
+			KeyPrefix: prefix,
+			Exposed:   true,
+		})
+		return cache, cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+	cacheA, handlerA := handler("a:")
+	defer cacheA.Stop()
+	cacheB, handlerB := handler("b:")
+	defer cacheB.Stop()
+	microcachetest.ExpectMiss(t, handlerA, "/")
+	microcachetest.ExpectMiss(t, handlerB, "/")
+	if err := cacheA.PurgeAll(); err != nil {
+		t.Fatal(err)
+	}
+	microcachetest.ExpectMiss(t, handlerA, "/")
+	microcachetest.ExpectHit(t, handlerB, "/")
+}
+
+// Importing the package registers the driver for ConfigSpec
+func TestRegister(t *testing.T) {
+	o, err := microcache.ConfigSpec{Driver: "arc", DriverSize: 10}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := o.Driver.(Driver); !ok {
+		t.Fatalf("Expected arc driver, got %T", o.Driver)
+	}
+}
@@ -0,0 +1,8 @@
+module github.com/kevburnsjr/microcache/driver/arc
+
+go 1.13
+
+require (
+	github.com/hashicorp/golang-lru v0.5.3
+	github.com/kevburnsjr/microcache v1.1.0
+)
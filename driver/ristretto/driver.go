@@ -0,0 +1,207 @@
+// Package microcacheristretto provides a microcache driver using
+// github.com/dgraph-io/ristretto.
+package microcacheristretto
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/ristretto"
+	"github.com/kevburnsjr/microcache"
+)
+
+var (
+	errRemovePrefixUnsupported = errors.New("microcache: ristretto driver cannot remove keys by prefix")
+	errNoCache                 = errors.New("ristretto driver has no cache (use NewDriver)")
+	errNoMetrics               = errors.New("ristretto cache must be created with Metrics enabled")
+	errNegativeTTL             = errors.New("ristretto driver TTL must not be negative")
+	errNegativeSize            = errors.New("ristretto driver sizes must not be negative")
+)
+
+func init() {
+	microcache.RegisterDriver("ristretto", func(spec microcache.DriverSpec) microcache.Driver {
+		return NewDriverTTL(int64(spec.Size), spec.Bytes, spec.TTL)
+	})
+}
+
+// Driver is a driver implementation using github.com/dgraph-io/ristretto
+//
+//	cache := microcache.MustNew(microcache.Config{
+//		Driver: microcacheristretto.NewDriver(1e4, 1<<28),
+//	})
+type Driver struct {
+	microcache.Driver
+
+	Cache *ristretto.Cache
+
+	// TTL bounds the lifetime of request options and response objects. Entries older
+	// than TTL are treated as missing and removed when next read. The vendored version
+	// of ristretto has no SetWithTTL so expired entries which are never read again
+	// remain until evicted.
+	// Default: 0 (no limit)
+	TTL time.Duration
+
+	removed *int64
+	err     error
+}
+
+// entry is a cached value with an expiration date
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewDriver returns the default Ristretto driver configuration.
+// requests should be the number of items you expect to keep in the cache when full.
+// Estimating this on the higher side is better.
+// size determines the maximum number of bytes in the cache.
+func NewDriver(requests, size int64) Driver {
+	if requests < 0 || size < 0 {
+		return Driver{err: errNegativeSize}
+	}
+	if size == 0 {
+		size = 1
+	}
+	if requests == 0 {
+		requests = size
+	}
+
+	cache, err := ristretto.NewCache(&ristretto.Config{
+		NumCounters: requests * 10,
+		MaxCost:     size,
+		BufferItems: 64,
+		Metrics:     true, // Required to implement Driver.GetSize()
+	})
+	if err != nil {
+		return Driver{err: err}
+	}
+
+	return Driver{Cache: cache, removed: new(int64)}
+}
+
+// NewDriverTTL returns a Ristretto driver bounding the lifetime of entries to ttl
+func NewDriverTTL(requests, size int64, ttl time.Duration) Driver {
+	d := NewDriver(requests, size)
+	d.TTL = ttl
+	return d
+}
+
+// Validate reports an invalid ristretto configuration, ie. non-positive sizes passed
+// to NewDriver. Implements microcache.DriverValidator so that misconfiguration is
+// returned by microcache.New.
+func (d Driver) Validate() error {
+	switch {
+	case d.err != nil:
+		return d.err
+	case d.Cache == nil:
+		return errNoCache
+	case d.Cache.Metrics == nil:
+		return errNoMetrics
+	case d.TTL < 0:
+		return errNegativeTTL
+	}
+	return nil
+}
+
+// set stores a value, wrapping it with an expiration date if TTL is set
+func (d Driver) set(hash string, value interface{}, cost int64) {
+	if d.TTL > 0 {
+		value = entry{value, time.Now().Add(d.TTL)}
+	}
+	d.Cache.Set(hash, value, cost)
+}
+
+// get retrieves a value, removing it if expired
+func (d Driver) get(hash string) interface{} {
+	v, ok := d.Cache.Get(hash)
+	if !ok || v == nil {
+		return nil
+	}
+	if e, ok := v.(entry); ok {
+		if !time.Now().Before(e.expires) {
+			d.del(hash)
+			return nil
+		}
+		return e.value
+	}
+	return v
+}
+
+// del deletes a key, counting the removal so that GetSize remains accurate since
+// ristretto does not count deletions as evictions
+func (d Driver) del(hash string) {
+	d.Cache.Del(hash)
+	if d.removed != nil {
+		atomic.AddInt64(d.removed, 1)
+	}
+}
+
+func (d Driver) SetRequestOpts(hash string, req microcache.RequestOpts) error {
+	d.set(hash, req, int64(req.Size()))
+	return nil
+}
+
+func (d Driver) GetRequestOpts(hash string) (req microcache.RequestOpts) {
+	if r, ok := d.get(hash).(microcache.RequestOpts); ok {
+		req = r
+	}
+	return req
+}
+
+func (d Driver) Set(hash string, res microcache.Response) error {
+	d.set(hash, res, int64(res.Size()))
+	return nil
+}
+
+func (d Driver) Get(hash string) (res microcache.Response) {
+	if r, ok := d.get(hash).(microcache.Response); ok {
+		res = r
+	}
+	return res
+}
+
+func (d Driver) Remove(hash string) error {
+	if _, ok := d.Cache.Get(hash); ok {
+		d.del(hash)
+	}
+	return nil
+}
+
+// RemovePrefix clears the cache. Ristretto cannot iterate keys so only an empty
+// prefix is supported.
+func (d Driver) RemovePrefix(prefix string) error {
+	if prefix != "" {
+		return errRemovePrefixUnsupported
+	}
+	d.Cache.Clear()
+	if d.removed != nil {
+		atomic.StoreInt64(d.removed, 0)
+	}
+	return nil
+}
+
+// GetSize returns the number of live keys, including request options. Keys updated
+// in place are not counted again and keys rejected by the admission policy are never
+// counted.
+func (d Driver) GetSize() int {
+	n := int64(d.Cache.Metrics.KeysAdded() - d.Cache.Metrics.KeysEvicted())
+	if d.removed != nil {
+		n -= atomic.LoadInt64(d.removed)
+	}
+	if n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+// GetSizeBytes returns the total cost of all items in the cache, including request options
+func (d Driver) GetSizeBytes() int {
+	return int(d.Cache.Metrics.CostAdded() - d.Cache.Metrics.CostEvicted())
+}
+
+// GetRejected returns the number of writes dropped by the set buffer or rejected by
+// the admission policy
+func (d Driver) GetRejected() int {
+	return int(d.Cache.Metrics.SetsDropped() + d.Cache.Metrics.SetsRejected())
+}
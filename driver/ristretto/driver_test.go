@@ -0,0 +1,87 @@
+package microcacheristretto
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kevburnsjr/microcache"
+	"github.com/kevburnsjr/microcache/microcachetest"
+)
+
+// Driver should report live keys and expire entries after TTL
+func TestDriver(t *testing.T) {
+	driver := NewDriverTTL(1e3, 1e6, 50*time.Millisecond)
+	cache := microcache.MustNew(microcache.Config{
+		TTL:     30 * time.Second,
+		Driver:  driver,
+		Exposed: true,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	microcachetest.ExpectMiss(t, handler, "/")
+	time.Sleep(10 * time.Millisecond)
+	microcachetest.ExpectHit(t, handler, "/")
+	// Request options and response
+	if driver.GetSize() != 2 {
+		t.Fatalf("Driver should have size 2, got %d", driver.GetSize())
+	}
+	time.Sleep(50 * time.Millisecond)
+	microcachetest.ExpectMiss(t, handler, "/")
+	if err := cache.PurgeAll(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if driver.GetSize() != 0 {
+		t.Fatalf("Driver should have size 0, got %d", driver.GetSize())
+	}
+}
+
+// PurgeAll with a key prefix is unsupported
+func TestRemovePrefix(t *testing.T) {
+	cache := microcache.MustNew(microcache.Config{Driver: NewDriver(1e3, 1e6), KeyPrefix: "a:"})
+	defer cache.Stop()
+	if cache.PurgeAll() == nil {
+		t.Fatal("PurgeAll with a prefix should fail since ristretto cannot iterate keys")
+	}
+}
+
+// Health checks should accommodate buffered writes
+func TestHealth(t *testing.T) {
+	cache := microcache.MustNew(microcache.Config{Driver: NewDriver(1e3, 1e6)})
+	defer cache.Stop()
+	w := httptest.NewRecorder()
+	cache.HealthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Cache should be healthy: %s", w.Body.String())
+	}
+}
+
+// Importing the package registers the driver for ConfigSpec
+func TestRegister(t *testing.T) {
+	o, err := microcache.ConfigSpec{
+		Driver:      "ristretto",
+		DriverSize:  10,
+		DriverBytes: 1000000,
+		DriverTTL:   time.Minute,
+	}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := o.Driver.(Driver); !ok || d.TTL != time.Minute {
+		t.Fatalf("Expected ristretto driver with TTL, got %#v", o.Driver)
+	}
+}
+
+// Misconfigured drivers should be rejected by New
+func TestValidate(t *testing.T) {
+	for _, d := range []Driver{NewDriver(-1, 1e6), {}, NewDriverTTL(1e3, 1e6, -time.Second)} {
+		if _, err := microcache.New(microcache.Config{Driver: d}); err == nil {
+			t.Fatalf("Invalid driver should be rejected %+v", d)
+		}
+	}
+	if _, err := microcache.New(microcache.Config{Driver: NewDriver(1e3, 1e6)}); err != nil {
+		t.Fatalf("Valid driver rejected: %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+module github.com/kevburnsjr/microcache/driver/ristretto
+
+go 1.13
+
+require (
+	github.com/dgraph-io/ristretto v0.0.1
+	github.com/kevburnsjr/microcache v1.1.0
+)
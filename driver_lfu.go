@@ -0,0 +1,232 @@
+package microcache
+
+import (
+	"container/heap"
+	"strings"
+	"sync"
+)
+
+// DriverLFU is a dependency-free driver implementation using a Least Frequently Used
+// eviction policy. Objects with the fewest hits are evicted first which can
+// outperform LRU when traffic is heavily skewed toward a small set of hot objects.
+type DriverLFU struct {
+	RequestCache  *lfuCache
+	ResponseCache *lfuCache
+}
+
+// NewDriverLFU returns an LFU driver.
+// size determines the number of items in the cache.
+// Memory usage should be considered when choosing the appropriate cache size.
+// The amount of memory consumed by the driver will depend upon the response size.
+// Roughly, memory = cacheSize * averageResponseSize / compression ratio
+func NewDriverLFU(size int) DriverLFU {
+	return NewDriverLFU2(size, size)
+}
+
+// NewDriverLFU2 returns an LFU driver with separate capacities for the request cache
+// and the response cache. Request options are small and numerous so reqSize may be
+// set much larger than resSize at little cost.
+func NewDriverLFU2(reqSize, resSize int) DriverLFU {
+	if reqSize < 1 {
+		reqSize = 1
+	}
+	if resSize < 1 {
+		resSize = 1
+	}
+	return DriverLFU{
+		newLFUCache(reqSize),
+		newLFUCache(resSize),
+	}
+}
+
+func (c DriverLFU) SetRequestOpts(hash string, req RequestOpts) error {
+	c.RequestCache.Add(hash, req)
+	return nil
+}
+
+func (c DriverLFU) GetRequestOpts(hash string) (req RequestOpts) {
+	obj, success := c.RequestCache.Get(hash)
+	if success {
+		req = obj.(RequestOpts)
+	}
+	return req
+}
+
+func (c DriverLFU) Set(hash string, res Response) error {
+	c.ResponseCache.Add(hash, res)
+	return nil
+}
+
+func (c DriverLFU) Get(hash string) (res Response) {
+	obj, success := c.ResponseCache.Get(hash)
+	if success {
+		res = obj.(Response)
+	}
+	return res
+}
+
+func (c DriverLFU) Remove(hash string) error {
+	c.ResponseCache.Remove(hash)
+	return nil
+}
+
+func (c DriverLFU) RemovePrefix(prefix string) error {
+	c.RequestCache.RemovePrefix(prefix)
+	c.ResponseCache.RemovePrefix(prefix)
+	return nil
+}
+
+func (c DriverLFU) GetSizeBytes() int {
+	var size int
+	for _, obj := range c.ResponseCache.Values() {
+		size += obj.(Response).Size()
+	}
+	return size
+}
+
+func (c DriverLFU) GetSize() int {
+	return c.ResponseCache.Len()
+}
+
+// lfuCache is a thread-safe fixed size LFU cache.
+// Ties in frequency are broken by evicting the least recently used entry.
+type lfuCache struct {
+	size    int
+	mutex   sync.Mutex
+	items   map[string]*lfuEntry
+	entries lfuHeap
+	tick    uint64
+}
+
+type lfuEntry struct {
+	key   string
+	value interface{}
+	hits  uint64
+	tick  uint64
+	index int
+}
+
+func newLFUCache(size int) *lfuCache {
+	return &lfuCache{
+		size:  size,
+		items: make(map[string]*lfuEntry, size),
+	}
+}
+
+// Add adds or replaces a value, evicting the least frequently used entry if full
+func (c *lfuCache) Add(key string, value interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tick++
+	if e, ok := c.items[key]; ok {
+		e.value = value
+		e.tick = c.tick
+		heap.Fix(&c.entries, e.index)
+		return
+	}
+	if len(c.items) >= c.size {
+		e := heap.Pop(&c.entries).(*lfuEntry)
+		delete(c.items, e.key)
+	}
+	e := &lfuEntry{key: key, value: value, tick: c.tick}
+	heap.Push(&c.entries, e)
+	c.items[key] = e
+}
+
+// Get returns a value and increments its hit count
+func (c *lfuCache) Get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.tick++
+	e.hits++
+	e.tick = c.tick
+	heap.Fix(&c.entries, e.index)
+	return e.value, true
+}
+
+// Hits returns the number of times a key has been retrieved
+func (c *lfuCache) Hits(key string) uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.items[key]; ok {
+		return e.hits
+	}
+	return 0
+}
+
+// Remove removes a value
+func (c *lfuCache) Remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.items[key]; ok {
+		heap.Remove(&c.entries, e.index)
+		delete(c.items, key)
+	}
+}
+
+// RemovePrefix removes all values having keys beginning with prefix
+func (c *lfuCache) RemovePrefix(prefix string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, e := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			heap.Remove(&c.entries, e.index)
+			delete(c.items, key)
+		}
+	}
+}
+
+// Len returns the number of items in the cache
+func (c *lfuCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.items)
+}
+
+// Values returns a snapshot of all values in the cache
+func (c *lfuCache) Values() []interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	values := make([]interface{}, 0, len(c.items))
+	for _, e := range c.items {
+		values = append(values, e.value)
+	}
+	return values
+}
+
+// lfuHeap is a min-heap of entries ordered by hits then recency
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].hits == h[j].hits {
+		return h[i].tick < h[j].tick
+	}
+	return h[i].hits < h[j].hits
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
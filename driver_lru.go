@@ -1,13 +1,18 @@
 package microcache
 
 import (
-	"github.com/hashicorp/golang-lru"
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-// DriverLRU is a driver implementation using github.com/hashicorp/golang-lru
+// DriverLRU is a dependency-free driver implementation using a Least Recently Used
+// eviction policy. It is the default driver. Reads are lock free so that hits are not
+// delayed by concurrent refreshes of hot keys.
 type DriverLRU struct {
-	RequestCache  *lru.Cache
-	ResponseCache *lru.Cache
+	RequestCache  *lruCache
+	ResponseCache *lruCache
 }
 
 // NewDriverLRU returns the default LRU driver configuration.
@@ -16,18 +21,32 @@ type DriverLRU struct {
 // The amount of memory consumed by the driver will depend upon the response size.
 // Roughly, memory = cacheSize * averageResponseSize / compression ratio
 func NewDriverLRU(size int) DriverLRU {
-	// golang-lru segfaults when size is zero
-	if size < 1 {
-		size = 1
+	return NewDriverLRU2(size, size)
+}
+
+// NewDriverLRU2 returns an LRU driver with separate capacities for the request cache
+// and the response cache. Request options are small and numerous so reqSize may be
+// set much larger than resSize at little cost.
+func NewDriverLRU2(reqSize, resSize int) DriverLRU {
+	if reqSize < 1 {
+		reqSize = 1
 	}
-	reqCache, _ := lru.New(size)
-	resCache, _ := lru.New(size)
+	if resSize < 1 {
+		resSize = 1
+	}
+	res := newLRUCache(resSize)
+	res.sizeOf = sizeOfResponse
 	return DriverLRU{
-		reqCache,
-		resCache,
+		newLRUCache(reqSize),
+		res,
 	}
 }
 
+// sizeOfResponse returns the size in bytes of a cached Response
+func sizeOfResponse(v interface{}) int {
+	return v.(Response).Size()
+}
+
 func (c DriverLRU) SetRequestOpts(hash string, req RequestOpts) error {
 	c.RequestCache.Add(hash, req)
 	return nil
@@ -59,6 +78,177 @@ func (c DriverLRU) Remove(hash string) error {
 	return nil
 }
 
+func (c DriverLRU) RemovePrefix(prefix string) error {
+	c.RequestCache.RemovePrefix(prefix)
+	c.ResponseCache.RemovePrefix(prefix)
+	return nil
+}
+
 func (c DriverLRU) GetSize() int {
 	return c.ResponseCache.Len()
 }
+
+// GetSizeBytes returns the approximate size in bytes of stored responses.
+// The size is maintained as responses are added and removed so that reporting
+// does not scan the cache.
+func (c DriverLRU) GetSizeBytes() int {
+	return c.ResponseCache.Bytes()
+}
+
+// lruCache is a thread-safe fixed size LRU cache.
+// Reads are lock free so that hits on hot keys never contend with concurrent writes.
+// Entries are immutable (replaced rather than modified) and published to readers
+// through a sync.Map. Since readers can not reorder the list, recency is approximated
+// with a reference bit set on read and consulted on eviction (second chance).
+type lruCache struct {
+	// bytes is the total size of all values if sizeOf is set.
+	// It is first for 64 bit alignment on 32 bit platforms.
+	bytes int64
+
+	size  int
+	mutex sync.Mutex
+	items map[string]*list.Element
+	order *list.List
+	index sync.Map
+
+	// sizeOf returns the size in bytes of a value
+	sizeOf func(interface{}) int
+}
+
+type lruEntry struct {
+	key        string
+	value      interface{}
+	bytes      int64
+	referenced int32
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		items: make(map[string]*list.Element, size),
+		order: list.New(),
+	}
+}
+
+// Add adds or replaces a value, evicting the least recently used entry if full
+func (c *lruCache) Add(key string, value interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry := &lruEntry{key: key, value: value}
+	if c.sizeOf != nil {
+		entry.bytes = int64(c.sizeOf(value))
+	}
+	atomic.AddInt64(&c.bytes, entry.bytes)
+	if el, ok := c.items[key]; ok {
+		atomic.AddInt64(&c.bytes, -el.Value.(*lruEntry).bytes)
+		el.Value = entry
+		c.order.MoveToFront(el)
+		c.index.Store(key, entry)
+		return
+	}
+	if len(c.items) >= c.size {
+		c.evict()
+	}
+	c.items[key] = c.order.PushFront(entry)
+	c.index.Store(key, entry)
+}
+
+// evict removes the least recently used entry, giving entries read since they were
+// last considered a second chance
+func (c *lruCache) evict() {
+	for el := c.order.Back(); el != nil; el = c.order.Back() {
+		entry := el.Value.(*lruEntry)
+		if atomic.SwapInt32(&entry.referenced, 0) == 1 {
+			c.order.MoveToFront(el)
+			continue
+		}
+		c.order.Remove(el)
+		delete(c.items, entry.key)
+		c.index.Delete(entry.key)
+		atomic.AddInt64(&c.bytes, -entry.bytes)
+		return
+	}
+}
+
+// Get returns a value and marks it as recently used
+func (c *lruCache) Get(key string) (interface{}, bool) {
+	v, ok := c.index.Load(key)
+	if !ok {
+		return nil, false
+	}
+	entry := v.(*lruEntry)
+	if atomic.LoadInt32(&entry.referenced) == 0 {
+		atomic.StoreInt32(&entry.referenced, 1)
+	}
+	return entry.value, true
+}
+
+// Peek returns a value without marking it as recently used
+func (c *lruCache) Peek(key string) (interface{}, bool) {
+	v, ok := c.index.Load(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*lruEntry).value, true
+}
+
+// Remove removes a value
+func (c *lruCache) Remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+		c.index.Delete(key)
+		atomic.AddInt64(&c.bytes, -el.Value.(*lruEntry).bytes)
+	}
+}
+
+// RemovePrefix removes all values having keys beginning with prefix
+func (c *lruCache) RemovePrefix(prefix string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.order.Remove(el)
+			delete(c.items, key)
+			c.index.Delete(key)
+			atomic.AddInt64(&c.bytes, -el.Value.(*lruEntry).bytes)
+		}
+	}
+}
+
+// Purge removes all values
+func (c *lruCache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key := range c.items {
+		c.index.Delete(key)
+	}
+	c.items = make(map[string]*list.Element, c.size)
+	c.order.Init()
+	atomic.StoreInt64(&c.bytes, 0)
+}
+
+// Len returns the number of items in the cache
+func (c *lruCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.items)
+}
+
+// Bytes returns the total size in bytes of all values if sizeOf is set
+func (c *lruCache) Bytes() int {
+	return int(atomic.LoadInt64(&c.bytes))
+}
+
+// Keys returns a snapshot of all keys in the cache from oldest to newest
+func (c *lruCache) Keys() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	keys := make([]string, 0, len(c.items))
+	for el := c.order.Back(); el != nil; el = el.Prev() {
+		keys = append(keys, el.Value.(*lruEntry).key)
+	}
+	return keys
+}
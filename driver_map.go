@@ -0,0 +1,123 @@
+package microcache
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DriverMap is a dependency free driver backed by sync.Map intended for small sites
+// caching a fixed set of pages. Nothing is ever evicted. Once the optional maximum
+// number of entries is reached, new keys are rejected until existing keys are removed.
+type DriverMap struct {
+	RequestCache  *mapCache
+	ResponseCache *mapCache
+}
+
+// NewDriverMap returns a map driver holding at most max request options and max
+// responses. A max of 0 is unbounded.
+func NewDriverMap(max int) DriverMap {
+	return DriverMap{
+		&mapCache{max: max},
+		&mapCache{max: max},
+	}
+}
+
+func (d DriverMap) SetRequestOpts(hash string, req RequestOpts) error {
+	d.RequestCache.set(hash, req)
+	return nil
+}
+
+func (d DriverMap) GetRequestOpts(hash string) (req RequestOpts) {
+	if v, ok := d.RequestCache.items.Load(hash); ok {
+		req = v.(RequestOpts)
+	}
+	return req
+}
+
+func (d DriverMap) Set(hash string, res Response) error {
+	d.ResponseCache.set(hash, res)
+	return nil
+}
+
+func (d DriverMap) Get(hash string) (res Response) {
+	if v, ok := d.ResponseCache.items.Load(hash); ok {
+		res = v.(Response)
+	}
+	return res
+}
+
+func (d DriverMap) Remove(hash string) error {
+	d.ResponseCache.remove(hash)
+	return nil
+}
+
+// RemovePrefix removes all request options and responses having keys beginning with prefix
+func (d DriverMap) RemovePrefix(prefix string) error {
+	d.RequestCache.removePrefix(prefix)
+	d.ResponseCache.removePrefix(prefix)
+	return nil
+}
+
+func (d DriverMap) GetSize() int {
+	return d.ResponseCache.len()
+}
+
+// GetRejected returns the number of new keys rejected because the driver was full
+func (d DriverMap) GetRejected() int {
+	return d.RequestCache.getRejected() + d.ResponseCache.getRejected()
+}
+
+// mapCache is a sync.Map with an entry count. Reads are lock free. Writes are
+// serialized so that the count remains accurate.
+type mapCache struct {
+	items    sync.Map
+	mutex    sync.Mutex
+	count    int
+	max      int
+	rejected int64
+}
+
+func (c *mapCache) set(key string, value interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.items.Load(key); !ok {
+		if c.max > 0 && c.count >= c.max {
+			atomic.AddInt64(&c.rejected, 1)
+			return
+		}
+		c.count++
+	}
+	c.items.Store(key, value)
+}
+
+func (c *mapCache) remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.items.Load(key); ok {
+		c.items.Delete(key)
+		c.count--
+	}
+}
+
+func (c *mapCache) removePrefix(prefix string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.items.Range(func(key, _ interface{}) bool {
+		if strings.HasPrefix(key.(string), prefix) {
+			c.items.Delete(key)
+			c.count--
+		}
+		return true
+	})
+}
+
+func (c *mapCache) len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.count
+}
+
+func (c *mapCache) getRejected() int {
+	return int(atomic.LoadInt64(&c.rejected))
+}
@@ -0,0 +1,450 @@
+package microcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cespare/xxhash"
+)
+
+const (
+	slabBuckets      = 32
+	slabMaxChunkSize = 1 << 20
+	slabMinChunkSize = 4 << 10
+	slabEntryHeader  = 8
+)
+
+// DriverSlab is a driver storing serialized request options and responses in large
+// preallocated byte slabs in the style of bigcache and freecache. The index maps
+// contain no pointers so the garbage collector never scans cached objects, which
+// keeps GC pauses flat for very large in-memory caches.
+//
+// Slabs are written as ring buffers so the oldest entries are evicted first (FIFO).
+// Removed and replaced entries occupy space until overwritten. Entries larger than
+// 1/128 of the slab size (at most 1 MiB) are not stored.
+type DriverSlab struct {
+	RequestCache  *slabCache
+	ResponseCache *slabCache
+}
+
+// NewDriverSlab returns a slab driver storing up to size bytes of responses.
+// An additional size/8 bytes are allocated for request options.
+func NewDriverSlab(size int) DriverSlab {
+	return NewDriverSlab2(size/8, size)
+}
+
+// NewDriverSlab2 returns a slab driver with separate sizes in bytes for the request
+// cache and the response cache. Slabs are allocated as they are first written.
+func NewDriverSlab2(reqSize, resSize int) DriverSlab {
+	return DriverSlab{
+		newSlabCache(reqSize),
+		newSlabCache(resSize),
+	}
+}
+
+func (d DriverSlab) SetRequestOpts(hash string, req RequestOpts) error {
+	b := encodeRequestOpts(getBody(), req)
+	d.RequestCache.set(hash, b)
+	putBody(b)
+	return nil
+}
+
+func (d DriverSlab) GetRequestOpts(hash string) (req RequestOpts) {
+	if b, ok := d.RequestCache.get(hash); ok {
+		req, _ = decodeRequestOpts(b)
+	}
+	return req
+}
+
+func (d DriverSlab) Set(hash string, res Response) error {
+	b := encodeSlabResponse(getBody(), res)
+	d.ResponseCache.set(hash, b)
+	putBody(b)
+	return nil
+}
+
+func (d DriverSlab) Get(hash string) (res Response) {
+	if b, ok := d.ResponseCache.get(hash); ok {
+		res, _ = decodeSlabResponse(b)
+	}
+	return res
+}
+
+func (d DriverSlab) Remove(hash string) error {
+	d.ResponseCache.remove(hash)
+	return nil
+}
+
+// RemovePrefix removes all request options and responses having keys beginning with prefix
+func (d DriverSlab) RemovePrefix(prefix string) error {
+	d.RequestCache.removePrefix(prefix)
+	d.ResponseCache.removePrefix(prefix)
+	return nil
+}
+
+func (d DriverSlab) GetSize() int {
+	return d.ResponseCache.len()
+}
+
+// GetSizeBytes returns the size in bytes of live serialized responses
+func (d DriverSlab) GetSizeBytes() int {
+	return d.ResponseCache.sizeBytes()
+}
+
+// GetRejected returns the number of writes rejected for exceeding the maximum entry size
+func (d DriverSlab) GetRejected() int {
+	return d.RequestCache.getRejected() + d.ResponseCache.getRejected()
+}
+
+// slabCache is a sharded byte slab cache
+type slabCache struct {
+	buckets  [slabBuckets]slabBucket
+	rejected int64
+}
+
+func newSlabCache(size int) *slabCache {
+	bucketSize := size / slabBuckets
+	chunkSize := bucketSize / 4
+	if chunkSize > slabMaxChunkSize {
+		chunkSize = slabMaxChunkSize
+	}
+	if chunkSize < slabMinChunkSize {
+		chunkSize = slabMinChunkSize
+	}
+	chunks := bucketSize / chunkSize
+	if chunks < 2 {
+		chunks = 2
+	}
+	c := &slabCache{}
+	for i := range c.buckets {
+		c.buckets[i] = slabBucket{
+			chunks:    make([][]byte, chunks),
+			chunkSize: chunkSize,
+			index:     make(map[uint64]int),
+		}
+	}
+	return c
+}
+
+func (c *slabCache) bucket(key string) (*slabBucket, uint64) {
+	h := xxhash.Sum64String(key)
+	return &c.buckets[h%slabBuckets], h
+}
+
+func (c *slabCache) set(key string, value []byte) {
+	b, h := c.bucket(key)
+	if !b.set(h, key, value) {
+		atomic.AddInt64(&c.rejected, 1)
+	}
+}
+
+func (c *slabCache) get(key string) ([]byte, bool) {
+	b, h := c.bucket(key)
+	return b.get(h, key)
+}
+
+func (c *slabCache) remove(key string) {
+	b, h := c.bucket(key)
+	b.remove(h, key)
+}
+
+func (c *slabCache) removePrefix(prefix string) {
+	for i := range c.buckets {
+		c.buckets[i].removePrefix(prefix)
+	}
+}
+
+func (c *slabCache) len() (n int) {
+	for i := range c.buckets {
+		b := &c.buckets[i]
+		b.mutex.Lock()
+		n += len(b.index)
+		b.mutex.Unlock()
+	}
+	return n
+}
+
+func (c *slabCache) sizeBytes() (n int) {
+	for i := range c.buckets {
+		b := &c.buckets[i]
+		b.mutex.Lock()
+		n += b.bytes
+		b.mutex.Unlock()
+	}
+	return n
+}
+
+func (c *slabCache) getRejected() int {
+	return int(atomic.LoadInt64(&c.rejected))
+}
+
+// slabBucket is a ring of fixed size chunks. Each entry is written as a 4 byte key
+// length, a 4 byte value length, the key and the value. Entries never span chunks.
+// The index maps key hashes to entry offsets and only holds live entries since
+// entries are removed from the index before their chunk is overwritten.
+type slabBucket struct {
+	mutex     sync.Mutex
+	chunks    [][]byte
+	chunkSize int
+	index     map[uint64]int
+	offset    int
+	bytes     int
+}
+
+func (b *slabBucket) set(h uint64, key string, value []byte) bool {
+	size := slabEntryHeader + len(key) + len(value)
+	if size > b.chunkSize {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	chunk := b.offset / b.chunkSize
+	if b.offset%b.chunkSize+size > b.chunkSize {
+		chunk = (chunk + 1) % len(b.chunks)
+		b.offset = chunk * b.chunkSize
+		b.evict(chunk)
+	}
+	if b.chunks[chunk] == nil {
+		b.chunks[chunk] = make([]byte, b.chunkSize)
+	}
+	if old, ok := b.index[h]; ok {
+		b.bytes -= b.entrySize(old)
+	}
+	buf := b.chunks[chunk][b.offset%b.chunkSize:]
+	binary.LittleEndian.PutUint32(buf, uint32(len(key)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(value)))
+	copy(buf[slabEntryHeader:], key)
+	copy(buf[slabEntryHeader+len(key):], value)
+	b.index[h] = b.offset
+	b.offset += size
+	b.bytes += size
+	return true
+}
+
+// evict removes all entries in a chunk from the index prior to it being overwritten
+func (b *slabBucket) evict(chunk int) {
+	if b.chunks[chunk] == nil {
+		return
+	}
+	start, end := chunk*b.chunkSize, (chunk+1)*b.chunkSize
+	for h, offset := range b.index {
+		if offset >= start && offset < end {
+			b.bytes -= b.entrySize(offset)
+			delete(b.index, h)
+		}
+	}
+}
+
+// entry returns the key and value of the entry at offset. Neither is copied.
+func (b *slabBucket) entry(offset int) ([]byte, []byte) {
+	buf := b.chunks[offset/b.chunkSize][offset%b.chunkSize:]
+	keyLen := int(binary.LittleEndian.Uint32(buf))
+	valueLen := int(binary.LittleEndian.Uint32(buf[4:]))
+	buf = buf[slabEntryHeader:]
+	return buf[:keyLen], buf[keyLen : keyLen+valueLen]
+}
+
+func (b *slabBucket) entrySize(offset int) int {
+	buf := b.chunks[offset/b.chunkSize][offset%b.chunkSize:]
+	return slabEntryHeader + int(binary.LittleEndian.Uint32(buf)) + int(binary.LittleEndian.Uint32(buf[4:]))
+}
+
+func (b *slabBucket) get(h uint64, key string) ([]byte, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	offset, ok := b.index[h]
+	if !ok {
+		return nil, false
+	}
+	// Keys are compared since distinct keys may share a hash
+	k, value := b.entry(offset)
+	if string(k) != key {
+		return nil, false
+	}
+	return cloneBytes(value), true
+}
+
+func (b *slabBucket) remove(h uint64, key string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	offset, ok := b.index[h]
+	if !ok {
+		return
+	}
+	if k, _ := b.entry(offset); string(k) != key {
+		return
+	}
+	b.bytes -= b.entrySize(offset)
+	delete(b.index, h)
+}
+
+func (b *slabBucket) removePrefix(prefix string) {
+	p := []byte(prefix)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for h, offset := range b.index {
+		if k, _ := b.entry(offset); bytes.HasPrefix(k, p) {
+			b.bytes -= b.entrySize(offset)
+			delete(b.index, h)
+		}
+	}
+}
+
+// encodeRequestOpts appends serialized request options to b
+func encodeRequestOpts(b []byte, req RequestOpts) []byte {
+	b = appendBool(b, req.found)
+	b = appendVarint(b, int64(req.ttl))
+	b = appendVarint(b, int64(req.staleIfError))
+	b = appendBool(b, req.staleRecache)
+	b = appendVarint(b, int64(req.staleWhileRevalidate))
+	b = appendBool(b, req.collapsedForwarding)
+	b = appendVarint(b, int64(req.timeout))
+	b = appendStrings(b, req.vary)
+	b = appendStrings(b, req.varyQuery)
+	b = appendStrings(b, req.varyCookie)
+	b = appendBool(b, req.nocache)
+	b = appendBool(b, req.setCookie)
+	b = appendBool(b, req.immutable)
+	return appendVarint(b, req.version)
+}
+
+// decodeRequestOpts restores request options serialized by encodeRequestOpts
+func decodeRequestOpts(b []byte) (req RequestOpts, err error) {
+	d := decoder{b: b}
+	req.found = d.bool()
+	req.ttl = time.Duration(d.varint())
+	req.staleIfError = time.Duration(d.varint())
+	req.staleRecache = d.bool()
+	req.staleWhileRevalidate = time.Duration(d.varint())
+	req.collapsedForwarding = d.bool()
+	req.timeout = time.Duration(d.varint())
+	req.vary = d.strings()
+	req.varyQuery = d.strings()
+	req.varyCookie = d.strings()
+	req.nocache = d.bool()
+	req.setCookie = d.bool()
+	req.immutable = d.bool()
+	req.version = d.varint()
+	if d.err != nil {
+		return RequestOpts{}, d.err
+	}
+	return req, nil
+}
+
+// encodeSlabResponse appends a serialized response including its metadata to b
+func encodeSlabResponse(b []byte, res Response) []byte {
+	b = appendBool(b, res.found)
+	b = appendTime(b, res.date)
+	b = appendVarint(b, int64(res.age))
+	b = appendTime(b, res.expires)
+	b = appendVarint(b, int64(res.status))
+	b = appendBool(b, res.headerWritten)
+	b = appendBool(b, res.digested)
+	b = appendVarint(b, int64(res.digest))
+	return encodeResponse(b, res)
+}
+
+// decodeSlabResponse restores a response serialized by encodeSlabResponse. The body
+// references b.
+func decodeSlabResponse(b []byte) (Response, error) {
+	d := decoder{b: b}
+	res := Response{
+		found:         d.bool(),
+		date:          d.time(),
+		age:           time.Duration(d.varint()),
+		expires:       d.time(),
+		status:        int(d.varint()),
+		headerWritten: d.bool(),
+		digested:      d.bool(),
+		digest:        uint64(d.varint()),
+	}
+	if d.err != nil {
+		return Response{}, d.err
+	}
+	res, err := decodeResponse(res, d.b)
+	if err != nil {
+		return Response{}, err
+	}
+	return res, nil
+}
+
+func appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutVarint(buf[:], v)]...)
+}
+
+// appendTime appends a time as seconds and nanoseconds so that dates beyond the range
+// of UnixNano (ie. immutableExpires) are preserved. The zero time is preserved.
+func appendTime(b []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return appendBool(b, false)
+	}
+	b = appendBool(b, true)
+	b = appendVarint(b, t.Unix())
+	return appendVarint(b, int64(t.Nanosecond()))
+}
+
+func appendStrings(b []byte, ss []string) []byte {
+	b = appendUvarint(b, uint64(len(ss)))
+	for _, s := range ss {
+		b = appendBytes(b, s)
+	}
+	return b
+}
+
+func (d *decoder) bool() bool {
+	if d.err != nil {
+		return false
+	}
+	if len(d.b) == 0 {
+		d.err = errEncodingInvalid
+		return false
+	}
+	v := d.b[0] == 1
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errEncodingInvalid
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) time() time.Time {
+	if !d.bool() {
+		return time.Time{}
+	}
+	sec := d.varint()
+	nsec := d.varint()
+	return time.Unix(sec, nsec)
+}
+
+func (d *decoder) strings() []string {
+	n := d.uvarint()
+	if d.err != nil || n == 0 {
+		return nil
+	}
+	ss := make([]string, n)
+	for i := range ss {
+		ss[i] = d.string()
+	}
+	return ss
+}
@@ -2,13 +2,16 @@ package microcache
 
 import (
 	"net/http"
+	"reflect"
+	"strconv"
 	"testing"
+	"time"
 )
 
 // Remove should work as expected
 func TestRemove(t *testing.T) {
 	var testDriver = func(name string, d Driver) {
-		cache := New(Config{Driver: d})
+		cache := newMicrocache(Config{Driver: d})
 		defer cache.Stop()
 		handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
 		batchGet(handler, []string{
@@ -20,20 +23,59 @@ func TestRemove(t *testing.T) {
 		r, _ := http.NewRequest("GET", "/", nil)
 		reqHash := getRequestHash(cache, r)
 		reqOpts := buildRequestOpts(cache, Response{}, r)
-		objHash := reqOpts.getObjectHash(reqHash, r)
+		objHash := reqOpts.getObjectHash(cache, reqHash, r)
 		d.Remove(objHash)
 		if d.GetSize() != 0 {
 			t.Fatalf("%s Driver cannot delete items", name)
 		}
 	}
-	testDriver("ARC", NewDriverARC(10))
 	testDriver("LRU", NewDriverLRU(10))
+	testDriver("LFU", NewDriverLFU(10))
+	testDriver("Slab", NewDriverSlab(1<<20))
+	testDriver("Map", NewDriverMap(0))
+}
+
+// Drivers report approximate response size in bytes
+func TestDriverSizeBytes(t *testing.T) {
+	var testDriver = func(name string, d DriverSizeBytes) {
+		d.(Driver).Set("a", Response{body: make([]byte, 1000)})
+		if size := d.GetSizeBytes(); size < 1000 || size > 2000 {
+			t.Fatalf("%s Driver reports inaccurate size %d", name, size)
+		}
+		d.(Driver).Remove("a")
+		if size := d.GetSizeBytes(); size != 0 {
+			t.Fatalf("%s Driver reports inaccurate size %d after remove", name, size)
+		}
+	}
+	testDriver("LRU", NewDriverLRU(10))
+	testDriver("LFU", NewDriverLFU(10))
+	testDriver("Slab", NewDriverSlab(1<<20))
+}
+
+// Request and response caches may have separate capacities
+func TestDriverSeparateSizes(t *testing.T) {
+	var testDriver = func(name string, d Driver) {
+		for _, hash := range []string{"a", "b", "c"} {
+			d.SetRequestOpts(hash, RequestOpts{found: true})
+			d.Set(hash, Response{found: true})
+		}
+		for _, hash := range []string{"a", "b", "c"} {
+			if !d.GetRequestOpts(hash).found {
+				t.Fatalf("%s Driver should retain 3 request options", name)
+			}
+		}
+		if d.GetSize() != 1 {
+			t.Fatalf("%s Driver should retain 1 response", name)
+		}
+	}
+	testDriver("LRU", NewDriverLRU2(3, 1))
+	testDriver("LFU", NewDriverLFU2(3, 1))
 }
 
 // Empty init should not fatal
 func TestEmptyInit(t *testing.T) {
 	var testDriver = func(name string, d Driver) {
-		cache := New(Config{Driver: d})
+		cache := newMicrocache(Config{Driver: d})
 		defer cache.Stop()
 		handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
 		batchGet(handler, []string{
@@ -44,6 +86,190 @@ func TestEmptyInit(t *testing.T) {
 			t.Fatalf("%s Driver should have length 1", name)
 		}
 	}
-	testDriver("ARC", NewDriverARC(0))
 	testDriver("LRU", NewDriverLRU(0))
+	testDriver("LFU", NewDriverLFU(0))
+}
+
+// LFU should evict the least frequently used object
+func TestDriverLFUEviction(t *testing.T) {
+	d := NewDriverLFU(2)
+	d.Set("a", Response{found: true})
+	d.Set("b", Response{found: true})
+	d.Get("a")
+	d.Get("a")
+	d.Get("b")
+	d.Set("c", Response{found: true})
+	if !d.Get("a").found || d.Get("b").found || !d.Get("c").found {
+		t.Fatal("LFU driver evicted the wrong object")
+	}
+	if d.ResponseCache.Hits("a") != 3 {
+		t.Fatal("LFU driver reports inaccurate hit count")
+	}
+}
+
+// LRU driver should evict the least recently read object
+func TestDriverLRUEviction(t *testing.T) {
+	d := NewDriverLRU(2)
+	d.Set("a", Response{found: true})
+	d.Set("b", Response{found: true})
+	d.Get("a")
+	d.Set("c", Response{found: true})
+	if !d.Get("a").found || d.Get("b").found || !d.Get("c").found {
+		t.Fatal("LRU driver evicted the wrong object")
+	}
+	d.Set("a", Response{found: true, status: 201})
+	if d.Get("a").status != 201 || d.GetSize() != 2 {
+		t.Fatal("LRU driver did not replace object")
+	}
+}
+
+// LRU driver reads should not race with concurrent writes of the same key
+func TestDriverLRUConcurrentReads(t *testing.T) {
+	d := NewDriverLRU(4)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			d.Set("hot", Response{found: true, status: 200 + i%2})
+			d.Set(strconv.Itoa(i), Response{found: true})
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if res := d.Get("hot"); res.found && res.status != 200 && res.status != 201 {
+			t.Fatalf("Unexpected status %d", res.status)
+		}
+	}
+	<-done
+}
+
+// RemovePrefix should remove only keys having the prefix
+func TestDriverRemovePrefix(t *testing.T) {
+	var testDriver = func(name string, d Driver) {
+		d.Set("a/1", Response{found: true})
+		d.Set("a/2", Response{found: true})
+		d.Set("b/1", Response{found: true})
+		if err := d.(DriverRemovePrefix).RemovePrefix("a/"); err != nil {
+			t.Fatalf("%s Driver returned error: %v", name, err)
+		}
+		if d.Get("a/1").found || d.Get("a/2").found || !d.Get("b/1").found {
+			t.Fatalf("%s Driver removed the wrong keys", name)
+		}
+	}
+	testDriver("LRU", NewDriverLRU(10))
+	testDriver("LFU", NewDriverLFU(10))
+	testDriver("Slab", NewDriverSlab(1<<20))
+	testDriver("Map", NewDriverMap(0))
+}
+
+// Slab should round trip request options and responses
+func TestDriverSlabEncoding(t *testing.T) {
+	d := NewDriverSlab(1 << 20)
+	req := RequestOpts{
+		found:                true,
+		ttl:                  30 * time.Second,
+		staleIfError:         time.Minute,
+		staleWhileRevalidate: 10 * time.Second,
+		collapsedForwarding:  true,
+		timeout:              time.Second,
+		vary:                 []string{"Accept-Language"},
+		varyQuery:            []string{"page", "q"},
+		varyCookie:           []string{"session"},
+		setCookie:            true,
+		immutable:            true,
+		version:              -1,
+	}
+	d.SetRequestOpts("a", req)
+	if !reflect.DeepEqual(d.GetRequestOpts("a"), req) {
+		t.Fatalf("Slab driver corrupted request options: %+v", d.GetRequestOpts("a"))
+	}
+	now := time.Now()
+	res := Response{
+		found:         true,
+		key:           "key",
+		date:          now,
+		age:           5 * time.Second,
+		expires:       immutableExpires,
+		status:        http.StatusCreated,
+		headerWritten: true,
+		header:        http.Header{"Content-Type": {"text/plain"}, "X-Multi": {"a", "b"}},
+		body:          []byte("body"),
+		digest:        1 << 63,
+		digested:      true,
+	}
+	d.Set("a", res)
+	got := d.Get("a")
+	if !got.date.Equal(now) || !got.expires.Equal(immutableExpires) {
+		t.Fatalf("Slab driver corrupted dates: %v %v", got.date, got.expires)
+	}
+	got.date, got.expires = res.date, res.expires
+	if !reflect.DeepEqual(got, res) {
+		t.Fatalf("Slab driver corrupted response: %+v", got)
+	}
+}
+
+// Slab should evict the oldest entries and reject oversized entries
+func TestDriverSlabEviction(t *testing.T) {
+	d := NewDriverSlab(0)
+	body := make([]byte, 1<<10)
+	for i := 0; i < 1e4; i++ {
+		d.Set(strconv.Itoa(i), Response{found: true, body: body})
+	}
+	if d.Get("0").found {
+		t.Fatal("Slab driver should evict the oldest entries")
+	}
+	if !d.Get("9999").found {
+		t.Fatal("Slab driver should retain the newest entries")
+	}
+	if n := d.GetSize(); n == 0 || n >= 1e4 {
+		t.Fatalf("Slab driver reports inaccurate size %d", n)
+	}
+	d.Set("large", Response{found: true, body: make([]byte, 1<<20)})
+	if d.Get("large").found || d.GetRejected() != 1 {
+		t.Fatal("Slab driver should reject entries larger than a chunk")
+	}
+}
+
+// Map should reject new keys once full
+func TestDriverMapMax(t *testing.T) {
+	d := NewDriverMap(2)
+	d.Set("a", Response{found: true})
+	d.Set("b", Response{found: true})
+	d.Set("c", Response{found: true})
+	d.Set("a", Response{found: true, status: 201})
+	if d.GetSize() != 2 || d.Get("c").found || d.Get("a").status != 201 {
+		t.Fatal("Map driver should retain existing keys and reject new keys when full")
+	}
+	if d.GetRejected() != 1 {
+		t.Fatalf("Map driver should report 1 rejection, got %d", d.GetRejected())
+	}
+	d.Remove("b")
+	d.Remove("b")
+	d.Set("c", Response{found: true})
+	if d.GetSize() != 2 || !d.Get("c").found {
+		t.Fatal("Map driver should accept new keys after removal")
+	}
+}
+
+// LRU driver maintains its size in bytes as objects are replaced, evicted and removed
+func TestDriverLRUSizeBytes(t *testing.T) {
+	d := NewDriverLRU(2)
+	d.Set("a", Response{body: make([]byte, 1000)})
+	d.Set("a", Response{body: make([]byte, 2000)})
+	d.Set("b", Response{body: make([]byte, 3000)})
+	size := d.GetSizeBytes()
+	if size < 5000 || size > 6000 {
+		t.Fatalf("LRU driver reports inaccurate size %d after replace", size)
+	}
+	d.Set("c", Response{body: make([]byte, 100)})
+	if size := d.GetSizeBytes(); size < 3100 || size > 4000 {
+		t.Fatalf("LRU driver reports inaccurate size %d after eviction", size)
+	}
+	d.RemovePrefix("c")
+	if size := d.GetSizeBytes(); size < 3000 || size > 3500 {
+		t.Fatalf("LRU driver reports inaccurate size %d after remove prefix", size)
+	}
+	d.ResponseCache.Purge()
+	if size := d.GetSizeBytes(); size != 0 {
+		t.Fatalf("LRU driver reports inaccurate size %d after purge", size)
+	}
 }
@@ -0,0 +1,64 @@
+// Package microcacheecho adapts microcache to echo middleware.
+//
+//	cache := microcache.MustNew(microcache.Config{ForegroundOnly: true})
+//	e := echo.New()
+//	e.Use(microcacheecho.Middleware(cache))
+//
+// Handlers further down the chain receive the same echo.Context so values set
+// by earlier middleware remain available. Handler errors are passed to the echo
+// HTTPErrorHandler within the cache so error responses are never stored as 200s.
+//
+// Echo recycles contexts once a request completes so the handler chain must never be
+// reached after the request returns. The cache must be created with
+// microcache.Config.ForegroundOnly, which rejects options requiring background work
+// (Timeout, StaleWhileRevalidate, RefreshAhead, HedgeAfter, BackendRetries,
+// VerifySampleRate and WarmKeys). Middleware panics otherwise.
+package microcacheecho
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/kevburnsjr/microcache"
+)
+
+// Middleware returns an echo.MiddlewareFunc caching responses with m
+func Middleware(m microcache.Microcache) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		mw := m.Middleware(handler{next})
+		return func(c echo.Context) error {
+			req, res := c.Request(), c.Response()
+			mw.ServeHTTP(res, req.WithContext(context.WithValue(req.Context(), contextKey{}, c)))
+			c.SetRequest(req)
+			c.SetResponse(res)
+			return nil
+		}
+	}
+}
+
+// contextKey is the request context key of the echo.Context being served
+type contextKey struct{}
+
+// handler calls the next echo handler with the context carried by the request
+// so that the middleware is built once for all requests
+type handler struct {
+	next echo.HandlerFunc
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, ok := r.Context().Value(contextKey{}).(echo.Context)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.SetRequest(r)
+	c.SetResponse(echo.NewResponse(w, c.Echo()))
+	if err := h.next(c); err != nil {
+		c.Error(err)
+	}
+}
+
+// ForegroundOnly implements microcache.ForegroundHandler
+func (handler) ForegroundOnly() {}
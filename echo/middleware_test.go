@@ -0,0 +1,132 @@
+package microcacheecho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/kevburnsjr/microcache"
+)
+
+// Responses are cached and context values are preserved
+func TestMiddleware(t *testing.T) {
+	cache := microcache.MustNew(microcache.Config{
+		ForegroundOnly: true,
+		Nocache:        true,
+		Driver:         microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("tenant", "a")
+			return next(c)
+		}
+	})
+	e.Use(Middleware(cache))
+	e.GET("/:id", func(c echo.Context) error {
+		calls++
+		c.Response().Header().Set("microcache-cache", "1")
+		c.Response().Header().Set("microcache-ttl", "30")
+		return c.String(http.StatusOK, c.Get("tenant").(string)+" "+c.Param("id"))
+	})
+	for _, path := range []string{"/1", "/1", "/2", "/2"} {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != "a "+path[1:] {
+			t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("Expected 2 handler calls, got %d", calls)
+	}
+}
+
+// Handler errors are rendered by the error handler and not cached
+func TestMiddlewareError(t *testing.T) {
+	cache := microcache.MustNew(microcache.Config{
+		ForegroundOnly: true,
+		Nocache:        true,
+		Driver:         microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int
+	e := echo.New()
+	e.Use(Middleware(cache))
+	e.GET("/", func(c echo.Context) error {
+		calls++
+		c.Response().Header().Set("microcache-cache", "1")
+		c.Response().Header().Set("microcache-ttl", "30")
+		return echo.NewHTTPError(http.StatusNotFound)
+	})
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("Unexpected status %d", w.Code)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("Expected 2 handler calls, got %d", calls)
+	}
+}
+
+// Stale responses are revalidated in the foreground, even when requested per response
+func TestMiddlewareStale(t *testing.T) {
+	clock := &testClock{time.Now()}
+	cache := microcache.MustNew(microcache.Config{
+		ForegroundOnly: true,
+		TTL:            30 * time.Second,
+		Clock:          clock,
+		Driver:         microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int
+	e := echo.New()
+	e.Use(Middleware(cache))
+	e.GET("/", func(c echo.Context) error {
+		calls++
+		c.Response().Header().Set("microcache-stale-while-revalidate", "30")
+		return c.String(http.StatusOK, strconv.Itoa(calls))
+	})
+	for _, body := range []string{"1", "1", "2"} {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != http.StatusOK || w.Body.String() != body {
+			t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+		}
+		clock.now = clock.now.Add(20 * time.Second)
+	}
+	if calls != 2 {
+		t.Fatalf("Expected 2 handler calls, got %d", calls)
+	}
+}
+
+// Caches not created with ForegroundOnly are rejected
+func TestMiddlewareForegroundOnly(t *testing.T) {
+	cache := microcache.MustNew(microcache.Config{
+		StaleWhileRevalidate: 30 * time.Second,
+		TTL:                  30 * time.Second,
+		Driver:               microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected panic")
+		}
+	}()
+	Middleware(cache)(func(c echo.Context) error { return nil })
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
@@ -0,0 +1,12 @@
+package microcache
+
+// Encryptor is the interface for response encryptors
+type Encryptor interface {
+
+	// Encrypt encrypts a response prior to being saved in the cache and returns a clone.
+	// The returned body must not share memory with the original.
+	Encrypt(Response) (Response, error)
+
+	// Decrypt decrypts a response (destructively)
+	Decrypt(Response) (Response, error)
+}
@@ -0,0 +1,134 @@
+package microcache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+)
+
+var (
+	errCiphertextInvalid = errors.New("invalid ciphertext")
+	errEncodingInvalid   = errors.New("invalid encoding")
+)
+
+// EncryptorAESGCM is an AES-GCM encryptor
+// The canonical key, headers and body of each response are sealed together so that
+// only expiration metadata is stored in plaintext.
+type EncryptorAESGCM struct {
+	aead cipher.AEAD
+}
+
+// NewEncryptorAESGCM returns an AES-GCM encryptor
+// The key must be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256
+func NewEncryptorAESGCM(key []byte) (EncryptorAESGCM, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return EncryptorAESGCM{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return EncryptorAESGCM{}, err
+	}
+	return EncryptorAESGCM{aead}, nil
+}
+
+func (e EncryptorAESGCM) Encrypt(res Response) (Response, error) {
+	newres := res.clone()
+	plaintext := encodeResponse(getBody(), res)
+	defer putBody(plaintext)
+	nonce := make([]byte, e.aead.NonceSize(), e.aead.NonceSize()+len(plaintext)+e.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return newres, err
+	}
+	newres.body = e.aead.Seal(nonce, nonce, plaintext, nil)
+	newres.key = ""
+	newres.header = nil
+	return newres, nil
+}
+
+func (e EncryptorAESGCM) Decrypt(res Response) (Response, error) {
+	size := e.aead.NonceSize()
+	if len(res.body) < size {
+		return res, errCiphertextInvalid
+	}
+	plaintext, err := e.aead.Open(nil, res.body[:size], res.body[size:], nil)
+	if err != nil {
+		return res, err
+	}
+	return decodeResponse(res, plaintext)
+}
+
+// encodeResponse appends the serialized key, headers and body of a response to b
+func encodeResponse(b []byte, res Response) []byte {
+	b = appendBytes(b, res.key)
+	b = appendUvarint(b, uint64(len(res.header)))
+	for k, vv := range res.header {
+		b = appendBytes(b, k)
+		b = appendUvarint(b, uint64(len(vv)))
+		for _, v := range vv {
+			b = appendBytes(b, v)
+		}
+	}
+	return append(b, res.body...)
+}
+
+// decodeResponse restores the key, headers and body of a response serialized by encodeResponse
+func decodeResponse(res Response, b []byte) (Response, error) {
+	d := decoder{b: b}
+	res.key = d.string()
+	n := d.uvarint()
+	res.header = make(http.Header, n)
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		k := d.string()
+		vv := make([]string, d.uvarint())
+		for j := range vv {
+			vv[j] = d.string()
+		}
+		res.header[k] = vv
+	}
+	res.body = d.b
+	return res, d.err
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendBytes(b []byte, s string) []byte {
+	b = appendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// decoder reads values written by encodeResponse, encodeRequestOpts and encodeSlabResponse
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 || v > uint64(len(d.b)) {
+		d.err = errEncodingInvalid
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
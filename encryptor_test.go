@@ -0,0 +1,102 @@
+package microcache
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+// EncryptorAESGCM
+func TestEncryptorAESGCM(t *testing.T) {
+	e, err := NewEncryptorAESGCM(testEncryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := Response{
+		key:    "/secret",
+		header: http.Header{"Set-Cookie": []string{"a=1", "b=2"}, "Content-Type": []string{"text/plain"}},
+		body:   zipTest,
+	}
+	enRes, err := e.Encrypt(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(enRes.body, []byte("Smith")) || bytes.Contains(enRes.body, []byte("/secret")) ||
+		enRes.key != "" || enRes.header != nil {
+		t.Fatal("Response not encrypted")
+	}
+	deRes, err := e.Decrypt(enRes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deRes.key != res.key || !reflect.DeepEqual(deRes.header, res.header) || !bytes.Equal(deRes.body, res.body) {
+		t.Fatal("Decrypted response does not match")
+	}
+	if res.key != "/secret" || len(res.header) != 2 {
+		t.Fatal("Encrypt modified the original response")
+	}
+}
+
+// Tampered, truncated or foreign ciphertext should produce decryption errors
+func TestEncryptorAESGCMCorrupt(t *testing.T) {
+	e, _ := NewEncryptorAESGCM(testEncryptionKey)
+	other, _ := NewEncryptorAESGCM(testEncryptionKey[:16])
+	enRes, _ := e.Encrypt(Response{body: zipTest})
+	tampered := enRes.clone()
+	tampered.body = append([]byte{}, enRes.body...)
+	tampered.body[len(tampered.body)-1] ^= 1
+	for name, res := range map[string]Response{
+		"tampered":  tampered,
+		"truncated": {body: enRes.body[:4]},
+		"plaintext": {body: zipTest},
+	} {
+		if _, err := e.Decrypt(res); err == nil {
+			t.Fatalf("Decrypt should fail for %s ciphertext", name)
+		}
+	}
+	if _, err := other.Decrypt(enRes); err == nil {
+		t.Fatal("Decrypt should fail with the wrong key")
+	}
+	if _, err := NewEncryptorAESGCM([]byte("short")); err == nil {
+		t.Fatal("Invalid key size should return error")
+	}
+}
+
+// Encrypted and compressed responses are served from cache
+func TestEncryptor(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	e, _ := NewEncryptorAESGCM(testEncryptionKey)
+	driver := NewDriverLRU(10)
+	cache := MustNew(Config{
+		TTL:        30 * time.Second,
+		Encryptor:  e,
+		Compressor: CompressorGzip{},
+		Monitor:    testMonitor,
+		Driver:     driver,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(zipTest)
+	}))
+	batchGet(handler, []string{
+		"/",
+	})
+	w := getResponse(handler, "/")
+	if !bytes.Equal(w.Body.Bytes(), zipTest) || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatal("Encrypted response not served correctly")
+	}
+	if testMonitor.getHits() != 1 || testMonitor.getMisses() != 1 {
+		t.Fatalf("Hits and misses not counted correctly %s", dumpMonitor(testMonitor))
+	}
+	for _, k := range driver.ResponseCache.Keys() {
+		v, _ := driver.ResponseCache.Peek(k)
+		if obj := v.(Response); obj.key != "" || obj.header != nil || bytes.Contains(obj.body, []byte("Smith")) {
+			t.Fatal("Stored response not encrypted")
+		}
+	}
+}
@@ -18,6 +18,9 @@ func main() {
 	//
 	// - Timeout: 3 * time.Second
 	// Requests will be timed out and treated as 503 if they do not return within 35s
+	// Can be altered per request with response header
+	//
+	//     microcache-timeout: 10
 	//
 	// - TTL: 30 * time.Second
 	// Responses which enable cache explicitly will be cached for 30s by default
@@ -70,7 +73,7 @@ func main() {
 	// - Monitor: microcache.MonitorFunc(5 * time.Second, logStats)
 	// LogStats will be called every 5s to log stats about the cache
 	//
-	cache := microcache.New(microcache.Config{
+	cache := microcache.MustNew(microcache.Config{
 		Nocache:              true,
 		Timeout:              3 * time.Second,
 		TTL:                  30 * time.Second,
@@ -84,7 +87,7 @@ func main() {
 		SuppressAgeHeader:    false,
 		Monitor:              microcache.MonitorFunc(5*time.Second, logStats),
 		Driver:               microcache.NewDriverLRU(1e4),
-		Compressor:           microcache.CompressorSnappy{},
+		Compressor:           microcache.CompressorGzip{},
 	})
 	defer cache.Stop()
 
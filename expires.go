@@ -0,0 +1,45 @@
+package microcache
+
+import (
+	"net/http"
+	"time"
+)
+
+// applyExpires applies an upstream Expires header to request options when the
+// response has no Cache-Control header, as an HTTP/1.0 origin would send. The ttl is
+// the difference between Expires and Date (or the current time if Date is absent).
+// Expires values in the past or which cannot be parsed (ie. 0) disable caching.
+func (m *microcache) applyExpires(req *RequestOpts, h http.Header) {
+	if !m.LegacyExpires || len(h["Cache-Control"]) > 0 {
+		return
+	}
+	value := h.Get("Expires")
+	if value == "" {
+		return
+	}
+	expires, err := http.ParseTime(value)
+	if err != nil {
+		req.nocache = true
+		return
+	}
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		date = m.now()
+	}
+	ttl := expires.Sub(date)
+	if ttl < time.Second {
+		req.nocache = true
+		return
+	}
+	req.ttl = m.clampTTL(ttl)
+}
+
+// setLegacyExpires sets an Expires header describing the remaining freshness of obj
+// for HTTP/1.0 clients and proxies which do not understand Cache-Control
+func (m *microcache) setLegacyExpires(w http.ResponseWriter, obj Response) {
+	if !m.LegacyExpires || m.SetClientCacheControl || !downstreamCacheable(obj) {
+		return
+	}
+	_, expires := m.downstreamFreshness(w, obj)
+	w.Header().Set("Expires", expires.UTC().Format(http.TimeFormat))
+}
@@ -0,0 +1,59 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// LegacyExpires obeys upstream Expires and emits Expires relative to the cached object
+func TestLegacyExpires(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	clock := &fakeClock{now: time.Now()}
+	cache := MustNew(Config{
+		TTL:           30 * time.Second,
+		LegacyExpires: true,
+		Clock:         clock,
+		Monitor:       testMonitor,
+		Driver:        NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	start := clock.Now()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", start.UTC().Format(http.TimeFormat))
+		switch r.URL.Path {
+		case "/expired":
+			w.Header().Set("Expires", "0")
+		case "/cache-control":
+			w.Header().Set("Cache-Control", "max-age=60")
+			fallthrough
+		default:
+			w.Header().Set("Expires", start.Add(10*time.Second).UTC().Format(http.TimeFormat))
+		}
+		noopSuccessHandler(w, r)
+	}))
+	w := getResponse(handler, "/")
+	exp := start.Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if v := w.Header()["Expires"]; len(v) != 1 || v[0] != exp {
+		t.Fatalf("Miss Expires not correct %v != %q", v, exp)
+	}
+	clock.add(5 * time.Second)
+	w = getResponse(handler, "/")
+	if w.Header().Get("Expires") != exp || w.Header().Get("Cache-Control") != "" {
+		t.Fatalf("Hit Expires not correct %q != %q", w.Header().Get("Expires"), exp)
+	}
+	clock.add(6 * time.Second)
+	getResponse(handler, "/")
+	getResponse(handler, "/cache-control")
+	clock.add(11 * time.Second)
+	w = getResponse(handler, "/cache-control")
+	exp = clock.Now().Add(19 * time.Second).UTC().Format(http.TimeFormat)
+	if w.Header().Get("Expires") != exp {
+		t.Fatalf("Expires should be ignored with Cache-Control %q != %q", w.Header().Get("Expires"), exp)
+	}
+	getResponse(handler, "/expired")
+	getResponse(handler, "/expired")
+	if testMonitor.getHits() != 2 || testMonitor.getMisses() != 5 {
+		t.Fatalf("Expires not respected %s", dumpMonitor(testMonitor))
+	}
+}
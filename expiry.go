@@ -0,0 +1,142 @@
+package microcache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPurgeExpiredUnsupported is returned by PurgeExpired when ExpiryIndex is not enabled
+var ErrPurgeExpiredUnsupported = errors.New("microcache: PurgeExpired requires ExpiryIndex")
+
+// PurgeExpired removes all objects which have expired and may no longer be served
+// stale. Objects are tracked in one second buckets by expiration as they are stored
+// so that only expired buckets are visited. Requires ExpiryIndex.
+func (m *microcache) PurgeExpired() error {
+	if m.expiryIndex == nil {
+		return ErrPurgeExpiredUnsupported
+	}
+	expired := m.expiryIndex.expire(m.now())
+	for _, objHash := range expired {
+		m.remove(objHash)
+	}
+	m.event(EventPurge, Labels{"scope": "expired"})
+	m.logDebug("microcache purge expired", "objects", len(expired))
+	return nil
+}
+
+// indexExpiry records the time after which a stored object may no longer be served,
+// including any stale-if-error or stale-while-revalidate grace period
+func (m *microcache) indexExpiry(objHash string, expires time.Time, req RequestOpts) {
+	if m.expiryIndex == nil || expires.Equal(immutableExpires) {
+		return
+	}
+	grace := req.staleIfError
+	if req.staleWhileRevalidate > grace {
+		grace = req.staleWhileRevalidate
+	}
+	m.expiryIndex.add(objHash, expires.Add(grace))
+}
+
+// startJanitor periodically purges expired objects if JanitorInterval is set
+func (m *microcache) startJanitor() {
+	if m.JanitorInterval <= 0 || m.janitorDone != nil {
+		return
+	}
+	m.janitorDone = make(chan struct{})
+	go func(done chan struct{}) {
+		ticker := time.NewTicker(m.JanitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.PurgeExpired()
+			case <-done:
+				return
+			}
+		}
+	}(m.janitorDone)
+}
+
+// stopJanitor stops the janitor
+func (m *microcache) stopJanitor() {
+	if m.janitorDone == nil {
+		return
+	}
+	close(m.janitorDone)
+	m.janitorDone = nil
+}
+
+// expiryIndex groups keys into one second buckets by expiration
+type expiryIndex struct {
+	mutex   sync.Mutex
+	cursor  int64
+	buckets map[int64]map[string]struct{}
+	keys    map[string]int64
+}
+
+func newExpiryIndex(now time.Time) *expiryIndex {
+	return &expiryIndex{
+		cursor:  now.Unix(),
+		buckets: map[int64]map[string]struct{}{},
+		keys:    map[string]int64{},
+	}
+}
+
+// add indexes a key by expiration, replacing any previous expiration
+func (x *expiryIndex) add(key string, expires time.Time) {
+	b := expires.Unix()
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if b < x.cursor {
+		b = x.cursor
+	}
+	if prev, ok := x.keys[key]; ok {
+		if prev == b {
+			return
+		}
+		delete(x.buckets[prev], key)
+		if len(x.buckets[prev]) == 0 {
+			delete(x.buckets, prev)
+		}
+	}
+	bucket, ok := x.buckets[b]
+	if !ok {
+		bucket = map[string]struct{}{}
+		x.buckets[b] = bucket
+	}
+	bucket[key] = struct{}{}
+	x.keys[key] = b
+}
+
+// expire removes and returns all keys in buckets preceding the current second.
+// Visits the elapsed buckets or the occupied buckets, whichever is fewer.
+func (x *expiryIndex) expire(now time.Time) []string {
+	end := now.Unix()
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if end <= x.cursor {
+		return nil
+	}
+	var expired []string
+	take := func(b int64) {
+		for key := range x.buckets[b] {
+			expired = append(expired, key)
+			delete(x.keys, key)
+		}
+		delete(x.buckets, b)
+	}
+	if end-x.cursor > int64(len(x.buckets)) {
+		for b := range x.buckets {
+			if b < end {
+				take(b)
+			}
+		}
+	} else {
+		for b := x.cursor; b < end; b++ {
+			take(b)
+		}
+	}
+	x.cursor = end
+	return expired
+}
@@ -0,0 +1,86 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// PurgeExpired removes objects beyond their stale grace period
+func TestPurgeExpired(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	driver := NewDriverLRU(10)
+	cache := MustNew(Config{
+		TTL:          30 * time.Second,
+		StaleIfError: 60 * time.Second,
+		ExpiryIndex:  true,
+		Clock:        clock,
+		Driver:       driver,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/long" {
+			SetTTL(w, 600*time.Second)
+		}
+		noopSuccessHandler(w, r)
+	}))
+	batchGet(handler, []string{"/", "/long"})
+	clock.add(60 * time.Second)
+	cache.PurgeExpired()
+	if driver.GetSize() != 2 {
+		t.Fatalf("Object within stale grace period purged %d", driver.GetSize())
+	}
+	clock.add(31 * time.Second)
+	cache.PurgeExpired()
+	if driver.GetSize() != 1 {
+		t.Fatalf("Expired object not purged %d", driver.GetSize())
+	}
+	cache.offsetIncr(365 * 24 * time.Hour)
+	cache.PurgeExpired()
+	if driver.GetSize() != 0 {
+		t.Fatalf("Expired object not purged %d", driver.GetSize())
+	}
+	if err := MustNew(Config{}).PurgeExpired(); err != ErrPurgeExpiredUnsupported {
+		t.Fatalf("PurgeExpired without index should be unsupported %v", err)
+	}
+}
+
+// Reindexed keys move to their new bucket
+func TestExpiryIndex(t *testing.T) {
+	now := time.Unix(1000, 0)
+	x := newExpiryIndex(now)
+	x.add("a", now.Add(5*time.Second))
+	x.add("b", now.Add(5*time.Second))
+	x.add("a", now.Add(20*time.Second))
+	x.add("c", now.Add(-5*time.Second))
+	if expired := x.expire(now.Add(10 * time.Second)); len(expired) != 2 {
+		t.Fatalf("Expired keys not correct %v", expired)
+	}
+	if expired := x.expire(now.Add(10 * time.Second)); len(expired) != 0 {
+		t.Fatalf("Keys expired twice %v", expired)
+	}
+	if expired := x.expire(now.Add(time.Hour)); len(expired) != 1 || expired[0] != "a" {
+		t.Fatalf("Reindexed key not expired %v", expired)
+	}
+	if len(x.buckets) != 0 || len(x.keys) != 0 {
+		t.Fatal("Index not empty")
+	}
+}
+
+// JanitorInterval purges expired objects in the background
+func TestJanitor(t *testing.T) {
+	driver := NewDriverLRU(10)
+	cache := MustNew(Config{
+		TTL:             30 * time.Second,
+		JanitorInterval: 10 * time.Millisecond,
+		Driver:          driver,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/"})
+	cache.offsetIncr(32 * time.Second)
+	time.Sleep(50 * time.Millisecond)
+	if driver.GetSize() != 0 {
+		t.Fatal("Janitor did not purge expired object")
+	}
+}
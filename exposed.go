@@ -0,0 +1,47 @@
+package microcache
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setExposedHeader adds a header to the response indicating the response state if
+// Exposed is set
+func (m *microcache) setExposedHeader(w http.ResponseWriter, state, reqHash string, obj Response) {
+	if m.Exposed {
+		w.Header().Set(m.ExposedHeaderName, m.exposedValue(state, reqHash, obj))
+	}
+}
+
+// exposedValue formats the value of the exposed header according to ExposedFormat.
+// Age is zero unless a cached object is served.
+func (m *microcache) exposedValue(state, reqHash string, obj Response) string {
+	if m.ExposedFormat == "" {
+		return state
+	}
+	var age int64
+	if obj.found {
+		age = int64((obj.age + m.now().Sub(obj.date)) / time.Second)
+	}
+	return strings.NewReplacer(
+		"{state}", state,
+		"{age}", strconv.FormatInt(age, 10),
+		"{key}", reqHash,
+		"{driver}", driverName(m.Driver),
+	).Replace(m.ExposedFormat)
+}
+
+// driverName returns the type name of a driver (ie. DriverLRU)
+func driverName(d Driver) string {
+	t := reflect.TypeOf(d)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.Name()
+}
@@ -0,0 +1,50 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// ExposedHeaderName and ExposedFormat should customize the exposed header
+func TestExposedFormat(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:               30 * time.Second,
+		Exposed:           true,
+		ExposedHeaderName: "X-Cache",
+		ExposedFormat:     "{state} from edge-1 (age={age}; driver={driver})",
+		Driver:            NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	w := getResponse(handler, "/")
+	if v := w.Header().Get("X-Cache"); v != "MISS from edge-1 (age=0; driver=DriverLRU)" {
+		t.Fatalf("Unexpected exposed header on miss %q", v)
+	}
+	if w.Header().Get("microcache") != "" {
+		t.Fatal("Default exposed header should not be set")
+	}
+	cache.offsetIncr(5 * time.Second)
+	w = getResponse(handler, "/")
+	if v := w.Header().Get("X-Cache"); v != "HIT from edge-1 (age=5; driver=DriverLRU)" {
+		t.Fatalf("Unexpected exposed header on hit %q", v)
+	}
+}
+
+// ExposedFormat {key} should be replaced by the request hash
+func TestExposedFormatKey(t *testing.T) {
+	cache := newMicrocache(Config{
+		TTL:           30 * time.Second,
+		Exposed:       true,
+		ExposedFormat: "{state} {key}",
+		Driver:        NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	r, _ := http.NewRequest("GET", "/", nil)
+	getResponse(handler, "/")
+	w := getResponse(handler, "/")
+	if v := w.Header().Get("microcache"); v != "HIT "+getRequestHash(cache, r) {
+		t.Fatalf("Unexpected exposed header %q", v)
+	}
+}
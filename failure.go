@@ -0,0 +1,80 @@
+package microcache
+
+import (
+	"context"
+	"net/http"
+)
+
+// FailureMode determines how requests are handled when the driver fails to read
+type FailureMode int
+
+const (
+	// FailOpen passes requests through to the backend without caching
+	FailOpen FailureMode = iota
+
+	// FailClosed responds with 503 Service Unavailable
+	FailClosed
+)
+
+// DriverReadErrors is an optional interface implemented by drivers whose reads may
+// fail, such as remote drivers. When implemented, read failures are handled according
+// to Config.FailureMode rather than being treated as cache misses.
+type DriverReadErrors interface {
+
+	// GetRequestOptsErr retrieves request options from the request cache
+	GetRequestOptsErr(string) (RequestOpts, error)
+
+	// GetErr retrieves a response object from the response cache
+	GetErr(string) (Response, error)
+}
+
+// getRequestOpts retrieves request options from the L1 cache if enabled, otherwise
+// from the driver, reporting read errors if supported by the driver. Reads from drivers
+// implementing DriverContext are bound to ctx.
+func (m *microcache) getRequestOpts(ctx context.Context, reqHash string) (req RequestOpts, err error) {
+	if m.l1 != nil {
+		if req, ok := m.l1.get(reqHash, m.now()); ok {
+			return req, nil
+		}
+	}
+	if d, ok := m.Driver.(DriverContext); ok {
+		ctx, cancel := m.driverContext(ctx)
+		req, err = d.GetRequestOptsCtx(ctx, reqHash)
+		cancel()
+	} else if d, ok := m.Driver.(DriverReadErrors); ok {
+		req, err = d.GetRequestOptsErr(reqHash)
+	} else {
+		req = m.Driver.GetRequestOpts(reqHash)
+	}
+	if m.l1 != nil && req.found {
+		m.l1.set(reqHash, req, m.now())
+	}
+	return req, err
+}
+
+// getObject retrieves a response object, reporting read errors if supported by the driver.
+// Reads from drivers implementing DriverContext are bound to ctx.
+func (m *microcache) getObject(ctx context.Context, objHash string) (Response, error) {
+	if d, ok := m.Driver.(DriverContext); ok {
+		ctx, cancel := m.driverContext(ctx)
+		defer cancel()
+		return d.GetCtx(ctx, objHash)
+	}
+	if d, ok := m.Driver.(DriverReadErrors); ok {
+		return d.GetErr(objHash)
+	}
+	return m.Driver.Get(objHash), nil
+}
+
+// handleReadFailure responds to a driver read failure according to the failure mode
+func (m *microcache) handleReadFailure(h http.Handler, w http.ResponseWriter, r *http.Request, op string, err error) {
+	m.driverError(op, err)
+	m.countMiss()
+	if m.FailureMode == FailClosed {
+		m.event(EventDriverReadFailure, Labels{"path": r.URL.Path, "mode": "closed"})
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	m.event(EventDriverReadFailure, Labels{"path": r.URL.Path, "mode": "open"})
+	m.passthrough(h, w, r, RequestOpts{})
+}
@@ -0,0 +1,81 @@
+package microcache
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingDriver is a DriverLRU whose reads fail while failing is set
+type failingDriver struct {
+	DriverLRU
+	failing *int32
+}
+
+func (d failingDriver) GetRequestOptsErr(hash string) (RequestOpts, error) {
+	if atomic.LoadInt32(d.failing) == 1 {
+		return RequestOpts{}, errors.New("unreachable")
+	}
+	return d.GetRequestOpts(hash), nil
+}
+
+func (d failingDriver) GetErr(hash string) (Response, error) {
+	if atomic.LoadInt32(d.failing) == 1 {
+		return Response{}, errors.New("unreachable")
+	}
+	return d.Get(hash), nil
+}
+
+// FailOpen passes requests through to the backend on driver read failure
+func TestFailOpen(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	failing := new(int32)
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Monitor: testMonitor,
+		Driver:  failingDriver{NewDriverLRU(10), failing},
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{
+		"/",
+		"/",
+	})
+	atomic.StoreInt32(failing, 1)
+	w := getResponse(handler, "/")
+	if w.Code != 200 || w.Body.String() != "done\n" {
+		t.Fatalf("FailOpen did not pass request through %d %q", w.Code, w.Body.String())
+	}
+	if testMonitor.getBackends() != 1 || testMonitor.getHits() != 1 || testMonitor.getMisses() != 2 {
+		t.Fatalf("FailOpen not counted correctly %s", dumpMonitor(testMonitor))
+	}
+	if testMonitor.getDriverErrors() != 1 || testMonitor.getEvents(EventDriverReadFailure) != 1 {
+		t.Fatal("Driver read failure not reported")
+	}
+}
+
+// FailClosed responds 503 on driver read failure
+func TestFailClosed(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	failing := new(int32)
+	cache := MustNew(Config{
+		TTL:         30 * time.Second,
+		FailureMode: FailClosed,
+		Monitor:     testMonitor,
+		Driver:      failingDriver{NewDriverLRU(10), failing},
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{
+		"/",
+	})
+	atomic.StoreInt32(failing, 1)
+	if w := getResponse(handler, "/"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("FailClosed did not respond 503 %d", w.Code)
+	}
+	if testMonitor.getBackends() != 1 || testMonitor.getEvents(EventDriverReadFailure) != 1 {
+		t.Fatalf("FailClosed not counted correctly %s", dumpMonitor(testMonitor))
+	}
+}
@@ -0,0 +1,41 @@
+package microcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrFetchStatus is returned by Fetch when a fragment responds with a non-2xx status
+var ErrFetchStatus = errors.New("microcache: fetch failed")
+
+// Fetch performs an internal GET sub-request for path through h, a handler returned
+// by Microcache.Middleware, returning the cached response or invoking the handler on a
+// miss. Fragments are cached, collapsed and served stale independently, each according
+// to its own ttl, enabling edge side include style composition of pages.
+//
+//	mw := cache.Middleware(handler)
+//	nav, err := microcache.Fetch(r.Context(), mw, "/fragments/nav")
+//
+// The response is returned along with an error wrapping ErrFetchStatus if its status
+// is not 2xx. Request headers are not propagated to the sub-request. A handler
+// fetching its own path deadlocks when CollapsedForwarding is enabled.
+func Fetch(ctx context.Context, h http.Handler, path string) (Response, error) {
+	r, err := http.NewRequestWithContext(ctx, "GET", path, nil)
+	if err != nil {
+		return Response{}, err
+	}
+	res := Response{header: http.Header{}}
+	h.ServeHTTP(&res, r)
+	if res.status == 0 {
+		res.status = http.StatusOK
+	}
+	if err := ctx.Err(); err != nil {
+		return res, err
+	}
+	if res.status < 200 || res.status > 299 {
+		return res, fmt.Errorf("%w: %s responded %d", ErrFetchStatus, path, res.status)
+	}
+	return res, nil
+}
@@ -0,0 +1,55 @@
+package microcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Fetch should serve cached fragments independently of the page composing them
+func TestFetch(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:                 30 * time.Second,
+		CollapsedForwarding: true,
+		Driver:              NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var navs int32
+	var handler http.Handler
+	handler = cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nav":
+			n := atomic.AddInt32(&navs, 1)
+			w.Write([]byte("nav" + strconv.Itoa(int(n))))
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.Header().Set("microcache-nocache", "1")
+			nav, err := Fetch(r.Context(), handler, "/nav")
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(append([]byte("page:"), nav.Body()...))
+		}
+	}))
+	for i := 0; i < 3; i++ {
+		if w := getResponse(handler, "/page"); w.Body.String() != "page:nav1" {
+			t.Fatalf("Unexpected composed page %q", w.Body.String())
+		}
+	}
+	res, err := Fetch(context.Background(), handler, "/nav")
+	if err != nil || res.Status() != http.StatusOK || string(res.Body()) != "nav1" {
+		t.Fatalf("Unexpected fragment %d %q %v", res.Status(), res.Body(), err)
+	}
+	if atomic.LoadInt32(&navs) != 1 {
+		t.Fatalf("Expected fragment to be rendered once, got %d", navs)
+	}
+	res, err = Fetch(context.Background(), handler, "/missing")
+	if !errors.Is(err, ErrFetchStatus) || res.Status() != http.StatusNotFound {
+		t.Fatalf("Expected ErrFetchStatus for 404, got %d %v", res.Status(), err)
+	}
+}
@@ -0,0 +1,36 @@
+package microcache
+
+import (
+	"context"
+	"net/http"
+)
+
+type foregroundKey struct{}
+
+// ForegroundHandler is implemented by the handlers of framework adapters which recycle
+// their request contexts once a request completes (ie. gin, echo) and so must never be
+// called after the request returns. Middleware panics if passed a ForegroundHandler
+// unless the cache was created with Config.ForegroundOnly, so that options requiring
+// background work are rejected by New rather than silently ignored.
+type ForegroundHandler interface {
+	http.Handler
+
+	// ForegroundOnly marks the handler. It is never called.
+	ForegroundOnly()
+}
+
+// ForegroundOnly returns a shallow copy of r which the cache serves without any work
+// outliving the request. Caches created with Config.ForegroundOnly mark every request.
+//
+// Stale objects are revalidated in the foreground rather than served while revalidating,
+// and refresh ahead, hedging, verification, warming, retries and backend timeouts are
+// not applied to the request. StaleIfError still applies.
+func ForegroundOnly(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), foregroundKey{}, true))
+}
+
+// foregroundOnly reports whether r was marked with ForegroundOnly
+func foregroundOnly(r *http.Request) bool {
+	v, _ := r.Context().Value(foregroundKey{}).(bool)
+	return v
+}
@@ -0,0 +1,122 @@
+package microcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Stale objects are revalidated in the foreground for ForegroundOnly requests
+func TestForegroundOnly(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := newMicrocache(Config{
+		TTL:                  30 * time.Second,
+		StaleWhileRevalidate: 30 * time.Second,
+		RefreshAhead:         10 * time.Second,
+		HedgeAfter:           time.Millisecond,
+		StaleIfError:         30 * time.Second,
+		Monitor:              testMonitor,
+		Driver:               NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(strconv.Itoa(calls)))
+	}))
+	get := func() string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, ForegroundOnly(httptest.NewRequest("GET", "/", nil)))
+		return w.Body.String()
+	}
+	for i, c := range []struct {
+		offset time.Duration
+		body   string
+	}{
+		{0, "1"},
+		{25 * time.Second, "1"},
+		{10 * time.Second, "2"},
+		{0, "2"},
+	} {
+		cache.offsetIncr(c.offset)
+		if body := get(); body != c.body {
+			t.Fatalf("Case %d: expected %q, got %q", i, c.body, body)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if calls != 2 || testMonitor.getStales() != 0 || testMonitor.getEvents(EventRevalidate) != 0 {
+		t.Fatalf("Expected 2 foreground calls, got %d calls, %d stales, %d revalidations",
+			calls, testMonitor.getStales(), testMonitor.getEvents(EventRevalidate))
+	}
+}
+
+// Backend timeouts are not applied to ForegroundOnly requests
+func TestForegroundOnlyTimeout(t *testing.T) {
+	cache := MustNew(Config{
+		Timeout: 10 * time.Millisecond,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		noopSuccessHandler(w, r)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, ForegroundOnly(httptest.NewRequest("GET", "/", nil)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+}
+
+type testForegroundHandler struct {
+	http.HandlerFunc
+}
+
+func (testForegroundHandler) ForegroundOnly() {}
+
+// ForegroundHandlers require Config.ForegroundOnly which also disables per request
+// stale-while-revalidate
+func TestForegroundHandler(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:    30 * time.Second,
+		Driver: NewDriverLRU(10),
+	})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("Expected panic for ForegroundHandler without ForegroundOnly")
+			}
+		}()
+		cache.Middleware(testForegroundHandler{noopSuccessHandler})
+	}()
+	cache.Stop()
+
+	cache = MustNew(Config{
+		TTL:            30 * time.Second,
+		ForegroundOnly: true,
+		Driver:         NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int
+	handler := cache.Middleware(testForegroundHandler{func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("microcache-stale-while-revalidate", "30")
+		w.Write([]byte(strconv.Itoa(calls)))
+	}})
+	for i, c := range []struct {
+		offset time.Duration
+		body   string
+	}{
+		{0, "1"},
+		{40 * time.Second, "2"},
+	} {
+		cache.offsetIncr(c.offset)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Body.String() != c.body {
+			t.Fatalf("Case %d: expected %q, got %q", i, c.body, w.Body.String())
+		}
+	}
+}
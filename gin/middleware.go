@@ -0,0 +1,57 @@
+// Package microcachegin adapts microcache to gin middleware.
+//
+//	cache := microcache.MustNew(microcache.Config{ForegroundOnly: true})
+//	router := gin.New()
+//	router.Use(microcachegin.Middleware(cache))
+//
+// Handlers further down the chain receive the same *gin.Context so values set
+// by earlier middleware remain available.
+//
+// Gin recycles contexts once a request completes so the handler chain must never be
+// reached after the request returns. The cache must be created with
+// microcache.Config.ForegroundOnly, which rejects options requiring background work
+// (Timeout, StaleWhileRevalidate, RefreshAhead, HedgeAfter, BackendRetries,
+// VerifySampleRate and WarmKeys). Middleware panics otherwise.
+package microcachegin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kevburnsjr/microcache"
+)
+
+// Middleware returns a gin.HandlerFunc caching responses with m
+func Middleware(m microcache.Microcache) gin.HandlerFunc {
+	mw := m.Middleware(handler{})
+	return func(c *gin.Context) {
+		writer := c.Writer
+		r := c.Request.WithContext(context.WithValue(c.Request.Context(), contextKey{}, c))
+		mw.ServeHTTP(writer, r)
+		c.Writer = writer
+		c.Abort()
+	}
+}
+
+// contextKey is the request context key of the *gin.Context being served
+type contextKey struct{}
+
+// handler continues the gin handler chain of the context carried by the request
+// so that the middleware is built once for all requests
+type handler struct{}
+
+func (handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, ok := r.Context().Value(contextKey{}).(*gin.Context)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.Writer = newResponseWriter(w)
+	c.Request = r
+	c.Next()
+}
+
+// ForegroundOnly implements microcache.ForegroundHandler
+func (handler) ForegroundOnly() {}
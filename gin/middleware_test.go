@@ -0,0 +1,132 @@
+package microcachegin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kevburnsjr/microcache"
+)
+
+// Responses are cached and context values are preserved
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := microcache.MustNew(microcache.Config{
+		ForegroundOnly: true,
+		Nocache:        true,
+		Driver:         microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("tenant", "a")
+	})
+	router.Use(Middleware(cache))
+	router.GET("/:id", func(c *gin.Context) {
+		calls++
+		c.Header("microcache-cache", "1")
+		c.Header("microcache-ttl", "30")
+		c.String(http.StatusOK, c.GetString("tenant")+" "+c.Param("id"))
+	})
+	for _, path := range []string{"/1", "/1", "/2", "/2"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != "a "+path[1:] {
+			t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("Expected 2 handler calls, got %d", calls)
+	}
+}
+
+// Error responses are not cached
+func TestMiddlewareError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := microcache.MustNew(microcache.Config{
+		ForegroundOnly: true,
+		Nocache:        true,
+		Driver:         microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int
+	router := gin.New()
+	router.Use(Middleware(cache))
+	router.GET("/", func(c *gin.Context) {
+		calls++
+		c.Header("microcache-cache", "1")
+		c.Header("microcache-ttl", "30")
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("Unexpected status %d", w.Code)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("Expected 2 handler calls, got %d", calls)
+	}
+}
+
+// Stale responses are revalidated in the foreground, even when requested per response
+func TestMiddlewareStale(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := &testClock{time.Now()}
+	cache := microcache.MustNew(microcache.Config{
+		ForegroundOnly: true,
+		TTL:            30 * time.Second,
+		Clock:          clock,
+		Driver:         microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int
+	router := gin.New()
+	router.Use(Middleware(cache))
+	router.GET("/", func(c *gin.Context) {
+		calls++
+		c.Header("microcache-stale-while-revalidate", "30")
+		c.String(http.StatusOK, strconv.Itoa(calls))
+	})
+	for _, body := range []string{"1", "1", "2"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != http.StatusOK || w.Body.String() != body {
+			t.Fatalf("Unexpected response %d %s", w.Code, w.Body.String())
+		}
+		clock.now = clock.now.Add(20 * time.Second)
+	}
+	if calls != 2 {
+		t.Fatalf("Expected 2 handler calls, got %d", calls)
+	}
+}
+
+// Caches not created with ForegroundOnly are rejected
+func TestMiddlewareForegroundOnly(t *testing.T) {
+	cache := microcache.MustNew(microcache.Config{
+		StaleWhileRevalidate: 30 * time.Second,
+		TTL:                  30 * time.Second,
+		Driver:               microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected panic")
+		}
+	}()
+	Middleware(cache)
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
@@ -2,8 +2,4 @@ module github.com/kevburnsjr/microcache
 
 go 1.13
 
-require (
-	github.com/dgraph-io/ristretto v0.0.1
-	github.com/golang/snappy v0.0.1
-	github.com/hashicorp/golang-lru v0.5.3
-)
+require github.com/cespare/xxhash v1.1.0
@@ -0,0 +1,17 @@
+module github.com/kevburnsjr/microcache/grpc
+
+go 1.21
+
+require (
+	github.com/kevburnsjr/microcache v1.1.0
+	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.34.1
+)
+
+require (
+	github.com/cespare/xxhash v1.1.0 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
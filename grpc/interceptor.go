@@ -0,0 +1,213 @@
+// Package microcachegrpc applies microcache semantics to unary gRPC responses.
+//
+// Responses are keyed on the full method name and a hash of the request message.
+// Handlers control caching with the same microcache-* keys used for HTTP response
+// headers by setting response metadata.
+//
+//	grpc.SetHeader(ctx, metadata.Pairs("microcache-ttl", "10"))
+//
+// Unary RPC errors are translated to HTTP status codes so that stale-if-error applies
+// to codes.Unavailable, codes.DeadlineExceeded and other server errors. Error details
+// are not preserved.
+//
+// Incoming metadata is presented to the cache as request headers so that Config.Vary
+// and microcache-vary apply. Responses are shared by all callers sending the same
+// message unless they are varied on, so per-user RPCs must vary on authorization.
+//
+//	grpc.SetHeader(ctx, metadata.Pairs("microcache-vary", "authorization"))
+package microcachegrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/kevburnsjr/microcache"
+)
+
+const (
+	typeHeader = "Grpc-Message-Type"
+	codeHeader = "Grpc-Status-Code"
+)
+
+// UnaryServerInterceptor returns a unary server interceptor caching responses with m.
+// Request and response messages must be protocol buffers.
+func UnaryServerInterceptor(m microcache.Microcache) grpc.UnaryServerInterceptor {
+	mw := m.Middleware(unaryHandler{})
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+		b, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			return handler(ctx, req)
+		}
+		sum := sha1.Sum(b)
+		r, err := http.NewRequest("GET", info.FullMethod+"/"+hex.EncodeToString(sum[:]), nil)
+		if err != nil {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for k, vals := range md {
+			// Pseudo headers such as :authority are not metadata
+			if strings.HasPrefix(k, ":") {
+				continue
+			}
+			for _, v := range vals {
+				r.Header.Add(k, v)
+			}
+		}
+		r = r.WithContext(context.WithValue(ctx, callKey{}, unaryCall{req, handler}))
+		w := &responseWriter{header: http.Header{}, code: http.StatusOK}
+		mw.ServeHTTP(w, r)
+		if w.code != http.StatusOK {
+			code := grpcCode(w.code)
+			if c, err := strconv.Atoi(w.header.Get(codeHeader)); err == nil {
+				code = codes.Code(c)
+			}
+			return nil, status.Error(code, w.body.String())
+		}
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(w.header.Get(typeHeader)))
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		res := mt.New().Interface()
+		if err = proto.Unmarshal(w.body.Bytes(), res); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return res, nil
+	}
+}
+
+// callKey is the request context key of the unaryCall being served
+type callKey struct{}
+
+// unaryCall is a unary RPC request message and the handler serving it
+type unaryCall struct {
+	req     interface{}
+	handler grpc.UnaryHandler
+}
+
+// unaryHandler adapts the unary RPC carried by the request context to an http.Handler
+// so that the middleware is built once for all calls
+type unaryHandler struct{}
+
+func (unaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	call, ok := ctx.Value(callKey{}).(unaryCall)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	stream := &captureStream{grpc.ServerTransportStreamFromContext(ctx), w.Header()}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+	res, err := call.handler(ctx, call.req)
+	if err != nil {
+		st := status.Convert(err)
+		w.Header().Set(codeHeader, strconv.Itoa(int(st.Code())))
+		w.WriteHeader(httpStatus(st.Code()))
+		w.Write([]byte(st.Message()))
+		return
+	}
+	msg, ok := res.(proto.Message)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("response is not a protocol buffer"))
+		return
+	}
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set(typeHeader, string(msg.ProtoReflect().Descriptor().FullName()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// responseWriter captures the response rendered by the middleware
+type responseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+// captureStream converts microcache-* response metadata to http response headers.
+// All other metadata is forwarded to the underlying stream.
+type captureStream struct {
+	grpc.ServerTransportStream
+	header http.Header
+}
+
+func (s *captureStream) Method() string {
+	if s.ServerTransportStream == nil {
+		return ""
+	}
+	return s.ServerTransportStream.Method()
+}
+
+func (s *captureStream) SetHeader(md metadata.MD) error {
+	return s.capture(md, func(md metadata.MD) error {
+		return s.ServerTransportStream.SetHeader(md)
+	})
+}
+
+func (s *captureStream) SendHeader(md metadata.MD) error {
+	return s.capture(md, func(md metadata.MD) error {
+		return s.ServerTransportStream.SendHeader(md)
+	})
+}
+
+func (s *captureStream) SetTrailer(md metadata.MD) error {
+	return s.capture(md, func(md metadata.MD) error {
+		return s.ServerTransportStream.SetTrailer(md)
+	})
+}
+
+func (s *captureStream) capture(md metadata.MD, forward func(metadata.MD) error) error {
+	rest := metadata.MD{}
+	for k, vals := range md {
+		if strings.HasPrefix(k, "microcache-") {
+			for _, v := range vals {
+				s.header.Add(k, v)
+			}
+			continue
+		}
+		rest[k] = vals
+	}
+	if len(rest) == 0 || s.ServerTransportStream == nil {
+		return nil
+	}
+	return forward(rest)
+}
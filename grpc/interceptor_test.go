@@ -0,0 +1,89 @@
+package microcachegrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/kevburnsjr/microcache"
+)
+
+// Responses are cached by method and request message
+func TestUnaryServerInterceptor(t *testing.T) {
+	cache := microcache.MustNew(microcache.Config{
+		Nocache: true,
+		Driver:  microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	interceptor := UnaryServerInterceptor(cache)
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Echo"}
+	var calls int
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		grpc.SetHeader(ctx, metadata.Pairs("microcache-cache", "1", "microcache-ttl", "30"))
+		return wrapperspb.String("echo " + req.(*wrapperspb.StringValue).GetValue()), nil
+	}
+	for _, v := range []string{"a", "a", "b", "b"} {
+		res, err := interceptor(context.Background(), wrapperspb.String(v), info, handler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.(*wrapperspb.StringValue).GetValue() != "echo "+v {
+			t.Fatalf("Unexpected response %v", res)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("Responses not cached - got %d calls", calls)
+	}
+}
+
+// Errors are returned with their original status and may serve stale
+func TestUnaryServerInterceptorError(t *testing.T) {
+	cache := microcache.MustNew(microcache.Config{
+		TTL:          30 * time.Second,
+		StaleIfError: 30 * time.Second,
+		Driver:       microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	interceptor := UnaryServerInterceptor(cache)
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Echo"}
+	failing := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	_, err := interceptor(context.Background(), wrapperspb.String("a"), info, failing)
+	if status.Code(err) != codes.NotFound || status.Convert(err).Message() != "not found" {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
+
+// Incoming metadata is varied on like request headers
+func TestUnaryServerInterceptorVary(t *testing.T) {
+	cache := microcache.MustNew(microcache.Config{
+		TTL:    30 * time.Second,
+		Driver: microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	interceptor := UnaryServerInterceptor(cache)
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Whoami"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		grpc.SetHeader(ctx, metadata.Pairs("microcache-vary", "authorization"))
+		md, _ := metadata.FromIncomingContext(ctx)
+		return wrapperspb.String(md.Get("authorization")[0]), nil
+	}
+	for _, user := range []string{"alice", "bob", "alice", "bob"} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", user))
+		res, err := interceptor(ctx, wrapperspb.String("me"), info, handler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.(*wrapperspb.StringValue).GetValue() != user {
+			t.Fatalf("Expected response for %s, got %v", user, res)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package microcache
+
+import (
+	"sync"
+)
+
+// hashBuffer accumulates hash input to avoid per-request hasher allocations
+type hashBuffer struct {
+	b []byte
+}
+
+var hashBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &hashBuffer{make([]byte, 0, 256)}
+	},
+}
+
+func getHashBuffer() *hashBuffer {
+	return hashBufferPool.Get().(*hashBuffer)
+}
+
+func (h *hashBuffer) write(s ...string) {
+	for _, str := range s {
+		h.b = append(h.b, str...)
+	}
+}
+
+// sum returns the hash of the buffer and returns the buffer to the pool
+func (h *hashBuffer) sum(hasher Hasher) Key {
+	sum := hasher.Sum(h.b)
+	h.release()
+	return sum
+}
+
+// release returns the buffer to the pool
+func (h *hashBuffer) release() {
+	h.b = h.b[:0]
+	hashBufferPool.Put(h)
+}
@@ -0,0 +1,84 @@
+package microcache
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+
+	"github.com/cespare/xxhash"
+)
+
+// Hasher is the interface for cache key hash functions
+type Hasher interface {
+
+	// Sum returns a fixed size hash of b used as a cache key
+	Sum(b []byte) Key
+}
+
+// KeySize is the maximum size in bytes of a cache key hash
+const KeySize = sha1.Size
+
+// Key is a fixed size cache key hash. Keys are arrays free of pointers so hashing does
+// not allocate. A Key is converted to a string, prefixed with Config.KeyPrefix, only
+// at the Driver boundary.
+type Key struct {
+	sum  [KeySize]byte
+	size uint8
+}
+
+// NewKey returns a Key holding sum, which is truncated to KeySize bytes.
+// Custom Hashers use NewKey to return their sums.
+func NewKey(sum []byte) Key {
+	var k Key
+	k.size = uint8(copy(k.sum[:], sum))
+	return k
+}
+
+// String returns the hash as a string
+func (k Key) String() string {
+	return string(k.sum[:k.size])
+}
+
+// driverKey returns the Driver key of a hash
+func (m *microcache) driverKey(k Key) string {
+	return m.KeyPrefix + string(k.sum[:k.size])
+}
+
+// HasherSHA1 generates 20 byte SHA-1 cache keys
+// This is the default hasher
+type HasherSHA1 struct{}
+
+func (HasherSHA1) Sum(b []byte) Key {
+	return Key{sha1.Sum(b), sha1.Size}
+}
+
+// HasherXXHash generates 8 byte xxHash cache keys
+// Much faster than SHA-1 but not collision resistant against crafted input.
+// See Config.Hasher for the effect of collisions.
+type HasherXXHash struct{}
+
+func (HasherXXHash) Sum(b []byte) Key {
+	k := Key{size: 8}
+	binary.BigEndian.PutUint64(k.sum[:], xxhash.Sum64(b))
+	return k
+}
+
+// HasherFNV generates 8 byte FNV-1a cache keys
+// Faster than SHA-1 for short keys but not collision resistant against crafted input.
+// See Config.Hasher for the effect of collisions.
+type HasherFNV struct{}
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+func (HasherFNV) Sum(b []byte) Key {
+	var h uint64 = fnvOffset64
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= fnvPrime64
+	}
+	k := Key{size: 8}
+	binary.BigEndian.PutUint64(k.sum[:], h)
+	return k
+}
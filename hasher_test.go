@@ -0,0 +1,144 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Hashers produce fixed size keys which differ by input
+func TestHasherSum(t *testing.T) {
+	hashers := map[Hasher]int{
+		HasherSHA1{}:   20,
+		HasherXXHash{}: 8,
+		HasherFNV{}:    8,
+	}
+	for hasher, size := range hashers {
+		a := hasher.Sum([]byte("/a"))
+		b := hasher.Sum([]byte("/b"))
+		if len(a.String()) != size || len(b.String()) != size {
+			t.Fatalf("%T produced keys of length %d and %d, expected %d", hasher, len(a.String()), len(b.String()), size)
+		}
+		if a == b {
+			t.Fatalf("%T produced identical keys for different input", hasher)
+		}
+		if a != hasher.Sum([]byte("/a")) {
+			t.Fatalf("%T is not deterministic", hasher)
+		}
+	}
+}
+
+// customHasher returns the input as the key, truncated to KeySize
+type customHasher struct{}
+
+func (customHasher) Sum(b []byte) Key {
+	return NewKey(b)
+}
+
+// Custom hashers return keys built by NewKey
+func TestNewKey(t *testing.T) {
+	if k := NewKey([]byte("abc")); k.String() != "abc" {
+		t.Fatalf("Unexpected key %q", k.String())
+	}
+	long := []byte("0123456789012345678901234567890123456789")
+	if k := NewKey(long); k.String() != string(long[:KeySize]) {
+		t.Fatalf("Key should be truncated to KeySize, got %q", k.String())
+	}
+	cache := MustNew(Config{
+		TTL:       30 * time.Second,
+		KeyPrefix: "p:",
+		Hasher:    customHasher{},
+		Exposed:   true,
+		Driver:    NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/a"})
+	if w := getResponse(handler, "/a"); w.Header().Get("microcache") != "HIT" {
+		t.Fatal("Custom hasher should cache")
+	}
+}
+
+// Alternate hashers cache and vary as expected
+func TestHasher(t *testing.T) {
+	for _, hasher := range []Hasher{HasherXXHash{}, HasherFNV{}} {
+		testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+		cache := MustNew(Config{
+			TTL:     30 * time.Second,
+			Vary:    []string{"foo"},
+			Hasher:  hasher,
+			Monitor: testMonitor,
+			Driver:  NewDriverLRU(10),
+		})
+		handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+		batchGet(handler, []string{
+			"/",
+			"/",
+			"/a",
+		})
+		getResponseWithHeader(handler, "/", http.Header{"Foo": []string{"bar"}})
+		if testMonitor.getMisses() != 3 || testMonitor.getHits() != 1 {
+			t.Logf("%T: Hits and misses not counted correctly", hasher)
+			dumpMonitor(testMonitor)
+			t.Fail()
+		}
+		cache.Stop()
+	}
+}
+
+func BenchmarkHitsXXHash(b *testing.B) {
+	benchmarkHitsHasher(b, HasherXXHash{})
+}
+
+func BenchmarkHitsFNV(b *testing.B) {
+	benchmarkHitsHasher(b, HasherFNV{})
+}
+
+func benchmarkHitsHasher(b *testing.B, hasher Hasher) {
+	cache := MustNew(Config{
+		TTL:    30 * time.Second,
+		Hasher: hasher,
+		Driver: NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(successHandler))
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := &noopWriter{http.Header{}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// constantHasher hashes every key to the same value
+type constantHasher struct{}
+
+func (constantHasher) Sum([]byte) Key {
+	return NewKey([]byte("collision"))
+}
+
+// Hash collisions never serve the wrong resource
+func TestHashCollision(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Hasher:  constantHasher{},
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	for _, path := range []string{"/a", "/b", "/b", "/a"} {
+		if w := getResponse(handler, path); w.Body.String() != path {
+			t.Fatalf("Collision served %q for %q", w.Body.String(), path)
+		}
+	}
+	if testMonitor.getHits() != 1 || testMonitor.getMisses() != 3 {
+		t.Fatalf("Hits and misses not counted correctly %s", dumpMonitor(testMonitor))
+	}
+	if testMonitor.getEvents(EventCollision) != 2 {
+		t.Fatalf("Collisions not reported %d", testMonitor.getEvents(EventCollision))
+	}
+}
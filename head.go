@@ -0,0 +1,37 @@
+package microcache
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// HEAD and GET requests share cached objects. HEAD requests requiring a backend
+// response are sent to the backend as GET requests so that the captured body may
+// populate the shared object. Cached bodies are never sent in response to HEAD.
+
+// headAsGet returns a shallow copy of a HEAD request converted to GET
+func headAsGet(r *http.Request) *http.Request {
+	gr := r.WithContext(r.Context())
+	gr.Method = "GET"
+	return gr
+}
+
+// sendHead sends the response header with the Content-Length of the cached body
+func (res *Response) sendHead(w http.ResponseWriter) {
+	status := res.status
+	if !res.headerWritten {
+		status = http.StatusOK
+	}
+	h := w.Header()
+	_, cached := res.header["Content-Length"]
+	_, set := h["Content-Length"]
+	if !cached && !set && bodyAllowed(status) {
+		h["Content-Length"] = []string{strconv.Itoa(len(res.body))}
+	}
+	res.sendHeader(w)
+}
+
+// bodyAllowed reports whether a response with the given status may include a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,49 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// HEAD and GET requests share a cached object populated by either method
+func TestHead(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var methods []string
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		// Like http.ServeContent, the body is omitted for HEAD
+		if r.Method != "HEAD" {
+			w.Write([]byte("body"))
+		}
+	}))
+	w := getResponseWithMethod(handler, "/", "HEAD")
+	if w.Body.Len() != 0 || w.Header().Get("Content-Length") != "4" {
+		t.Fatalf("HEAD miss not correct %q %q", w.Body.String(), w.Header().Get("Content-Length"))
+	}
+	w = getResponse(handler, "/")
+	if w.Body.String() != "body" {
+		t.Fatalf("GET hit not populated by HEAD %q", w.Body.String())
+	}
+	w = getResponseWithMethod(handler, "/", "HEAD")
+	if w.Body.Len() != 0 || w.Header().Get("Content-Length") != "4" {
+		t.Fatalf("HEAD hit not correct %q %q", w.Body.String(), w.Header().Get("Content-Length"))
+	}
+	getResponse(handler, "/get")
+	w = getResponseWithMethod(handler, "/get", "HEAD")
+	if w.Body.Len() != 0 || w.Header().Get("Content-Length") != "4" {
+		t.Fatalf("HEAD hit populated by GET not correct %q", w.Body.String())
+	}
+	if len(methods) != 2 || methods[0] != "GET" || methods[1] != "GET" {
+		t.Fatalf("Backend requests not correct %v", methods)
+	}
+	if testMonitor.getHits() != 3 || testMonitor.getMisses() != 2 {
+		t.Fatalf("HEAD not cached %s", dumpMonitor(testMonitor))
+	}
+}
@@ -0,0 +1,152 @@
+package microcache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeaderOptions are the cache options set by microcache-* response headers.
+// Zero values indicate that a header was absent or invalid.
+type HeaderOptions struct {
+	Cache                 bool          // microcache-cache
+	Nocache               bool          // microcache-nocache
+	TTL                   time.Duration // microcache-ttl
+	StaleIfError          time.Duration // microcache-stale-if-error
+	StaleWhileRevalidate  time.Duration // microcache-stale-while-revalidate
+	Timeout               time.Duration // microcache-timeout
+	CollapsedForwarding   bool          // microcache-collapsed-forwarding
+	NoCollapsedForwarding bool          // microcache-no-collapsed-forwarding
+	StaleRecache          bool          // microcache-stale-recache
+	NoStaleRecache        bool          // microcache-no-stale-recache
+	Vary                  []string      // microcache-vary (canonical header names)
+	VaryQuery             []string      // microcache-vary-query
+	VaryCookie            []string      // microcache-vary-cookie
+	SetCookie             bool          // microcache-set-cookie
+}
+
+// HeaderError is an invalid microcache-* header value
+type HeaderError struct {
+	Header string
+	Value  string
+	Err    error
+}
+
+func (e HeaderError) Error() string {
+	return fmt.Sprintf("invalid %s header %q: %v", e.Header, e.Value, e.Err)
+}
+
+// HeaderErrors lists every invalid header found by ParseHeaders
+type HeaderErrors []HeaderError
+
+func (e HeaderErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+var durationHeaders = []string{
+	"microcache-ttl",
+	"microcache-stale-if-error",
+	"microcache-stale-while-revalidate",
+	"microcache-timeout",
+}
+
+// ParseHeaders parses microcache-* response headers.
+// Invalid values are ignored and returned as HeaderErrors alongside the valid options.
+func ParseHeaders(header http.Header) (HeaderOptions, error) {
+	var opts HeaderOptions
+	var errs HeaderErrors
+	durations := []*time.Duration{&opts.TTL, &opts.StaleIfError, &opts.StaleWhileRevalidate, &opts.Timeout}
+	for i, name := range durationHeaders {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		d, err := ParseDuration(value)
+		if err != nil {
+			errs = append(errs, HeaderError{name, value, err})
+			continue
+		}
+		*durations[i] = d
+	}
+	opts.Cache = header.Get("microcache-cache") != ""
+	opts.Nocache = header.Get("microcache-nocache") != ""
+	opts.CollapsedForwarding = header.Get("microcache-collapsed-forwarding") != ""
+	opts.NoCollapsedForwarding = header.Get("microcache-no-collapsed-forwarding") != ""
+	opts.StaleRecache = header.Get("microcache-stale-recache") != ""
+	opts.NoStaleRecache = header.Get("microcache-no-stale-recache") != ""
+	opts.SetCookie = header.Get("microcache-set-cookie") != ""
+	for _, hdr := range header["Microcache-Vary"] {
+		opts.Vary = appendVary(opts.Vary, strings.Split(hdr, ",")...)
+	}
+	for _, hdr := range header["Microcache-Vary-Query"] {
+		for _, param := range strings.Split(hdr, ",") {
+			if param = strings.TrimSpace(param); param != "" {
+				opts.VaryQuery = append(opts.VaryQuery, param)
+			}
+		}
+	}
+	for _, hdr := range header["Microcache-Vary-Cookie"] {
+		for _, name := range strings.Split(hdr, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				opts.VaryCookie = append(opts.VaryCookie, name)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return opts, errs
+	}
+	return opts, nil
+}
+
+// ParseDuration parses a duration header value.
+// Integers are seconds. Go duration strings (ie. 500ms, 1m30s) are also accepted.
+// Surrounding whitespace is ignored. Negative and out of range values are errors.
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errors.New("empty duration")
+	}
+	var d time.Duration
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if n > math.MaxInt64/int64(time.Second) || n < 0 {
+			return 0, errors.New("duration out of range")
+		}
+		d = time.Duration(n) * time.Second
+	} else if d, err = time.ParseDuration(value); err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("negative duration")
+	}
+	return d, nil
+}
+
+// SetTTL sets the ttl of a response (microcache-ttl)
+// Sub-second durations are supported.
+func SetTTL(w http.ResponseWriter, ttl time.Duration) {
+	w.Header().Set("microcache-ttl", ttl.String())
+}
+
+// SetStaleIfError sets the stale-if-error period of a response (microcache-stale-if-error)
+func SetStaleIfError(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("microcache-stale-if-error", d.String())
+}
+
+// SetStaleWhileRevalidate sets the stale-while-revalidate period of a response
+// (microcache-stale-while-revalidate)
+func SetStaleWhileRevalidate(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("microcache-stale-while-revalidate", d.String())
+}
+
+// SetTimeout sets the backend timeout of subsequent requests (microcache-timeout)
+func SetTimeout(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("microcache-timeout", d.String())
+}
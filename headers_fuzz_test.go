@@ -0,0 +1,50 @@
+//go:build go1.18
+// +build go1.18
+
+package microcache
+
+import (
+	"net/http"
+	"testing"
+)
+
+func FuzzParseDuration(f *testing.F) {
+	for _, seed := range []string{"10", "500ms", "1m30s", "-1", "soon", "", "9223372036854775807"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		d, err := ParseDuration(value)
+		if err != nil && d != 0 {
+			t.Fatalf("%q: non-zero duration %v returned with error", value, d)
+		}
+		if d < 0 {
+			t.Fatalf("%q: negative duration %v", value, d)
+		}
+	})
+}
+
+func FuzzParseHeaders(f *testing.F) {
+	f.Add("10", "1s", "q, page", "accept-language")
+	f.Add("-1", "soon", ",,", " , ")
+	f.Fuzz(func(t *testing.T, ttl, timeout, varyQuery, vary string) {
+		header := http.Header{}
+		header.Set("microcache-ttl", ttl)
+		header.Set("microcache-timeout", timeout)
+		header.Set("microcache-vary-query", varyQuery)
+		header.Set("microcache-vary", vary)
+		opts, _ := ParseHeaders(header)
+		if opts.TTL < 0 || opts.Timeout < 0 {
+			t.Fatalf("negative duration parsed from %q, %q", ttl, timeout)
+		}
+		for _, param := range opts.VaryQuery {
+			if param == "" {
+				t.Fatalf("empty vary query param parsed from %q", varyQuery)
+			}
+		}
+		for _, name := range opts.Vary {
+			if name == "" {
+				t.Fatalf("empty vary header parsed from %q", vary)
+			}
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package microcache
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	for i, c := range []struct {
+		value string
+		exp   time.Duration
+		err   bool
+	}{
+		{"10", 10 * time.Second, false},
+		{" 10 ", 10 * time.Second, false},
+		{"0", 0, false},
+		{"500ms", 500 * time.Millisecond, false},
+		{"1m30s", 90 * time.Second, false},
+		{"", 0, true},
+		{"soon", 0, true},
+		{"-1", 0, true},
+		{"-1s", 0, true},
+		{"1.5", 0, true},
+		{"9223372036854775807", 0, true},
+		{"99999999999999999999", 0, true},
+		{"10s;", 0, true},
+	} {
+		d, err := ParseDuration(c.value)
+		if d != c.exp || (err != nil) != c.err {
+			t.Fatalf("Case %d %q: got %v, %v", i+1, c.value, d, err)
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("microcache-ttl", "30")
+	header.Set("microcache-stale-if-error", "forever")
+	header.Set("microcache-timeout", "-5s")
+	header.Set("microcache-nocache", "1")
+	header.Add("microcache-vary", "accept-language, ")
+	header.Add("microcache-vary-query", "q, ,page")
+	header.Add("microcache-vary-cookie", "lang")
+	opts, err := ParseHeaders(header)
+	exp := HeaderOptions{
+		TTL:        30 * time.Second,
+		Nocache:    true,
+		Vary:       []string{"Accept-Language"},
+		VaryQuery:  []string{"q", "page"},
+		VaryCookie: []string{"lang"},
+	}
+	if !reflect.DeepEqual(opts, exp) {
+		t.Fatalf("Mismatch\n%#v\n%#v", opts, exp)
+	}
+	errs, ok := err.(HeaderErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Expected 2 header errors, got %v", err)
+	}
+	if errs[0].Header != "microcache-stale-if-error" || errs[1].Header != "microcache-timeout" {
+		t.Fatalf("Unexpected header errors %v", err)
+	}
+	if _, err := ParseHeaders(http.Header{}); err != nil {
+		t.Fatalf("Empty headers should not produce an error, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package microcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const healthProbeKey = "microcache-health-probe"
+
+var healthProbeBody = bytes.Repeat([]byte("microcache health probe "), 16)
+
+// healthStatus is the JSON body rendered by HealthHandler
+type healthStatus struct {
+	Status     string `json:"status"`
+	Driver     string `json:"driver"`
+	Compressor string `json:"compressor"`
+	Monitor    string `json:"monitor"`
+}
+
+// HealthHandler returns an http.Handler suitable for load balancer health checks of
+// the caching layer. It verifies that the driver round-trips a probe object, that the
+// compressor round-trips a payload and that the monitor is still logging. Responds
+// 200 OK or 503 Service Unavailable with JSON details.
+//
+//	{"status":"ok","driver":"ok","compressor":"ok","monitor":"disabled"}
+func (m *microcache) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := healthStatus{
+			Status:     "ok",
+			Driver:     healthResult(m.checkDriver()),
+			Compressor: "disabled",
+			Monitor:    "disabled",
+		}
+		if m.Compressor != nil {
+			status.Compressor = healthResult(m.checkCompressor())
+		}
+		if m.Monitor != nil {
+			status.Monitor = healthResult(m.checkMonitor())
+		}
+		code := http.StatusOK
+		for _, res := range []string{status.Driver, status.Compressor, status.Monitor} {
+			if res != "ok" && res != "disabled" {
+				status.Status = "error"
+				code = http.StatusServiceUnavailable
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+func healthResult(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+// probeKey returns the driver key of the health probe object. Keys are prefixed with
+// KeyPrefix and unique per instance so that instances sharing a remote driver do not
+// remove each other's probe objects.
+func (m *microcache) probeKey() string {
+	return m.KeyPrefix + healthProbeKey + ":" + m.instanceID
+}
+
+// checkDriver stores, retrieves and removes a probe object.
+// Retrieval is retried briefly to accommodate drivers with buffered writes.
+func (m *microcache) checkDriver() error {
+	key := m.probeKey()
+	if err := m.driverSet(key, Response{found: true, body: healthProbeBody}); err != nil {
+		return err
+	}
+	defer m.driverRemove(key)
+	for i := 0; i < 10; i++ {
+		res, err := m.getObject(context.Background(), key)
+		if err != nil {
+			return err
+		}
+		if res.found {
+			if !bytes.Equal(res.body, healthProbeBody) {
+				return errors.New("probe object corrupted")
+			}
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return errors.New("probe object not found")
+}
+
+// checkCompressor compresses and expands a probe payload
+func (m *microcache) checkCompressor() error {
+	res, err := m.Compressor.Compress(Response{header: http.Header{}, body: healthProbeBody})
+	if err != nil {
+		return err
+	}
+	res, err = m.Compressor.Expand(res)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(res.body, healthProbeBody) {
+		return errors.New("probe payload corrupted")
+	}
+	return nil
+}
+
+// setMonitorLast records the time at which the monitor last logged
+func (m *microcache) setMonitorLast() {
+	m.monitorMutex.Lock()
+	m.monitorLast = time.Now()
+	m.monitorMutex.Unlock()
+}
+
+// checkMonitor verifies that the monitor has logged within two intervals
+func (m *microcache) checkMonitor() error {
+	m.monitorMutex.RLock()
+	last := m.monitorLast
+	m.monitorMutex.RUnlock()
+	if last.IsZero() {
+		return errors.New("not started")
+	}
+	if time.Since(last) > 2*m.Monitor.GetInterval() {
+		return errors.New("not logging")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package microcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bufferedDriver is a DriverLRU whose writes are applied asynchronously
+type bufferedDriver struct {
+	DriverLRU
+}
+
+func (d bufferedDriver) Set(hash string, res Response) error {
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		d.DriverLRU.Set(hash, res)
+	}()
+	return nil
+}
+
+// Health handler verifies driver, compressor and monitor
+func TestHealthHandler(t *testing.T) {
+	check := func(cache *microcache) (int, healthStatus) {
+		r := getResponse(cache.HealthHandler(), "/health")
+		var status healthStatus
+		if err := json.Unmarshal(r.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		return r.Code, status
+	}
+
+	testMonitor := &monitorFunc{interval: 10 * time.Millisecond, logFunc: func(Stats) {}}
+	cache := newMicrocache(Config{
+		Monitor:    testMonitor,
+		Driver:     NewDriverLRU(10),
+		Compressor: CompressorGzip{},
+	})
+	code, status := check(cache)
+	if code != http.StatusOK || status != (healthStatus{"ok", "ok", "ok", "ok"}) {
+		t.Fatalf("Cache should be healthy %d %#v", code, status)
+	}
+	if cache.Driver.GetSize() != 0 {
+		t.Fatal("Health check should remove probe object")
+	}
+	cache.Stop()
+	time.Sleep(30 * time.Millisecond)
+	code, status = check(cache)
+	if code != http.StatusServiceUnavailable || status.Monitor != "not logging" {
+		t.Fatalf("Stopped monitor should be unhealthy %d %#v", code, status)
+	}
+
+	// Buffered driver
+	cache = newMicrocache(Config{Driver: bufferedDriver{NewDriverLRU(10)}})
+	defer cache.Stop()
+	code, status = check(cache)
+	if code != http.StatusOK || status != (healthStatus{"ok", "ok", "disabled", "disabled"}) {
+		t.Fatalf("Cache should be healthy %d %#v", code, status)
+	}
+
+	// Failing driver
+	cache = newMicrocache(Config{Driver: errorDriver{NewDriverLRU(10)}})
+	defer cache.Stop()
+	code, status = check(cache)
+	if code != http.StatusServiceUnavailable || status.Driver != "set failed" {
+		t.Fatalf("Failing driver should be unhealthy %d %#v", code, status)
+	}
+}
+
+// keyDriver is a DriverLRU recording the keys of objects set
+type keyDriver struct {
+	DriverLRU
+	keys *[]string
+}
+
+func (d keyDriver) Set(hash string, res Response) error {
+	*d.keys = append(*d.keys, hash)
+	return d.DriverLRU.Set(hash, res)
+}
+
+// Health probe keys are prefixed and unique per instance
+func TestHealthProbeKey(t *testing.T) {
+	var keys []string
+	driver := keyDriver{NewDriverLRU(10), &keys}
+	a := newMicrocache(Config{KeyPrefix: "app:", Driver: driver})
+	defer a.Stop()
+	b := newMicrocache(Config{KeyPrefix: "app:", Driver: driver})
+	defer b.Stop()
+	getResponse(a.HealthHandler(), "/health")
+	getResponse(b.HealthHandler(), "/health")
+	if len(keys) != 2 || keys[0] == keys[1] {
+		t.Fatalf("Expected unique probe keys per instance %q", keys)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "app:") {
+			t.Fatalf("Probe key %q not prefixed", key)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package microcache
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// hedgeWriter captures the response of a hedged backend request.
+// The response is rendered only if claimed before the stale response.
+type hedgeWriter struct {
+	Response
+	mutex   sync.Mutex
+	claimed bool
+}
+
+// claim reports whether the caller may render the response to the client
+// Only the first caller succeeds
+func (hw *hedgeWriter) claim() bool {
+	hw.mutex.Lock()
+	defer hw.mutex.Unlock()
+	if hw.claimed {
+		return false
+	}
+	hw.claimed = true
+	return true
+}
+
+// render reports whether a backend response should be rendered to the client.
+// Background requests are never rendered, nor are hedged requests for which a stale
+// response has already been served.
+func render(w http.ResponseWriter, background bool) bool {
+	if background {
+		return false
+	}
+	if hw, ok := w.(*hedgeWriter); ok {
+		return hw.claim()
+	}
+	return true
+}
+
+// hedgeable reports whether a backend request may be hedged by a stale object
+func (m *microcache) hedgeable(r *http.Request, req RequestOpts, obj Response) bool {
+	return m.HedgeAfter > 0 && obj.found &&
+		obj.expires.Add(req.staleIfError).After(m.now()) && replayable(r)
+}
+
+// hedge executes a backend request, serving the stale object if the backend has not
+// responded within HedgeAfter. The backend request continues in the background to
+// refresh the cache. Hedged requests share the revalidation lock so that while a
+// slow backend request is in flight, the stale object is served immediately.
+func (m *microcache) hedge(
+	h http.Handler,
+	w http.ResponseWriter,
+	r *http.Request,
+	reqHash string,
+	req RequestOpts,
+	objHash string,
+	obj Response,
+) {
+	m.revalidateMutex.Lock()
+	_, revalidating := m.revalidating[objHash]
+	if !revalidating {
+		m.revalidating[objHash] = true
+	}
+	m.revalidateMutex.Unlock()
+	if revalidating {
+		m.serveHedge(w, r, reqHash, obj)
+		return
+	}
+	hw := &hedgeWriter{Response: Response{header: http.Header{}}}
+	br, cancel := newBackgroundRequest(r, m.RevalidateTimeout)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			cancel()
+			m.revalidateMutex.Lock()
+			delete(m.revalidating, objHash)
+			m.revalidateMutex.Unlock()
+		}()
+		m.handleBackendResponse(h, hw, br, reqHash, req, objHash, obj, false)
+	}()
+	timer := time.NewTimer(m.HedgeAfter)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		if hw.claim() {
+			m.serveHedge(w, r, reqHash, obj)
+			return
+		}
+		// The backend response is being rendered
+		<-done
+	}
+	hw.sendResponse(w, r)
+}
+
+// serveHedge serves a stale object in place of a slow backend response
+func (m *microcache) serveHedge(w http.ResponseWriter, r *http.Request, reqHash string, obj Response) {
+	m.countStale()
+	setOutcome(w, OutcomeStale)
+	m.setExposedHeader(w, "STALE", reqHash, obj)
+	m.event(EventHedge, Labels{"path": r.URL.Path})
+	m.logDebug("microcache hedge", "path", r.URL.Path)
+	m.setStaleHeaders(w, obj, "hedge")
+	m.setAgeHeader(w, obj)
+	m.setPerRequestHeaders(w, r)
+	obj.sendResponse(w, r)
+}
@@ -0,0 +1,63 @@
+package microcache
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// HedgeAfter serves stale responses for slow backends while refreshing the cache
+func TestHedgeAfter(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:          30 * time.Second,
+		StaleIfError: 30 * time.Second,
+		HedgeAfter:   20 * time.Millisecond,
+		Monitor:      testMonitor,
+		Driver:       NewDriverLRU(10),
+		Exposed:      true,
+	})
+	defer cache.Stop()
+	var delay, version int64
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(atomic.LoadInt64(&delay)))
+		w.Write([]byte{byte('0' + atomic.AddInt64(&version, 1))})
+	}))
+	getResponse(handler, "/")
+
+	// Fast backend responses are served
+	cache.offsetIncr(31 * time.Second)
+	r := getResponse(handler, "/")
+	if r.Header().Get("microcache") != "MISS" || r.Body.String() != "2" {
+		t.Fatalf("Fast backend response should be served, got %s %q", r.Header().Get("microcache"), r.Body.String())
+	}
+
+	// Slow backend responses are hedged
+	atomic.StoreInt64(&delay, int64(100*time.Millisecond))
+	cache.offsetIncr(31 * time.Second)
+	start := time.Now()
+	r = getResponse(handler, "/")
+	if r.Header().Get("microcache") != "STALE" || r.Body.String() != "2" {
+		t.Fatalf("Slow backend response should be hedged, got %s %q", r.Header().Get("microcache"), r.Body.String())
+	}
+	if time.Since(start) > 80*time.Millisecond {
+		t.Fatal("Hedged response should not wait for the backend")
+	}
+	// Concurrent requests are served stale without another backend request
+	r = getResponse(handler, "/")
+	if r.Header().Get("microcache") != "STALE" {
+		t.Fatalf("Request during hedged backend request should be stale, got %s", r.Header().Get("microcache"))
+	}
+	time.Sleep(150 * time.Millisecond)
+	r = getResponse(handler, "/")
+	if r.Header().Get("microcache") != "HIT" || r.Body.String() != "3" {
+		t.Fatalf("Hedged backend response should refresh the cache, got %s %q", r.Header().Get("microcache"), r.Body.String())
+	}
+	if atomic.LoadInt64(&version) != 3 {
+		t.Fatalf("Expected 3 backend requests, got %d", version)
+	}
+	if testMonitor.getStales() != 2 || testMonitor.getMisses() != 2 || testMonitor.getHits() != 1 {
+		t.Fatalf("Unexpected stats %d stales, %d misses, %d hits", testMonitor.getStales(), testMonitor.getMisses(), testMonitor.getHits())
+	}
+}
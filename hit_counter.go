@@ -0,0 +1,129 @@
+package microcache
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// hitCounterShards is the number of independently locked shards of a hitCounter
+const hitCounterShards = 16
+
+// hitCounter approximates the most hit objects over a monitor interval using the
+// space-saving algorithm. Objects are keyed by object hash and spread across shards
+// to reduce lock contention. Each shard tracks a bounded number of objects, so memory
+// does not grow with the number of distinct URIs hit. When a shard is full, the least
+// hit object is replaced and its count inherited, which may overestimate the hits of
+// objects entering late in the interval but never misses an object hit more than
+// interval hits / capacity times.
+type hitCounter struct {
+	capacity int
+	shards   [hitCounterShards]hitShard
+}
+
+type hitShard struct {
+	mutex   sync.Mutex
+	entries map[string]*hitEntry
+	heap    hitHeap
+}
+
+// hitEntry is a tracked object and a request URI of the object for reporting
+type hitEntry struct {
+	objHash string
+	uri     string
+	hits    int
+	index   int
+}
+
+// hitHeap is a min heap of tracked objects by hits
+type hitHeap []*hitEntry
+
+func (h hitHeap) Len() int           { return len(h) }
+func (h hitHeap) Less(i, j int) bool { return h[i].hits < h[j].hits }
+func (h hitHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *hitHeap) Push(x interface{}) {
+	e := x.(*hitEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *hitHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// newHitCounter returns a hitCounter able to report the n most hit objects.
+// Ten times as many objects are tracked to improve accuracy.
+func newHitCounter(n int) *hitCounter {
+	capacity := n * 10 / hitCounterShards
+	if capacity < 16 {
+		capacity = 16
+	}
+	c := &hitCounter{capacity: capacity}
+	for i := range c.shards {
+		c.shards[i].entries = map[string]*hitEntry{}
+	}
+	return c
+}
+
+// incr counts a hit of the object having objHash, served for uri
+func (c *hitCounter) incr(objHash, uri string) {
+	var s *hitShard
+	if len(objHash) > 0 {
+		// Object hashes are uniformly distributed
+		s = &c.shards[int(objHash[0])%hitCounterShards]
+	} else {
+		s = &c.shards[0]
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e, ok := s.entries[objHash]; ok {
+		e.hits++
+		heap.Fix(&s.heap, e.index)
+		return
+	}
+	if len(s.heap) < c.capacity {
+		e := &hitEntry{objHash: objHash, uri: uri, hits: 1}
+		s.entries[objHash] = e
+		heap.Push(&s.heap, e)
+		return
+	}
+	// Replace the least hit object
+	e := s.heap[0]
+	delete(s.entries, e.objHash)
+	e.objHash, e.uri = objHash, uri
+	e.hits++
+	s.entries[objHash] = e
+	heap.Fix(&s.heap, 0)
+}
+
+// flush returns the n most hit objects and resets all counts
+func (c *hitCounter) flush(n int) []KeyHits {
+	var top []KeyHits
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mutex.Lock()
+		entries := s.heap
+		s.entries = map[string]*hitEntry{}
+		s.heap = nil
+		s.mutex.Unlock()
+		for _, e := range entries {
+			top = append(top, KeyHits{e.uri, e.hits})
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Hits == top[j].Hits {
+			return top[i].Key < top[j].Key
+		}
+		return top[i].Hits > top[j].Hits
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
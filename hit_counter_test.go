@@ -0,0 +1,41 @@
+package microcache
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Hot objects are reported while the number of tracked objects stays bounded
+func TestHitCounterBounded(t *testing.T) {
+	c := newHitCounter(1)
+	for i := 0; i < 10000; i++ {
+		c.incr(HasherSHA1{}.Sum([]byte("/hot")).String(), "/hot")
+		key := "/" + strconv.Itoa(i)
+		c.incr(HasherSHA1{}.Sum([]byte(key)).String(), key)
+	}
+	for i := range c.shards {
+		if n := len(c.shards[i].entries); n > c.capacity {
+			t.Fatalf("Shard %d tracks %d objects, capacity %d", i, n, c.capacity)
+		}
+	}
+	top := c.flush(1)
+	if len(top) != 1 || top[0].Key != "/hot" || top[0].Hits < 10000 {
+		t.Fatalf("Expected /hot to be most hit, got %#v", top)
+	}
+	if top = c.flush(1); len(top) != 0 {
+		t.Fatalf("Expected counts to be reset, got %#v", top)
+	}
+}
+
+// Hits of the same object under different URIs are counted together
+func TestHitCounterObject(t *testing.T) {
+	c := newHitCounter(2)
+	objHash := HasherSHA1{}.Sum([]byte("/a")).String()
+	c.incr(objHash, "/a?x=1")
+	c.incr(objHash, "/a?x=2")
+	c.incr(HasherSHA1{}.Sum([]byte("/b")).String(), "/b")
+	top := c.flush(2)
+	if len(top) != 2 || top[0].Key != "/a?x=1" || top[0].Hits != 2 || top[1].Hits != 1 {
+		t.Fatalf("Unexpected top keys %#v", top)
+	}
+}
@@ -0,0 +1,23 @@
+package microcache
+
+import (
+	"net/http"
+	"path"
+	"time"
+)
+
+// immutableExpires is the expiration assigned to immutable objects
+var immutableExpires = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// immutableCacheControl is sent downstream with immutable responses
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// isImmutable reports whether the request path matches one of ImmutablePaths
+func (m *microcache) isImmutable(r *http.Request) bool {
+	for _, pattern := range m.ImmutablePaths {
+		if ok, _ := path.Match(pattern, r.URL.Path); ok {
+			return true
+		}
+	}
+	return false
+}
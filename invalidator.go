@@ -0,0 +1,111 @@
+package microcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Invalidator is the interface for broadcasting purges to peer instances so that a
+// fleet of instances using in-memory drivers remains coherent. Implementations for
+// Redis pub/sub and NATS are provided in the redis and nats submodules.
+type Invalidator interface {
+
+	// Publish broadcasts a message to all instances
+	Publish([]byte) error
+
+	// Subscribe calls handler with each message published by any instance, including
+	// this one. The returned func cancels the subscription.
+	Subscribe(handler func([]byte)) (func(), error)
+}
+
+const (
+	invalidateTenant  = "tenant"
+	invalidateRequest = "request"
+	invalidateAll     = "all"
+	invalidateMatch   = "match"
+)
+
+// invalidation is the message broadcast to peers
+type invalidation struct {
+	Origin  string `json:"origin"`
+	Type    string `json:"type"`
+	Path    string `json:"path,omitempty"`
+	Tenant  string `json:"tenant,omitempty"`
+	Prefix  string `json:"prefix,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Request []byte `json:"request,omitempty"`
+	Object  []byte `json:"object,omitempty"`
+}
+
+// newInstanceID returns a random id used to ignore invalidations published by this instance
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startInvalidator subscribes to invalidations published by peers
+func (m *microcache) startInvalidator() {
+	if m.Invalidator == nil || m.unsubscribe != nil {
+		return
+	}
+	unsubscribe, err := m.Invalidator.Subscribe(m.handleInvalidation)
+	if err != nil {
+		m.logWarn("microcache invalidator subscribe failed", "error", err)
+		return
+	}
+	m.unsubscribe = unsubscribe
+}
+
+// stopInvalidator cancels the invalidation subscription
+func (m *microcache) stopInvalidator() {
+	if m.unsubscribe == nil {
+		return
+	}
+	m.unsubscribe()
+	m.unsubscribe = nil
+}
+
+// publish broadcasts an invalidation to peers
+func (m *microcache) publish(inv invalidation) {
+	if m.Invalidator == nil {
+		return
+	}
+	inv.Origin = m.instanceID
+	msg, _ := json.Marshal(inv)
+	if err := m.Invalidator.Publish(msg); err != nil {
+		m.logWarn("microcache invalidator publish failed", "error", err)
+	}
+}
+
+// handleInvalidation applies an invalidation published by a peer
+func (m *microcache) handleInvalidation(msg []byte) {
+	var inv invalidation
+	if err := json.Unmarshal(msg, &inv); err != nil {
+		m.logWarn("microcache invalid invalidation message", "error", err)
+		return
+	}
+	if inv.Origin == m.instanceID {
+		return
+	}
+	switch inv.Type {
+	case invalidateTenant:
+		m.purgeTenant(inv.Tenant)
+	case invalidateAll:
+		if inv.Prefix == m.KeyPrefix {
+			m.purgeAll()
+		}
+	case invalidateMatch:
+		m.purgeMatch(inv.Pattern)
+	case invalidateRequest:
+		reqHash := string(inv.Request)
+		req, err := m.getRequestOpts(context.Background(), reqHash)
+		if err != nil {
+			// The object is still removed unless PurgeOnWrite requires the request options
+			m.driverError("GetRequestOpts", err)
+		}
+		m.invalidate(inv.Path, reqHash, req, string(inv.Object))
+	}
+}
@@ -0,0 +1,80 @@
+package microcache
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryInvalidator delivers messages synchronously to all subscribers
+type memoryInvalidator struct {
+	mutex    sync.Mutex
+	handlers map[int]func([]byte)
+	next     int
+}
+
+func (b *memoryInvalidator) Publish(msg []byte) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+func (b *memoryInvalidator) Subscribe(handler func([]byte)) (func(), error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.handlers == nil {
+		b.handlers = map[int]func([]byte){}
+	}
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.handlers, id)
+	}, nil
+}
+
+// Purges are propagated to peers
+func TestInvalidator(t *testing.T) {
+	for _, purgeOnWrite := range []bool{false, true} {
+		invalidator := &memoryInvalidator{}
+		var monitors []*monitorFunc
+		var handlers []http.Handler
+		var caches []*microcache
+		for i := 0; i < 2; i++ {
+			testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+			cache := newMicrocache(Config{
+				TTL:           30 * time.Second,
+				PurgeOnWrite:  purgeOnWrite,
+				TenantKeyFunc: func(r *http.Request) string { return r.Header.Get("tenant") },
+				Invalidator:   invalidator,
+				Monitor:       testMonitor,
+				Driver:        NewDriverLRU(10),
+			})
+			defer cache.Stop()
+			monitors = append(monitors, testMonitor)
+			caches = append(caches, cache)
+			handlers = append(handlers, cache.Middleware(http.HandlerFunc(noopSuccessHandler)))
+		}
+		for _, handler := range handlers {
+			batchGet(handler, []string{"/a", "/b"})
+		}
+		// Unsafe request on one instance purges the resource on all instances
+		getResponseWithMethod(handlers[0], "/a", "POST")
+		batchGet(handlers[1], []string{"/a", "/b"})
+		if monitors[1].getHits() != 1 || monitors[1].getBackends() != 3 {
+			t.Fatalf("Request purge not propagated (PurgeOnWrite: %v) %s", purgeOnWrite, dumpMonitor(monitors[1]))
+		}
+		// Tenant purge on one instance purges the tenant on all instances
+		caches[0].PurgeTenant("")
+		batchGet(handlers[1], []string{"/b"})
+		if monitors[1].getHits() != 1 || monitors[1].getBackends() != 4 {
+			t.Fatalf("Tenant purge not propagated (PurgeOnWrite: %v) %s", purgeOnWrite, dumpMonitor(monitors[1]))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package microcache
+
+import (
+	"net/http"
+	"sync"
+)
+
+// KeyConfig is the subset of Config which determines request hashes.
+// See Config for a description of each field.
+type KeyConfig struct {
+	KeyPrefix       string
+	Hasher          Hasher
+	HashQuery       bool
+	QueryIgnore     []string
+	QueryInclude    []string
+	NormalizeQuery  bool
+	HashScheme      bool
+	Vary            []string
+	VaryNormalizers map[string]func(string) string
+	CookieWhitelist []string
+	TenantKeyFunc   func(*http.Request) string
+	CacheablePOST   BodyKeyFunc
+	CacheOptions    bool
+}
+
+// KeyConfig returns the subset of the config which determines request hashes
+func (o Config) KeyConfig() KeyConfig {
+	return KeyConfig{
+		KeyPrefix:       o.KeyPrefix,
+		Hasher:          o.Hasher,
+		HashQuery:       o.HashQuery,
+		QueryIgnore:     o.QueryIgnore,
+		QueryInclude:    o.QueryInclude,
+		NormalizeQuery:  o.NormalizeQuery,
+		HashScheme:      o.HashScheme,
+		Vary:            o.Vary,
+		VaryNormalizers: o.VaryNormalizers,
+		CookieWhitelist: o.CookieWhitelist,
+		TenantKeyFunc:   o.TenantKeyFunc,
+		CacheablePOST:   o.CacheablePOST,
+		CacheOptions:    o.CacheOptions,
+	}
+}
+
+// ComputeKey returns the request hash the middleware would use for r, including
+// KeyPrefix. Request options are stored under this key. Response objects are
+// stored under a further hash of the request headers and query parameters named
+// by the vary options of the response.
+//
+// Tenant keys assume the tenant has not been purged since the cache started.
+// Any portion of a POST body read by CacheablePOST is restored.
+func ComputeKey(cfg KeyConfig, r *http.Request) string {
+	m := &microcache{
+		KeyPrefix:       cfg.KeyPrefix,
+		Hasher:          cfg.Hasher,
+		HashQuery:       cfg.HashQuery,
+		QueryIgnore:     newQueryIgnore(cfg.QueryIgnore),
+		QueryInclude:    cfg.QueryInclude,
+		NormalizeQuery:  cfg.NormalizeQuery,
+		HashScheme:      cfg.HashScheme,
+		Vary:            appendVary(nil, cfg.Vary...),
+		VaryNormalizers: newVaryNormalizers(cfg.VaryNormalizers, cfg.CookieWhitelist),
+		TenantKeyFunc:   cfg.TenantKeyFunc,
+		CacheablePOST:   cfg.CacheablePOST,
+		CacheOptions:    cfg.CacheOptions,
+		tenants:         map[string]uint64{},
+		tenantMutex:     &sync.RWMutex{},
+	}
+	if m.Hasher == nil {
+		m.Hasher = HasherSHA1{}
+	}
+	var postKey string
+	var cacheablePOST bool
+	if r.Method == "POST" && m.CacheablePOST != nil {
+		postKey, cacheablePOST = m.getPostKey(r)
+	}
+	return m.requestHash(r, postKey, cacheablePOST)
+}
+
+// requestHash returns the request hash of r given its POST body key, if cacheable
+func (m *microcache) requestHash(r *http.Request, postKey string, cacheablePOST bool) string {
+	reqHash := getRequestHash(m, r)
+	if cacheablePOST {
+		reqHash = m.driverKey(getPostRequestHash(m, reqHash, postKey))
+	}
+	if r.Method == "OPTIONS" && m.CacheOptions {
+		reqHash = m.driverKey(getOptionsRequestHash(m, reqHash, r))
+	}
+	return reqHash
+}
+
+// newVaryNormalizers returns the default vary normalizers merged with custom normalizers
+func newVaryNormalizers(custom map[string]func(string) string, cookieWhitelist []string) map[string]func(string) string {
+	normalizers := map[string]func(string) string{}
+	if cookieWhitelist != nil {
+		normalizers["Cookie"] = NormalizeCookies(cookieWhitelist...)
+	}
+	for header, normalize := range custom {
+		normalizers[http.CanonicalHeaderKey(header)] = normalize
+	}
+	return normalizers
+}
+
+// newQueryIgnore returns a set of ignored query parameters
+func newQueryIgnore(keys []string) map[string]bool {
+	if keys == nil {
+		return nil
+	}
+	ignore := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		ignore[key] = true
+	}
+	return ignore
+}
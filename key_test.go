@@ -0,0 +1,61 @@
+package microcache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ComputeKey returns the key under which the middleware stores request options
+func TestComputeKey(t *testing.T) {
+	driver := NewDriverLRU(10)
+	cfg := Config{
+		TTL:            30 * time.Second,
+		KeyPrefix:      "app:",
+		Hasher:         HasherXXHash{},
+		HashQuery:      true,
+		QueryIgnore:    []string{"utm_source"},
+		NormalizeQuery: true,
+		Vary:           []string{"accept-language"},
+		CacheOptions:   true,
+		CacheablePOST: func(r *http.Request) (string, bool) {
+			body, err := ioutil.ReadAll(r.Body)
+			return string(body), err == nil
+		},
+		Driver: driver,
+	}
+	cache := MustNew(cfg)
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	for _, tc := range []struct {
+		method string
+		url    string
+		body   string
+	}{
+		{"GET", "/a?b=1&a=2&utm_source=x", ""},
+		{"OPTIONS", "/a", ""},
+		{"POST", "/search", "q=1"},
+	} {
+		newRequest := func() *http.Request {
+			r, _ := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			r.Header.Set("Accept-Language", "en")
+			r.Header.Set("Origin", "https://a.example")
+			return r
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), newRequest())
+		r := newRequest()
+		key := ComputeKey(cfg.KeyConfig(), r)
+		if !strings.HasPrefix(key, "app:") {
+			t.Fatalf("%s %s: Key prefix missing %q", tc.method, tc.url, key)
+		}
+		if _, ok := driver.RequestCache.Peek(key); !ok {
+			t.Fatalf("%s %s: Computed key not found", tc.method, tc.url)
+		}
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != tc.body {
+			t.Fatalf("%s %s: Body not restored %q", tc.method, tc.url, body)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package microcache
+
+import (
+	"time"
+)
+
+// l1Entry is a request options entry in the in-process L1 cache
+type l1Entry struct {
+	req     RequestOpts
+	expires time.Time
+}
+
+// l1Cache is a small in-process cache of request options placed in front of the
+// driver so that remote drivers need not be consulted for request options on every
+// request. Entries expire after a short TTL so that changes made by other instances
+// sharing the driver are eventually observed.
+type l1Cache struct {
+	cache *lruCache
+	ttl   time.Duration
+}
+
+func newL1Cache(size int, ttl time.Duration) *l1Cache {
+	return &l1Cache{cache: newLRUCache(size), ttl: ttl}
+}
+
+// get returns unexpired request options
+func (c *l1Cache) get(reqHash string, now time.Time) (RequestOpts, bool) {
+	v, ok := c.cache.Get(reqHash)
+	if !ok {
+		return RequestOpts{}, false
+	}
+	entry := v.(l1Entry)
+	if !now.Before(entry.expires) {
+		c.cache.Remove(reqHash)
+		return RequestOpts{}, false
+	}
+	return entry.req, true
+}
+
+// set stores request options until the TTL expires
+func (c *l1Cache) set(reqHash string, req RequestOpts, now time.Time) {
+	c.cache.Add(reqHash, l1Entry{req, now.Add(c.ttl)})
+}
+
+// setRequestOpts stores request options in the driver and the L1 cache
+func (m *microcache) setRequestOpts(reqHash string, req RequestOpts) {
+	if m.l1 != nil {
+		m.l1.set(reqHash, req, m.now())
+	}
+	if err := m.driverSetRequestOpts(reqHash, req); err != nil {
+		m.driverError("SetRequestOpts", err)
+	}
+}
@@ -0,0 +1,68 @@
+package microcache
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingDriver is a DriverLRU counting request options reads
+type countingDriver struct {
+	DriverLRU
+	reads *int32
+}
+
+func (d countingDriver) GetRequestOpts(hash string) RequestOpts {
+	atomic.AddInt32(d.reads, 1)
+	return d.DriverLRU.GetRequestOpts(hash)
+}
+
+// Request options should be read from the driver only once per RequestOptsCacheTTL
+func TestRequestOptsCache(t *testing.T) {
+	reads := new(int32)
+	clock := &fakeClock{now: time.Now()}
+	cache := MustNew(Config{
+		TTL:                  30 * time.Second,
+		Driver:               countingDriver{NewDriverLRU(10), reads},
+		RequestOptsCacheSize: 10,
+		RequestOptsCacheTTL:  5 * time.Second,
+		Clock:                clock,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/", "/", "/"})
+	if n := atomic.LoadInt32(reads); n != 1 {
+		t.Fatalf("Driver should be read once for request options, got %d", n)
+	}
+	clock.now = clock.now.Add(6 * time.Second)
+	batchGet(handler, []string{"/", "/"})
+	if n := atomic.LoadInt32(reads); n != 2 {
+		t.Fatalf("Request options should be reread after RequestOptsCacheTTL, got %d", n)
+	}
+}
+
+// Related uris purged on write read request options through the l1 cache
+func TestRequestOptsCachePurgeRelated(t *testing.T) {
+	reads := new(int32)
+	cache := MustNew(Config{
+		TTL:                  30 * time.Second,
+		Driver:               countingDriver{NewDriverLRU(10), reads},
+		RequestOptsCacheSize: 10,
+		Exposed:              true,
+		PurgeRelated: func(r *http.Request) []string {
+			return []string{"/items"}
+		},
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/items", "/items"})
+	n := atomic.LoadInt32(reads)
+	getResponseWithMethod(handler, "/items/1", "POST")
+	if d := atomic.LoadInt32(reads) - n; d != 1 {
+		t.Fatalf("Related request options should be read from the l1 cache, got %d driver reads", d)
+	}
+	if w := getResponse(handler, "/items"); w.Header().Get("microcache") == "HIT" {
+		t.Fatal("Related uri should be purged")
+	}
+}
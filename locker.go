@@ -0,0 +1,60 @@
+package microcache
+
+import (
+	"time"
+)
+
+// lockPollInterval is the interval at which a held distributed lock is retried
+const lockPollInterval = 10 * time.Millisecond
+
+// defaultLockTTL is the distributed lock expiration used for requests without a timeout
+const defaultLockTTL = 30 * time.Second
+
+// DistributedLocker is an optional interface implemented by shared drivers (ie. Redis)
+// to deduplicate collapsed forwarding and background revalidation across all
+// instances sharing the driver rather than only within a single process.
+type DistributedLocker interface {
+
+	// TryLock attempts to acquire the named lock without blocking.
+	// The lock must expire after ttl in case the holder fails to release it.
+	// Returns a token unique to this acquisition, or false if the lock is held by
+	// another instance.
+	TryLock(key string, ttl time.Duration) (token string, ok bool, err error)
+
+	// Unlock releases the named lock only if it is still held with token (compare and
+	// delete), so that a lock which expired and was acquired by another instance is
+	// never released by its previous holder.
+	Unlock(key, token string) error
+}
+
+// getLocker returns the driver's DistributedLocker, if implemented
+func (m *microcache) getLocker() (DistributedLocker, bool) {
+	l, ok := m.Driver.(DistributedLocker)
+	return l, ok
+}
+
+// tryDistributedLock acquires a lock shared by all instances without waiting.
+// Lock failures are reported and treated as acquired.
+func (m *microcache) tryDistributedLock(l DistributedLocker, key string, ttl time.Duration) (unlock func(), ok bool) {
+	token, acquired, err := l.TryLock(key, ttl)
+	if err != nil {
+		m.driverError("TryLock", err)
+		return func() {}, true
+	}
+	if !acquired {
+		return nil, false
+	}
+	return func() {
+		if err := l.Unlock(key, token); err != nil {
+			m.driverError("Unlock", err)
+		}
+	}, true
+}
+
+// getLockTTL returns the distributed lock expiration for a request
+func (m *microcache) getLockTTL(req RequestOpts) time.Duration {
+	if timeout := m.getTimeout(req); timeout > 0 {
+		return timeout
+	}
+	return defaultLockTTL
+}
@@ -0,0 +1,130 @@
+package microcache
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lockingDriver is a DriverLRU implementing DistributedLocker, standing in for a
+// shared driver used by multiple instances
+type lockingDriver struct {
+	DriverLRU
+	locks *lockTable
+}
+
+// lockTable maps held lock keys to their tokens
+type lockTable struct {
+	mutex  sync.Mutex
+	tokens map[string]string
+	seq    int
+}
+
+func newLockingDriver() lockingDriver {
+	return lockingDriver{NewDriverLRU(10), &lockTable{tokens: map[string]string{}}}
+}
+
+func (d lockingDriver) TryLock(key string, ttl time.Duration) (string, bool, error) {
+	d.locks.mutex.Lock()
+	defer d.locks.mutex.Unlock()
+	if _, held := d.locks.tokens[key]; held {
+		return "", false, nil
+	}
+	d.locks.seq++
+	token := strconv.Itoa(d.locks.seq)
+	d.locks.tokens[key] = token
+	return token, true, nil
+}
+
+func (d lockingDriver) Unlock(key, token string) error {
+	d.locks.mutex.Lock()
+	defer d.locks.mutex.Unlock()
+	if d.locks.tokens[key] != token {
+		return errors.New("lock not held")
+	}
+	delete(d.locks.tokens, key)
+	return nil
+}
+
+// held returns the number of locks held
+func (d lockingDriver) held() int {
+	d.locks.mutex.Lock()
+	defer d.locks.mutex.Unlock()
+	return len(d.locks.tokens)
+}
+
+// Collapsed forwarding deduplicates backend requests across instances sharing a driver
+func TestDistributedCollapsedForwarding(t *testing.T) {
+	var backends int32
+	driver := newLockingDriver()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backends, 1)
+		time.Sleep(50 * time.Millisecond)
+		noopSuccessHandler(w, r)
+	})
+	var handlers []http.Handler
+	for i := 0; i < 2; i++ {
+		cache := newMicrocache(Config{
+			TTL:                 30 * time.Second,
+			CollapsedForwarding: true,
+			Driver:              driver,
+		})
+		defer cache.Stop()
+		handlers = append(handlers, cache.Middleware(handler))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(h http.Handler) {
+			getResponse(h, "/")
+			wg.Done()
+		}(handlers[i%2])
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&backends); n != 1 {
+		t.Fatalf("Requests not collapsed across instances %d != 1", n)
+	}
+	if n := driver.held(); n != 0 {
+		t.Fatalf("Locks should be released with their tokens, %d held", n)
+	}
+}
+
+// Background revalidation is deduplicated across instances sharing a driver
+func TestDistributedRevalidation(t *testing.T) {
+	var backends int32
+	driver := newLockingDriver()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backends, 1)
+		time.Sleep(50 * time.Millisecond)
+		noopSuccessHandler(w, r)
+	})
+	var caches []*microcache
+	var handlers []http.Handler
+	for i := 0; i < 2; i++ {
+		cache := newMicrocache(Config{
+			TTL:                  30 * time.Second,
+			StaleWhileRevalidate: 30 * time.Second,
+			Driver:               driver,
+		})
+		defer cache.Stop()
+		caches = append(caches, cache)
+		handlers = append(handlers, cache.Middleware(handler))
+	}
+	getResponse(handlers[0], "/")
+	for _, cache := range caches {
+		cache.offsetIncr(31 * time.Second)
+	}
+	getResponse(handlers[0], "/")
+	getResponse(handlers[1], "/")
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&backends); n != 2 {
+		t.Fatalf("Revalidation not deduplicated across instances %d != 2", n)
+	}
+	if n := driver.held(); n != 0 {
+		t.Fatalf("Locks should be released with their tokens, %d held", n)
+	}
+}
@@ -0,0 +1,21 @@
+package microcache
+
+// Logger is an interface for logging cache decisions and failures.
+// Arguments are alternating key/value pairs.
+// *slog.Logger satisfies this interface.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+}
+
+func (m *microcache) logDebug(msg string, args ...interface{}) {
+	if m.Logger != nil {
+		m.Logger.Debug(msg, args...)
+	}
+}
+
+func (m *microcache) logWarn(msg string, args ...interface{}) {
+	if m.Logger != nil {
+		m.Logger.Warn(msg, args...)
+	}
+}
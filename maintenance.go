@@ -0,0 +1,89 @@
+package microcache
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// SetMaintenanceMode enables or disables maintenance mode. While enabled, cached
+// objects are served regardless of freshness and the backend is never called.
+// Requests without a cached object receive MaintenanceResponse.
+func (m *microcache) SetMaintenanceMode(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&m.maintenance, v)
+	m.logWarn("microcache maintenance mode", "enabled", enabled)
+}
+
+// inMaintenance reports whether maintenance mode is enabled
+func (m *microcache) inMaintenance() bool {
+	return atomic.LoadInt32(&m.maintenance) == 1
+}
+
+// serveMaintenance serves a request from the cache alone
+func (m *microcache) serveMaintenance(w http.ResponseWriter, r *http.Request) {
+	var reqHash string
+	var obj Response
+	if r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS" || r.Method == "POST" {
+		reqHash, obj = m.maintenanceObject(w, r)
+	}
+	if !obj.found {
+		m.countMiss()
+		m.event(EventMaintenance, Labels{"path": r.URL.Path})
+		m.logDebug("microcache maintenance miss", "path", r.URL.Path)
+		if m.MaintenanceResponse != nil {
+			m.MaintenanceResponse.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if obj.expires.After(m.now()) {
+		m.countHit()
+		setOutcome(w, OutcomeHit)
+		m.setExposedHeader(w, "HIT", reqHash, obj)
+	} else {
+		m.countStale()
+		setOutcome(w, OutcomeStale)
+		m.setExposedHeader(w, "STALE", reqHash, obj)
+		m.setStaleHeaders(w, obj, "maintenance")
+	}
+	m.logDebug("microcache maintenance hit", "path", r.URL.Path)
+	m.setAgeHeader(w, obj)
+	m.setPerRequestHeaders(w, r)
+	obj.sendResponse(w, r)
+}
+
+// maintenanceObject returns the request hash and cached object for a request, if any.
+// Read failures are treated as misses.
+func (m *microcache) maintenanceObject(w http.ResponseWriter, r *http.Request) (string, Response) {
+	var postKey string
+	var cacheablePOST bool
+	if r.Method == "POST" {
+		if m.CacheablePOST == nil {
+			return "", Response{}
+		}
+		if postKey, cacheablePOST = m.getPostKey(r); !cacheablePOST {
+			return "", Response{}
+		}
+	}
+	if r.Method == "OPTIONS" && !m.CacheOptions {
+		return "", Response{}
+	}
+	reqHash := m.requestHash(r, postKey, cacheablePOST)
+	if cacheablePOST {
+		r = withPostKey(r, postKey)
+	}
+	setResultKey(w, reqHash)
+	req, err := m.getRequestOpts(r.Context(), reqHash)
+	if err != nil || !req.found || req.nocache {
+		return reqHash, Response{}
+	}
+	_, obj, err := m.fetchObject(r, reqHash, req)
+	if err != nil {
+		return reqHash, Response{}
+	}
+	return reqHash, obj
+}
@@ -0,0 +1,51 @@
+package microcache
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Maintenance mode serves cached objects regardless of freshness without calling the backend
+func TestMaintenanceMode(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	var backend int64
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Exposed: true,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+		MaintenanceResponse: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Down for maintenance", http.StatusServiceUnavailable)
+		}),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&backend, 1)
+		noopSuccessHandler(w, r)
+	}))
+	batchGet(handler, []string{"/a", "/b"})
+	cache.SetMaintenanceMode(true)
+	if w := getResponse(handler, "/a"); w.Code != 200 || w.Header().Get("microcache") != "HIT" {
+		t.Fatalf("Fresh object not served in maintenance mode %d %q", w.Code, w.Header().Get("microcache"))
+	}
+	cache.offsetIncr(24 * time.Hour)
+	if w := getResponse(handler, "/b"); w.Code != 200 || w.Header().Get("microcache") != "STALE" {
+		t.Fatalf("Expired object not served in maintenance mode %d %q", w.Code, w.Header().Get("microcache"))
+	}
+	if w := getResponse(handler, "/c"); w.Code != 503 || w.Body.String() != "Down for maintenance\n" {
+		t.Fatalf("MaintenanceResponse not served %d %q", w.Code, w.Body.String())
+	}
+	if w := getResponseWithMethod(handler, "/a", "POST"); w.Code != 503 {
+		t.Fatalf("Unsafe request not rejected %d", w.Code)
+	}
+	if atomic.LoadInt64(&backend) != 2 {
+		t.Fatalf("Backend called in maintenance mode %d", backend)
+	}
+	cache.SetMaintenanceMode(false)
+	getResponse(handler, "/c")
+	if atomic.LoadInt64(&backend) != 3 {
+		t.Fatal("Backend not called after maintenance mode")
+	}
+}
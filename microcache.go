@@ -2,8 +2,8 @@
 package microcache
 
 import (
-	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,31 +13,142 @@ type Microcache interface {
 	Middleware(http.Handler) http.Handler
 	Start()
 	Stop()
+	PurgeTenant(string)
+	PurgeAll() error
+	PurgeMatch(string) error
+	PurgeExpired() error
+	SetMaintenanceMode(bool)
+	TTLRemaining(*http.Request) (time.Duration, bool)
+	HealthHandler() http.Handler
+	Stats() Stats
 	offsetIncr(time.Duration)
 }
 
 type microcache struct {
-	Nocache              bool
-	Timeout              time.Duration
-	TTL                  time.Duration
-	StaleIfError         time.Duration
-	StaleRecache         bool
-	StaleWhileRevalidate time.Duration
-	HashQuery            bool
-	QueryIgnore          map[string]bool
-	CollapsedForwarding  bool
-	Vary                 []string
-	Driver               Driver
-	Compressor           Compressor
-	Monitor              Monitor
-	Exposed              bool
-	SuppressAgeHeader    bool
+	Nocache               bool
+	Timeout               time.Duration
+	TimeoutResponse       http.Handler
+	ErrorHandler          http.Handler
+	BackendRetries        int
+	BackendRetryBackoff   time.Duration
+	DigestMinSize         int
+	DigestETag            bool
+	MaintenanceResponse   http.Handler
+	TTL                   time.Duration
+	MinTTL                time.Duration
+	MaxTTL                time.Duration
+	AdaptiveTTL           bool
+	StaleIfError          time.Duration
+	StaleIfErrorPolicy    StalePolicy
+	StaleIfErrorStatus    []int
+	StaleRecache          bool
+	StaleWhileRevalidate  time.Duration
+	RefreshAhead          time.Duration
+	VerifySampleRate      float64
+	RevalidateTimeout     time.Duration
+	RevalidateWorkers     int
+	RevalidateQueueSize   int
+	MaxRequestBodyBuffer  int64
+	MinHitsToCache        int
+	MinHitsWindow         time.Duration
+	HashQuery             bool
+	QueryIgnore           map[string]bool
+	QueryInclude          []string
+	NormalizeQuery        bool
+	HashScheme            bool
+	CollapsedForwarding   bool
+	Coalescer             Coalescer
+	MaxBackendConcurrency int
+	MaxBackendWait        time.Duration
+	StreamMisses          bool
+	HedgeAfter            time.Duration
+	ForegroundOnly        bool
+	RevalidationHeaders   bool
+	Vary                  []string
+	ImmutablePaths        []string
+	VaryNormalizers       map[string]func(string) string
+	Driver                Driver
+	DriverTimeout         time.Duration
+	RequestOptsCacheSize  int
+	RequestOptsCacheTTL   time.Duration
+	Compressor            Compressor
+	ValidateResponse      func(Response) bool
+	Encryptor             Encryptor
+	Hasher                Hasher
+	KeyPrefix             string
+	Clock                 Clock
+	FailureMode           FailureMode
+	Invalidator           Invalidator
+	Monitor               Monitor
+	Logger                Logger
+	Exposed               bool
+	ExposedHeaderName     string
+	ExposedFormat         string
+	SuppressAgeHeader     bool
+	StaleWarning          bool
+	SetClientCacheControl bool
+	LegacyExpires         bool
+	SurrogateControl      bool
+	SetSurrogateControl   bool
+	DebugHeader           string
+	BypassHeader          string
+	BypassQueryParam      string
+	BypassToken           string
+	BypassRefresh         bool
+	Refresh               bool
+	RefreshToken          string
+	RefreshOnNoCache      bool
+	TopKeys               int
+	RecoverPanics         bool
+	TenantKeyFunc         func(*http.Request) string
+	CacheablePOST         BodyKeyFunc
+	CacheOptions          bool
+	RolloutPercent        int
+	RolloutKeyFunc        func(*http.Request) string
+	OptionsTTL            time.Duration
+	PurgeOnWrite          bool
+	PurgeRelated          func(*http.Request) []string
+	PurgeIndexSize        int
+	ExpiryIndex           bool
+	JanitorInterval       time.Duration
+	OnRequestComplete     func(RequestResult)
+	LabelFunc             func(*http.Request) string
+	WarmKeys              int
+	WarmInterval          time.Duration
+	WarmRate              int
+	MaxVariantsPerKey     int
+
+	CacheableContentTypes   []string
+	UncacheableContentTypes []string
+	StripSetCookie          bool
+	PerRequestHeaders       []string
 
+	counters        *counters
 	stopMonitor     chan bool
+	monitorLast     time.Time
+	monitorMutex    *sync.RWMutex
+	hitCounter      *hitCounter
+	admission       *admission
+	l1              *l1Cache
+	adaptive        *lruCache
+	purgeIndex      *lruCache
+	expiryIndex     *expiryIndex
+	janitorDone     chan struct{}
+	warm            *lruCache
+	warmDone        chan struct{}
+	variants        *lruCache
+	variantMutex    *sync.Mutex
+	maintenance     int32
 	revalidating    map[string]bool
 	revalidateMutex *sync.Mutex
-	collapse        map[string]*sync.Mutex
-	collapseMutex   *sync.Mutex
+	coalescer       Coalescer
+	backendSlots    chan struct{}
+	revalidateQueue chan func()
+	workersDone     chan struct{}
+	tenants         map[string]uint64
+	tenantMutex     *sync.RWMutex
+	instanceID      string
+	unsubscribe     func()
 
 	// Used to advance time for testing
 	offset      time.Duration
@@ -52,16 +163,77 @@ type Config struct {
 	// Timeout specifies the maximum execution time for backend responses
 	// Example: If the underlying handler takes more than 10s to respond,
 	// the request is cancelled and the response is treated as 503
+	// Can be overridden by the microcache-timeout response header
 	// Recommended: 10s
 	// Default: 0
 	Timeout time.Duration
 
+	// TimeoutResponse is an optional handler used to render the response when a
+	// backend request times out. Timed out responses are never cached.
+	// Default: 503 Service Unavailable with body "Timed out"
+	TimeoutResponse http.Handler
+
+	// ErrorHandler is an optional handler used to render the response when the backend
+	// fails (5xx or timeout) and no stale object is available, ie. a branded error page
+	// or a retry hint. The failed response is discarded. Timeouts are rendered by
+	// TimeoutResponse instead when it is set. Responses already streamed to the client
+	// by StreamMisses cannot be replaced.
+	// Default: nil (the backend response is passed through)
+	ErrorHandler http.Handler
+
+	// BackendRetries is the number of times a backend request is retried after a 5xx
+	// response before falling back to stale-if-error or ErrorHandler.
+	// Retries are reported as EventBackendRetry and counted in Stats.Retries.
+	// Requests having unbuffered bodies and streamed misses are never retried. Timeouts
+	// are never retried since the timed out handler continues to run.
+	// Default: 0
+	BackendRetries int
+
+	// BackendRetryBackoff is the delay before the first retry. It doubles with each
+	// subsequent retry. The MaxBackendConcurrency slot is released during backoff.
+	// Default: 0 (retry immediately)
+	BackendRetryBackoff time.Duration
+
+	// DigestMinSize is the body size in bytes above which a digest of the body is
+	// stored alongside the response. Stored digests are compared in place of bodies by
+	// revalidation, AdaptiveTTL and VerifySampleRate so that large bodies need not be
+	// rehashed or compared byte for byte on every request.
+	// Default: 0 (disabled)
+	DigestMinSize int
+
+	// DigestETag sets a weak ETag derived from the stored digest on responses which
+	// have none so that clients and conditional revalidation have a validator.
+	// Requires DigestMinSize
+	// Default: false
+	DigestETag bool
+
+	// MaintenanceResponse is an optional handler used to render the response to
+	// requests having no cached object while maintenance mode is enabled.
+	// See SetMaintenanceMode.
+	// Default: 503 Service Unavailable
+	MaintenanceResponse http.Handler
+
 	// TTL specifies a default ttl for cached responses
-	// Can be overridden by the microcache-ttl response header
+	// Can be overridden by the microcache-ttl response header in seconds or as a
+	// duration string (ie. 500ms) or by SetTTL
 	// Recommended: 10s
 	// Default: 0
 	TTL time.Duration
 
+	// MinTTL and MaxTTL clamp ttls set by the microcache-ttl response header so that
+	// a misbehaving backend cannot thrash the cache or store objects indefinitely
+	// Default: 0 (no limit)
+	MinTTL time.Duration
+	MaxTTL time.Duration
+
+	// AdaptiveTTL is an experimental mode comparing the body of each backend response
+	// to the previous version of the object. The ttl doubles for objects that are
+	// unchanged and halves for objects that change with every fetch, bounded by MinTTL
+	// and MaxTTL. Without MinTTL or MaxTTL the ttl may only lengthen or shorten
+	// respectively. Change history is retained for the 10k most recent objects.
+	// Default: false
+	AdaptiveTTL bool
+
 	// StaleWhileRevalidate specifies a period during which a stale response may be
 	// served immediately while the resource is fetched in the background. This can be
 	// useful for ensuring consistent response times at the cost of content freshness.
@@ -70,6 +242,62 @@ type Config struct {
 	// Default: 0
 	StaleWhileRevalidate time.Duration
 
+	// RefreshAhead specifies a period before expiration during which a cache hit
+	// triggers a background refresh of the object. Frequently requested objects are
+	// refreshed before they expire so they never serve stale, while objects that are
+	// not requested during this period are left to expire.
+	// Recommended: 5s (with a ttl of 30s)
+	// Default: 0
+	RefreshAhead time.Duration
+
+	// VerifySampleRate is the fraction of cache hits (ie. 0.001) re-fetched from the
+	// backend in the background and compared to the cached object by status and body.
+	// Divergence is reported to MonitorEvents and the Logger, catching cache poisoning
+	// and vary misconfiguration. Responses containing timestamps, nonces or other
+	// per-request content will always diverge.
+	// Default: 0 (disabled)
+	VerifySampleRate float64
+
+	// RevalidateTimeout specifies a deadline for the context of background revalidation
+	// requests (StaleWhileRevalidate and RefreshAhead). Background requests are otherwise
+	// never cancelled. Failed revalidations are reported to MonitorEvents.
+	// Recommended: 30s
+	// Default: 0 (no deadline)
+	RevalidateTimeout time.Duration
+
+	// RevalidateWorkers specifies the number of workers performing background
+	// revalidation. When set, revalidations are queued rather than each being run in
+	// a new goroutine so that a flood of stale objects cannot overwhelm the backend.
+	// RevalidateTimeout includes time spent in the queue.
+	// Default: 0 (unbounded)
+	RevalidateWorkers int
+
+	// RevalidateQueueSize specifies the number of background revalidations which may
+	// wait for a worker. Revalidations are dropped when the queue is full and the stale
+	// object is revalidated by a later request.
+	// Default: 0 (equal to RevalidateWorkers)
+	RevalidateQueueSize int
+
+	// MinHitsToCache specifies the number of times an object must be requested within
+	// MinHitsWindow before it is stored so that long tail one-off requests do not
+	// evict hot objects. Request frequency is estimated with a fixed size sketch.
+	// Recommended: 2
+	// Default: 0 (always store)
+	MinHitsToCache int
+
+	// MinHitsWindow specifies the period over which requests are counted for
+	// MinHitsToCache. Counts decay by half each window.
+	// Default: 1m
+	MinHitsWindow time.Duration
+
+	// MaxRequestBodyBuffer specifies the maximum size in bytes of cacheable request
+	// bodies buffered so that the request can be replayed during background
+	// revalidation. Requests having bodies which are not buffered are never
+	// revalidated in the background.
+	// Recommended: 65536
+	// Default: 0 (disabled)
+	MaxRequestBodyBuffer int64
+
 	// StaleIfError specifies a default stale grace period
 	// If a request fails and StaleIfError is set, the object will be served as stale
 	// and the response will be re-cached for the duration of this grace period
@@ -79,6 +307,19 @@ type Config struct {
 	// Default: 0
 	StaleIfError time.Duration
 
+	// StaleIfErrorPolicy determines which failures are served stale by StaleIfError.
+	// A backend 429 may warrant a stale response while a 401 should not.
+	//
+	//   StaleIfErrorPolicy: microcache.StaleOn5xx | microcache.StaleOn4xx
+	//
+	// Default: StaleOn5xx | StaleOnTimeout
+	StaleIfErrorPolicy StalePolicy
+
+	// StaleIfErrorStatus restricts StaleIfError to these exact status codes (ie. 429,
+	// 502, 503) in place of the StaleOn5xx and StaleOn4xx policies
+	// Default: nil
+	StaleIfErrorStatus []int
+
 	// StaleRecache specifies whether to re-cache the response object for ttl while serving
 	// stale response on backend error
 	// Recommended: true
@@ -90,6 +331,62 @@ type Config struct {
 	// Default: false
 	CollapsedForwarding bool
 
+	// Coalescer replaces the built-in implementation of CollapsedForwarding, ie. to
+	// coalesce requests per user. NewLocalCoalescer and NewDistributedCoalescer return
+	// the built-in in-process and distributed implementations.
+	// Default: nil (in-process, and across instances for drivers implementing
+	// DistributedLocker)
+	Coalescer Coalescer
+
+	// MaxBackendConcurrency limits the number of simultaneous backend requests made to
+	// fill or revalidate the cache. Requests in excess of this limit are queued for up to
+	// MaxBackendWait after which they are shed, serving a stale response if one exists
+	// or 503 Service Unavailable otherwise. Background revalidations are skipped rather
+	// than queued. This helps protect the backend following a cache flush, even when
+	// CollapsedForwarding is disabled.
+	// Default: 0 (unlimited)
+	MaxBackendConcurrency int
+
+	// MaxBackendWait specifies the maximum amount of time a request will be queued
+	// waiting for a backend request slot when MaxBackendConcurrency is exceeded
+	// Default: 0 (wait until the request is cancelled)
+	MaxBackendWait time.Duration
+
+	// StreamMisses streams backend responses to the client on a miss while capturing
+	// them for the cache, reducing time to first byte for large responses.
+	// Responses are still buffered when a timeout applies, when revalidating an
+	// expired object and during background revalidation.
+	// Default: false
+	StreamMisses bool
+
+	// HedgeAfter serves a stale response if the backend has not responded within this
+	// duration and the cached object is within its stale-if-error period. The backend
+	// request continues in the background to refresh the cache. A softer alternative
+	// to Timeout which does not abandon slow backend requests.
+	// Recommended: the backend's p99 latency
+	// Default: 0 (disabled)
+	HedgeAfter time.Duration
+
+	// ForegroundOnly serves every request without any work outliving the request, as
+	// required by framework adapters which recycle their request contexts once a
+	// request completes (ie. gin, echo). Stale objects are revalidated in the foreground
+	// and StaleIfError still applies. New returns a ConfigError if ForegroundOnly is
+	// combined with Timeout, StaleWhileRevalidate, RefreshAhead, HedgeAfter,
+	// BackendRetries, VerifySampleRate or WarmKeys. Middleware panics if passed a
+	// ForegroundHandler unless ForegroundOnly is set.
+	// Default: false
+	ForegroundOnly bool
+
+	// RevalidationHeaders adds request headers to backend requests revalidating an
+	// expired object so that handlers may cheaply respond 304 Not Modified if data
+	// has not changed, in which case the cached object is extended.
+	// Microcache-Revalidating: 1
+	// Microcache-Age: ( seconds )
+	// Microcache-Etag: ( ETag of the cached object, if any )
+	// These headers are removed from client requests.
+	// Default: false
+	RevalidationHeaders bool
+
 	// HashQuery determines whether all query parameters in the request URI
 	// should be hashed to differentiate requests
 	// Default: false
@@ -99,74 +396,622 @@ type Config struct {
 	// Default: nil
 	QueryIgnore []string
 
+	// QueryInclude is a list of the only query parameters to hash when HashQuery is
+	// enabled. All other parameters are ignored. Takes precedence over QueryIgnore.
+	// Safer than enumerating every possible cache buster in QueryIgnore.
+	// Default: nil
+	QueryInclude []string
+
+	// NormalizeQuery hashes query parameters sorted by key and percent-decoded so that
+	// ?a=1&b=2 and ?b=2&a=1 share a cached object. Disabled by default for compatibility
+	// since it changes the request hash. Always applies with QueryIgnore.
+	// Default: false
+	NormalizeQuery bool
+
+	// HashScheme includes the request scheme in the request hash so that http and https
+	// responses which differ (absolute links, HSTS, redirects) are cached separately.
+	// The scheme is read from X-Forwarded-Proto when present, so the header should be
+	// set or stripped by a trusted proxy.
+	// Default: false
+	HashScheme bool
+
 	// Vary specifies a list of http request headers by which all requests
 	// should be differentiated. When making use of this option, it may be a good idea
-	// to normalize these headers first using a separate piece of middleware.
+	// to normalize these headers first using VaryNormalizers.
 	//
 	//   []string{"accept-language", "accept-encoding", "xml-http-request"}
 	//
 	// Default: []string{}
 	Vary []string
 
+	// ImmutablePaths specifies path patterns (path.Match syntax) of long-lived assets
+	// such as fingerprinted static files. Matching responses are cached regardless of
+	// Nocache, never expire and are served downstream with
+	// Cache-Control: public, max-age=31536000, immutable. Immutable objects may still
+	// be evicted by the driver and are removed by purges.
+	// Example: []string{"/static/*", "/assets/*.js"}
+	// Default: nil
+	ImmutablePaths []string
+
+	// CacheableContentTypes lists the only media types (path.Match syntax) which may be
+	// stored. UncacheableContentTypes lists media types which are never stored and takes
+	// precedence. Responses without a Content-Type header are sniffed. The microcache-cache
+	// and microcache-nocache response headers take precedence over both.
+	//   CacheableContentTypes:   []string{"text/html", "application/json"}
+	//   UncacheableContentTypes: []string{"multipart/*", "application/octet-stream"}
+	// Default: nil (all content types)
+	CacheableContentTypes   []string
+	UncacheableContentTypes []string
+
+	// VaryNormalizers maps request header names to functions which transform header
+	// values before they are hashed for vary. Normalization reduces the number of
+	// variants cached for headers with many equivalent values.
+	//
+	//   map[string]func(string) string{
+	//     "accept-language": normalizeLanguage, // en-US,en;q=0.9 => en
+	//   }
+	//
+	// Applies to headers in Vary as well as the Vary and microcache-vary response headers
+	// NormalizeAcceptEncoding may be used for Accept-Encoding if the backend selects a
+	// coding in the same order of preference.
+	// Default: nil
+	VaryNormalizers map[string]func(string) string
+
+	// CookieWhitelist names the cookies which contribute to the request fingerprint
+	// when Cookie appears in Vary. All other cookies are scrubbed before hashing so that
+	// analytics and other client specific cookies do not splinter the cache. Individual
+	// cookies may also be varied per route with the microcache-vary-cookie header.
+	// Cookie is normalized by NormalizeCookies unless overridden in VaryNormalizers
+	// Default: nil (all cookies)
+	CookieWhitelist []string
+
+	// StripSetCookie removes Set-Cookie from stored responses so that cookies set for
+	// one client are never served to others from the cache. The client which caused
+	// the miss still receives its cookies. Routes may opt out with the
+	// microcache-set-cookie response header.
+	// Default: false
+	StripSetCookie bool
+
+	// PerRequestHeaders lists response headers unique to each request such as
+	// X-Request-ID or traceparent. They are removed from stored responses and never
+	// replayed. Responses served from the cache carry the live request's values
+	// instead so that tracing systems do not see duplicated IDs.
+	// Default: nil
+	PerRequestHeaders []string
+
 	// Driver specifies a cache storage driver
 	// Default: lru with 10,000 item capacity
 	Driver Driver
 
+	// DriverTimeout specifies the maximum duration of each operation on drivers
+	// implementing DriverContext. Reads are also cancelled with the request.
+	// Failed reads are handled according to FailureMode.
+	// Recommended: 100ms for remote drivers
+	// Default: Timeout
+	DriverTimeout time.Duration
+
+	// RequestOptsCacheSize specifies the number of request options held in an
+	// in-process cache in front of the driver. Recommended for remote drivers so that
+	// each request does not require a round trip to fetch request options.
+	// Default: 0 (disabled)
+	RequestOptsCacheSize int
+
+	// RequestOptsCacheTTL specifies how long request options are held in the
+	// in-process cache. Changes to request options made by other instances sharing
+	// the driver (ie. purges with PurgeOnWrite) may go unobserved for this long unless
+	// an Invalidator is configured.
+	// Default: 1s
+	RequestOptsCacheTTL time.Duration
+
 	// Compressor specifies a compressor to use for reducing the memory required to cache
 	// response bodies
 	// Default: nil
 	Compressor Compressor
 
+	// ValidateResponse is called before a successful backend response is cached.
+	// Responses for which it returns false are served but not cached, avoiding the
+	// caching of truncated responses from flaky backends.
+	// Default: ValidResponse
+	ValidateResponse func(Response) bool
+
+	// Encryptor specifies an encryptor used to encrypt response objects at rest.
+	// Responses are compressed prior to encryption.
+	// Default: nil
+	Encryptor Encryptor
+
+	// Hasher specifies the hash function used to generate cache keys. Hashes are fixed
+	// size Keys which do not allocate, converted to strings only when passed to the Driver.
+	// HasherXXHash and HasherFNV are faster but produce 64 bit keys which are not collision
+	// resistant against crafted requests. Response objects are always verified against
+	// their canonical key so a collision can never serve the wrong response, but
+	// colliding requests share request options (ie. ttl, vary, nocache) and evict each
+	// other's objects. Object collisions are reported as EventCollision.
+	// Default: HasherSHA1
+	Hasher Hasher
+
+	// KeyPrefix is prepended to all driver keys so that multiple caches or applications
+	// may share a remote driver without collisions. PurgeAll removes only keys having
+	// this prefix.
+	// Default: ""
+	KeyPrefix string
+
+	// Clock specifies the source of the current time used to determine object
+	// freshness and age. Useful for injecting a fake clock in tests.
+	// Default: system time
+	Clock Clock
+
+	// FailureMode determines how requests are handled when a driver implementing
+	// DriverReadErrors fails to read. FailOpen passes requests through to the backend
+	// without caching. FailClosed responds with 503 Service Unavailable.
+	// Default: FailOpen
+	FailureMode FailureMode
+
+	// Invalidator broadcasts purges (PurgeTenant and purges following unsafe requests)
+	// to peer instances so that a fleet of instances using in-memory drivers remains
+	// coherent. Peers must share the same Vary and hashing configuration.
+	// Default: nil
+	Invalidator Invalidator
+
 	// Monitor is an optional parameter which will periodically report statistics about
 	// the cache to enable monitoring of cache size, cache efficiency and error rate
 	// Default: nil
 	Monitor Monitor
 
+	// Logger is an optional parameter used to log cache decisions at debug level and
+	// backend errors, timeouts and driver failures at warn level
+	// Default: nil
+	Logger Logger
+
 	// Exposed determines whether to add a header to the response indicating the response state
 	// Microcache: ( HIT | MISS | STALE )
 	// Default: false
 	Exposed bool
 
+	// ExposedHeaderName is the name of the header added by Exposed (ie. X-Cache)
+	// Default: microcache
+	ExposedHeaderName string
+
+	// ExposedFormat formats the value of the header added by Exposed for tooling which
+	// parses existing conventions. {state} is replaced by HIT, MISS or STALE, {age} by
+	// the age of the cached object in seconds, {key} by the request hash and {driver} by
+	// the type name of the driver.
+	//
+	//   "{state} from edge-1"
+	//
+	// Default: {state}
+	ExposedFormat string
+
 	// SuppressAgeHeader determines whether to suppress the age header in responses
 	// The age header is added by default to all HIT and STALE responses
 	// Age: ( seconds )
 	// Default: false
 	SuppressAgeHeader bool
+
+	// StaleWarning adds Warning and Cache-Status headers to STALE responses indicating
+	// how long ago the object expired and why it was served so that API consumers may
+	// decide whether to trust the data (RFC 5861, RFC 9211)
+	// Warning: 110 - "Response is Stale"
+	// Cache-Status: microcache; hit; ttl=-( seconds stale ); detail=( reason )
+	// Default: false
+	StaleWarning bool
+
+	// SetClientCacheControl sends Cache-Control and Expires headers with cached responses
+	// derived from the remaining freshness of the object so that browser caches and CDNs
+	// layer correctly on top of the microcache. Immutable responses and responses marked
+	// private or no-store by the backend are sent unchanged.
+	// Cache-Control: public, max-age=( ttl - age )
+	// Default: false
+	SetClientCacheControl bool
+
+	// LegacyExpires improves compatibility with HTTP/1.0 clients and proxies. Cached
+	// responses are sent with an Expires header derived from the remaining freshness of
+	// the object (as with SetClientCacheControl, which also sends Expires). The backend's
+	// Expires header determines the ttl of responses without Cache-Control. Expires in
+	// the past prevents caching. microcache-* and Surrogate-Control headers take precedence.
+	// Expires: ( now + ttl - age )
+	// Default: false
+	LegacyExpires bool
+
+	// SurrogateControl obeys the backend's Surrogate-Control header when determining the
+	// ttl, stale-while-revalidate and stale-if-error of a response. no-store prevents
+	// caching. microcache-* headers take precedence. Surrogate-Control is stripped from
+	// client responses, leaving Cache-Control for browsers.
+	// Surrogate-Control: max-age=60, stale-while-revalidate=30, stale-if-error=3600
+	// Default: false
+	SurrogateControl bool
+
+	// SetSurrogateControl sends a Surrogate-Control header with cached responses derived
+	// from the remaining freshness of the object for edge caches (ie. Fastly) placed in
+	// front of the microcache.
+	// Surrogate-Control: max-age=( ttl - age )
+	// Default: false
+	SetSurrogateControl bool
+
+	// DebugHeader enables deep inspection of cache decisions. Requests sent with a
+	// microcache-debug request header matching this value receive additional
+	// response headers describing the request hash, object hash, vary headers,
+	// remaining ttl and whether the request was collapsed. Set it to "1" for open
+	// access or to a secret token to secure debug mode.
+	//
+	//   microcache-debug: 1
+	//
+	// Default: "" (disabled)
+	DebugHeader string
+
+	// BypassHeader and BypassQueryParam name a request header and query parameter
+	// which force a backend request, allowing operators and smoke tests to see fresh
+	// responses while other traffic continues to be served from the cache. Both are
+	// removed from the request before it is hashed and sent to the backend.
+	//
+	//   microcache-bypass: secret
+	//   /page?mc_bypass=secret
+	//
+	// Default: "" (disabled)
+	BypassHeader     string
+	BypassQueryParam string
+
+	// BypassToken secures cache bypass. When set, the bypass header or query
+	// parameter value must match this token.
+	// Default: ""
+	BypassToken string
+
+	// BypassRefresh stores the backend response to a bypass request, replacing the
+	// cached object.
+	// Default: false
+	BypassRefresh bool
+
+	// Refresh enables the microcache-refresh request header which replaces the cached
+	// object with a fresh backend response without purging first.
+	//
+	//   microcache-refresh: 1
+	//
+	// Default: false
+	Refresh bool
+
+	// RefreshToken secures refresh. When set, the value of the microcache-refresh
+	// request header must match this token.
+	// Default: ""
+	RefreshToken string
+
+	// RefreshOnNoCache refreshes cached objects for requests sent with
+	// Cache-Control: no-cache or Pragma: no-cache (ie. shift-reload). Since any client
+	// may then force backend requests, enable only for trusted clients.
+	// Default: false
+	RefreshOnNoCache bool
+
+	// TopKeys specifies the number of most hit objects to report to the Monitor each
+	// interval in Stats.TopKeys. Useful for identifying hot objects. Hits are counted
+	// per object in bounded memory, so counts are approximate when many distinct
+	// objects are hit.
+	// Default: 0 (disabled)
+	TopKeys int
+
+	// RecoverPanics recovers panics in the handler during foreground requests, treating
+	// them as 500 Internal Server Error so that stale-if-error applies. Panics during
+	// background revalidation are always recovered. Recovered panics are reported to
+	// MonitorEvents, counted in Stats.Panics and logged to the Logger.
+	// Default: false
+	RecoverPanics bool
+
+	// TenantKeyFunc returns a tenant identifier for each request, such as a subdomain
+	// or a JWT claim. All cache keys are namespaced per tenant so that multi-tenant
+	// applications can safely share a single cache. A tenant's objects can be
+	// invalidated with PurgeTenant.
+	// Default: nil
+	TenantKeyFunc func(*http.Request) string
+
+	// CacheablePOST enables caching of idempotent POST requests such as search APIs
+	// or RPC over POST. It is called for each POST request and returns a key derived
+	// from the request body and whether the request may be cached. Any portion of the
+	// body read by the function is restored for the handler. Other POST requests pass
+	// through and purge as usual. Bodies larger than MaxRequestBodyBuffer, or 1MB if
+	// unset, are never buffered and pass through uncached.
+	// Default: nil
+	CacheablePOST BodyKeyFunc
+
+	// CacheOptions enables caching of OPTIONS responses such as CORS preflights.
+	// Responses are keyed on the Origin, Access-Control-Request-Method and
+	// Access-Control-Request-Headers request headers and are cached regardless of
+	// Nocache. OPTIONS requests pass through uncached when disabled.
+	// Default: false
+	CacheOptions bool
+
+	// OptionsTTL specifies the ttl of cached OPTIONS responses. Can be overridden by
+	// the microcache-ttl response header.
+	// Default: TTL
+	OptionsTTL time.Duration
+
+	// RolloutPercent enables caching for a fraction of requests so that the cache can
+	// be introduced gradually in front of a legacy application. Requests are bucketed
+	// deterministically by key and requests outside the rollout pass through uncached.
+	// Default: 0 (all requests are cacheable)
+	RolloutPercent int
+
+	// RolloutKeyFunc returns the key used to bucket requests for RolloutPercent.
+	// Bucket by user or session to roll out by fraction of traffic rather than keys.
+	// Default: nil (request hash)
+	RolloutKeyFunc func(*http.Request) string
+
+	// PurgeOnWrite purges all variants of a resource following a successful unsafe
+	// request rather than only the variant matching the request's vary headers
+	// Default: false
+	PurgeOnWrite bool
+
+	// PurgeRelated returns additional request URIs to purge following a successful
+	// unsafe request. Related URIs are purged with the same scope as the request.
+	//
+	//   func(r *http.Request) []string { return []string{"/items"} } // PUT /items/1
+	//
+	// Default: nil
+	PurgeRelated func(*http.Request) []string
+
+	// PurgeIndexSize enables PurgeMatch by retaining the request paths of up to this
+	// many of the most recently stored objects. Each entry costs roughly the length of
+	// the path plus 100 bytes.
+	// Default: 0 (PurgeMatch disabled)
+	PurgeIndexSize int
+
+	// ExpiryIndex enables PurgeExpired by tracking stored objects by expiration so that
+	// objects which may no longer be served, even stale, can be removed without scanning
+	// the cache. Useful for persistent or very large drivers which do not evict expired
+	// objects on their own.
+	// Default: false (enabled by JanitorInterval)
+	ExpiryIndex bool
+
+	// JanitorInterval runs PurgeExpired periodically
+	// Default: 0 (disabled)
+	JanitorInterval time.Duration
+
+	// OnRequestComplete is called after each request is served with its cache outcome,
+	// request hash, latency, response size and status. Use it to feed access logs or
+	// analytics. It is called synchronously and should return quickly.
+	// Default: nil
+	OnRequestComplete func(RequestResult)
+
+	// LabelFunc returns a label for each request such as a route pattern or tenant so
+	// that monitors may break down the hit ratio per logical route. Each request is
+	// reported to MonitorEvents as EventRequest with its label and outcome. MonitorFunc
+	// reports totals per label in Stats.ByLabel. Labels should have low cardinality.
+	// Default: nil
+	LabelFunc func(*http.Request) string
+
+	// PredeclaredRoutes seeds request options for known endpoints at startup so that
+	// per-route vary, ttl and other microcache-* response headers are honored before the
+	// first backend response is received. Routes already having request options in the
+	// driver are untouched.
+	//
+	//   []microcache.Route{
+	//     {URL: "/products", Header: http.Header{"Microcache-Vary-Query": {"page"}}},
+	//   }
+	//
+	// Default: nil
+	PredeclaredRoutes []Route
+
+	// WarmKeys keeps up to this many of the most recently hit keys perpetually warm.
+	// Each WarmInterval, keys hit since the previous interval whose objects will expire
+	// before the next are revalidated in the background so that extremely hot endpoints
+	// never miss. Keys not hit during an interval are forgotten.
+	// Default: 0 (disabled)
+	WarmKeys int
+
+	// WarmInterval is the period between background warming cycles
+	// Default: TTL / 2 (minimum 1 second)
+	WarmInterval time.Duration
+
+	// WarmRate limits background warming to this many revalidations per second
+	// Default: 0 (unlimited)
+	WarmRate int
+
+	// MaxVariantsPerKey limits the number of objects stored for a request hash so that
+	// a response varying on a high cardinality header (ie. an unnormalized
+	// Accept-Language) can not fill the cache. Excess variants are served uncached and
+	// reported to MonitorEvents as EventVariantLimit.
+	// Default: 0 (unlimited)
+	MaxVariantsPerKey int
 }
 
-// New creates and returns a configured microcache instance
-func New(o Config) *microcache {
+// New creates and returns a configured microcache instance.
+// ConfigErrors are returned if the config is invalid (see Config.Validate).
+func New(o Config) (Microcache, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	return newMicrocache(o), nil
+}
+
+// MustNew is like New but panics if the config is invalid
+func MustNew(o Config) Microcache {
+	m, err := New(o)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// newMicrocache creates and starts a microcache from a valid config
+func newMicrocache(o Config) *microcache {
 	// Defaults
 	m := microcache{
-		Nocache:              o.Nocache,
-		TTL:                  o.TTL,
-		StaleIfError:         o.StaleIfError,
-		StaleRecache:         o.StaleRecache,
-		StaleWhileRevalidate: o.StaleWhileRevalidate,
-		Timeout:              o.Timeout,
-		HashQuery:            o.HashQuery,
-		CollapsedForwarding:  o.CollapsedForwarding,
-		Vary:                 o.Vary,
-		Driver:               o.Driver,
-		Compressor:           o.Compressor,
-		Monitor:              o.Monitor,
-		Exposed:              o.Exposed,
-		SuppressAgeHeader:    o.SuppressAgeHeader,
-		revalidating:         map[string]bool{},
-		revalidateMutex:      &sync.Mutex{},
-		collapse:             map[string]*sync.Mutex{},
-		collapseMutex:        &sync.Mutex{},
-		offsetMutex:          &sync.RWMutex{},
+		Nocache:               o.Nocache,
+		TTL:                   o.TTL,
+		MinTTL:                o.MinTTL,
+		MaxTTL:                o.MaxTTL,
+		AdaptiveTTL:           o.AdaptiveTTL,
+		StaleIfError:          o.StaleIfError,
+		StaleIfErrorPolicy:    o.StaleIfErrorPolicy,
+		StaleIfErrorStatus:    o.StaleIfErrorStatus,
+		StaleRecache:          o.StaleRecache,
+		StaleWhileRevalidate:  o.StaleWhileRevalidate,
+		RefreshAhead:          o.RefreshAhead,
+		VerifySampleRate:      o.VerifySampleRate,
+		RevalidateTimeout:     o.RevalidateTimeout,
+		RevalidateWorkers:     o.RevalidateWorkers,
+		RevalidateQueueSize:   o.RevalidateQueueSize,
+		MaxRequestBodyBuffer:  o.MaxRequestBodyBuffer,
+		MinHitsToCache:        o.MinHitsToCache,
+		MinHitsWindow:         o.MinHitsWindow,
+		Timeout:               o.Timeout,
+		TimeoutResponse:       o.TimeoutResponse,
+		ErrorHandler:          o.ErrorHandler,
+		BackendRetries:        o.BackendRetries,
+		BackendRetryBackoff:   o.BackendRetryBackoff,
+		DigestMinSize:         o.DigestMinSize,
+		DigestETag:            o.DigestETag,
+		MaintenanceResponse:   o.MaintenanceResponse,
+		HashQuery:             o.HashQuery,
+		QueryInclude:          o.QueryInclude,
+		NormalizeQuery:        o.NormalizeQuery,
+		HashScheme:            o.HashScheme,
+		CollapsedForwarding:   o.CollapsedForwarding,
+		Coalescer:             o.Coalescer,
+		MaxBackendConcurrency: o.MaxBackendConcurrency,
+		MaxBackendWait:        o.MaxBackendWait,
+		StreamMisses:          o.StreamMisses,
+		HedgeAfter:            o.HedgeAfter,
+		ForegroundOnly:        o.ForegroundOnly,
+		RevalidationHeaders:   o.RevalidationHeaders,
+		Vary:                  appendVary(nil, o.Vary...),
+		ImmutablePaths:        o.ImmutablePaths,
+		Driver:                o.Driver,
+		DriverTimeout:         o.DriverTimeout,
+		RequestOptsCacheSize:  o.RequestOptsCacheSize,
+		RequestOptsCacheTTL:   o.RequestOptsCacheTTL,
+		Compressor:            o.Compressor,
+		ValidateResponse:      o.ValidateResponse,
+		Encryptor:             o.Encryptor,
+		Hasher:                o.Hasher,
+		KeyPrefix:             o.KeyPrefix,
+		Clock:                 o.Clock,
+		FailureMode:           o.FailureMode,
+		Invalidator:           o.Invalidator,
+		Monitor:               o.Monitor,
+		Logger:                o.Logger,
+		Exposed:               o.Exposed,
+		ExposedHeaderName:     o.ExposedHeaderName,
+		ExposedFormat:         o.ExposedFormat,
+		SuppressAgeHeader:     o.SuppressAgeHeader,
+		StaleWarning:          o.StaleWarning,
+		SetClientCacheControl: o.SetClientCacheControl,
+		LegacyExpires:         o.LegacyExpires,
+		SurrogateControl:      o.SurrogateControl,
+		SetSurrogateControl:   o.SetSurrogateControl,
+		DebugHeader:           o.DebugHeader,
+		BypassHeader:          o.BypassHeader,
+		BypassQueryParam:      o.BypassQueryParam,
+		BypassToken:           o.BypassToken,
+		BypassRefresh:         o.BypassRefresh,
+		Refresh:               o.Refresh,
+		RefreshToken:          o.RefreshToken,
+		RefreshOnNoCache:      o.RefreshOnNoCache,
+		TopKeys:               o.TopKeys,
+		RecoverPanics:         o.RecoverPanics,
+		TenantKeyFunc:         o.TenantKeyFunc,
+		CacheablePOST:         o.CacheablePOST,
+		CacheOptions:          o.CacheOptions,
+		OptionsTTL:            o.OptionsTTL,
+		RolloutPercent:        o.RolloutPercent,
+		RolloutKeyFunc:        o.RolloutKeyFunc,
+		PurgeOnWrite:          o.PurgeOnWrite,
+		PurgeRelated:          o.PurgeRelated,
+		PurgeIndexSize:        o.PurgeIndexSize,
+		ExpiryIndex:           o.ExpiryIndex || o.JanitorInterval > 0,
+		JanitorInterval:       o.JanitorInterval,
+		OnRequestComplete:     o.OnRequestComplete,
+		LabelFunc:             o.LabelFunc,
+		WarmKeys:              o.WarmKeys,
+		WarmInterval:          o.WarmInterval,
+		WarmRate:              o.WarmRate,
+		MaxVariantsPerKey:     o.MaxVariantsPerKey,
+
+		CacheableContentTypes:   o.CacheableContentTypes,
+		UncacheableContentTypes: o.UncacheableContentTypes,
+		StripSetCookie:          o.StripSetCookie,
+		PerRequestHeaders:       appendVary(nil, o.PerRequestHeaders...),
+
+		revalidating:    map[string]bool{},
+		revalidateMutex: &sync.Mutex{},
+		tenants:         map[string]uint64{},
+		tenantMutex:     &sync.RWMutex{},
+		instanceID:      newInstanceID(),
+		monitorMutex:    &sync.RWMutex{},
+		counters:        &counters{},
+		offsetMutex:     &sync.RWMutex{},
+	}
+	if m.StaleIfErrorPolicy == 0 {
+		m.StaleIfErrorPolicy = StaleOn5xx | StaleOnTimeout
+	}
+	if m.ExposedHeaderName == "" {
+		m.ExposedHeaderName = "microcache"
 	}
 	if o.Driver == nil {
 		m.Driver = NewDriverLRU(1e4) // default 10k cache items
 	}
-	if o.QueryIgnore != nil {
-		m.QueryIgnore = make(map[string]bool)
-		for _, key := range o.QueryIgnore {
-			m.QueryIgnore[key] = true
+	m.coalescer = o.Coalescer
+	if o.Coalescer == nil {
+		m.coalescer = NewLocalCoalescer()
+	}
+	if o.Hasher == nil {
+		m.Hasher = HasherSHA1{}
+	}
+	if o.Clock == nil {
+		m.Clock = systemClock{}
+	}
+	if o.ValidateResponse == nil {
+		m.ValidateResponse = ValidResponse
+	}
+	if o.MaxBackendConcurrency > 0 {
+		m.backendSlots = make(chan struct{}, o.MaxBackendConcurrency)
+	}
+	if o.RevalidateWorkers > 0 {
+		size := o.RevalidateQueueSize
+		if size < 1 {
+			size = o.RevalidateWorkers
+		}
+		m.revalidateQueue = make(chan func(), size)
+	}
+	if o.TopKeys > 0 {
+		m.hitCounter = newHitCounter(o.TopKeys)
+	}
+	if o.DriverTimeout <= 0 {
+		m.DriverTimeout = m.Timeout
+	}
+	if o.RequestOptsCacheSize > 0 {
+		if m.RequestOptsCacheTTL <= 0 {
+			m.RequestOptsCacheTTL = time.Second
 		}
+		m.l1 = newL1Cache(o.RequestOptsCacheSize, m.RequestOptsCacheTTL)
 	}
+	if m.ExpiryIndex {
+		m.expiryIndex = newExpiryIndex(m.now())
+	}
+	if o.PurgeIndexSize > 0 {
+		m.purgeIndex = newLRUCache(o.PurgeIndexSize)
+	}
+	if o.AdaptiveTTL {
+		m.adaptive = newLRUCache(adaptiveTTLSize)
+	}
+	if o.MinHitsToCache > 1 {
+		if m.MinHitsWindow <= 0 {
+			m.MinHitsWindow = time.Minute
+		}
+		m.admission = newAdmission(m.MinHitsWindow)
+	}
+	m.VaryNormalizers = newVaryNormalizers(o.VaryNormalizers, o.CookieWhitelist)
+	m.QueryIgnore = newQueryIgnore(o.QueryIgnore)
+	if o.MaxVariantsPerKey > 0 {
+		m.variants = newLRUCache(variantsSize)
+		m.variantMutex = &sync.Mutex{}
+	}
+	if o.WarmKeys > 0 {
+		m.warm = newLRUCache(o.WarmKeys)
+		if m.WarmInterval <= 0 {
+			m.WarmInterval = m.TTL / 2
+		}
+		if m.WarmInterval < time.Second {
+			m.WarmInterval = time.Second
+		}
+	}
+	m.seedRoutes(o.PredeclaredRoutes)
 	m.Start()
 	return &m
 }
@@ -174,38 +1019,88 @@ func New(o Config) *microcache {
 // Middleware can be used to wrap an HTTP handler with microcache functionality.
 // It can also be passed to http middleware providers like alice as a constructor.
 //
-//     mx := microcache.New(microcache.Config{TTL: 10 * time.Second})
-//     newHandler := mx.Middleware(yourHandler)
+//	mx := microcache.MustNew(microcache.Config{TTL: 10 * time.Second})
+//	newHandler := mx.Middleware(yourHandler)
 //
 // Or with alice
 //
-//    chain.Append(mx.Middleware)
-//
+//	chain.Append(mx.Middleware)
 func (m *microcache) Middleware(h http.Handler) http.Handler {
-	if m.Timeout > 0 {
-		h = http.TimeoutHandler(h, m.Timeout, "Timed out")
+	if _, ok := h.(ForegroundHandler); ok && !m.ForegroundOnly {
+		panic("microcache: ForegroundHandler requires Config.ForegroundOnly")
 	}
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	bh := m.withRecover(h, true)
+	if m.RecoverPanics {
+		h = m.withRecover(h, false)
+	}
+	mh := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Per request options must not enable background work either
+		if m.ForegroundOnly {
+			r = ForegroundOnly(r)
+		}
+
+		// Serve from the cache alone while the backend is offline
+		if m.inMaintenance() {
+			m.serveMaintenance(w, r)
+			return
+		}
+
 		// Websocket passthrough
 		upgrade := strings.ToLower(r.Header.Get("connection")) == "upgrade"
 		if upgrade || m.Driver == nil {
-			if m.Monitor != nil {
-				m.Monitor.Miss()
-			}
-			h.ServeHTTP(w, r)
+			m.countMiss()
+			m.logDebug("microcache passthrough", "path", r.URL.Path, "upgrade", upgrade)
+			m.passthrough(h, w, r, RequestOpts{})
+			return
+		}
+
+		// Operator cache bypass
+		var bypass bool
+		if m.BypassHeader != "" || m.BypassQueryParam != "" {
+			bypass, r = m.checkBypass(r)
+		}
+		refresh := (m.Refresh || m.RefreshOnNoCache) && m.isRefresh(r)
+
+		// Cacheable POST
+		var cacheablePOST bool
+		var postKey string
+		if r.Method == "POST" && m.CacheablePOST != nil {
+			postKey, cacheablePOST = m.getPostKey(r)
+		}
+
+		// Request hash
+		reqHash := m.requestHash(r, postKey, cacheablePOST)
+		if cacheablePOST {
+			r = withPostKey(r, postKey)
+		}
+		cacheableOPTIONS := r.Method == "OPTIONS" && m.CacheOptions
+		setResultKey(w, reqHash)
+
+		// Requests outside a gradual rollout pass through uncached
+		if !m.inRollout(r, reqHash) {
+			m.countMiss()
+			m.logDebug("microcache rollout passthrough", "path", r.URL.Path)
+			m.passthrough(h, w, r, RequestOpts{})
 			return
 		}
 
 		// Fetch request options
-		reqHash := getRequestHash(m, r)
-		req := m.Driver.GetRequestOpts(reqHash)
+		req, err := m.getRequestOpts(r.Context(), reqHash)
+		if err != nil {
+			m.handleReadFailure(h, w, r, "GetRequestOpts", err)
+			return
+		}
+
+		debug := m.isDebug(r)
+		if debug {
+			setDebugRequestHeaders(w, reqHash, req)
+		}
 
 		// Hard passthrough on non cacheable requests
 		if req.nocache {
-			if m.Monitor != nil {
-				m.Monitor.Miss()
-			}
-			h.ServeHTTP(w, r)
+			m.countMiss()
+			m.logDebug("microcache nocache", "path", r.URL.Path)
+			m.passthrough(h, w, r, req)
 			return
 		}
 
@@ -213,23 +1108,20 @@ func (m *microcache) Middleware(h http.Handler) http.Handler {
 		// This implementation may collapse too many uncacheable requests.
 		// Refactor may be complicated.
 		if m.CollapsedForwarding {
-			m.collapseMutex.Lock()
-			mutex, ok := m.collapse[reqHash]
-			if !ok {
-				mutex = &sync.Mutex{}
-				m.collapse[reqHash] = mutex
+			// Coalescer serializes collapsible requests
+			waited, done := m.coalesce(r, reqHash, m.getLockTTL(req))
+			defer done()
+			if debug {
+				setDebugCollapsedHeader(w, waited)
+			}
+			if waited {
+				m.event(EventCollapse, Labels{"path": r.URL.Path})
 			}
-			m.collapseMutex.Unlock()
-			// Mutex serializes collapsible requests
-			mutex.Lock()
-			defer func() {
-				mutex.Unlock()
-				m.collapseMutex.Lock()
-				delete(m.collapse, reqHash)
-				m.collapseMutex.Unlock()
-			}()
 			if !req.found {
-				req = m.Driver.GetRequestOpts(reqHash)
+				if req, err = m.getRequestOpts(r.Context(), reqHash); err != nil {
+					m.handleReadFailure(h, w, r, "GetRequestOpts", err)
+					return
+				}
 			}
 		}
 
@@ -237,83 +1129,230 @@ func (m *microcache) Middleware(h http.Handler) http.Handler {
 		var objHash string
 		var obj Response
 		if req.found {
-			objHash = req.getObjectHash(reqHash, r)
-			obj = m.Driver.Get(objHash)
-			if m.Compressor != nil {
-				obj = m.Compressor.Expand(obj)
+			if objHash, obj, err = m.fetchObject(r, reqHash, req); err != nil {
+				m.handleReadFailure(h, w, r, "Get", err)
+				return
+			}
+			if debug {
+				setDebugObjectHeaders(w, objHash, obj, m.now())
 			}
 		}
 
 		// Non-cacheable request method passthrough and purge
-		if r.Method != "GET" && r.Method != "HEAD" && r.Method != "OPTIONS" {
-			if m.Monitor != nil {
-				m.Monitor.Miss()
-			}
-			if obj.found {
+		if r.Method != "GET" && r.Method != "HEAD" && !cacheableOPTIONS && !cacheablePOST {
+			m.countMiss()
+			// OPTIONS and TRACE are safe methods which never purge
+			unsafe := r.Method != "OPTIONS" && r.Method != "TRACE"
+			if unsafe && (obj.found || (m.PurgeOnWrite && req.found) || m.PurgeRelated != nil) {
 				// HTTP spec requires caches to purge cached responses following
 				// successful unsafe request
-				ptw := passthroughWriter{w, 0}
-				h.ServeHTTP(&ptw, r)
-				if ptw.status >= 200 && ptw.status < 400 {
-					m.Driver.Remove(objHash)
+				if status := m.passthrough(h, w, r, req); status >= 200 && status < 400 {
+					m.purge(r, reqHash, req)
 				}
 			} else {
-				h.ServeHTTP(w, r)
+				m.passthrough(h, w, r, req)
 			}
 			return
 		}
 
-		// Fresh response object found
-		if obj.found && obj.expires.After(m.now()) {
-			if m.Monitor != nil {
-				m.Monitor.Hit()
+		// Bypass the cache, optionally storing the fresh response
+		if bypass || refresh {
+			if refresh {
+				m.event(EventRefresh, Labels{"path": r.URL.Path})
+				m.logDebug("microcache refresh", "path", r.URL.Path)
+			} else {
+				m.event(EventBypass, Labels{"path": r.URL.Path})
+				m.logDebug("microcache bypass", "path", r.URL.Path, "refresh", m.BypassRefresh)
 			}
-			if m.Exposed {
-				w.Header().Set("microcache", "HIT")
+			if !refresh && !m.BypassRefresh {
+				m.countMiss()
+				m.passthrough(h, w, r, req)
+				return
 			}
-			m.setAgeHeader(w, obj)
-			obj.sendResponse(w)
+			m.handleBackendResponse(h, w, r, reqHash, req, objHash, Response{}, false)
 			return
 		}
 
-		// Stale While Revalidate
-		if obj.found && req.staleWhileRevalidate > 0 &&
-			obj.expires.Add(req.staleWhileRevalidate).After(m.now()) {
-			if m.Monitor != nil {
-				m.Monitor.Stale()
+		// Buffer request body for replay during background revalidation
+		m.bufferBody(r)
+
+		// Distributed collapsed forwarding
+		// Requests requiring a backend response wait for any peer instance fetching
+		// the same request and then check the cache again
+		// A custom Coalescer replaces distributed collapsed forwarding
+		if l, ok := m.getLocker(); ok && m.CollapsedForwarding && m.Coalescer == nil && !m.servable(obj, req) {
+			c := distributedCoalescer{locker: l, onError: m.driverError}
+			waited, unlock := c.Coalesce(r, "collapse:"+reqHash, m.getLockTTL(req))
+			defer unlock()
+			if waited {
+				m.event(EventCollapse, Labels{"path": r.URL.Path})
 			}
-			if m.Exposed {
-				w.Header().Set("microcache", "STALE")
+			if waited && !req.found {
+				if req, err = m.getRequestOpts(r.Context(), reqHash); err != nil {
+					m.handleReadFailure(h, w, r, "GetRequestOpts", err)
+					return
+				}
 			}
-			m.setAgeHeader(w, obj)
-			obj.sendResponse(w)
+			if waited && req.found {
+				if objHash, obj, err = m.fetchObject(r, reqHash, req); err != nil {
+					m.handleReadFailure(h, w, r, "Get", err)
+					return
+				}
+			}
+		}
 
-			// Dedupe revalidation
-			m.revalidateMutex.Lock()
-			_, revalidating := m.revalidating[objHash]
-			if !revalidating {
-				m.revalidating[objHash] = true
+		// Fresh response object found
+		if obj.found && obj.expires.After(m.now()) {
+			m.countHit()
+			setOutcome(w, OutcomeHit)
+			if m.hitCounter != nil {
+				m.hitCounter.incr(objHash, r.URL.RequestURI())
 			}
-			m.revalidateMutex.Unlock()
-			if !revalidating {
-				br := newBackgroundRequest(r)
-				go func() {
-					defer func() {
-						// Clear revalidation lock
-						m.revalidateMutex.Lock()
-						delete(m.revalidating, objHash)
-						m.revalidateMutex.Unlock()
-					}()
-					m.handleBackendResponse(h, w, br, reqHash, req, objHash, obj, true)
-				}()
+			m.setExposedHeader(w, "HIT", reqHash, obj)
+			// Guarded to avoid allocating log arguments on the hot path
+			if m.Logger != nil {
+				m.logDebug("microcache hit", "path", r.URL.Path)
 			}
+			m.setAgeHeader(w, obj)
+			m.setPerRequestHeaders(w, r)
+			obj.sendResponse(w, r)
+
+			m.verify(bh, r, req, obj)
+			m.markWarm(bh, r, reqHash)
+
+			// Refresh Ahead
+			if m.RefreshAhead > 0 && obj.expires.Sub(m.now()) < m.RefreshAhead {
+				m.logDebug("microcache refresh ahead", "path", r.URL.Path)
+				m.revalidate(bh, w, r, reqHash, req, objHash, obj)
+			}
+			return
+		}
 
+		// Stale While Revalidate
+		if obj.found && req.staleWhileRevalidate > 0 && !foregroundOnly(r) &&
+			obj.expires.Add(req.staleWhileRevalidate).After(m.now()) {
+			m.countStale()
+			setOutcome(w, OutcomeStale)
+			m.setExposedHeader(w, "STALE", reqHash, obj)
+			m.logDebug("microcache stale while revalidate", "path", r.URL.Path)
+			m.setStaleHeaders(w, obj, "stale-while-revalidate")
+			m.setAgeHeader(w, obj)
+			m.setPerRequestHeaders(w, r)
+			obj.sendResponse(w, r)
+			m.markWarm(bh, r, reqHash)
+			m.revalidate(bh, w, r, reqHash, req, objHash, obj)
+			return
+		} else if m.hedgeable(r, req, obj) {
+			m.hedge(h, w, r, reqHash, req, objHash, obj)
 			return
 		} else {
 			m.handleBackendResponse(h, w, r, reqHash, req, objHash, obj, false)
 			return
 		}
 	})
+	if m.OnRequestComplete != nil || m.LabelFunc != nil {
+		return m.withResult(mh)
+	}
+	return mh
+}
+
+// fetchObject retrieves, decrypts, expands and verifies a cached response object.
+// Objects which cannot be decrypted, expanded or verified are treated as not found.
+func (m *microcache) fetchObject(r *http.Request, reqHash string, req RequestOpts) (string, Response, error) {
+	objHash := req.getObjectHash(m, reqHash, r)
+	obj, err := m.getObject(r.Context(), objHash)
+	if err != nil {
+		return objHash, obj, err
+	}
+	if m.Encryptor != nil && obj.found {
+		obj, err = m.Encryptor.Decrypt(obj)
+		if err != nil {
+			// Fail open, treating the object as not found
+			m.driverError("Decrypt", err)
+			obj = Response{}
+		}
+	}
+	if m.Compressor != nil && obj.found {
+		obj, err = m.Compressor.Expand(obj)
+		if err != nil {
+			// Fail open, treating the object as not found
+			m.driverError("Expand", err)
+			obj = Response{}
+		}
+	}
+	if obj.found && !m.verifyKey(r, req, obj) {
+		obj = Response{}
+	}
+	return objHash, obj, nil
+}
+
+// servable reports whether a cached object can be served without a foreground
+// backend request
+func (m *microcache) servable(obj Response, req RequestOpts) bool {
+	return obj.found && obj.expires.Add(req.staleWhileRevalidate).After(m.now())
+}
+
+// revalidate fetches a fresh copy of a cached object in the background.
+// Revalidation is deduplicated per object hash, and across instances if the
+// driver implements DistributedLocker. Requests having bodies which are not buffered
+// and requests marked ForegroundOnly are not revalidated.
+func (m *microcache) revalidate(
+	h http.Handler,
+	w http.ResponseWriter,
+	r *http.Request,
+	reqHash string,
+	req RequestOpts,
+	objHash string,
+	obj Response,
+) {
+	if !replayable(r) {
+		m.logDebug("microcache revalidation skipped, request not replayable", "path", r.URL.Path)
+		return
+	}
+	m.revalidateMutex.Lock()
+	_, revalidating := m.revalidating[objHash]
+	if !revalidating {
+		m.revalidating[objHash] = true
+	}
+	m.revalidateMutex.Unlock()
+	if revalidating {
+		return
+	}
+	m.event(EventRevalidate, Labels{"path": r.URL.Path})
+	br, cancel := newBackgroundRequest(r, m.RevalidateTimeout)
+	done := func() {
+		cancel()
+		// Clear revalidation lock
+		m.revalidateMutex.Lock()
+		delete(m.revalidating, objHash)
+		m.revalidateMutex.Unlock()
+	}
+	job := func() {
+		defer done()
+		if l, ok := m.getLocker(); ok {
+			ttl := m.RevalidateTimeout
+			if ttl <= 0 {
+				ttl = m.getLockTTL(req)
+			}
+			unlock, ok := m.tryDistributedLock(l, "revalidate:"+objHash, ttl)
+			if !ok {
+				return
+			}
+			defer unlock()
+		}
+		m.handleBackendResponse(h, w, br, reqHash, req, objHash, obj, true)
+	}
+	if m.revalidateQueue == nil {
+		go job()
+		return
+	}
+	select {
+	case m.revalidateQueue <- job:
+	default:
+		done()
+		m.event(EventRevalidateDropped, Labels{"path": r.URL.Path})
+		m.logWarn("microcache revalidation queue full", "path", r.URL.Path)
+	}
 }
 
 func (m *microcache) handleBackendResponse(
@@ -326,88 +1365,249 @@ func (m *microcache) handleBackendResponse(
 	obj Response,
 	background bool,
 ) {
-	if m.Monitor != nil {
-		m.Monitor.Backend()
+	// Shed requests in excess of MaxBackendConcurrency
+	if !m.acquireBackend(r, background) {
+		m.logWarn("microcache backend concurrency exceeded", "path", r.URL.Path)
+		if !render(w, background) {
+			return
+		}
+		if obj.found {
+			m.countStale()
+			setOutcome(w, OutcomeStale)
+			m.setExposedHeader(w, "STALE", reqHash, obj)
+			m.setStaleHeaders(w, obj, "overload")
+			m.setAgeHeader(w, obj)
+			m.setPerRequestHeaders(w, r)
+			obj.sendResponse(w, r)
+			return
+		}
+		m.countMiss()
+		m.setExposedHeader(w, "MISS", reqHash, Response{})
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
 	}
+	// Released on return so that a panicking handler can not leak the slot.
+	// Retries give up the slot during backoff and may fail to reacquire it.
+	held := true
+	defer func() {
+		if held {
+			m.releaseBackend()
+		}
+	}()
+
+	m.countBackend()
 
 	// Backend Response
-	beres := Response{header: http.Header{}}
+	// The body is captured in a pooled buffer released once the response is sent
+	beres := Response{header: http.Header{}, body: getBody()}
+	defer func() { putBody(beres.body) }()
 
-	// Execute request
-	h.ServeHTTP(&beres, r)
+	// Revalidate cached objects conditionally
+	ber, conditional := r, false
+	if m.RevalidationHeaders {
+		ber = stripRevalidationHeaders(r)
+	}
+	if obj.found {
+		ber, conditional = m.conditionalRequest(ber, obj)
+	}
+	if ber.Method == "HEAD" {
+		ber = headAsGet(ber)
+	}
+
+	// Stream misses to the client as they are captured
+	var bew http.ResponseWriter = &beres
+	var tee *teeWriter
+	if m.streamMiss(req, obj, background) && r.Method != "HEAD" {
+		tee = &teeWriter{res: &beres, w: w, surrogate: m.SurrogateControl}
+		if m.Exposed {
+			tee.exposedName = m.ExposedHeaderName
+			tee.exposedValue = m.exposedValue("MISS", reqHash, Response{})
+		}
+		bew = tee
+	}
+
+	// Execute request, retrying transient failures
+	var timedOut, retry bool
+	var requestTime time.Time
+	for attempt := 0; ; attempt++ {
+		timedOut = false
+		requestTime = m.now()
+		m.withTimeoutFunc(h, req, func(w http.ResponseWriter, r *http.Request) {
+			timedOut = true
+			m.handleTimeout(w, r)
+		}).ServeHTTP(bew, ber)
+		if retry, held = m.retryBackend(ber, &beres, tee, timedOut, attempt, background); !retry {
+			break
+		}
+	}
+	beres.age = initialAge(beres.header, requestTime, m.now())
+	panicked := beres.header.Get(panicHeader) != ""
+	if panicked {
+		beres.header.Del(panicHeader)
+	}
+	canceled := r.Context().Err() != nil && !timedOut
 
 	if !beres.headerWritten {
 		beres.status = http.StatusOK
 	}
+	m.event(EventBackendResponse, Labels{"path": r.URL.Path, "status": statusClass(beres.status)})
+
+	// Report failed background revalidation
+	if background && (beres.status >= 500 || timedOut || canceled) {
+		m.event(EventRevalidateFailure, Labels{"path": r.URL.Path, "status": strconv.Itoa(beres.status)})
+		m.logWarn("microcache revalidation failed", "path", r.URL.Path, "status", beres.status)
+	}
+
+	// Object not modified, extend ttl of cached object
+	if conditional && beres.status == http.StatusNotModified && !timedOut {
+		obj.expires = m.now().Add(req.ttl)
+		obj.age = beres.age
+		m.store(objHash, obj)
+		m.indexExpiry(objHash, obj.expires, req)
+		if background {
+			m.event(EventRevalidateComplete, Labels{"path": r.URL.Path, "changed": "false"})
+		}
+		if !render(w, background) {
+			return
+		}
+		m.countMiss()
+		m.setExposedHeader(w, "MISS", reqHash, Response{})
+		m.logDebug("microcache not modified", "path", r.URL.Path)
+		m.setPerRequestHeaders(w, r)
+		obj.sendResponse(w, r)
+		return
+	}
 
 	// Log Error
-	if beres.status >= 500 && m.Monitor != nil {
-		m.Monitor.Error()
+	if beres.status >= 500 && !timedOut {
+		m.countError()
+		m.logWarn("microcache backend error", "path", r.URL.Path, "status", beres.status)
 	}
 
 	// Serve Stale
-	if beres.status >= 500 && obj.found {
+	if obj.found && m.staleOnError(beres.status, timedOut, canceled) {
 		serveStale := obj.expires.Add(req.staleIfError).After(m.now())
 		// Extend stale response expiration by staleIfError grace period
 		if req.found && serveStale && req.staleRecache {
 			obj.expires = obj.date.Add(m.getOffset()).Add(req.ttl)
 			m.store(objHash, obj)
+			m.indexExpiry(objHash, obj.expires, req)
 		}
-		if !background && serveStale {
-			if m.Monitor != nil {
-				m.Monitor.Stale()
-			}
-			if m.Exposed {
-				w.Header().Set("microcache", "STALE")
-			}
+		if serveStale && render(w, background) {
+			m.countStale()
+			setOutcome(w, OutcomeStale)
+			m.setExposedHeader(w, "STALE", reqHash, obj)
+			reason := staleReason(timedOut, panicked, canceled)
+			m.event(EventStaleIfError, Labels{"path": r.URL.Path, "reason": reason})
+			m.logDebug("microcache stale if error", "path", r.URL.Path, "reason", reason)
+			m.setStaleHeaders(w, obj, reason)
 			m.setAgeHeader(w, obj)
-			obj.sendResponse(w)
+			m.setPerRequestHeaders(w, r)
+			obj.sendResponse(w, r)
 			return
 		}
 	}
 
 	// Backend Request succeeded
-	if beres.status >= 200 && beres.status < 400 {
+	// Responses to canceled requests may be incomplete
+	var stored bool
+	if beres.status >= 200 && beres.status < 400 && !timedOut && !canceled {
+		m.setDigest(&beres)
+		// Report whether the revalidated body differs from the stale object
+		if background && obj.found {
+			changed := strconv.FormatBool(bodyChanged(beres, obj))
+			m.event(EventRevalidateComplete, Labels{"path": r.URL.Path, "changed": changed})
+		}
 		if !req.found {
 			// Store request options
 			req = buildRequestOpts(m, beres, r)
-			m.Driver.SetRequestOpts(reqHash, req)
-			objHash = req.getObjectHash(reqHash, r)
+			m.setRequestOpts(reqHash, req)
+			objHash = req.getObjectHash(m, reqHash, r)
 		}
+		m.stripSurrogateControl(beres.header)
 		// Cache response
-		if !req.nocache {
-			beres.expires = m.now().Add(req.ttl)
-			m.store(objHash, beres)
+		// Responses with Vary: * are never reused
+		// New objects must be requested MinHitsToCache times to be stored
+		if !req.nocache && !varyAll(beres.header) && m.validate(r, beres) &&
+			(obj.found || (m.admit(objHash) && m.admitVariant(r, reqHash, objHash, req))) {
+			beres.expires = m.now().Add(m.adaptiveTTL(objHash, beres, req.ttl))
+			if req.immutable {
+				beres.expires = immutableExpires
+				beres.header.Set("Cache-Control", immutableCacheControl)
+			}
+			beres.key = m.canonicalKey(r, req)
+			retained := m.retainable(beres)
+			m.stripSetCookie(retained, req)
+			m.stripPerRequestHeaders(retained.header)
+			m.store(objHash, retained)
+			m.indexPath(objHash, r.URL.Path)
+			m.indexExpiry(objHash, beres.expires, req)
+			stored = true
 		}
 	}
 
 	// Don't render response during background revalidate
-	if background {
+	if !render(w, background) {
 		return
 	}
 
-	if m.Monitor != nil {
-		m.Monitor.Miss()
+	m.countMiss()
+	m.setExposedHeader(w, "MISS", reqHash, Response{})
+	m.logDebug("microcache miss", "path", r.URL.Path, "status", beres.status)
+	if tee != nil && tee.started {
+		return
+	}
+	// Render the error page in place of a failed response having no stale object
+	if m.ErrorHandler != nil && beres.status >= 500 && !canceled &&
+		!(timedOut && m.TimeoutResponse != nil) {
+		m.ErrorHandler.ServeHTTP(w, r)
+		return
 	}
-	if m.Exposed {
-		w.Header().Set("microcache", "MISS")
+	m.stripSurrogateControl(beres.header)
+	if stored {
+		m.setClientCacheControl(w, beres)
+		m.setLegacyExpires(w, beres)
+		m.setSurrogateControl(w, beres)
 	}
-	beres.sendResponse(w)
+	beres.sendResponse(w, r)
 }
 
 // Start starts the monitor and any other required background processes
 func (m *microcache) Start() {
+	m.startWorkers()
+	m.startInvalidator()
+	m.startJanitor()
+	m.startWarmer()
 	if m.stopMonitor != nil || m.Monitor == nil {
 		return
 	}
 	m.stopMonitor = make(chan bool)
+	m.setMonitorLast()
+	var rejected int
+	if d, ok := m.Driver.(DriverRejections); ok {
+		rejected = d.GetRejected()
+	}
 	go func() {
 		for {
 			select {
 			case <-time.After(m.Monitor.GetInterval()):
-				m.Monitor.Log(Stats{
+				m.setMonitorLast()
+				stats := Stats{
 					Size: m.Driver.GetSize(),
-				})
+				}
+				if d, ok := m.Driver.(DriverSizeBytes); ok {
+					stats.Bytes = d.GetSizeBytes()
+				}
+				if d, ok := m.Driver.(DriverRejections); ok {
+					total := d.GetRejected()
+					stats.Rejected = total - rejected
+					rejected = total
+				}
+				if m.hitCounter != nil {
+					stats.TopKeys = m.hitCounter.flush(m.TopKeys)
+				}
+				m.setGauges(&stats)
+				m.Monitor.Log(stats)
 			case <-m.stopMonitor:
 				return
 			}
@@ -416,26 +1616,74 @@ func (m *microcache) Start() {
 }
 
 // setAgeHeader sets the age header if not suppressed
+// Age is the initial age of the response plus the time it has been resident in the cache
 func (m *microcache) setAgeHeader(w http.ResponseWriter, obj Response) {
 	if !m.SuppressAgeHeader {
-		age := (m.now().Unix() - obj.date.Unix())
-		w.Header().Set("age", fmt.Sprintf("%d", age))
+		age := obj.age + m.now().Sub(obj.date)
+		w.Header()["Age"] = []string{strconv.FormatInt(int64(age/time.Second), 10)}
 	}
+	m.setClientCacheControl(w, obj)
+	m.setLegacyExpires(w, obj)
+	m.setSurrogateControl(w, obj)
 }
 
-// store sets the age header if not suppressed
+// store compresses, encrypts and stores a response object
 func (m *microcache) store(objHash string, obj Response) {
 	obj.found = true
-	obj.date = time.Now()
+	obj.date = m.Clock.Now()
 	if m.Compressor != nil {
-		m.Driver.Set(objHash, m.Compressor.Compress(obj))
-	} else {
-		m.Driver.Set(objHash, obj)
+		var err error
+		obj, err = m.Compressor.Compress(obj)
+		if err != nil {
+			m.driverError("Compress", err)
+			return
+		}
+	}
+	if m.Encryptor != nil {
+		var err error
+		obj, err = m.Encryptor.Encrypt(obj)
+		if err != nil {
+			m.driverError("Encrypt", err)
+			return
+		}
 	}
+	if err := m.driverSet(objHash, obj); err != nil {
+		m.driverError("Set", err)
+	}
+}
+
+// retainable returns a response which may be retained by the cache as an immutable
+// object. The header is copied since the backend may still hold a reference to it.
+// The body is copied from the pooled buffer it was captured in, unless a compressor
+// or encryptor is configured since either always produces a new body.
+func (m *microcache) retainable(res Response) Response {
+	res.header = res.header.Clone()
+	if m.Compressor == nil && m.Encryptor == nil {
+		res.body = cloneBytes(res.body)
+	}
+	return res
+}
+
+// remove removes a response object
+func (m *microcache) remove(objHash string) {
+	if err := m.driverRemove(objHash); err != nil {
+		m.driverError("Remove", err)
+	}
+}
+
+// driverError reports a driver or compressor failure to the monitor and logger
+func (m *microcache) driverError(op string, err error) {
+	m.countDriverError()
+	m.event(EventDriverError, Labels{"op": op})
+	m.logWarn("microcache driver error", "op", op, "error", err)
 }
 
 // Stop stops the monitor and any other required background processes
 func (m *microcache) Stop() {
+	m.stopWorkers()
+	m.stopInvalidator()
+	m.stopJanitor()
+	m.stopWarmer()
 	if m.stopMonitor == nil {
 		return
 	}
@@ -458,5 +1706,5 @@ func (m *microcache) getOffset() time.Duration {
 
 // Get current time with offset
 func (m *microcache) now() time.Time {
-	return time.Now().Add(m.getOffset())
+	return m.Clock.Now().Add(m.getOffset())
 }
@@ -1,14 +1,18 @@
 package microcache
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"testing"
 	"time"
 )
 
 func BenchmarkHits(b *testing.B) {
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:    30 * time.Second,
 		Driver: NewDriverLRU(10),
 	})
@@ -23,7 +27,7 @@ func BenchmarkHits(b *testing.B) {
 }
 
 func BenchmarkNocache(b *testing.B) {
-	cache := New(Config{
+	cache := MustNew(Config{
 		Nocache: true,
 		Driver:  NewDriverLRU(10),
 	})
@@ -38,7 +42,7 @@ func BenchmarkNocache(b *testing.B) {
 }
 
 func BenchmarkMisses(b *testing.B) {
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:    30 * time.Second,
 		Driver: NewDriverLRU(10),
 	})
@@ -54,10 +58,10 @@ func BenchmarkMisses(b *testing.B) {
 }
 
 func BenchmarkCompression1kHits(b *testing.B) {
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:        30 * time.Second,
 		Driver:     NewDriverLRU(10),
-		Compressor: CompressorSnappy{},
+		Compressor: CompressorGzip{},
 	})
 	defer cache.Stop()
 	handler := cache.Middleware(http.HandlerFunc(success1kHandler))
@@ -70,10 +74,10 @@ func BenchmarkCompression1kHits(b *testing.B) {
 }
 
 func BenchmarkCompression1kNocache(b *testing.B) {
-	cache := New(Config{
+	cache := MustNew(Config{
 		Nocache:    true,
 		Driver:     NewDriverLRU(10),
-		Compressor: CompressorSnappy{},
+		Compressor: CompressorGzip{},
 	})
 	defer cache.Stop()
 	handler := cache.Middleware(http.HandlerFunc(success1kHandler))
@@ -86,10 +90,10 @@ func BenchmarkCompression1kNocache(b *testing.B) {
 }
 
 func BenchmarkCompression1kMisses(b *testing.B) {
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:        30 * time.Second,
 		Driver:     NewDriverLRU(10),
-		Compressor: CompressorSnappy{},
+		Compressor: CompressorGzip{},
 	})
 	defer cache.Stop()
 	handler := cache.Middleware(http.HandlerFunc(success1kHandler))
@@ -103,10 +107,10 @@ func BenchmarkCompression1kMisses(b *testing.B) {
 }
 
 func BenchmarkParallelCompression1kHits(b *testing.B) {
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:        30 * time.Second,
 		Driver:     NewDriverLRU(10),
-		Compressor: CompressorSnappy{},
+		Compressor: CompressorGzip{},
 	})
 	defer cache.Stop()
 	handler := cache.Middleware(http.HandlerFunc(success1kHandler))
@@ -120,11 +124,36 @@ func BenchmarkParallelCompression1kHits(b *testing.B) {
 	})
 }
 
+// Hits on a hot key while it is concurrently refreshed
+func BenchmarkParallelHitsRefresh(b *testing.B) {
+	cache := MustNew(Config{
+		TTL:              30 * time.Second,
+		RefreshOnNoCache: true,
+		Driver:           NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	r, _ := http.NewRequest("GET", "/", nil)
+	refresh, _ := http.NewRequest("GET", "/", nil)
+	refresh.Header.Set("Cache-Control", "no-cache")
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		w := &noopWriter{http.Header{}}
+		for i := 0; pb.Next(); i++ {
+			if i%100 == 0 {
+				handler.ServeHTTP(w, refresh)
+				continue
+			}
+			handler.ServeHTTP(w, r)
+		}
+	})
+}
+
 func BenchmarkParallelCompression1kNocache(b *testing.B) {
-	cache := New(Config{
+	cache := MustNew(Config{
 		Nocache:    true,
 		Driver:     NewDriverLRU(10),
-		Compressor: CompressorSnappy{},
+		Compressor: CompressorGzip{},
 	})
 	defer cache.Stop()
 	handler := cache.Middleware(http.HandlerFunc(success1kHandler))
@@ -139,10 +168,10 @@ func BenchmarkParallelCompression1kNocache(b *testing.B) {
 }
 
 func BenchmarkParallelCompression1kMisses(b *testing.B) {
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:        30 * time.Second,
 		Driver:     NewDriverLRU(10),
-		Compressor: CompressorSnappy{},
+		Compressor: CompressorGzip{},
 	})
 	defer cache.Stop()
 	handler := cache.Middleware(http.HandlerFunc(success1kHandler))
@@ -178,3 +207,46 @@ var json1k = []byte(`{"counts":[{"bucket":1569888000,"total":115,"unique":39},{"
 func success1kHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(json1k)
 }
+
+func BenchmarkHits1MBServer(b *testing.B) {
+	cache := MustNew(Config{
+		TTL:    30 * time.Second,
+		Driver: NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	body := bytes.Repeat([]byte("a"), 1<<20)
+	server := httptest.NewServer(cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	})))
+	defer server.Close()
+	client := server.Client()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res, err := client.Get(server.URL)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+	}
+}
+
+func BenchmarkHitsHeaders(b *testing.B) {
+	cache := MustNew(Config{
+		TTL:    30 * time.Second,
+		Driver: NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 10; i++ {
+			w.Header().Set("X-Header-"+strconv.Itoa(i), "value")
+		}
+		w.Write(json1k)
+	}))
+	r, _ := http.NewRequest("GET", "/", nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler.ServeHTTP(&noopWriter{http.Header{}}, r)
+	}
+}
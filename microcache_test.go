@@ -1,12 +1,16 @@
 package microcache
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -14,7 +18,7 @@ import (
 // TTL should be respected
 func TestTTL(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:     30 * time.Second,
 		Monitor: testMonitor,
 		Driver:  NewDriverLRU(10),
@@ -38,7 +42,7 @@ func TestTTL(t *testing.T) {
 // HashQuery
 func TestHashQuery(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:       30 * time.Second,
 		HashQuery: true,
 		Monitor:   testMonitor,
@@ -58,7 +62,7 @@ func TestHashQuery(t *testing.T) {
 // HashQuery Disabled
 func TestHashQueryDisabled(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:       30 * time.Second,
 		HashQuery: false,
 		Monitor:   testMonitor,
@@ -77,7 +81,7 @@ func TestHashQueryDisabled(t *testing.T) {
 
 // Query Ignore operates as expected
 func TestQueryIgnore(t *testing.T) {
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:         30 * time.Second,
 		HashQuery:   true,
 		QueryIgnore: []string{"a"},
@@ -105,10 +109,125 @@ func TestQueryIgnore(t *testing.T) {
 	}
 }
 
+// NormalizeQuery ignores query parameter order and encoding
+func TestNormalizeQuery(t *testing.T) {
+	for _, normalize := range []bool{false, true} {
+		cache := MustNew(Config{
+			TTL:            30 * time.Second,
+			HashQuery:      true,
+			NormalizeQuery: normalize,
+			Driver:         NewDriverLRU(10),
+			Exposed:        true,
+		})
+		handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+		cases := []struct {
+			url string
+			hit bool
+		}{
+			{"/?a=1&b=2", false},
+			{"/?b=2&a=1", normalize},
+			{"/?a=%31&b=2", normalize},
+			{"/?a=1&a=2", false},
+			{"/?a=2&a=1", false},
+		}
+		for i, c := range cases {
+			r := getResponse(handler, c.url)
+			if c.hit != (r.Header().Get("microcache") == "HIT") {
+				t.Fatalf("Hit should have been %v for case %d (NormalizeQuery: %v)", c.hit, i+1, normalize)
+			}
+		}
+		cache.Stop()
+	}
+}
+
+// HashScheme caches http and https responses separately
+func TestHashScheme(t *testing.T) {
+	for _, hashScheme := range []bool{false, true} {
+		cache := MustNew(Config{
+			TTL:        30 * time.Second,
+			HashScheme: hashScheme,
+			Driver:     NewDriverLRU(10),
+			Exposed:    true,
+		})
+		handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+		cases := []struct {
+			proto string
+			hit   bool
+		}{
+			{"", false},
+			{"http", true},
+			{"https", !hashScheme},
+			{"HTTPS, http", true},
+		}
+		for i, c := range cases {
+			header := http.Header{}
+			if c.proto != "" {
+				header.Set("X-Forwarded-Proto", c.proto)
+			}
+			r := getResponseWithHeader(handler, "/", header)
+			if c.hit != (r.Header().Get("microcache") == "HIT") {
+				t.Fatalf("Hit should have been %v for case %d (HashScheme: %v)", c.hit, i+1, hashScheme)
+			}
+		}
+		cache.Stop()
+	}
+}
+
+// QueryIgnore hashes remaining parameters independent of order
+func TestQueryIgnoreOrder(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:         30 * time.Second,
+		HashQuery:   true,
+		QueryIgnore: []string{"utm_source"},
+		Driver:      NewDriverLRU(10),
+		Exposed:     true,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	getResponse(handler, "/?a=1&b=2&c=3&utm_source=x")
+	for i := 0; i < 10; i++ {
+		if r := getResponse(handler, "/?c=3&b=2&a=1"); r.Header().Get("microcache") != "HIT" {
+			t.Fatalf("QueryIgnore hash depends on parameter order")
+		}
+	}
+}
+
+// QueryInclude hashes only the listed query parameters
+func TestQueryInclude(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:          30 * time.Second,
+		HashQuery:    true,
+		QueryInclude: []string{"page", "q"},
+		QueryIgnore:  []string{"q"},
+		Driver:       NewDriverLRU(10),
+		Exposed:      true,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	cases := []struct {
+		url string
+		hit bool
+	}{
+		{"/", false},
+		{"/?utm_source=x", true},
+		{"/?page=2", false},
+		{"/?page=2&utm_source=x&fbclid=y", true},
+		{"/?q=a&page=2", false},
+		{"/?page=2&q=a", true},
+		{"/?page=2&q=b", false},
+	}
+	for i, c := range cases {
+		r := getResponse(handler, c.url)
+		if c.hit != (r.Header().Get("microcache") == "HIT") {
+			t.Fatalf("Hit should have been %v for case %d", c.hit, i+1)
+		}
+	}
+}
+
 // QueryIgnore should be disregarded when HashQuery is false
 func TestQueryIgnoreDisabled(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:         30 * time.Second,
 		HashQuery:   false,
 		QueryIgnore: []string{"a"},
@@ -130,7 +249,7 @@ func TestQueryIgnoreDisabled(t *testing.T) {
 // StaleWhileRevalidate
 func TestStaleWhileRevalidate(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:                  30 * time.Second,
 		StaleWhileRevalidate: 30 * time.Second,
 		Monitor:              testMonitor,
@@ -163,10 +282,253 @@ func TestStaleWhileRevalidate(t *testing.T) {
 	}
 }
 
+// RefreshAhead
+func TestRefreshAhead(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:          30 * time.Second,
+		RefreshAhead: 10 * time.Second,
+		Monitor:      testMonitor,
+		Driver:       NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/", "/"})
+	if testMonitor.getBackends() != 1 {
+		t.Fatal("RefreshAhead should not refresh fresh objects", dumpMonitor(testMonitor))
+	}
+
+	// hit and refresh within 10s of expiration
+	cache.offsetIncr(25 * time.Second)
+	batchGet(handler, []string{"/"})
+	time.Sleep(10 * time.Millisecond)
+
+	// still a hit after original expiration
+	cache.offsetIncr(10 * time.Second)
+	batchGet(handler, []string{"/"})
+	if testMonitor.getHits() != 3 || testMonitor.getBackends() != 2 || testMonitor.getStales() != 0 {
+		t.Fatal("RefreshAhead not respected", dumpMonitor(testMonitor))
+	}
+}
+
+// Conditional revalidation extends ttl on 304 Not Modified
+func TestConditionalRevalidation(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:                  30 * time.Second,
+		StaleWhileRevalidate: 30 * time.Second,
+		Monitor:              testMonitor,
+		Driver:               NewDriverLRU(10),
+		Compressor:           CompressorGzip{},
+	})
+	defer cache.Stop()
+	var mutex sync.Mutex
+	var notModified int
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			mutex.Lock()
+			notModified++
+			mutex.Unlock()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Etag", `"v1"`)
+		w.Write([]byte("v1"))
+	}))
+	batchGet(handler, []string{"/"})
+
+	// background revalidation
+	cache.offsetIncr(31 * time.Second)
+	batchGet(handler, []string{"/"})
+	time.Sleep(10 * time.Millisecond)
+	r := getResponse(handler, "/")
+	if r.Code != 200 || r.Body.String() != "v1" || testMonitor.getHits() != 1 {
+		t.Fatal("Background revalidation should extend ttl on 304", dumpMonitor(testMonitor))
+	}
+
+	// foreground revalidation
+	cache.offsetIncr(61 * time.Second)
+	r = getResponse(handler, "/")
+	if r.Code != 200 || r.Body.String() != "v1" || testMonitor.getMisses() != 2 {
+		t.Fatal("Foreground revalidation should serve cached object on 304", dumpMonitor(testMonitor))
+	}
+	r = getResponse(handler, "/")
+	if r.Body.String() != "v1" || testMonitor.getHits() != 2 || testMonitor.getBackends() != 3 {
+		t.Fatal("Foreground revalidation should extend ttl on 304", dumpMonitor(testMonitor))
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if notModified != 2 {
+		t.Fatalf("Expected 2 not modified responses, got %d", notModified)
+	}
+}
+
+// RevalidationHeaders describe the cached object to the backend
+func TestRevalidationHeaders(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:                 30 * time.Second,
+		RevalidationHeaders: true,
+		Clock:               &fakeClock{now: time.Now()},
+		Driver:              NewDriverLRU(10),
+		Exposed:             true,
+	})
+	defer cache.Stop()
+	var received []http.Header
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Clone())
+		if r.Header.Get("Microcache-Revalidating") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("v1"))
+	}))
+	// Spoofed client headers are removed
+	getResponseWithHeader(handler, "/", http.Header{"Microcache-Revalidating": []string{"1"}})
+	if received[0].Get("Microcache-Revalidating") != "" {
+		t.Fatal("Client revalidation headers should be removed")
+	}
+	cache.offsetIncr(45 * time.Second)
+	r := getResponse(handler, "/")
+	if r.Body.String() != "v1" {
+		t.Fatalf("Object should be extended on 304, got %q", r.Body.String())
+	}
+	if received[1].Get("Microcache-Revalidating") != "1" || received[1].Get("Microcache-Age") != "45" {
+		t.Fatalf("Revalidation headers missing %v", received[1])
+	}
+	if r = getResponse(handler, "/"); r.Header().Get("microcache") != "HIT" {
+		t.Fatal("Object should be extended on 304")
+	}
+}
+
+// RevalidateTimeout cancels background revalidation
+func TestRevalidateTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, 10 * time.Millisecond} {
+		testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+		cache := MustNew(Config{
+			TTL:                  30 * time.Second,
+			StaleWhileRevalidate: 30 * time.Second,
+			RevalidateTimeout:    timeout,
+			Monitor:              testMonitor,
+			Driver:               NewDriverLRU(10),
+		})
+		var calls int32
+		handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return
+			}
+			select {
+			case <-r.Context().Done():
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}))
+		batchGet(handler, []string{"/"})
+		cache.offsetIncr(31 * time.Second)
+		batchGet(handler, []string{"/"})
+		time.Sleep(80 * time.Millisecond)
+		failures := testMonitor.getEvents(EventRevalidateFailure)
+		if timeout == 0 && failures != 0 {
+			t.Fatal("Background revalidation should not be cancelled without RevalidateTimeout")
+		}
+		if timeout > 0 && failures != 1 {
+			t.Fatal("Background revalidation should be cancelled by RevalidateTimeout")
+		}
+		cache.Stop()
+	}
+}
+
+// RevalidateWorkers bounds background revalidation
+func TestRevalidateWorkers(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:                  30 * time.Second,
+		StaleWhileRevalidate: 30 * time.Second,
+		RevalidateWorkers:    1,
+		RevalidateQueueSize:  1,
+		Monitor:              testMonitor,
+		Driver:               NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var active, maxActive int32
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		if n > atomic.LoadInt32(&maxActive) {
+			atomic.StoreInt32(&maxActive, n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	urls := []string{"/1", "/2", "/3", "/4", "/5"}
+	batchGet(handler, urls)
+	cache.offsetIncr(31 * time.Second)
+	batchGet(handler, urls)
+	time.Sleep(60 * time.Millisecond)
+	dropped := testMonitor.getEvents(EventRevalidateDropped)
+	if atomic.LoadInt32(&maxActive) != 1 || dropped < 2 || dropped > 3 || testMonitor.getStales() != 5 {
+		t.Fatal("RevalidateWorkers should bound background revalidation", dropped, dumpMonitor(testMonitor))
+	}
+}
+
+// Panics are recovered during background revalidation and optionally foreground requests
+func TestRecoverPanics(t *testing.T) {
+	var panics int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&panics) > 0 {
+			atomic.AddInt32(&panics, -1)
+			panic("handler panic")
+		}
+		w.Write([]byte("ok"))
+	})
+
+	// Background
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:                   30 * time.Second,
+		StaleWhileRevalidate:  30 * time.Second,
+		MaxBackendConcurrency: 1,
+		Monitor:               testMonitor,
+		Driver:                NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	h := cache.Middleware(handler)
+	batchGet(h, []string{"/"})
+	cache.offsetIncr(31 * time.Second)
+	atomic.StoreInt32(&panics, 1)
+	batchGet(h, []string{"/"})
+	time.Sleep(10 * time.Millisecond)
+	if r := getResponse(h, "/b"); r.Code != 200 || testMonitor.getEvents(EventPanic) != 1 {
+		t.Fatal("Background panic should be recovered", dumpMonitor(testMonitor))
+	}
+
+	// Foreground
+	testMonitor = &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache = MustNew(Config{
+		TTL:           30 * time.Second,
+		StaleIfError:  30 * time.Second,
+		RecoverPanics: true,
+		Monitor:       testMonitor,
+		Driver:        NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	h = cache.Middleware(handler)
+	batchGet(h, []string{"/"})
+	cache.offsetIncr(31 * time.Second)
+	atomic.StoreInt32(&panics, 1)
+	r := getResponse(h, "/")
+	if r.Code != 200 || r.Body.String() != "ok" || testMonitor.getStales() != 1 || testMonitor.getEvents(EventPanic) != 1 {
+		t.Fatal("Foreground panic should serve stale", dumpMonitor(testMonitor))
+	}
+	atomic.StoreInt32(&panics, 1)
+	if r = getResponse(h, "/b"); r.Code != 500 {
+		t.Fatal("Foreground panic should respond 500 without stale")
+	}
+}
+
 // CollapsedFowarding and StaleWhileRevalidate
 func TestCollapsedFowardingStaleWhileRevalidate(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:                  30 * time.Second,
 		CollapsedForwarding:  true,
 		StaleWhileRevalidate: 30 * time.Second,
@@ -191,7 +553,7 @@ func TestCollapsedFowardingStaleWhileRevalidate(t *testing.T) {
 // StaleIfError
 func TestStaleIfError(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:          30 * time.Second,
 		StaleIfError: 600 * time.Second,
 		Monitor:      testMonitor,
@@ -230,10 +592,60 @@ func TestStaleIfError(t *testing.T) {
 	}
 }
 
+// StaleIfError applies to errors, timeouts, panics and canceled requests
+func TestStaleIfErrorReasons(t *testing.T) {
+	var stats Stats
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(s Stats) { stats = s }}
+	cache := MustNew(Config{
+		TTL:           30 * time.Second,
+		StaleIfError:  600 * time.Second,
+		Timeout:       20 * time.Millisecond,
+		RecoverPanics: true,
+		Monitor:       testMonitor,
+		QueryIgnore:   []string{"mode"},
+		Driver:        NewDriverLRU(10),
+		Exposed:       true,
+	})
+	defer cache.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("mode") {
+		case "error":
+			w.WriteHeader(500)
+		case "timeout":
+			time.Sleep(50 * time.Millisecond)
+		case "panic":
+			panic("fail")
+		case "cancel":
+			cancel()
+			w.Write([]byte("incomplete"))
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	getResponse(handler, "/")
+	cache.offsetIncr(30 * time.Second)
+	for _, mode := range []string{"error", "timeout", "panic", "cancel"} {
+		r, _ := http.NewRequest("GET", "/?mode="+mode, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r.WithContext(ctx))
+		if w.Header().Get("microcache") != "STALE" || w.Body.String() != "ok" {
+			t.Fatalf("Expected stale response for %s, got %s %q", mode, w.Header().Get("microcache"), w.Body.String())
+		}
+		if w.Header().Get(panicHeader) != "" {
+			t.Fatal("Panic marker header should not be sent to the client")
+		}
+	}
+	testMonitor.Log(Stats{})
+	if stats.StaleErrors != 1 || stats.StaleTimeouts != 1 || stats.StalePanics != 1 || stats.StaleCanceled != 1 {
+		t.Fatalf("Unexpected stale breakdown %+v", stats)
+	}
+}
+
 // StaleRecache
 func TestStaleRecache(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:          30 * time.Second,
 		StaleIfError: 600 * time.Second,
 		StaleRecache: true,
@@ -275,7 +687,7 @@ func TestStaleRecache(t *testing.T) {
 // Timeout
 func TestTimeout(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:     30 * time.Second,
 		Timeout: 10 * time.Millisecond,
 		Monitor: testMonitor,
@@ -287,15 +699,102 @@ func TestTimeout(t *testing.T) {
 	batchGet(handler, []string{
 		"/",
 	})
-	if testMonitor.getErrors() != 1 || time.Since(start) > 20*time.Millisecond {
-		t.Fatal("Timeout not respected - got", testMonitor.getErrors(), "errors")
+	if testMonitor.getTimeouts() != 1 || testMonitor.getErrors() != 0 || time.Since(start) > 20*time.Millisecond {
+		t.Fatal("Timeout not respected - got", testMonitor.getTimeouts(), "timeouts")
+	}
+	w := getResponse(handler, "/")
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "Timed out" {
+		t.Fatal("Timeout should return 503")
+	}
+}
+
+// TimeoutResponse customizes the response rendered upon timeout
+func TestTimeoutResponse(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Timeout: 10 * time.Millisecond,
+		TimeoutResponse: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusGatewayTimeout)
+			w.Write([]byte("try again"))
+		}),
+		Driver:  NewDriverLRU(10),
+		Exposed: true,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(slowSuccessHandler))
+	for i := 0; i < 2; i++ {
+		w := getResponse(handler, "/")
+		if w.Code != http.StatusGatewayTimeout || w.Body.String() != "try again" ||
+			w.Header().Get("Retry-After") != "5" || w.Header().Get("microcache") != "MISS" {
+			t.Fatal("TimeoutResponse not respected")
+		}
+	}
+}
+
+// ErrorHandler renders backend failures having no stale object
+func TestErrorHandler(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:          30 * time.Second,
+		StaleIfError: 600 * time.Second,
+		ErrorHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("sorry"))
+		}),
+		Driver: NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(failureHandler))
+	w := getResponse(handler, "/?fail=1")
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "sorry" || w.Header().Get("Retry-After") != "5" {
+		t.Fatalf("ErrorHandler not respected: %d %q", w.Code, w.Body.String())
+	}
+	getResponse(handler, "/")
+	cache.offsetIncr(60 * time.Second)
+	w = getResponse(handler, "/?fail=1")
+	if w.Code != http.StatusOK || w.Body.String() != "done\n" {
+		t.Fatalf("Stale object should be served in place of ErrorHandler: %d %q", w.Code, w.Body.String())
+	}
+
+	// Timeouts are rendered by ErrorHandler when TimeoutResponse is not set
+	cache = MustNew(Config{
+		Timeout:      10 * time.Millisecond,
+		ErrorHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("sorry")) }),
+		Driver:       NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler = cache.Middleware(http.HandlerFunc(slowSuccessHandler))
+	if w := getResponse(handler, "/"); w.Body.String() != "sorry" {
+		t.Fatalf("ErrorHandler not respected on timeout: %q", w.Body.String())
+	}
+}
+
+// Timeout can be overridden per request with the microcache-timeout header
+func TestTimeoutHeader(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		Timeout: 10 * time.Millisecond,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("microcache-timeout", "1")
+		if r.FormValue("slow") != "" {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	batchGet(handler, []string{"/", "/?slow=1"})
+	if testMonitor.getBackends() != 2 || testMonitor.getTimeouts() != 0 {
+		t.Fatal("Timeout header not respected - got", testMonitor.getTimeouts(), "timeouts")
 	}
 }
 
 // Request context cancellation should not cause error from TimeoutHandler
 func TestRequestContextCancel(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := newMicrocache(Config{
 		TTL:                  30 * time.Second,
 		StaleWhileRevalidate: 30 * time.Second,
 		Timeout:              10 * time.Second,
@@ -313,15 +812,16 @@ func TestRequestContextCancel(t *testing.T) {
 	w := httptest.NewRecorder()
 	handler.ServeHTTP(w, r)
 	cancel()
-	time.Sleep(1 * time.Millisecond)
-	if testMonitor.getErrors() > 0 {
+	// Wait for background revalidation to complete
+	time.Sleep(20 * time.Millisecond)
+	if testMonitor.getErrors() > 0 || testMonitor.getTimeouts() > 0 {
 		t.Fatal("TimeoutHandler returned error")
 	}
 	cache.offsetIncr(31 * time.Second)
 	cache.Timeout = 1 * time.Millisecond
 	batchGet(cache.Middleware(http.HandlerFunc(slowSuccessHandler)), []string{"/"})
 	time.Sleep(2 * time.Millisecond)
-	if testMonitor.getErrors() != 1 {
+	if testMonitor.getTimeouts() != 1 {
 		t.Fatal("Request did not time out")
 	}
 }
@@ -329,7 +829,7 @@ func TestRequestContextCancel(t *testing.T) {
 // CollapsedFowarding
 func TestCollapsedFowarding(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:                 30 * time.Second,
 		CollapsedForwarding: true,
 		Monitor:             testMonitor,
@@ -351,11 +851,145 @@ func TestCollapsedFowarding(t *testing.T) {
 	}
 }
 
+// MaxBackendConcurrency sheds requests in excess of the limit
+func TestMaxBackendConcurrency(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:                   30 * time.Second,
+		MaxBackendConcurrency: 2,
+		MaxBackendWait:        time.Millisecond,
+		Monitor:               testMonitor,
+		Driver:                NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(timelySuccessHandler))
+	parallelGet(handler, []string{"/a", "/b", "/c", "/d"})
+	if testMonitor.getBackends() != 2 || testMonitor.getMisses() != 4 {
+		t.Fatalf("MaxBackendConcurrency not respected %s", dumpMonitor(testMonitor))
+	}
+}
+
+// MaxBackendConcurrency slots are released by handlers which panic
+func TestMaxBackendConcurrencyPanic(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:                   30 * time.Second,
+		MaxBackendConcurrency: 2,
+		MaxBackendWait:        time.Millisecond,
+		Driver:                NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("fail")
+		}
+		noopSuccessHandler(w, r)
+	}))
+	for i := 0; i < 2; i++ {
+		func() {
+			defer func() { recover() }()
+			getResponse(handler, "/panic")
+		}()
+	}
+	if w := getResponse(handler, "/"); w.Code != http.StatusOK {
+		t.Fatalf("Backend slot leaked by panic, got %d", w.Code)
+	}
+}
+
+// Responses with Vary: * are never reused
+func TestVaryAll(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	var varyAll int32
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/all" || atomic.LoadInt32(&varyAll) == 1 {
+			w.Header().Set("Vary", "*")
+		}
+		noopSuccessHandler(w, r)
+	}))
+	batchGet(handler, []string{
+		"/all",
+		"/all",
+		"/",
+	})
+	// Request options learned prior to Vary: *
+	cache.offsetIncr(31 * time.Second)
+	atomic.StoreInt32(&varyAll, 1)
+	batchGet(handler, []string{
+		"/",
+		"/",
+	})
+	if testMonitor.getHits() != 0 || testMonitor.getMisses() != 5 {
+		t.Fatalf("Vary: * response was reused %s", dumpMonitor(testMonitor))
+	}
+}
+
+// ImmutablePaths are cached regardless of Nocache and never expire
+func TestImmutablePaths(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		Nocache:        true,
+		ImmutablePaths: []string{"/static/*"},
+		Monitor:        testMonitor,
+		Driver:         NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{
+		"/static/app.123.js",
+		"/static/app.123.js",
+		// * does not match path separators
+		"/static/css/app.css",
+		"/static/css/app.css",
+	})
+	cache.offsetIncr(365 * 24 * time.Hour)
+	w := getResponse(handler, "/static/app.123.js")
+	if w.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Fatalf("Immutable Cache-Control not set %q", w.Header().Get("Cache-Control"))
+	}
+	if testMonitor.getHits() != 2 || testMonitor.getMisses() != 3 {
+		t.Fatalf("ImmutablePaths not respected %s", dumpMonitor(testMonitor))
+	}
+}
+
+// SetTTL supports sub-second ttls
+func TestSubSecondTTL(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetTTL(w, 500*time.Millisecond)
+		noopSuccessHandler(w, r)
+	}))
+	batchGet(handler, []string{
+		"/",
+		"/",
+	})
+	cache.offsetIncr(400 * time.Millisecond)
+	batchGet(handler, []string{
+		"/",
+	})
+	cache.offsetIncr(200 * time.Millisecond)
+	batchGet(handler, []string{
+		"/",
+	})
+	if testMonitor.getHits() != 2 || testMonitor.getMisses() != 2 {
+		t.Fatalf("Sub-second ttl not respected %s", dumpMonitor(testMonitor))
+	}
+}
+
 // SuppressAgeHeader
 func TestAgeHeader(t *testing.T) {
 	// Age header is added by default
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:     30 * time.Second,
 		Monitor: testMonitor,
 		Driver:  NewDriverLRU(10),
@@ -372,33 +1006,46 @@ func TestAgeHeader(t *testing.T) {
 	}
 }
 
-// SuppressAgeHeaderSuppression
-func TestAgeHeaderSuppression(t *testing.T) {
-	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
-		TTL:               30 * time.Second,
-		SuppressAgeHeader: true,
-		Monitor:           testMonitor,
-		Driver:            NewDriverLRU(10),
+// Age header includes upstream Age and apparent age from the upstream Date header
+func TestAgeHeaderUpstream(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	cache := MustNew(Config{
+		TTL:    30 * time.Second,
+		Clock:  clock,
+		Driver: NewDriverLRU(10),
 	})
 	defer cache.Stop()
-	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/age":
+			w.Header().Set("Age", "15")
+		case "/date":
+			w.Header().Set("Date", clock.Now().Add(-40*time.Second).UTC().Format(http.TimeFormat))
+		}
+		noopSuccessHandler(w, r)
+	}))
 	batchGet(handler, []string{
-		"/",
+		"/age",
+		"/date",
 	})
-	w := getResponse(handler, "/")
-	if w.Header().Get("age") != "" {
-		t.Fatal("Age header was added when it should be empty")
+	clock.add(5 * time.Second)
+	if w := getResponse(handler, "/age"); !reflect.DeepEqual(w.Header()["Age"], []string{"20"}) {
+		t.Fatalf("Age header was not correct %v != [20]", w.Header()["Age"])
+	}
+	if w := getResponse(handler, "/date"); !reflect.DeepEqual(w.Header()["Age"], []string{"45"}) {
+		t.Fatalf("Age header was not correct %v != [45]", w.Header()["Age"])
 	}
 }
 
-// ARCCache should work as expected
-func TestARCCache(t *testing.T) {
+// Clock controls object expiration
+func TestClock(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	clock := &fakeClock{now: time.Now()}
+	cache := MustNew(Config{
 		TTL:     30 * time.Second,
+		Clock:   clock,
 		Monitor: testMonitor,
-		Driver:  NewDriverARC(10),
+		Driver:  NewDriverLRU(10),
 	})
 	defer cache.Stop()
 	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
@@ -406,20 +1053,39 @@ func TestARCCache(t *testing.T) {
 		"/",
 		"/",
 	})
-	cache.offsetIncr(30 * time.Second)
+	clock.add(31 * time.Second)
 	batchGet(handler, []string{
 		"/",
+	})
+	if testMonitor.getMisses() != 2 || testMonitor.getHits() != 1 {
+		t.Fatalf("Clock not respected %s", dumpMonitor(testMonitor))
+	}
+}
+
+// SuppressAgeHeaderSuppression
+func TestAgeHeaderSuppression(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:               30 * time.Second,
+		SuppressAgeHeader: true,
+		Monitor:           testMonitor,
+		Driver:            NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{
 		"/",
 	})
-	if testMonitor.getMisses() != 2 || testMonitor.getHits() != 2 {
-		t.Fatal("TTL not respected by ARC - got", testMonitor.getHits(), "hits")
+	w := getResponse(handler, "/")
+	if w.Header().Get("age") != "" {
+		t.Fatal("Age header was added when it should be empty")
 	}
 }
 
 // Multiple calls to Start should not cause race conditions
 func TestMultipleStart(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:     30 * time.Second,
 		Monitor: testMonitor,
 		Driver:  NewDriverLRU(10),
@@ -441,7 +1107,7 @@ func TestMultipleStart(t *testing.T) {
 // Without WriteHeader
 func TestNoWriteHeader(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:     30 * time.Second,
 		Monitor: testMonitor,
 		Driver:  NewDriverLRU(10),
@@ -462,7 +1128,7 @@ func TestNoWriteHeader(t *testing.T) {
 // Websocket should pass through
 func TestWebsocketPassthrough(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		Driver:  NewDriverLRU(10),
 		Monitor: testMonitor,
 	})
@@ -492,7 +1158,7 @@ func TestWebsocketPassthrough(t *testing.T) {
 // Nocache should pass through when triggered by header
 func TestNocacheHeader(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		Driver:  NewDriverLRU(10),
 		Monitor: testMonitor,
 	})
@@ -518,11 +1184,11 @@ func TestNocacheHeader(t *testing.T) {
 // TTL should be respected when used with compression
 func TestCompressorTTL(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:        30 * time.Second,
 		Monitor:    testMonitor,
 		Driver:     NewDriverLRU(10),
-		Compressor: CompressorSnappy{},
+		Compressor: CompressorGzip{},
 	})
 	defer cache.Stop()
 	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
@@ -543,7 +1209,7 @@ func TestCompressorTTL(t *testing.T) {
 // Vary operates as expected
 func TestVary(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:     30 * time.Second,
 		Monitor: testMonitor,
 		Driver:  NewDriverLRU(10),
@@ -583,10 +1249,52 @@ func TestVary(t *testing.T) {
 	}
 }
 
+// Vary headers are normalized before hashing
+func TestVaryNormalizers(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+		Vary:    []string{"accept-language"},
+		VaryNormalizers: map[string]func(string) string{
+			"accept-language": func(v string) string {
+				return strings.SplitN(v, "-", 2)[0]
+			},
+			"x-variant": strings.ToLower,
+		},
+		Exposed: true,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Microcache-Vary", "x-variant")
+	}))
+	cases := []struct {
+		hdr map[string]string
+		hit bool
+	}{
+		{map[string]string{"accept-language": "en-US,en;q=0.9"}, false},
+		{map[string]string{"accept-language": "en-GB"}, true},
+		{map[string]string{"accept-language": "fr-FR"}, false},
+		{map[string]string{"accept-language": "en", "x-variant": "A"}, false},
+		{map[string]string{"accept-language": "en", "x-variant": "a"}, true},
+	}
+	for i, c := range cases {
+		h := http.Header{}
+		for k, v := range c.hdr {
+			h.Set(k, v)
+		}
+		r := getResponseWithHeader(handler, "/", h)
+		if c.hit != (r.Header().Get("microcache") == "HIT") {
+			t.Fatalf("Hit should have been %v for case %d", c.hit, i+1)
+		}
+	}
+}
+
 // Vary Query operates as expected
 func TestVaryQuery(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:     30 * time.Second,
 		Monitor: testMonitor,
 		Driver:  NewDriverLRU(10),
@@ -619,7 +1327,7 @@ func TestVaryQuery(t *testing.T) {
 // Unsafe requests should miss
 func TestUnsafe(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:     30 * time.Second,
 		Monitor: testMonitor,
 		Driver:  NewDriverLRU(10),
@@ -648,7 +1356,7 @@ func TestUnsafe(t *testing.T) {
 // Unsafe requests should miss and purge objects
 func TestUnsafePurge(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:     30 * time.Second,
 		Monitor: testMonitor,
 		Driver:  NewDriverLRU(10),
@@ -684,9 +1392,326 @@ func TestUnsafePurge(t *testing.T) {
 	}
 }
 
+// Tenants are partitioned and purged independently
+func TestTenant(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+		Exposed: true,
+		TenantKeyFunc: func(r *http.Request) string {
+			return r.Header.Get("x-tenant")
+		},
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("x-tenant")))
+	}))
+	cases := []struct {
+		tenant string
+		purge  string
+		hit    bool
+	}{
+		{"a", "", false},
+		{"a", "", true},
+		{"b", "", false},
+		{"b", "", true},
+		{"a", "a", false},
+		{"a", "", true},
+		{"b", "", true},
+		{"c", "c", false},
+	}
+	for i, c := range cases {
+		if c.purge != "" {
+			cache.PurgeTenant(c.purge)
+		}
+		h := http.Header{}
+		h.Set("x-tenant", c.tenant)
+		r := getResponseWithHeader(handler, "/", h)
+		if c.hit != (r.Header().Get("microcache") == "HIT") {
+			t.Fatalf("Hit should have been %v for case %d", c.hit, i+1)
+		}
+		if r.Body.String() != c.tenant {
+			t.Fatalf("Tenant %s received response for tenant %s", c.tenant, r.Body.String())
+		}
+	}
+}
+
+// Cacheable POST requests are cached by body key
+func TestCacheablePOST(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:                  30 * time.Second,
+		StaleWhileRevalidate: 30 * time.Second,
+		Monitor:              testMonitor,
+		Driver:               NewDriverLRU(10),
+		Exposed:              true,
+		CacheablePOST: func(r *http.Request) (string, bool) {
+			if r.URL.Path != "/search" {
+				return "", false
+			}
+			b := make([]byte, 1)
+			r.Body.Read(b)
+			return string(b), true
+		},
+	})
+	defer cache.Stop()
+	var mutex sync.Mutex
+	var bodies []string
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		bodies = append(bodies, string(body))
+		mutex.Unlock()
+		w.Write(body)
+	}))
+	post := func(url, body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", url, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Body.String() != body {
+			t.Fatalf("Handler received %q, expected %q", w.Body.String(), body)
+		}
+		return w
+	}
+	cases := []struct {
+		url  string
+		body string
+		hit  bool
+	}{
+		{"/search", "abc", false},
+		{"/search", "abc", true},
+		{"/search", "xyz", false},
+		{"/search", "xyz", true},
+		{"/other", "abc", false},
+		{"/other", "abc", false},
+	}
+	for i, c := range cases {
+		r := post(c.url, c.body)
+		if c.hit != (r.Header().Get("microcache") == "HIT") {
+			t.Fatalf("Hit should have been %v for case %d", c.hit, i+1)
+		}
+	}
+
+	// Body is replayed during background revalidation
+	cache.offsetIncr(31 * time.Second)
+	post("/search", "abc")
+	time.Sleep(10 * time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(bodies) != 5 || bodies[4] != "abc" {
+		t.Fatalf("Background revalidation should replay request body %q", bodies)
+	}
+}
+
+// CacheablePOST bodies larger than MaxRequestBodyBuffer pass through uncached
+func TestCacheablePOSTBodyLimit(t *testing.T) {
+	bodyKey := func(r *http.Request) (string, bool) {
+		body, err := ioutil.ReadAll(r.Body)
+		return string(body), err == nil
+	}
+	cache := MustNew(Config{
+		TTL:                  30 * time.Second,
+		MaxRequestBodyBuffer: 4,
+		Driver:               NewDriverLRU(10),
+		Exposed:              true,
+		CacheablePOST:        bodyKey,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	cases := []struct {
+		body string
+		hit  bool
+	}{
+		{"abcdefgh", false},
+		{"abcdefgh", false},
+		{"abc", false},
+		{"abc", true},
+	}
+	for i, c := range cases {
+		// Hide the content length to exercise the read limit
+		r, _ := http.NewRequest("POST", "/", ioutil.NopCloser(strings.NewReader(c.body)))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Body.String() != c.body {
+			t.Fatalf("Handler received %q, expected %q", w.Body.String(), c.body)
+		}
+		if c.hit != (w.Header().Get("microcache") == "HIT") {
+			t.Fatalf("Hit should have been %v for case %d", c.hit, i+1)
+		}
+	}
+
+	// POST request hashes use the configured Hasher
+	r, _ := http.NewRequest("POST", "/", strings.NewReader("abc"))
+	if key := ComputeKey(KeyConfig{Hasher: HasherXXHash{}, CacheablePOST: bodyKey}, r); len(key) != 8 {
+		t.Fatalf("Expected 8 byte POST request hash, got %d", len(key))
+	}
+}
+
+// PurgeOnWrite purges all variants and PurgeRelated purges related uris
+func TestPurgeOnWrite(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:          30 * time.Second,
+		Monitor:      testMonitor,
+		Driver:       NewDriverLRU(10),
+		Exposed:      true,
+		PurgeOnWrite: true,
+		PurgeRelated: func(r *http.Request) []string {
+			if strings.HasPrefix(r.URL.Path, "/items/") {
+				return []string{"/items"}
+			}
+			return nil
+		},
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("microcache-vary", "x-variant")
+	}))
+	cases := []struct {
+		url     string
+		method  string
+		variant string
+		hit     bool
+	}{
+		{"/items", "GET", "a", false},
+		{"/items", "GET", "b", false},
+		{"/items/1", "GET", "a", false},
+		{"/items", "GET", "a", true},
+		{"/items", "GET", "b", true},
+		{"/items/1", "GET", "a", true},
+		{"/items", "POST", "a", false},
+		{"/items", "GET", "a", false},
+		{"/items", "GET", "b", false},
+		{"/items/1", "GET", "a", true},
+		{"/items/1", "PUT", "b", false},
+		{"/items/1", "GET", "a", false},
+		{"/items", "GET", "a", false},
+		{"/items", "GET", "b", false},
+		{"/items", "GET", "b", true},
+	}
+	for i, c := range cases {
+		r, _ := http.NewRequest(c.method, c.url, nil)
+		r.Header.Set("x-variant", c.variant)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if c.hit != (w.Header().Get("microcache") == "HIT") {
+			t.Fatalf("Hit should have been %v for case %d", c.hit, i+1)
+		}
+	}
+}
+
+// Modifying headers of a served response does not modify the cached object
+func TestSendResponseHeaders(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:    30 * time.Second,
+		Driver: NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-A", "1")
+		w.Write(bytes.Repeat([]byte("a"), readFromMinSize))
+	}))
+	for i := 0; i < 3; i++ {
+		r := getResponse(handler, "/")
+		if len(r.Header()["X-A"]) != 1 || r.Body.Len() != readFromMinSize {
+			t.Fatalf("Cached response modified %v", r.Header())
+		}
+		r.Header().Add("X-A", "2")
+	}
+}
+
+// Debug headers are returned only when requested with a valid token
+func TestDebug(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:         30 * time.Second,
+		Driver:      NewDriverLRU(10),
+		DebugHeader: "secret",
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/"})
+	h := http.Header{}
+	h.Set("microcache-debug", "wrong")
+	w := getResponseWithHeader(handler, "/", h)
+	if w.Header().Get("microcache-debug-request-hash") != "" {
+		t.Fatal("Debug headers should not be returned without a valid token")
+	}
+	h.Set("microcache-debug", "secret")
+	w = getResponseWithHeader(handler, "/", h)
+	if w.Header().Get("microcache-debug-request-hash") == "" ||
+		w.Header().Get("microcache-debug-object-found") != "true" ||
+		w.Header().Get("microcache-debug-ttl") != "30" {
+		t.Fatalf("Debug headers not returned %#v", w.Header())
+	}
+}
+
+// Logger receives cache decisions and driver failures
+func TestLogger(t *testing.T) {
+	logger := &testLogger{}
+	cache := MustNew(Config{
+		TTL:    30 * time.Second,
+		Driver: errorDriver{NewDriverLRU(10)},
+		Logger: logger,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/"})
+	if logger.count("debug", "microcache miss") != 1 {
+		t.Fatal("Logger should have logged miss")
+	}
+	if logger.count("warn", "microcache driver error") != 1 {
+		t.Fatal("Logger should have logged driver error")
+	}
+}
+
+// Driver and compressor errors are reported to the monitor
+func TestDriverError(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Driver:  errorDriver{NewDriverLRU(10)},
+		Monitor: testMonitor,
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/", "/"})
+	getResponseWithMethod(handler, "/", "POST")
+	if testMonitor.getDriverErrors() != 2 || testMonitor.getMisses() != 3 {
+		t.Fatalf("Driver errors not reported %s", dumpMonitor(testMonitor))
+	}
+
+	// Corrupt compressed objects are treated as not found
+	testMonitor = &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	d := NewDriverLRU(10)
+	cache = MustNew(Config{
+		TTL:        30 * time.Second,
+		Driver:     d,
+		Compressor: CompressorGzip{},
+		Monitor:    testMonitor,
+	})
+	defer cache.Stop()
+	handler = cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/"})
+	for _, k := range d.ResponseCache.Keys() {
+		res, _ := d.ResponseCache.Get(k)
+		obj := res.(Response)
+		obj.body = []byte("corrupt")
+		d.ResponseCache.Add(k, obj)
+	}
+	batchGet(handler, []string{"/"})
+	if testMonitor.getDriverErrors() != 1 || testMonitor.getMisses() != 2 {
+		t.Fatalf("Compressor errors not reported %s", dumpMonitor(testMonitor))
+	}
+}
+
 // Stop
 func TestStop(t *testing.T) {
-	cache := New(Config{})
+	cache := MustNew(Config{})
 	done := make(chan bool)
 	go func() {
 		cache.Stop()
@@ -749,6 +1774,23 @@ func getResponseWithMethod(handler http.Handler, url string, m string) *httptest
 	return w
 }
 
+type fakeClock struct {
+	now   time.Time
+	mutex sync.Mutex
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) add(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
 func noopSuccessHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "done", 200)
 }
@@ -772,12 +1814,178 @@ func timelySuccessHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "done", 200)
 }
 
+type testLogger struct {
+	mutex sync.Mutex
+	logs  []string
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.logs = append(l.logs, "debug "+msg)
+}
+
+func (l *testLogger) Warn(msg string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.logs = append(l.logs, "warn "+msg)
+}
+
+func (l *testLogger) count(level, msg string) (n int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, log := range l.logs {
+		if log == level+" "+msg {
+			n++
+		}
+	}
+	return n
+}
+
+// errorDriver fails all writes
+type errorDriver struct {
+	Driver
+}
+
+func (d errorDriver) Set(hash string, res Response) error {
+	return fmt.Errorf("set failed")
+}
+
+func (d errorDriver) Remove(hash string) error {
+	return fmt.Errorf("remove failed")
+}
+
 func dumpMonitor(m *monitorFunc) string {
-	return fmt.Sprintf("Hits: %d, Misses: %d, Backend: %d, Stales: %d, Errors: %d",
+	return fmt.Sprintf("Hits: %d, Misses: %d, Backend: %d, Stales: %d, Errors: %d, Timeouts: %d, DriverErrors: %d",
 		m.getHits(),
 		m.getMisses(),
 		m.getBackends(),
 		m.getStales(),
 		m.getErrors(),
+		m.getTimeouts(),
+		m.getDriverErrors(),
 	)
 }
+
+// Concurrent hits and late backend writes must never modify cached headers
+// Run with -race to detect shared state
+func TestCachedHeadersImmutable(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:    30 * time.Second,
+		Driver: NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var backendHeader http.Header
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Foo", "original")
+		w.Header().Add("X-Bar", "original")
+		backendHeader = w.Header()
+	}))
+	getResponse(handler, "/")
+	backendHeader.Set("X-Foo", "backend")
+	backendHeader["X-Bar"][0] = "backend"
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h := getResponse(handler, "/").Header()
+				h["X-Foo"][0] = "client"
+				h["X-Bar"] = append(h["X-Bar"], "client")
+			}
+		}()
+	}
+	wg.Wait()
+	h := getResponse(handler, "/").Header()
+	if h.Get("X-Foo") != "original" || len(h["X-Bar"]) != 1 || h.Get("X-Bar") != "original" {
+		t.Fatalf("Cached headers modified: %v", h)
+	}
+}
+
+// TTLRemaining reports the freshness of cached responses
+func TestTTLRemaining(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:          30 * time.Second,
+		StaleIfError: 30 * time.Second,
+		HashQuery:    true,
+		Clock:        &fakeClock{now: time.Now()},
+		Driver:       NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("microcache-vary", "Accept-Language")
+		if r.URL.Query().Get("ttl") != "" {
+			w.Header().Set("microcache-ttl", r.URL.Query().Get("ttl"))
+		}
+	}))
+	r, _ := http.NewRequest("GET", "/", nil)
+	if _, ok := cache.TTLRemaining(r); ok {
+		t.Fatal("TTLRemaining should report uncached requests")
+	}
+	getResponse(handler, "/")
+	getResponse(handler, "/?ttl=60")
+	cache.offsetIncr(10 * time.Second)
+	for i, c := range []struct {
+		url       string
+		lang      string
+		remaining time.Duration
+		ok        bool
+	}{
+		{"/", "", 20 * time.Second, true},
+		{"/?ttl=60", "", 50 * time.Second, true},
+		{"/", "fr", 0, false},
+		{"/?ttl=5", "", 0, false},
+	} {
+		r, _ := http.NewRequest("GET", c.url, nil)
+		r.Header.Set("Accept-Language", c.lang)
+		remaining, ok := cache.TTLRemaining(r)
+		if remaining != c.remaining || ok != c.ok {
+			t.Fatalf("Case %d: expected %v %v, got %v %v", i+1, c.remaining, c.ok, remaining, ok)
+		}
+	}
+	cache.offsetIncr(30 * time.Second)
+	if remaining, ok := cache.TTLRemaining(r); remaining != 0 || !ok {
+		t.Fatalf("Expired response should report zero, got %v %v", remaining, ok)
+	}
+}
+
+// Caches sharing a driver with different key prefixes should not collide
+func TestKeyPrefix(t *testing.T) {
+	driver := NewDriverLRU(10)
+	newCache := func(prefix, body string) (Microcache, http.Handler) {
+		cache := MustNew(Config{
+			TTL:       30 * time.Second,
+			Driver:    driver,
+			KeyPrefix: prefix,
+		})
+		return cache, cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+	}
+	cacheA, handlerA := newCache("a:", "a")
+	defer cacheA.Stop()
+	cacheB, handlerB := newCache("b:", "b")
+	defer cacheB.Stop()
+	if getResponse(handlerA, "/").Body.String() != "a" {
+		t.Fatal("Cache A returned wrong body")
+	}
+	if getResponse(handlerB, "/").Body.String() != "b" {
+		t.Fatal("Cache B returned cache A's response")
+	}
+	size := driver.GetSize()
+	if err := cacheA.PurgeAll(); err != nil {
+		t.Fatal(err)
+	}
+	if driver.GetSize() != size/2 {
+		t.Fatal("PurgeAll should remove only keys having the cache's prefix")
+	}
+	if getResponse(handlerB, "/").Body.String() != "b" {
+		t.Fatal("Cache B lost its response")
+	}
+	cacheC := MustNew(Config{Driver: struct{ Driver }{NewDriverLRU(10)}, KeyPrefix: "c:"})
+	defer cacheC.Stop()
+	if cacheC.PurgeAll() == nil {
+		t.Fatal("PurgeAll should fail for drivers not implementing DriverRemovePrefix")
+	}
+}
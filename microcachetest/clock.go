@@ -0,0 +1,38 @@
+package microcachetest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake microcache.Clock which only moves when advanced
+type Clock struct {
+	now   time.Time
+	mutex sync.Mutex
+}
+
+// NewClock returns a Clock set to now
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current fake time
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to now
+func (c *Clock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = now
+}
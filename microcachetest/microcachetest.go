@@ -0,0 +1,70 @@
+// Package microcachetest provides a fake clock, a recording monitor and assertion
+// helpers for writing deterministic tests of handlers wrapped by microcache.
+//
+//	clock := microcachetest.NewClock(time.Now())
+//	monitor := microcachetest.NewMonitor()
+//	cache := microcache.MustNew(microcache.Config{
+//		TTL:     30 * time.Second,
+//		Exposed: true,
+//		Clock:   clock,
+//		Monitor: monitor,
+//	})
+//	handler := cache.Middleware(app)
+//	microcachetest.ExpectMiss(t, handler, "/")
+//	microcachetest.ExpectHit(t, handler, "/")
+//	clock.Advance(time.Minute)
+//	microcachetest.ExpectMiss(t, handler, "/")
+//
+// The assertion helpers read the microcache response header so Config.Exposed must be true.
+package microcachetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Do serves a request and returns the recorded response
+func Do(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// Get serves a GET request for target and returns the recorded response
+func Get(h http.Handler, target string) *httptest.ResponseRecorder {
+	return Do(h, httptest.NewRequest("GET", target, nil))
+}
+
+// Expect serves a request and fails the test if the cache status reported by the
+// microcache response header does not match status (HIT, MISS or STALE)
+func Expect(t testing.TB, h http.Handler, r *http.Request, status string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := Do(h, r)
+	switch got := w.Header().Get("microcache"); got {
+	case status:
+	case "":
+		t.Errorf("%s %s: microcache header missing, expected %s (is Config.Exposed set?)", r.Method, r.URL, status)
+	default:
+		t.Errorf("%s %s: expected %s, got %s", r.Method, r.URL, status, got)
+	}
+	return w
+}
+
+// ExpectHit serves a GET request for target and fails the test if it was not a cache hit
+func ExpectHit(t testing.TB, h http.Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	return Expect(t, h, httptest.NewRequest("GET", target, nil), "HIT")
+}
+
+// ExpectMiss serves a GET request for target and fails the test if it was not a cache miss
+func ExpectMiss(t testing.TB, h http.Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	return Expect(t, h, httptest.NewRequest("GET", target, nil), "MISS")
+}
+
+// ExpectStale serves a GET request for target and fails the test if it was not served stale
+func ExpectStale(t testing.TB, h http.Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	return Expect(t, h, httptest.NewRequest("GET", target, nil), "STALE")
+}
@@ -0,0 +1,87 @@
+package microcachetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kevburnsjr/microcache"
+)
+
+func TestHarness(t *testing.T) {
+	clock := NewClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	monitor := NewMonitor()
+	cache := microcache.MustNew(microcache.Config{
+		TTL:          30 * time.Second,
+		StaleIfError: 30 * time.Second,
+		Exposed:      true,
+		Clock:        clock,
+		Monitor:      monitor,
+		Driver:       microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	fail := false
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "fail", 500)
+		}
+	}))
+	ExpectMiss(t, handler, "/")
+	ExpectHit(t, handler, "/")
+	clock.Advance(31 * time.Second)
+	fail = true
+	ExpectStale(t, handler, "/")
+	fail = false
+	ExpectMiss(t, handler, "/")
+	if monitor.Hits() != 1 || monitor.Misses() != 2 || monitor.Stales() != 1 {
+		t.Fatalf("Unexpected counts: %d hits, %d misses, %d stales", monitor.Hits(), monitor.Misses(), monitor.Stales())
+	}
+	monitor.Reset()
+	if monitor.Hits() != 0 {
+		t.Fatal("Reset should zero counts")
+	}
+}
+
+// Timeouts are counted from events rather than as errors
+func TestMonitorTimeouts(t *testing.T) {
+	monitor := NewMonitor()
+	cache := microcache.MustNew(microcache.Config{
+		Timeout: 10 * time.Millisecond,
+		Monitor: monitor,
+		Driver:  microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if monitor.Timeouts() != 1 || monitor.Errors() != 0 {
+		t.Fatalf("Expected 1 timeout and 0 errors, got %d and %d", monitor.Timeouts(), monitor.Errors())
+	}
+}
+
+func TestExpectFailure(t *testing.T) {
+	cache := microcache.MustNew(microcache.Config{
+		TTL:    30 * time.Second,
+		Driver: microcache.NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := &recorder{TB: t}
+	ExpectMiss(rec, handler, "/")
+	if !rec.failed {
+		t.Fatal("Expect should fail when the microcache header is not exposed")
+	}
+}
+
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failed = true
+}
@@ -0,0 +1,103 @@
+package microcachetest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kevburnsjr/microcache"
+)
+
+// Monitor is a microcache.Monitor which records counts for inspection by tests.
+// Unlike microcache.MonitorFunc, counts are not reset when stats are logged.
+type Monitor struct {
+	mutex        sync.Mutex
+	hits         int
+	misses       int
+	stales       int
+	backends     int
+	errors       int
+	driverErrors int
+	events       map[microcache.EventType]int
+	stats        microcache.Stats
+}
+
+// NewMonitor returns an empty Monitor
+func NewMonitor() *Monitor {
+	return &Monitor{}
+}
+
+// GetInterval returns a long interval so that stats are only logged on Stop
+func (m *Monitor) GetInterval() time.Duration {
+	return time.Hour
+}
+
+// Log records the most recently logged stats
+func (m *Monitor) Log(stats microcache.Stats) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.stats = stats
+}
+
+func (m *Monitor) Hit()         { m.incr(&m.hits) }
+func (m *Monitor) Miss()        { m.incr(&m.misses) }
+func (m *Monitor) Stale()       { m.incr(&m.stales) }
+func (m *Monitor) Backend()     { m.incr(&m.backends) }
+func (m *Monitor) Error()       { m.incr(&m.errors) }
+func (m *Monitor) DriverError() { m.incr(&m.driverErrors) }
+
+// Event counts events by type
+func (m *Monitor) Event(t microcache.EventType, labels microcache.Labels) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.events == nil {
+		m.events = map[microcache.EventType]int{}
+	}
+	m.events[t]++
+}
+
+func (m *Monitor) incr(n *int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	*n++
+}
+
+func (m *Monitor) get(n *int) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return *n
+}
+
+func (m *Monitor) Hits() int         { return m.get(&m.hits) }
+func (m *Monitor) Misses() int       { return m.get(&m.misses) }
+func (m *Monitor) Stales() int       { return m.get(&m.stales) }
+func (m *Monitor) Backends() int     { return m.get(&m.backends) }
+func (m *Monitor) Errors() int       { return m.get(&m.errors) }
+func (m *Monitor) DriverErrors() int { return m.get(&m.driverErrors) }
+
+// Timeouts returns the number of EventTimeout events
+func (m *Monitor) Timeouts() int {
+	return m.Events(microcache.EventTimeout)
+}
+
+// Events returns the number of events of type t
+func (m *Monitor) Events(t microcache.EventType) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.events[t]
+}
+
+// Stats returns the most recently logged stats
+func (m *Monitor) Stats() microcache.Stats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.stats
+}
+
+// Reset sets all counts to zero
+func (m *Monitor) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.hits, m.misses, m.stales, m.backends = 0, 0, 0, 0
+	m.errors, m.driverErrors = 0, 0
+	m.events = nil
+}
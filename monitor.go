@@ -13,13 +13,108 @@ type Monitor interface {
 	Stale()
 	Backend()
 	Error()
+	DriverError()
 }
 
+// Stats are reported to the Monitor each interval and returned by Microcache.Stats.
+//
+// Errors counts backend 5xx responses. Backend timeouts are not errors and are counted
+// in Timeouts instead.
+//
+// Counters derived from events (Backend2xx through Backend5xx, Timeouts, Retries,
+// Panics, VariantsRejected, StaleErrors through StaleCanceled, Revalidations,
+// WastedRevalidations, Verified, VerifyMismatches, Events and ByLabel) are only reported
+// by MonitorFunc, although Microcache.Stats also returns Timeouts. Custom Monitors may
+// count them by implementing MonitorEvents.
 type Stats struct {
-	Size    int
+	// Size is the number of response objects stored in the cache
+	Size int
+
+	// Bytes is the approximate size in bytes of response objects stored in the cache
+	// Only reported when the Driver implements DriverSizeBytes
+	Bytes int
+
+	// Rejected is the number of writes rejected by the driver's admission policy
+	// during the interval. Only reported when the Driver implements DriverRejections
+	Rejected int
+
 	Hits    int
 	Misses  int
 	Stales  int
 	Backend int
 	Errors  int
+
+	// Backend2xx, Backend3xx, Backend4xx and Backend5xx count backend responses
+	// by status class
+	Backend2xx int
+	Backend3xx int
+	Backend4xx int
+	Backend5xx int
+
+	// Timeouts counts backend requests which exceeded the timeout (see EventTimeout)
+	Timeouts int
+
+	// Retries counts backend requests retried due to BackendRetries
+	Retries int
+
+	// Panics counts recovered handler panics
+	Panics int
+
+	// VariantsRejected counts responses served uncached due to MaxVariantsPerKey
+	VariantsRejected int
+
+	// StaleErrors, StaleTimeouts, StalePanics and StaleCanceled count stale responses
+	// served in place of 5xx responses, timeouts, recovered handler panics and
+	// canceled requests respectively
+	StaleErrors   int
+	StaleTimeouts int
+	StalePanics   int
+	StaleCanceled int
+
+	// Revalidations counts successful background revalidations. WastedRevalidations
+	// counts those returning a body identical to the cached object. A high proportion
+	// of wasted revalidations suggests that ttls are too short
+	Revalidations       int
+	WastedRevalidations int
+
+	// Verified counts cache hits compared to a backend response by VerifySampleRate.
+	// VerifyMismatches counts those for which the status or body differed
+	Verified         int
+	VerifyMismatches int
+
+	// DriverErrors counts failures reported by the driver or compressor
+	DriverErrors int
+
+	// Collapsing is the number of requests currently waiting on or holding a collapsed
+	// forwarding key. Revalidating is the number of background revalidations currently
+	// in flight or queued and RevalidateQueued the number awaiting a worker. These are
+	// gauges. Values which grow without bound indicate a hung backend.
+	Collapsing       int
+	Revalidating     int
+	RevalidateQueued int
+
+	// Events counts events reported to MonitorEvents by type
+	Events map[EventType]int
+
+	// TopKeys lists the most hit objects during the interval
+	// Only reported when Config.TopKeys is set
+	TopKeys []KeyHits
+
+	// ByLabel counts requests by the label returned by Config.LabelFunc
+	// Only reported when Config.LabelFunc is set
+	ByLabel map[string]LabelStats
+}
+
+// LabelStats counts the outcomes of requests having a label
+type LabelStats struct {
+	Hits   int
+	Misses int
+	Stales int
+}
+
+// KeyHits is the approximate number of cache hits for an object.
+// Key is a request URI of the object.
+type KeyHits struct {
+	Key  string
+	Hits int
 }
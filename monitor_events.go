@@ -0,0 +1,160 @@
+package microcache
+
+import (
+	"strconv"
+)
+
+// EventType identifies a cache event reported to MonitorEvents
+type EventType string
+
+const (
+	// EventTimeout is reported when a backend request exceeds its timeout
+	// Labels: path
+	EventTimeout EventType = "timeout"
+
+	// EventDriverError is reported when the driver or compressor fails
+	// Labels: op
+	EventDriverError EventType = "driver_error"
+
+	// EventDriverReadFailure is reported when a driver implementing DriverReadErrors
+	// fails to read and the request is handled according to Config.FailureMode
+	// Labels: path, mode (open or closed)
+	EventDriverReadFailure EventType = "driver_read_failure"
+
+	// EventCollision is reported when a cached object retrieved for a request was
+	// stored for a different request having the same hash
+	// Labels: path
+	EventCollision EventType = "collision"
+
+	// EventPurge is reported when cached objects are purged following an unsafe request
+	// Labels: path, scope (object, all, prefix, match or expired). Path is omitted for
+	// scopes prefix, match and expired
+	EventPurge EventType = "purge"
+
+	// EventCollapse is reported when a request waits on a duplicate in-flight request
+	// Labels: path
+	EventCollapse EventType = "collapse"
+
+	// EventBackendResponse is reported for each backend response
+	// Labels: path, status (status class 2xx, 3xx, 4xx or 5xx)
+	EventBackendResponse EventType = "backend_response"
+
+	// EventPassthrough is reported for each response served directly from the handler
+	// without caching (nocache, unsafe methods and websockets)
+	// Labels: path, status (status class), bytes
+	EventPassthrough EventType = "passthrough"
+
+	// EventPanic is reported when a handler panic is recovered
+	// Labels: path
+	EventPanic EventType = "panic"
+
+	// EventRevalidate is reported when a cached object is revalidated in the background
+	// Labels: path
+	EventRevalidate EventType = "revalidate"
+
+	// EventWarm is reported when a hot key is revalidated by the background warmer
+	// (see Config.WarmKeys)
+	// Labels: path
+	EventWarm EventType = "warm"
+
+	// EventRevalidateComplete is reported when a background revalidation succeeds.
+	// Changed is false when the new body is identical to the cached object, indicating
+	// a wasted revalidation.
+	// Labels: path, changed (true or false)
+	EventRevalidateComplete EventType = "revalidate_complete"
+
+	// EventRevalidateDropped is reported when a background revalidation is dropped
+	// because the revalidation queue is full
+	// Labels: path
+	EventRevalidateDropped EventType = "revalidate_dropped"
+
+	// EventRevalidateFailure is reported when a background revalidation fails due to
+	// a backend error, timeout or the expiration of RevalidateTimeout
+	// Labels: path, status
+	EventRevalidateFailure EventType = "revalidate_failure"
+
+	// EventStaleIfError is reported when a stale response is served in place of a
+	// failed backend response. Reason is error (5xx status), timeout, panic or
+	// canceled (the request context was canceled or exceeded its deadline).
+	// Labels: path, reason
+	EventStaleIfError EventType = "stale_if_error"
+
+	// EventInvalidResponse is reported when a backend response is not cached because
+	// it was rejected by Config.ValidateResponse
+	// Labels: path, status (status class)
+	EventInvalidResponse EventType = "invalid_response"
+
+	// EventBypass is reported when a request bypasses the cache with the bypass
+	// header or query parameter
+	// Labels: path
+	EventBypass EventType = "bypass"
+
+	// EventRefresh is reported when a cached object is replaced following a request
+	// sent with microcache-refresh or Cache-Control: no-cache
+	// Labels: path
+	EventRefresh EventType = "refresh"
+
+	// EventVerify is reported when a sampled cache hit has been compared to a backend
+	// response. Result is match, status or body.
+	// Labels: path, result
+	EventVerify EventType = "verify"
+
+	// EventMaintenance is reported when a request having no cached object receives
+	// MaintenanceResponse while maintenance mode is enabled
+	// Labels: path
+	EventMaintenance EventType = "maintenance"
+
+	// EventHedge is reported when a stale response is served because the backend did
+	// not respond within HedgeAfter
+	// Labels: path
+	EventHedge EventType = "hedge"
+
+	// EventBackendRetry is reported when a backend request is retried following a
+	// 5xx response. Attempt is the retry number starting from 1.
+	// Labels: path, attempt
+	EventBackendRetry EventType = "backend_retry"
+
+	// EventVariantLimit is reported when a response is not stored because its request
+	// hash already has MaxVariantsPerKey stored variants
+	// Labels: path
+	EventVariantLimit EventType = "variant_limit"
+
+	// EventRequest is reported for each request served when Config.LabelFunc is set.
+	// Outcome is hit, miss or stale. Status is the response status class (ie. 2xx).
+	// Labels: label, outcome, status
+	EventRequest EventType = "request"
+)
+
+// Labels describe a cache event
+type Labels map[string]string
+
+// MonitorEvents is an optional interface which may be implemented by a Monitor to
+// receive cache events. New events may be added without changing the Monitor interface.
+type MonitorEvents interface {
+	Event(EventType, Labels)
+}
+
+// staleReason returns the reason a stale response is served in place of a backend response
+func staleReason(timedOut, panicked, canceled bool) string {
+	switch {
+	case timedOut:
+		return "timeout"
+	case panicked:
+		return "panic"
+	case canceled:
+		return "canceled"
+	}
+	return "error"
+}
+
+// statusClass returns the class of an http status code (ie. 2xx)
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// event reports a cache event to the monitor if it implements MonitorEvents
+func (m *microcache) event(t EventType, labels Labels) {
+	if e, ok := m.Monitor.(MonitorEvents); ok {
+		e.Event(t, labels)
+	}
+}
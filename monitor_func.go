@@ -1,6 +1,7 @@
 package microcache
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -14,16 +15,33 @@ func MonitorFunc(interval time.Duration, logFunc func(Stats)) *monitorFunc {
 }
 
 type monitorFunc struct {
-	interval time.Duration
-	logFunc  func(Stats)
-	hits     int64
-	misses   int64
-	stales   int64
-	backend  int64
-	errors   int64
-	stop     chan bool
+	interval  time.Duration
+	logFunc   func(Stats)
+	hits      int64
+	misses    int64
+	stales    int64
+	backend   int64
+	errors    int64
+	timeouts  int64
+	retries   int64
+	panics    int64
+	variants  int64
+	driverErr int64
+	status    [6]int64
+	stale     [4]int64
+	revalid   int64
+	wasted    int64
+	verified  int64
+	mismatch  int64
+	events    map[EventType]int
+	byLabel   map[string]LabelStats
+	eventsMux sync.Mutex
+	stop      chan bool
 }
 
+// staleReasons indexes monitorFunc stale counts by EventStaleIfError reason
+var staleReasons = [4]string{"error", "timeout", "panic", "canceled"}
+
 func (m *monitorFunc) GetInterval() time.Duration {
 	return m.interval
 }
@@ -44,6 +62,47 @@ func (m *monitorFunc) Log(stats Stats) {
 	// errors
 	stats.Errors = int(atomic.SwapInt64(&m.errors, 0))
 
+	// timeouts
+	stats.Timeouts = int(atomic.SwapInt64(&m.timeouts, 0))
+
+	// retries
+	stats.Retries = int(atomic.SwapInt64(&m.retries, 0))
+
+	// panics
+	stats.Panics = int(atomic.SwapInt64(&m.panics, 0))
+
+	// variants rejected
+	stats.VariantsRejected = int(atomic.SwapInt64(&m.variants, 0))
+
+	// driver errors
+	stats.DriverErrors = int(atomic.SwapInt64(&m.driverErr, 0))
+
+	// backend responses by status class
+	stats.Backend2xx = int(atomic.SwapInt64(&m.status[2], 0))
+	stats.Backend3xx = int(atomic.SwapInt64(&m.status[3], 0))
+	stats.Backend4xx = int(atomic.SwapInt64(&m.status[4], 0))
+	stats.Backend5xx = int(atomic.SwapInt64(&m.status[5], 0))
+
+	// stale responses by reason
+	stats.StaleErrors = int(atomic.SwapInt64(&m.stale[0], 0))
+	stats.StaleTimeouts = int(atomic.SwapInt64(&m.stale[1], 0))
+	stats.StalePanics = int(atomic.SwapInt64(&m.stale[2], 0))
+	stats.StaleCanceled = int(atomic.SwapInt64(&m.stale[3], 0))
+
+	// revalidations
+	stats.Revalidations = int(atomic.SwapInt64(&m.revalid, 0))
+	stats.WastedRevalidations = int(atomic.SwapInt64(&m.wasted, 0))
+
+	// verifications
+	stats.Verified = int(atomic.SwapInt64(&m.verified, 0))
+	stats.VerifyMismatches = int(atomic.SwapInt64(&m.mismatch, 0))
+
+	// events
+	m.eventsMux.Lock()
+	stats.Events, m.events = m.events, nil
+	stats.ByLabel, m.byLabel = m.byLabel, nil
+	m.eventsMux.Unlock()
+
 	// log
 	m.logFunc(stats)
 }
@@ -68,6 +127,71 @@ func (m *monitorFunc) Error() {
 	atomic.AddInt64(&m.errors, 1)
 }
 
+func (m *monitorFunc) DriverError() {
+	atomic.AddInt64(&m.driverErr, 1)
+}
+
+// Event counts events by type, reported in Stats.Events
+func (m *monitorFunc) Event(t EventType, labels Labels) {
+	if t == EventBackendResponse {
+		if class := labels["status"]; len(class) == 3 && class[0] >= '2' && class[0] <= '5' {
+			atomic.AddInt64(&m.status[class[0]-'0'], 1)
+		}
+	}
+	if t == EventTimeout {
+		atomic.AddInt64(&m.timeouts, 1)
+	}
+	if t == EventBackendRetry {
+		atomic.AddInt64(&m.retries, 1)
+	}
+	if t == EventPanic {
+		atomic.AddInt64(&m.panics, 1)
+	}
+	if t == EventVariantLimit {
+		atomic.AddInt64(&m.variants, 1)
+	}
+	if t == EventStaleIfError {
+		for i, reason := range staleReasons {
+			if labels["reason"] == reason {
+				atomic.AddInt64(&m.stale[i], 1)
+			}
+		}
+	}
+	if t == EventRevalidateComplete {
+		atomic.AddInt64(&m.revalid, 1)
+		if labels["changed"] == "false" {
+			atomic.AddInt64(&m.wasted, 1)
+		}
+	}
+	if t == EventVerify {
+		atomic.AddInt64(&m.verified, 1)
+		if labels["result"] != "match" {
+			atomic.AddInt64(&m.mismatch, 1)
+		}
+	}
+	m.eventsMux.Lock()
+	defer m.eventsMux.Unlock()
+	if m.events == nil {
+		m.events = map[EventType]int{}
+	}
+	m.events[t]++
+	if t == EventRequest {
+		if m.byLabel == nil {
+			m.byLabel = map[string]LabelStats{}
+		}
+		s := m.byLabel[labels["label"]]
+		switch Outcome(labels["outcome"]) {
+		case OutcomeHit:
+			s.Hits++
+		case OutcomeMiss:
+			s.Misses++
+		case OutcomeStale:
+			s.Stales++
+		}
+		m.byLabel[labels["label"]] = s
+	}
+}
+
 func (m *monitorFunc) getHits() int {
 	return int(atomic.LoadInt64(&m.hits))
 }
@@ -87,3 +211,17 @@ func (m *monitorFunc) getBackends() int {
 func (m *monitorFunc) getErrors() int {
 	return int(atomic.LoadInt64(&m.errors))
 }
+
+func (m *monitorFunc) getTimeouts() int {
+	return int(atomic.LoadInt64(&m.timeouts))
+}
+
+func (m *monitorFunc) getDriverErrors() int {
+	return int(atomic.LoadInt64(&m.driverErr))
+}
+
+func (m *monitorFunc) getEvents(t EventType) int {
+	m.eventsMux.Lock()
+	defer m.eventsMux.Unlock()
+	return m.events[t]
+}
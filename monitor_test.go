@@ -2,6 +2,8 @@ package microcache
 
 import (
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -26,7 +28,7 @@ func TestMicrocacheCallsMonitor(t *testing.T) {
 	testMonitor := &monitorFunc{interval: 10 * time.Millisecond, logFunc: func(s Stats) {
 		statChan <- s.Size
 	}}
-	cache := New(Config{
+	cache := MustNew(Config{
 		TTL:     30 * time.Second,
 		Monitor: testMonitor,
 		Driver:  NewDriverLRU(10),
@@ -39,3 +41,186 @@ func TestMicrocacheCallsMonitor(t *testing.T) {
 		t.Fatal("Monitor was not called by microcache")
 	}
 }
+
+// Microcache reports size in bytes to monitor
+func TestMonitorBytes(t *testing.T) {
+	var statChan = make(chan int)
+	testMonitor := &monitorFunc{interval: 10 * time.Millisecond, logFunc: func(s Stats) {
+		statChan <- s.Bytes
+	}}
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/"})
+	if bytes := <-statChan; bytes == 0 {
+		t.Fatal("Monitor should report size in bytes")
+	}
+}
+
+// rejectingDriver is a DriverLRU reporting a fixed number of rejected writes
+type rejectingDriver struct {
+	DriverLRU
+	rejected *int32
+}
+
+func (d rejectingDriver) GetRejected() int {
+	return int(atomic.LoadInt32(d.rejected))
+}
+
+// Microcache reports driver rejections during each interval to monitor
+func TestMonitorRejected(t *testing.T) {
+	var statChan = make(chan int)
+	testMonitor := &monitorFunc{interval: 10 * time.Millisecond, logFunc: func(s Stats) {
+		statChan <- s.Rejected
+	}}
+	rejected := new(int32)
+	atomic.StoreInt32(rejected, 5)
+	cache := MustNew(Config{
+		Monitor: testMonitor,
+		Driver:  rejectingDriver{NewDriverLRU(10), rejected},
+	})
+	defer cache.Stop()
+	atomic.AddInt32(rejected, 3)
+	if n := <-statChan; n != 3 {
+		t.Fatalf("Monitor should report 3 rejections, got %d", n)
+	}
+	if n := <-statChan; n != 0 {
+		t.Fatalf("Monitor should report 0 rejections, got %d", n)
+	}
+}
+
+// Microcache reports most hit keys to monitor
+func TestMonitorTopKeys(t *testing.T) {
+	var statChan = make(chan []KeyHits)
+	testMonitor := &monitorFunc{interval: 10 * time.Millisecond, logFunc: func(s Stats) {
+		statChan <- s.TopKeys
+	}}
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		TopKeys: 1,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/a", "/a", "/b", "/b", "/b"})
+	topKeys := <-statChan
+	if len(topKeys) != 1 || topKeys[0].Key != "/b" || topKeys[0].Hits != 2 {
+		t.Fatalf("Monitor received incorrect top keys %#v", topKeys)
+	}
+}
+
+// Monitors implementing MonitorEvents receive events
+func TestMonitorEvents(t *testing.T) {
+	var events map[EventType]int
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(s Stats) {
+		events = s.Events
+	}}
+	cache := MustNew(Config{
+		TTL:                  30 * time.Second,
+		StaleWhileRevalidate: 30 * time.Second,
+		Monitor:              testMonitor,
+		Driver:               NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/"})
+	cache.offsetIncr(31 * time.Second)
+	batchGet(handler, []string{"/"})
+	time.Sleep(10 * time.Millisecond)
+	getResponseWithMethod(handler, "/", "POST")
+	if testMonitor.getEvents(EventRevalidate) != 1 || testMonitor.getEvents(EventPurge) != 1 {
+		t.Fatal("Monitor should receive revalidate and purge events")
+	}
+	testMonitor.Log(Stats{})
+	if events[EventRevalidate] != 1 || events[EventPurge] != 1 || testMonitor.getEvents(EventPurge) != 0 {
+		t.Fatal("Monitor should report and reset events", events)
+	}
+}
+
+// Backend responses are counted by status class
+func TestMonitorStatusClass(t *testing.T) {
+	var stats Stats
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(s Stats) {
+		stats = s
+	}}
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Path[1:])
+		w.WriteHeader(status)
+	}))
+	batchGet(handler, []string{"/200", "/200", "/201", "/301", "/404", "/404", "/500", "/503"})
+	testMonitor.Log(Stats{})
+	if stats.Backend2xx != 2 || stats.Backend3xx != 1 || stats.Backend4xx != 2 || stats.Backend5xx != 2 {
+		t.Fatalf("Monitor reports inaccurate status classes %#v", stats)
+	}
+}
+
+// Revalidations returning an unchanged body are counted as wasted
+func TestMonitorWastedRevalidations(t *testing.T) {
+	var stats Stats
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(s Stats) {
+		stats = s
+	}}
+	cache := MustNew(Config{
+		TTL:                  30 * time.Second,
+		StaleWhileRevalidate: 30 * time.Second,
+		Monitor:              testMonitor,
+		Driver:               NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/changed" {
+			w.Write([]byte(strconv.FormatInt(time.Now().UnixNano(), 10)))
+			return
+		}
+		noopSuccessHandler(w, r)
+	}))
+	batchGet(handler, []string{"/", "/changed"})
+	cache.offsetIncr(31 * time.Second)
+	batchGet(handler, []string{"/", "/changed"})
+	time.Sleep(10 * time.Millisecond)
+	testMonitor.Log(Stats{})
+	if stats.Revalidations != 2 || stats.WastedRevalidations != 1 {
+		t.Fatalf("Wasted revalidations not counted %d/%d", stats.WastedRevalidations, stats.Revalidations)
+	}
+}
+
+// Recovered handler panics are counted
+func TestMonitorPanics(t *testing.T) {
+	var stats Stats
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(s Stats) {
+		stats = s
+	}}
+	cache := MustNew(Config{
+		TTL:           30 * time.Second,
+		RecoverPanics: true,
+		Monitor:       testMonitor,
+		Driver:        NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("panic")
+		}
+		noopSuccessHandler(w, r)
+	}))
+	batchGet(handler, []string{"/", "/panic", "/panic"})
+	testMonitor.Log(Stats{})
+	if stats.Panics != 2 {
+		t.Fatalf("Expected 2 panics, got %d", stats.Panics)
+	}
+	testMonitor.Log(Stats{})
+	if stats.Panics != 0 {
+		t.Fatalf("Panics should reset, got %d", stats.Panics)
+	}
+}
@@ -0,0 +1,54 @@
+// Package microcachenats provides a NATS Invalidator for microcache.
+package microcachenats
+
+import (
+	"github.com/kevburnsjr/microcache"
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultSubject is the subject used when none is specified
+const DefaultSubject = "microcache.invalidate"
+
+// Invalidator broadcasts microcache purges to peer instances over NATS
+//
+//	cache := microcache.MustNew(microcache.Config{
+//		Invalidator: microcachenats.NewInvalidator(conn, ""),
+//	})
+type Invalidator struct {
+	conn    *nats.Conn
+	subject string
+}
+
+var _ microcache.Invalidator = (*Invalidator)(nil)
+
+// NewInvalidator returns an Invalidator publishing to subject
+// Default subject: microcache.invalidate
+func NewInvalidator(conn *nats.Conn, subject string) *Invalidator {
+	if subject == "" {
+		subject = DefaultSubject
+	}
+	return &Invalidator{conn, subject}
+}
+
+// Publish broadcasts a message to all subscribed instances
+func (i *Invalidator) Publish(msg []byte) error {
+	return i.conn.Publish(i.subject, msg)
+}
+
+// Subscribe calls handler with each message published to the subject.
+// Returns once the subscription is confirmed by the server.
+func (i *Invalidator) Subscribe(handler func([]byte)) (func(), error) {
+	sub, err := i.conn.Subscribe(i.subject, func(msg *nats.Msg) {
+		handler(msg.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := i.conn.Flush(); err != nil {
+		sub.Unsubscribe()
+		return nil, err
+	}
+	return func() {
+		sub.Unsubscribe()
+	}, nil
+}
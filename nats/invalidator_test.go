@@ -0,0 +1,43 @@
+package microcachenats
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Messages are delivered to subscribers
+// Requires a NATS server at MICROCACHE_NATS_URL
+func TestInvalidator(t *testing.T) {
+	url := os.Getenv("MICROCACHE_NATS_URL")
+	if url == "" {
+		t.Skip("MICROCACHE_NATS_URL not set")
+	}
+	conn, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	inv := NewInvalidator(conn, "microcache.test")
+	received := make(chan []byte, 1)
+	unsubscribe, err := inv.Subscribe(func(msg []byte) {
+		received <- msg
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+	if err := inv.Publish([]byte("purge")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-received:
+		if string(msg) != "purge" {
+			t.Fatalf("Unexpected message %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Message not received")
+	}
+}
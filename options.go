@@ -0,0 +1,30 @@
+package microcache
+
+import (
+	"net/http"
+	"strings"
+)
+
+// preflightHeaders are the request headers distinguishing CORS preflight responses
+var preflightHeaders = []string{
+	"Origin",
+	"Access-Control-Request-Method",
+	"Access-Control-Request-Headers",
+}
+
+// writePreflightKey writes the CORS request headers of an OPTIONS request
+func writePreflightKey(h *hashBuffer, r *http.Request) {
+	h.write("&options")
+	for _, header := range preflightHeaders {
+		h.write("&", header, ":", strings.ToLower(strings.Join(r.Header[header], ",")))
+	}
+}
+
+// getOptionsRequestHash adds the CORS request headers of an OPTIONS request to a
+// request hash so that preflights never share objects with GET and HEAD requests
+func getOptionsRequestHash(m *microcache, reqHash string, r *http.Request) Key {
+	h := getHashBuffer()
+	h.write(reqHash)
+	writePreflightKey(h, r)
+	return h.sum(m.Hasher)
+}
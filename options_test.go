@@ -0,0 +1,76 @@
+package microcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func getPreflight(handler http.Handler, url, origin string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest("OPTIONS", url, nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func preflightHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	noopSuccessHandler(w, r)
+}
+
+// OPTIONS requests pass through without sharing objects with GET by default
+func TestOptionsPassthrough(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(preflightHandler))
+	getPreflight(handler, "/", "https://a.example")
+	getPreflight(handler, "/", "https://a.example")
+	if w := getResponse(handler, "/"); w.Code != 200 {
+		t.Fatalf("GET served OPTIONS response %d", w.Code)
+	}
+	if testMonitor.getMisses() != 3 || testMonitor.getHits() != 0 {
+		t.Fatalf("OPTIONS should pass through %s", dumpMonitor(testMonitor))
+	}
+}
+
+// CacheOptions caches preflights per origin with OptionsTTL
+func TestCacheOptions(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	clock := &fakeClock{now: time.Now()}
+	cache := MustNew(Config{
+		Nocache:      true,
+		TTL:          30 * time.Second,
+		CacheOptions: true,
+		OptionsTTL:   600 * time.Second,
+		Clock:        clock,
+		Monitor:      testMonitor,
+		Driver:       NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(preflightHandler))
+	getPreflight(handler, "/", "https://a.example")
+	getPreflight(handler, "/", "https://b.example")
+	clock.add(300 * time.Second)
+	if w := getPreflight(handler, "/", "https://b.example"); w.Header().Get("Access-Control-Allow-Origin") != "https://b.example" {
+		t.Fatalf("Preflight not keyed on origin %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	getPreflight(handler, "/", "https://a.example")
+	if w := getResponse(handler, "/"); w.Code != 200 {
+		t.Fatalf("GET served OPTIONS response %d", w.Code)
+	}
+	if testMonitor.getHits() != 2 || testMonitor.getMisses() != 3 {
+		t.Fatalf("Preflights not cached %s", dumpMonitor(testMonitor))
+	}
+}
@@ -0,0 +1,90 @@
+package microcache
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// passthrough serves a request directly from the handler without caching and
+// returns the response status
+func (m *microcache) passthrough(h http.Handler, w http.ResponseWriter, r *http.Request, req RequestOpts) int {
+	ptw := &passthroughWriter{ResponseWriter: w}
+	m.withTimeout(h, req).ServeHTTP(ptw, r)
+	m.event(EventPassthrough, Labels{
+		"path":   r.URL.Path,
+		"status": statusClass(ptw.getStatus()),
+		"bytes":  strconv.FormatInt(ptw.size, 10),
+	})
+	return ptw.getStatus()
+}
+
+// passthroughWriter captures the status and size of a response written directly
+// to the client while preserving the optional interfaces of the underlying writer
+type passthroughWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (w *passthroughWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.Header().Del(panicHeader)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *passthroughWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *passthroughWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err := rf.ReadFrom(src)
+		w.size += n
+		return n, err
+	}
+	return io.Copy(writerOnly{w}, src)
+}
+
+func (w *passthroughWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *passthroughWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.status = http.StatusSwitchingProtocols
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("microcache: response writer does not support hijacking")
+}
+
+// getStatus returns the response status, defaulting to 200 OK if none was written
+func (w *passthroughWriter) getStatus() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// writerOnly hides optional interfaces to prevent io.Copy recursion
+type writerOnly struct {
+	io.Writer
+}
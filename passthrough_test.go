@@ -0,0 +1,53 @@
+package microcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// passthroughWriter captures status and size
+func TestPassthroughWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &passthroughWriter{ResponseWriter: rec}
+	w.Write([]byte("abc"))
+	w.WriteHeader(http.StatusNotFound)
+	if w.getStatus() != http.StatusOK || w.size != 3 {
+		t.Fatalf("Implicit status not captured %d %d", w.getStatus(), w.size)
+	}
+
+	rec = httptest.NewRecorder()
+	w = &passthroughWriter{ResponseWriter: rec}
+	w.WriteHeader(http.StatusNotFound)
+	n, _ := w.ReadFrom(strings.NewReader("abcdef"))
+	w.Flush()
+	if w.getStatus() != http.StatusNotFound || w.size != 6 || n != 6 || rec.Body.String() != "abcdef" || !rec.Flushed {
+		t.Fatalf("Status or size not captured %d %d", w.getStatus(), w.size)
+	}
+	if _, _, err := w.Hijack(); err == nil {
+		t.Fatal("Hijack should fail when unsupported")
+	}
+
+	w = &passthroughWriter{ResponseWriter: httptest.NewRecorder()}
+	if w.getStatus() != http.StatusOK {
+		t.Fatal("Empty response should default to 200")
+	}
+}
+
+// Passthrough responses are reported to MonitorEvents
+func TestPassthroughEvent(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		Nocache: true,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/", "/", "/"})
+	if testMonitor.getEvents(EventPassthrough) != 2 {
+		t.Fatal("Passthrough responses should be reported", testMonitor.getEvents(EventPassthrough))
+	}
+}
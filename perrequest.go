@@ -0,0 +1,27 @@
+package microcache
+
+import (
+	"net/http"
+)
+
+// stripPerRequestHeaders removes PerRequestHeaders from a response about to be
+// stored so that request IDs and trace context are never replayed from the cache
+func (m *microcache) stripPerRequestHeaders(h http.Header) {
+	for _, header := range m.PerRequestHeaders {
+		h.Del(header)
+	}
+}
+
+// setPerRequestHeaders passes the live request's values of PerRequestHeaders through
+// to a response served from the cache. Values already set on the response, ie. by
+// an outer middleware, are left intact.
+func (m *microcache) setPerRequestHeaders(w http.ResponseWriter, r *http.Request) {
+	for _, header := range m.PerRequestHeaders {
+		if _, ok := w.Header()[header]; ok {
+			continue
+		}
+		if values, ok := r.Header[header]; ok {
+			w.Header()[header] = append([]string(nil), values...)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package microcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// PerRequestHeaders should never be served from the cache
+func TestPerRequestHeaders(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:               30 * time.Second,
+		PerRequestHeaders: []string{"x-request-id"},
+		Driver:            NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		w.Write([]byte("done\n"))
+	}))
+	get := func(id string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if id != "" {
+			r.Header.Set("X-Request-ID", id)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	if id := get("a").Header().Get("X-Request-ID"); id != "a" {
+		t.Fatalf("Expected live request ID a on miss, got %q", id)
+	}
+	if id := get("b").Header().Get("X-Request-ID"); id != "b" {
+		t.Fatalf("Expected live request ID b on hit, got %q", id)
+	}
+	if ids := get("").Header()["X-Request-Id"]; len(ids) > 0 {
+		t.Fatalf("Request ID should not be replayed from the cache, got %v", ids)
+	}
+}
@@ -0,0 +1,58 @@
+package microcache
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBufferSize is the largest buffer capacity returned to a pool so that
+// occasional large responses are not retained indefinitely
+const maxPooledBufferSize = 1 << 20
+
+var bodyPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 4<<10)
+		return &b
+	},
+}
+
+// getBody returns an empty pooled buffer used to capture a response body
+func getBody() []byte {
+	return (*bodyPool.Get().(*[]byte))[:0]
+}
+
+// putBody returns a body buffer to the pool
+// The buffer must not be referenced afterward
+func putBody(b []byte) {
+	if cap(b) == 0 || cap(b) > maxPooledBufferSize {
+		return
+	}
+	b = b[:0]
+	bodyPool.Put(&b)
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer returns an empty pooled scratch buffer
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns a scratch buffer to the pool
+// The buffer's contents must not be referenced afterward
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBufferSize {
+		return
+	}
+	b.Reset()
+	bufferPool.Put(b)
+}
+
+// cloneBytes returns an exactly sized copy of b
+func cloneBytes(b []byte) []byte {
+	return append(make([]byte, 0, len(b)), b...)
+}
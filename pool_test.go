@@ -0,0 +1,35 @@
+package microcache
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Cached bodies must not be corrupted when pooled capture buffers are reused
+func TestBodyPoolReuse(t *testing.T) {
+	key, _ := NewEncryptorAESGCM([]byte("0123456789abcdef"))
+	for name, cfg := range map[string]Config{
+		"none":    {},
+		"gzip":    {Compressor: CompressorGzip{}},
+		"encrypt": {Encryptor: key},
+	} {
+		cfg.TTL = 30 * time.Second
+		cfg.Driver = NewDriverLRU(100)
+		cache := MustNew(cfg)
+		handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(strings.Repeat(r.URL.Path, 100)))
+		}))
+		for i := 0; i < 50; i++ {
+			getResponse(handler, "/"+strings.Repeat(string(rune('a'+i%26)), 1+i/26))
+		}
+		for i := 0; i < 50; i++ {
+			path := "/" + strings.Repeat(string(rune('a'+i%26)), 1+i/26)
+			if body := getResponse(handler, path).Body.String(); body != strings.Repeat(path, 100) {
+				t.Fatalf("%s: cached body for %s corrupted", name, path)
+			}
+		}
+		cache.Stop()
+	}
+}
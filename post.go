@@ -0,0 +1,80 @@
+package microcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// BodyKeyFunc returns a cache key derived from the body of a POST request and
+// whether the request may be cached
+//
+//	func(r *http.Request) (string, bool) {
+//		if r.URL.Path != "/search" {
+//			return "", false
+//		}
+//		body, err := ioutil.ReadAll(r.Body)
+//		return string(body), err == nil
+//	}
+type BodyKeyFunc func(r *http.Request) (string, bool)
+
+// defaultPostBodyLimit is the maximum size of a cacheable POST body when
+// MaxRequestBodyBuffer is not set
+const defaultPostBodyLimit = 1 << 20
+
+// getPostKey calls CacheablePOST, restoring any portion of the body it consumes.
+// The body of a cacheable request is buffered so that it may be replayed during
+// background revalidation. Bodies larger than MaxRequestBodyBuffer (default 1MB) are
+// never buffered in full and the request passes through uncached.
+func (m *microcache) getPostKey(r *http.Request) (string, bool) {
+	limit := m.MaxRequestBodyBuffer
+	if limit <= 0 {
+		limit = defaultPostBodyLimit
+	}
+	if r.ContentLength > limit {
+		return "", false
+	}
+	buf := &bytes.Buffer{}
+	body := r.Body
+	r.Body = ioutil.NopCloser(io.TeeReader(io.LimitReader(body, limit+1), buf))
+	key, ok := m.CacheablePOST(r)
+	if ok {
+		_, err := buf.ReadFrom(io.LimitReader(body, limit+1-int64(buf.Len())))
+		ok = err == nil && int64(buf.Len()) <= limit
+	}
+	if !ok {
+		r.Body = readCloser{io.MultiReader(buf, body), body}
+		return "", false
+	}
+	b := buf.Bytes()
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	return key, true
+}
+
+// getPostRequestHash adds a POST body key to a request hash
+func getPostRequestHash(m *microcache, reqHash, key string) Key {
+	return m.Hasher.Sum([]byte(reqHash + "&post:" + key))
+}
+
+type postKeyContextKey struct{}
+
+// withPostKey attaches a POST body key to a request for inclusion in its canonical key
+func withPostKey(r *http.Request, key string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), postKeyContextKey{}, key))
+}
+
+// getPostKeyFromContext returns the POST body key attached to a request, if any
+func getPostKeyFromContext(r *http.Request) (string, bool) {
+	key, ok := r.Context().Value(postKeyContextKey{}).(string)
+	return key, ok
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,110 @@
+package microcache
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrPurgeAllUnsupported is returned by PurgeAll when the driver does not implement
+// DriverRemovePrefix
+var ErrPurgeAllUnsupported = errors.New("microcache: driver does not support PurgeAll")
+
+// PurgeAll removes all request options and response objects having keys beginning
+// with KeyPrefix (all keys if KeyPrefix is empty). The driver must implement
+// DriverRemovePrefix. The purge is broadcast to peers having the same KeyPrefix if an
+// Invalidator is configured.
+func (m *microcache) PurgeAll() error {
+	if err := m.purgeAll(); err != nil {
+		return err
+	}
+	m.publish(invalidation{Type: invalidateAll, Prefix: m.KeyPrefix})
+	return nil
+}
+
+// purgeAll removes all keys having KeyPrefix from the driver
+func (m *microcache) purgeAll() error {
+	d, ok := m.Driver.(DriverRemovePrefix)
+	if !ok {
+		return ErrPurgeAllUnsupported
+	}
+	if m.l1 != nil {
+		m.l1.cache.Purge()
+	}
+	if m.variants != nil {
+		m.variants.Purge()
+	}
+	m.event(EventPurge, Labels{"scope": "prefix"})
+	m.logDebug("microcache purge all", "prefix", m.KeyPrefix)
+	if err := d.RemovePrefix(m.KeyPrefix); err != nil {
+		m.driverError("RemovePrefix", err)
+		return err
+	}
+	return nil
+}
+
+// purge removes cached objects following a successful unsafe request
+func (m *microcache) purge(r *http.Request, reqHash string, req RequestOpts) {
+	m.purgeRequest(r, reqHash, req)
+	if m.PurgeRelated == nil {
+		return
+	}
+	for _, uri := range m.PurgeRelated(r) {
+		u, err := r.URL.Parse(uri)
+		if err != nil {
+			m.logWarn("microcache invalid related uri", "uri", uri, "error", err)
+			continue
+		}
+		rr := r.Clone(r.Context())
+		rr.Method = "GET"
+		rr.URL = u
+		rrHash := getRequestHash(m, rr)
+		rrOpts, err := m.getRequestOpts(rr.Context(), rrHash)
+		if err != nil {
+			m.driverError("GetRequestOpts", err)
+			continue
+		}
+		m.purgeRequest(rr, rrHash, rrOpts)
+	}
+}
+
+// purgeRequest removes the cached object matching a request. When PurgeOnWrite is
+// enabled, the request options are assigned a new version so that all variants
+// sharing the request hash become unreachable and are eventually evicted.
+func (m *microcache) purgeRequest(r *http.Request, reqHash string, req RequestOpts) {
+	if !req.found {
+		return
+	}
+	m.logDebug("microcache purge", "path", r.URL.Path, "method", r.Method)
+	objHash := req.getObjectHash(m, reqHash, r)
+	m.invalidate(r.URL.Path, reqHash, req, objHash)
+	m.publish(invalidation{
+		Type:    invalidateRequest,
+		Path:    r.URL.Path,
+		Request: []byte(reqHash),
+		Object:  []byte(objHash),
+	})
+}
+
+// invalidate assigns the request options a new version if PurgeOnWrite is enabled,
+// otherwise removes the object
+func (m *microcache) invalidate(path, reqHash string, req RequestOpts, objHash string) {
+	if m.PurgeOnWrite {
+		if !req.found {
+			return
+		}
+		m.event(EventPurge, Labels{"path": path, "scope": "all"})
+		req.version = newRequestVersion()
+		m.setRequestOpts(reqHash, req)
+		return
+	}
+	m.event(EventPurge, Labels{"path": path, "scope": "object"})
+	m.remove(objHash)
+}
+
+// newRequestVersion returns a version unique to the request options of a resource.
+// Versions are assigned whenever request options are created so that objects stored
+// prior to a purge never resurface if the request options are evicted.
+func newRequestVersion() int64 {
+	return time.Now().UnixNano()
+}
@@ -0,0 +1,78 @@
+package microcache
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ErrPurgeMatchUnsupported is returned by PurgeMatch when PurgeIndexSize is not set
+var ErrPurgeMatchUnsupported = errors.New("microcache: PurgeMatch requires PurgeIndexSize")
+
+// PurgeMatch removes all indexed response objects whose request path matches pattern.
+// Patterns are globs matched with path.Match (* does not match path separators).
+// Patterns prefixed with re: are regular expressions.
+//
+//	PurgeMatch("/api/v1/products/*")
+//	PurgeMatch("re:^/api/v1/products/")
+//
+// Objects are indexed by path as they are stored. The index retains the paths of the
+// PurgeIndexSize most recently stored objects. The purge is broadcast to peers if an
+// Invalidator is configured.
+func (m *microcache) PurgeMatch(pattern string) error {
+	if err := m.purgeMatch(pattern); err != nil {
+		return err
+	}
+	m.publish(invalidation{Type: invalidateMatch, Pattern: pattern})
+	return nil
+}
+
+// purgeMatch removes indexed objects matching pattern
+func (m *microcache) purgeMatch(pattern string) error {
+	if m.purgeIndex == nil {
+		return ErrPurgeMatchUnsupported
+	}
+	match, err := pathMatcher(pattern)
+	if err != nil {
+		return err
+	}
+	var n int
+	for _, objHash := range m.purgeIndex.Keys() {
+		p, ok := m.purgeIndex.Peek(objHash)
+		if !ok || !match(p.(string)) {
+			continue
+		}
+		m.purgeIndex.Remove(objHash)
+		m.remove(objHash)
+		n++
+	}
+	m.event(EventPurge, Labels{"scope": "match"})
+	m.logDebug("microcache purge match", "pattern", pattern, "objects", n)
+	return nil
+}
+
+// pathMatcher compiles a glob or re: prefixed regular expression
+func pathMatcher(pattern string) (func(string) bool, error) {
+	if strings.HasPrefix(pattern, "re:") {
+		re, err := regexp.Compile(pattern[3:])
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return func(p string) bool {
+		ok, _ := path.Match(pattern, p)
+		return ok
+	}, nil
+}
+
+// indexPath records the request path of a stored object for PurgeMatch
+func (m *microcache) indexPath(objHash, path string) {
+	if m.purgeIndex != nil {
+		m.purgeIndex.Add(objHash, path)
+	}
+}
@@ -0,0 +1,58 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// PurgeMatch removes objects whose paths match a glob or regular expression
+func TestPurgeMatch(t *testing.T) {
+	invalidator := &memoryInvalidator{}
+	var caches []*microcache
+	var handlers []http.Handler
+	var monitors []*monitorFunc
+	for i := 0; i < 2; i++ {
+		testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+		cache := newMicrocache(Config{
+			TTL:            30 * time.Second,
+			PurgeIndexSize: 100,
+			Invalidator:    invalidator,
+			Monitor:        testMonitor,
+			Driver:         NewDriverLRU(10),
+		})
+		defer cache.Stop()
+		caches = append(caches, cache)
+		monitors = append(monitors, testMonitor)
+		handlers = append(handlers, cache.Middleware(http.HandlerFunc(noopSuccessHandler)))
+	}
+	paths := []string{
+		"/products/1",
+		"/products/2",
+		"/products/1/reviews",
+		"/users/1",
+	}
+	for _, handler := range handlers {
+		batchGet(handler, paths)
+	}
+	if err := caches[0].PurgeMatch("/products/*"); err != nil {
+		t.Fatal(err)
+	}
+	if err := caches[0].PurgeMatch("re:/reviews$"); err != nil {
+		t.Fatal(err)
+	}
+	for i, handler := range handlers {
+		batchGet(handler, paths)
+		if monitors[i].getHits() != 1 || monitors[i].getMisses() != 7 {
+			t.Fatalf("%d: PurgeMatch not respected %s", i, dumpMonitor(monitors[i]))
+		}
+	}
+	if err := caches[0].PurgeMatch("re:("); err == nil {
+		t.Fatal("Invalid pattern should return an error")
+	}
+	cache := newMicrocache(Config{Driver: NewDriverLRU(10)})
+	defer cache.Stop()
+	if err := cache.PurgeMatch("/*"); err != ErrPurgeMatchUnsupported {
+		t.Fatalf("PurgeMatch without index should be unsupported %v", err)
+	}
+}
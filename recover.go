@@ -0,0 +1,33 @@
+package microcache
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// panicHeader marks a response rendered following a recovered panic so that the
+// reason for serving a stale response can be reported
+const panicHeader = "Microcache-Panic"
+
+// withRecover returns a handler which recovers panics in h, reporting them to the
+// monitor and logger and responding 500 Internal Server Error so that stale-if-error
+// applies. http.ErrAbortHandler is re-panicked in foreground requests to abort the
+// client response.
+func (m *microcache) withRecover(h http.Handler, background bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler && !background {
+				panic(err)
+			}
+			m.event(EventPanic, Labels{"path": r.URL.Path})
+			m.logWarn("microcache handler panic", "path", r.URL.Path, "error", err, "stack", string(debug.Stack()))
+			w.Header().Set(panicHeader, "1")
+			w.WriteHeader(http.StatusInternalServerError)
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,14 @@
+module github.com/kevburnsjr/microcache/redis
+
+go 1.21
+
+require (
+	github.com/kevburnsjr/microcache v1.1.0
+	github.com/redis/go-redis/v9 v9.5.1
+)
+
+require (
+	github.com/cespare/xxhash v1.1.0 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+)
@@ -0,0 +1,59 @@
+// Package microcacheredis provides a Redis pub/sub Invalidator and a Redis
+// DistributedLocker for microcache.
+package microcacheredis
+
+import (
+	"context"
+
+	"github.com/kevburnsjr/microcache"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultChannel is the pub/sub channel used when none is specified
+const DefaultChannel = "microcache-invalidate"
+
+// Invalidator broadcasts microcache purges to peer instances over Redis pub/sub
+//
+//	cache := microcache.MustNew(microcache.Config{
+//		Invalidator: microcacheredis.NewInvalidator(client, ""),
+//	})
+type Invalidator struct {
+	client  redis.UniversalClient
+	channel string
+}
+
+var _ microcache.Invalidator = (*Invalidator)(nil)
+
+// NewInvalidator returns an Invalidator publishing to channel
+// Default channel: microcache-invalidate
+func NewInvalidator(client redis.UniversalClient, channel string) *Invalidator {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	return &Invalidator{client, channel}
+}
+
+// Publish broadcasts a message to all subscribed instances
+func (i *Invalidator) Publish(msg []byte) error {
+	return i.client.Publish(context.Background(), i.channel, msg).Err()
+}
+
+// Subscribe calls handler with each message published to the channel.
+// Returns once the subscription is confirmed by the server.
+func (i *Invalidator) Subscribe(handler func([]byte)) (func(), error) {
+	ctx := context.Background()
+	ps := i.client.Subscribe(ctx, i.channel)
+	if _, err := ps.Receive(ctx); err != nil {
+		ps.Close()
+		return nil, err
+	}
+	ch := ps.Channel()
+	go func() {
+		for msg := range ch {
+			handler([]byte(msg.Payload))
+		}
+	}()
+	return func() {
+		ps.Close()
+	}, nil
+}
@@ -0,0 +1,40 @@
+package microcacheredis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Messages are delivered to subscribers
+// Requires a Redis server at MICROCACHE_REDIS_ADDR
+func TestInvalidator(t *testing.T) {
+	addr := os.Getenv("MICROCACHE_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("MICROCACHE_REDIS_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	inv := NewInvalidator(client, "microcache-test")
+	received := make(chan []byte, 1)
+	unsubscribe, err := inv.Subscribe(func(msg []byte) {
+		received <- msg
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+	if err := inv.Publish([]byte("purge")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-received:
+		if string(msg) != "purge" {
+			t.Fatalf("Unexpected message %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Message not received")
+	}
+}
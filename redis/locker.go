@@ -0,0 +1,63 @@
+package microcacheredis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/kevburnsjr/microcache"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultLockPrefix is the key prefix of locks when none is specified
+const DefaultLockPrefix = "microcache-lock:"
+
+// unlockScript deletes a lock only if it is still held with the given token
+var unlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// Locker deduplicates collapsed forwarding across instances with Redis locks
+//
+//	cache := microcache.MustNew(microcache.Config{
+//		CollapsedForwarding: true,
+//		Coalescer:           microcache.NewDistributedCoalescer(microcacheredis.NewLocker(client, "")),
+//	})
+type Locker struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+var _ microcache.DistributedLocker = (*Locker)(nil)
+
+// NewLocker returns a Locker storing locks under prefix
+// Default prefix: microcache-lock:
+func NewLocker(client redis.UniversalClient, prefix string) *Locker {
+	if prefix == "" {
+		prefix = DefaultLockPrefix
+	}
+	return &Locker{client, prefix}
+}
+
+// TryLock sets the lock to a random token if it is not already held
+func (l *Locker) TryLock(key string, ttl time.Duration) (string, bool, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", false, err
+	}
+	token := hex.EncodeToString(b[:])
+	ok, err := l.client.SetNX(context.Background(), l.prefix+key, token, ttl).Result()
+	if err != nil || !ok {
+		return "", false, err
+	}
+	return token, true, nil
+}
+
+// Unlock deletes the lock if it is still held with token
+func (l *Locker) Unlock(key, token string) error {
+	return unlockScript.Run(context.Background(), l.client, []string{l.prefix + key}, token).Err()
+}
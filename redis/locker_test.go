@@ -0,0 +1,48 @@
+package microcacheredis
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Locks are exclusive and only released by their holder
+// Requires a Redis server at MICROCACHE_REDIS_ADDR
+func TestLocker(t *testing.T) {
+	addr := os.Getenv("MICROCACHE_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("MICROCACHE_REDIS_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	l := NewLocker(client, "microcache-test-lock:")
+	tokenA, ok, err := l.TryLock("key", 50*time.Millisecond)
+	if err != nil || !ok {
+		t.Fatalf("Lock should be acquired: %v", err)
+	}
+	if _, ok, _ = l.TryLock("key", time.Second); ok {
+		t.Fatal("Held lock should not be acquired")
+	}
+	time.Sleep(100 * time.Millisecond)
+	tokenB, ok, err := l.TryLock("key", time.Second)
+	if err != nil || !ok {
+		t.Fatalf("Expired lock should be acquired: %v", err)
+	}
+	// The expired holder must not release the new holder's lock
+	if err = l.Unlock("key", tokenA); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ = l.TryLock("key", time.Second); ok {
+		t.Fatal("Lock should not be released by its previous holder")
+	}
+	if err = l.Unlock("key", tokenB); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ = l.TryLock("key", time.Second); !ok {
+		t.Fatal("Lock should be released by its holder")
+	}
+	client.Del(context.Background(), "microcache-test-lock:key")
+}
@@ -0,0 +1,35 @@
+package microcache
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// isRefresh reports whether a request asks to replace its cached object with a fresh
+// backend response, either with the microcache-refresh request header or, when
+// RefreshOnNoCache is enabled, with Cache-Control: no-cache (ie. shift-reload)
+func (m *microcache) isRefresh(r *http.Request) bool {
+	if m.Refresh {
+		if val := r.Header.Get("microcache-refresh"); val != "" {
+			if m.RefreshToken == "" ||
+				subtle.ConstantTimeCompare([]byte(val), []byte(m.RefreshToken)) == 1 {
+				return true
+			}
+		}
+	}
+	return m.RefreshOnNoCache && requestNoCache(r)
+}
+
+// requestNoCache reports whether request headers include Cache-Control: no-cache
+// or Pragma: no-cache
+func requestNoCache(r *http.Request) bool {
+	for _, hdr := range r.Header["Cache-Control"] {
+		for _, directive := range strings.Split(hdr, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+				return true
+			}
+		}
+	}
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Pragma")), "no-cache")
+}
@@ -0,0 +1,42 @@
+package microcache
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Refresh replaces cached objects with fresh backend responses
+func TestRefresh(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:              30 * time.Second,
+		Refresh:          true,
+		RefreshToken:     "secret",
+		RefreshOnNoCache: true,
+		Driver:           NewDriverLRU(10),
+		Exposed:          true,
+	})
+	defer cache.Stop()
+	var version int64
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte{byte('0' + atomic.AddInt64(&version, 1))})
+	}))
+	getResponse(handler, "/")
+	for i, c := range []struct {
+		header http.Header
+		body   string
+	}{
+		{http.Header{"Microcache-Refresh": {"wrong"}}, "1"},
+		{http.Header{"Microcache-Refresh": {"secret"}}, "2"},
+		{http.Header{}, "2"},
+		{http.Header{"Cache-Control": {"max-age=0, No-Cache"}}, "3"},
+		{http.Header{}, "3"},
+		{http.Header{"Pragma": {"no-cache"}}, "4"},
+		{http.Header{}, "4"},
+	} {
+		if r := getResponseWithHeader(handler, "/", c.header); r.Body.String() != c.body {
+			t.Fatalf("Case %d: expected %s, got %s", i+1, c.body, r.Body.String())
+		}
+	}
+}
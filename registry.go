@@ -0,0 +1,69 @@
+package microcache
+
+import (
+	"sync"
+	"time"
+)
+
+// DriverSpec holds the driver settings of a ConfigSpec
+type DriverSpec struct {
+	// Size is the number of items in the response cache (Default: 10000)
+	Size int
+
+	// RequestSize is the number of request options in the request cache (Default: Size)
+	RequestSize int
+
+	// Bytes is the maximum size of the cache in bytes
+	Bytes int64
+
+	// TTL bounds the lifetime of cache entries
+	TTL time.Duration
+}
+
+var (
+	registryMutex sync.RWMutex
+	drivers       = map[string]func(DriverSpec) Driver{}
+	compressors   = map[string]func() Compressor{}
+)
+
+// RegisterDriver makes a driver available by name to ConfigSpec and ConfigFromEnv.
+// Drivers implemented in submodules register themselves when imported so that their
+// dependencies are only required by programs which use them.
+//
+//	import _ "github.com/kevburnsjr/microcache/driver/ristretto"
+//
+// RegisterDriver panics if a driver is registered twice under the same name.
+func RegisterDriver(name string, f func(DriverSpec) Driver) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := drivers[name]; ok {
+		panic("microcache: driver registered twice: " + name)
+	}
+	drivers[name] = f
+}
+
+// RegisterCompressor makes a compressor available by name to ConfigSpec and
+// ConfigFromEnv. RegisterCompressor panics if a compressor is registered twice under
+// the same name.
+func RegisterCompressor(name string, f func() Compressor) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := compressors[name]; ok {
+		panic("microcache: compressor registered twice: " + name)
+	}
+	compressors[name] = f
+}
+
+func registeredDriver(name string) (func(DriverSpec) Driver, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	f, ok := drivers[name]
+	return f, ok
+}
+
+func registeredCompressor(name string) (func() Compressor, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	f, ok := compressors[name]
+	return f, ok
+}
@@ -1,34 +1,85 @@
 package microcache
 
 import (
-	"crypto/sha1"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unsafe"
 )
 
+var requestOptsSize = int(unsafe.Sizeof(RequestOpts{}))
+
 func getRequestHash(m *microcache, r *http.Request) string {
-	h := sha1.New()
-	h.Write([]byte(r.URL.Path))
+	h := getHashBuffer()
+	m.writeRequestKey(h, r)
+	return m.driverKey(h.sum(m.Hasher))
+}
+
+// writeRequestKey writes the request attributes hashed to produce a request hash
+func (m *microcache) writeRequestKey(h *hashBuffer, r *http.Request) {
+	if m.TenantKeyFunc != nil {
+		h.write(m.tenantKey(r))
+	}
+	// Host is empty for server requests and distinguishes origins for client requests
+	h.write(r.URL.Host, r.URL.Path)
+	if m.HashScheme {
+		h.write("&scheme:", requestScheme(r))
+	}
 	for _, header := range m.Vary {
-		h.Write([]byte("&" + header + ":" + r.Header.Get(header)))
+		h.write("&", header, ":", m.varyValue(r, header))
 	}
 	if m.HashQuery {
-		if m.QueryIgnore != nil {
-			for key, values := range r.URL.Query() {
-				if _, ok := m.QueryIgnore[key]; ok {
-					continue
-				}
-				for _, value := range values {
-					h.Write([]byte("&" + key + "=" + value))
+		if m.QueryInclude != nil {
+			query := r.URL.Query()
+			for _, key := range m.QueryInclude {
+				for _, value := range query[key] {
+					h.write("&", key, "=", value)
 				}
 			}
+		} else if m.QueryIgnore != nil || m.NormalizeQuery {
+			m.writeSortedQuery(h, r)
 		} else {
-			h.Write([]byte(r.URL.RawQuery))
+			h.write(r.URL.RawQuery)
+		}
+	}
+}
+
+// requestScheme returns the scheme of a request, preferring X-Forwarded-Proto
+// so that requests terminated by a TLS proxy are identified as https
+func requestScheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		if i := strings.IndexByte(proto, ','); i >= 0 {
+			proto = proto[:i]
+		}
+		return strings.ToLower(strings.TrimSpace(proto))
+	}
+	if r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// writeSortedQuery writes decoded query parameters sorted by key, omitting ignored
+// parameters, so that parameter order and percent-encoding do not affect the hash
+func (m *microcache) writeSortedQuery(h *hashBuffer, r *http.Request) {
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if _, ok := m.QueryIgnore[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range query[key] {
+			h.write("&", key, "=", value)
 		}
 	}
-	return string(h.Sum(nil))
 }
 
 // RequestOpts stores per-request cache options. This is necessary to allow
@@ -41,28 +92,69 @@ type RequestOpts struct {
 	staleRecache         bool
 	staleWhileRevalidate time.Duration
 	collapsedForwarding  bool
+	timeout              time.Duration
 	vary                 []string
 	varyQuery            []string
+	varyCookie           []string
 	nocache              bool
+	setCookie            bool
+	immutable            bool
+	version              int64
+}
+
+// Size returns the approximate number of bytes of memory consumed by the request options
+func (req RequestOpts) Size() int {
+	s := requestOptsSize
+	for _, v := range req.vary {
+		s += len(v)
+	}
+	for _, v := range req.varyQuery {
+		s += len(v)
+	}
+	for _, v := range req.varyCookie {
+		s += len(v)
+	}
+	return s
+}
+
+func (req *RequestOpts) getObjectHash(m *microcache, reqHash string, r *http.Request) string {
+	h := getHashBuffer()
+	h.write(reqHash)
+	req.writeObjectKey(m, h, r)
+	return m.driverKey(h.sum(m.Hasher))
 }
 
-func (req *RequestOpts) getObjectHash(reqHash string, r *http.Request) string {
-	h := sha1.New()
-	h.Write([]byte(reqHash))
+// writeObjectKey writes the request attributes added to a request hash to produce
+// an object hash
+func (req *RequestOpts) writeObjectKey(m *microcache, h *hashBuffer, r *http.Request) {
+	if req.version != 0 {
+		h.write("&version:", strconv.FormatInt(req.version, 10))
+	}
 	for _, header := range req.vary {
-		h.Write([]byte("&" + header + ":" + r.Header.Get(header)))
+		h.write("&", header, ":", m.varyValue(r, header))
 	}
 	if len(req.varyQuery) > 0 {
 		queryParams := r.URL.Query()
 		for _, param := range req.varyQuery {
 			if vals, ok := queryParams[param]; ok {
 				for _, val := range vals {
-					h.Write([]byte("&" + param + "=" + val))
+					h.write("&", param, "=", val)
 				}
 			}
 		}
 	}
-	return string(h.Sum(nil))
+	writeVaryCookie(h, r, req.varyCookie)
+}
+
+// clampTTL limits a ttl provided by response header to MinTTL and MaxTTL
+func (m *microcache) clampTTL(ttl time.Duration) time.Duration {
+	if m.MinTTL > 0 && ttl < m.MinTTL {
+		return m.MinTTL
+	}
+	if m.MaxTTL > 0 && ttl > m.MaxTTL {
+		return m.MaxTTL
+	}
+	return ttl
 }
 
 func buildRequestOpts(m *microcache, res Response, r *http.Request) RequestOpts {
@@ -75,88 +167,109 @@ func buildRequestOpts(m *microcache, res Response, r *http.Request) RequestOpts
 		staleRecache:         m.StaleRecache,
 		staleWhileRevalidate: m.StaleWhileRevalidate,
 		collapsedForwarding:  m.CollapsedForwarding,
-		vary:                 m.Vary,
+		vary:                 appendVary(nil, m.Vary...),
+	}
+	if m.PurgeOnWrite {
+		req.version = newRequestVersion()
+	}
+	if r.Method == "OPTIONS" {
+		req.nocache = false
+		if m.OptionsTTL > 0 {
+			req.ttl = m.OptionsTTL
+		}
+	}
+	if m.ImmutablePaths != nil && m.isImmutable(r) {
+		req.immutable = true
+		req.nocache = false
+	}
+	if !m.cacheableContentType(res) {
+		req.nocache = true
 	}
 
+	opts, err := ParseHeaders(headers)
+	if err != nil {
+		m.logWarn("microcache invalid header", "path", r.URL.Path, "error", err)
+	}
+
+	// w.Header().Set("Expires", "Thu, 01 Dec 1994 16:00:00 GMT")
+	m.applyExpires(&req, headers)
+
+	// w.Header().Set("Surrogate-Control", "max-age=60")
+	m.applySurrogateControl(&req, headers)
+
 	// w.Header().Set("microcache-cache", "1")
-	if headers.Get("microcache-cache") != "" {
+	if opts.Cache {
 		req.nocache = false
 	}
 
 	// w.Header().Set("microcache-nocache", "1")
-	if headers.Get("microcache-nocache") != "" {
+	if opts.Nocache {
 		req.nocache = true
 	}
 
 	// w.Header().Set("microcache-ttl", "10") // 10 seconds
-	ttlHdr, _ := strconv.Atoi(headers.Get("microcache-ttl"))
-	if ttlHdr > 0 {
-		req.ttl = time.Duration(ttlHdr) * time.Second
+	// w.Header().Set("microcache-ttl", "500ms")
+	if opts.TTL > 0 {
+		req.ttl = m.clampTTL(opts.TTL)
 	}
 
 	// w.Header().Set("microcache-stale-if-error", "20") // 20 seconds
-	staleIfErrorHdr, _ := strconv.Atoi(headers.Get("microcache-stale-if-error"))
-	if staleIfErrorHdr > 0 {
-		req.staleIfError = time.Duration(staleIfErrorHdr) * time.Second
+	if opts.StaleIfError > 0 {
+		req.staleIfError = opts.StaleIfError
 	}
 
 	// w.Header().Set("microcache-stale-while-revalidate", "20") // 20 seconds
-	staleWhileRevalidateHdr, _ := strconv.Atoi(headers.Get("microcache-stale-while-revalidate"))
-	if staleWhileRevalidateHdr > 0 {
-		req.staleWhileRevalidate = time.Duration(staleWhileRevalidateHdr) * time.Second
+	if opts.StaleWhileRevalidate > 0 {
+		req.staleWhileRevalidate = opts.StaleWhileRevalidate
+	}
+
+	// w.Header().Set("microcache-timeout", "30") // 30 seconds
+	if opts.Timeout > 0 {
+		req.timeout = opts.Timeout
 	}
 
 	// w.Header().Set("microcache-collapsed-forwarding", "1")
-	if headers.Get("microcache-collapsed-forwarding") != "" {
+	if opts.CollapsedForwarding {
 		req.collapsedForwarding = true
 	}
 
 	// w.Header().Set("microcache-no-collapsed-forwarding", "1")
-	if headers.Get("microcache-no-collapsed-forwarding") != "" {
+	if opts.NoCollapsedForwarding {
 		req.collapsedForwarding = false
 	}
 
 	// w.Header().Set("microcache-stale-recache", "1")
-	if headers.Get("microcache-stale-recache") != "" {
+	if opts.StaleRecache {
 		req.staleRecache = true
 	}
 
 	// w.Header().Set("microcache-no-stale-recache", "1")
-	if headers.Get("microcache-no-stale-recache") != "" {
+	if opts.NoStaleRecache {
 		req.staleRecache = false
 	}
 
 	// w.Header().Add("microcache-vary-query", "q, page, limit")
-	if varyQueries, ok := headers["Microcache-Vary-Query"]; ok {
-		for _, hdr := range varyQueries {
-			varyQueryParams := strings.Split(hdr, ",")
-			for i, v := range varyQueryParams {
-				varyQueryParams[i] = strings.Trim(v, " ")
-			}
-			req.varyQuery = append(req.varyQuery, varyQueryParams...)
-		}
+	req.varyQuery = opts.VaryQuery
+
+	// w.Header().Add("microcache-vary-cookie", "session, lang")
+	req.varyCookie = opts.VaryCookie
+
+	// w.Header().Set("microcache-set-cookie", "1")
+	if opts.SetCookie {
+		req.setCookie = true
 	}
 
 	// w.Header().Add("microcache-vary", "accept-language, accept-encoding")
-	if varyHdr, ok := headers["Microcache-Vary"]; ok {
-		for _, hdr := range varyHdr {
-			varyHdrs := strings.Split(hdr, ",")
-			for i, v := range varyHdrs {
-				varyHdrs[i] = strings.Trim(v, " ")
-			}
-			req.vary = append(req.vary, varyHdrs...)
-		}
-	}
+	req.vary = appendVary(req.vary, opts.Vary...)
 
 	// w.Header().Add("Vary", "accept-language, accept-encoding")
-	if varyHdr, ok := headers["Vary"]; ok {
-		for _, hdr := range varyHdr {
-			varyHdrs := strings.Split(hdr, ",")
-			for i, v := range varyHdrs {
-				varyHdrs[i] = strings.Trim(v, " ")
-			}
-			req.vary = append(req.vary, varyHdrs...)
-		}
+	// w.Header().Set("Vary", "*") // never cached
+	if varyAll(headers) {
+		req.nocache = true
+		return req
+	}
+	for _, hdr := range headers["Vary"] {
+		req.vary = appendVary(req.vary, strings.Split(hdr, ",")...)
 	}
 
 	return req
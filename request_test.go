@@ -28,28 +28,47 @@ func TestBuildRequestOpts(t *testing.T) {
 			i++
 		}
 	}
-	runCases(New(Config{}), []tc{
+	runCases(newMicrocache(Config{}), []tc{
 		{"microcache-nocache", "1", RequestOpts{nocache: true}},
 		{"microcache-ttl", "10", RequestOpts{ttl: time.Duration(10 * time.Second)}},
+		{"microcache-ttl", "500ms", RequestOpts{ttl: time.Duration(500 * time.Millisecond)}},
+		{"microcache-ttl", "1m30s", RequestOpts{ttl: time.Duration(90 * time.Second)}},
+		{"microcache-ttl", "-1s", RequestOpts{}},
+		{"microcache-ttl", "soon", RequestOpts{}},
+		{"microcache-stale-if-error", "1.5s", RequestOpts{staleIfError: time.Duration(1500 * time.Millisecond)}},
 		{"microcache-stale-if-error", "10", RequestOpts{staleIfError: time.Duration(10 * time.Second)}},
 		{"microcache-stale-while-revalidate", "10", RequestOpts{staleWhileRevalidate: time.Duration(10 * time.Second)}},
 		{"microcache-collapsed-forwarding", "1", RequestOpts{collapsedForwarding: true}},
+		{"microcache-timeout", "10", RequestOpts{timeout: time.Duration(10 * time.Second)}},
 		{"microcache-stale-recache", "1", RequestOpts{staleRecache: true}},
 		{"Microcache-Vary-Query", "a", RequestOpts{varyQuery: []string{"a"}}},
 	})
-	runCases(New(Config{Nocache: true}), []tc{
+	runCases(newMicrocache(Config{MinTTL: time.Second, MaxTTL: time.Minute}), []tc{
+		{"microcache-ttl", "10", RequestOpts{ttl: time.Duration(10 * time.Second)}},
+		{"microcache-ttl", "100ms", RequestOpts{ttl: time.Duration(time.Second)}},
+		{"microcache-ttl", "604800", RequestOpts{ttl: time.Duration(time.Minute)}},
+	})
+	runCases(newMicrocache(Config{Nocache: true}), []tc{
 		{"microcache-cache", "1", RequestOpts{nocache: false}},
 	})
-	runCases(New(Config{CollapsedForwarding: true}), []tc{
+	runCases(newMicrocache(Config{CollapsedForwarding: true}), []tc{
 		{"microcache-no-collapsed-forwarding", "1", RequestOpts{collapsedForwarding: false}},
 	})
-	runCases(New(Config{StaleRecache: true}), []tc{
+	runCases(newMicrocache(Config{StaleRecache: true}), []tc{
 		{"microcache-no-stale-recache", "1", RequestOpts{staleRecache: false}},
 	})
-	runCases(New(Config{Vary: []string{"a"}}), []tc{
-		{"Microcache-Vary", "b", RequestOpts{vary: []string{"a", "b"}}},
+	runCases(newMicrocache(Config{Vary: []string{"a"}}), []tc{
+		{"Microcache-Vary", "b", RequestOpts{vary: []string{"A", "B"}}},
+	})
+	runCases(newMicrocache(Config{Vary: []string{"a"}}), []tc{
+		{"Vary", "b", RequestOpts{vary: []string{"A", "B"}}},
+	})
+	// Vary headers are canonicalized and deduplicated
+	runCases(newMicrocache(Config{Vary: []string{"accept-language"}}), []tc{
+		{"Vary", "Accept-Language, ACCEPT-ENCODING, accept-encoding, ", RequestOpts{vary: []string{"Accept-Language", "Accept-Encoding"}}},
 	})
-	runCases(New(Config{Vary: []string{"a"}}), []tc{
-		{"Vary", "b", RequestOpts{vary: []string{"a", "b"}}},
+	// Vary: * is never cached
+	runCases(newMicrocache(Config{}), []tc{
+		{"Vary", "accept-language, *", RequestOpts{nocache: true}},
 	})
 }
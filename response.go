@@ -1,21 +1,39 @@
 package microcache
 
 import (
+	"bytes"
+	"io"
 	"net/http"
 	"strings"
 	"time"
+	"unsafe"
 )
 
+var responseSize = int(unsafe.Sizeof(Response{}))
+
+// readFromMinSize is the minimum size of a cached body sent using io.ReaderFrom
+const readFromMinSize = 32 << 10
+
 // Response is used both as a cache object for the response
 // and to wrap http.ResponseWriter for downstream requests.
+//
+// Cached objects are immutable. Their header and body are shared by clones and
+// concurrent readers so they must never be modified once stored.
 type Response struct {
 	found         bool
+	key           string
 	date          time.Time
+	age           time.Duration
 	expires       time.Time
 	status        int
 	headerWritten bool
 	header        http.Header
 	body          []byte
+
+	// digest is the xxhash of the uncompressed body, stored for large objects
+	// (see DigestMinSize) so that bodies need not be rehashed on comparison
+	digest   uint64
+	digested bool
 }
 
 func (res *Response) Write(b []byte) (int, error) {
@@ -32,40 +50,101 @@ func (res *Response) WriteHeader(code int) {
 	res.headerWritten = true
 }
 
-func (res *Response) sendResponse(w http.ResponseWriter) {
+// sendResponse sends the response to the client.
+// Responses to HEAD requests are sent without the body.
+func (res *Response) sendResponse(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "HEAD" {
+		res.sendHead(w)
+		return
+	}
+	res.sendHeader(w)
+	// Large bodies are handed off to the writer's ReadFrom which bypasses the
+	// response buffer and may write directly to the connection
+	if rf, ok := w.(io.ReaderFrom); ok && len(res.body) >= readFromMinSize {
+		rf.ReadFrom(bytes.NewReader(res.body))
+		return
+	}
+	w.Write(res.body)
+}
+
+// sendHeader copies the response header to w and writes the status if set
+func (res *Response) sendHeader(w http.ResponseWriter) {
+	h := w.Header()
+	// Cached values are copied into a single backing array so that writes to the
+	// response header can never modify the cached object
+	var n int
+	for _, values := range res.header {
+		n += len(values)
+	}
+	var copied []string
+	if n > 0 {
+		copied = make([]string, 0, n)
+	}
 	for header, values := range res.header {
 		// Do not forward microcache headers to client
 		if strings.HasPrefix(header, "Microcache-") {
 			continue
 		}
-		for _, val := range values {
-			w.Header().Add(header, val)
+		if _, ok := h[header]; ok {
+			// Age is single valued and already includes any upstream age
+			// Cache-Control, Expires and Surrogate-Control may have been replaced by
+			// SetClientCacheControl and SetSurrogateControl. Cache-Status already
+			// includes cached entries when set by StaleWarning
+			if header == "Age" || header == "Cache-Control" || header == "Expires" ||
+				header == "Surrogate-Control" || header == "Cache-Status" {
+				continue
+			}
+			h[header] = append(h[header], values...)
+			continue
 		}
+		copied = append(copied, values...)
+		h[header] = copied[len(copied)-len(values) : len(copied) : len(copied)]
 	}
 	if res.headerWritten {
 		w.WriteHeader(res.status)
 	}
-	w.Write(res.body)
-	return
 }
 
-func (res *Response) clone() Response {
-	return Response{
-		found:   res.found,
-		date:    res.date,
-		expires: res.expires,
-		status:  res.status,
-		header:  res.header,
-		body:    res.body,
+// Size returns the approximate number of bytes of memory consumed by the response.
+// Used by drivers to weigh or report the size of cached objects.
+func (res Response) Size() int {
+	s := responseSize
+
+	// Estimate size of the map itself.
+	s += 5*8 + len(res.header)*8
+
+	for k, vv := range res.header {
+		s += len(k)
+		for _, v := range vv {
+			s += len(v)
+		}
 	}
+
+	s += len(res.key)
+	s += cap(res.body)
+
+	return s
 }
 
-type passthroughWriter struct {
-	http.ResponseWriter
-	status int
+// WithBody returns a copy of the response having body. Used by compressors and
+// encryptors implemented outside of this package.
+func (res *Response) WithBody(body []byte) Response {
+	newres := res.clone()
+	newres.body = body
+	return newres
 }
 
-func (w *passthroughWriter) WriteHeader(code int) {
-	w.status = code
-	w.ResponseWriter.WriteHeader(code)
+func (res *Response) clone() Response {
+	return Response{
+		found:    res.found,
+		key:      res.key,
+		date:     res.date,
+		age:      res.age,
+		expires:  res.expires,
+		status:   res.status,
+		header:   res.header,
+		body:     res.body,
+		digest:   res.digest,
+		digested: res.digested,
+	}
 }
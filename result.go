@@ -0,0 +1,79 @@
+package microcache
+
+import (
+	"net/http"
+	"time"
+)
+
+// Outcome is the cache outcome of a request
+type Outcome string
+
+const (
+	// OutcomeHit is a fresh response served from the cache
+	OutcomeHit Outcome = "hit"
+
+	// OutcomeMiss is a response served by the backend, including passthrough
+	OutcomeMiss Outcome = "miss"
+
+	// OutcomeStale is an expired response served from the cache
+	OutcomeStale Outcome = "stale"
+)
+
+// RequestResult describes a completed request. It is passed to Config.OnRequestComplete.
+type RequestResult struct {
+	Request *http.Request
+	Outcome Outcome
+	Key     string        // request hash, empty for websocket passthrough
+	Label   string        // label returned by Config.LabelFunc, if set
+	Status  int           // response status
+	Size    int64         // response body bytes written to the client
+	Latency time.Duration // time spent serving the request
+}
+
+// resultWriter records the result of a request served to the client
+type resultWriter struct {
+	passthroughWriter
+	result RequestResult
+}
+
+// withResult reports the result of each request to OnRequestComplete and, when
+// LabelFunc is set, to the monitor as EventRequest
+func (m *microcache) withResult(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &resultWriter{passthroughWriter: passthroughWriter{ResponseWriter: w}}
+		rw.result = RequestResult{Request: r, Outcome: OutcomeMiss}
+		if m.LabelFunc != nil {
+			rw.result.Label = m.LabelFunc(r)
+		}
+		h.ServeHTTP(rw, r)
+		rw.result.Status = rw.getStatus()
+		rw.result.Size = rw.size
+		rw.result.Latency = time.Since(start)
+		if m.LabelFunc != nil {
+			m.event(EventRequest, Labels{
+				"label":   rw.result.Label,
+				"outcome": string(rw.result.Outcome),
+				"status":  statusClass(rw.result.Status),
+			})
+		}
+		if m.OnRequestComplete != nil {
+			m.OnRequestComplete(rw.result)
+		}
+	})
+}
+
+// setResultKey records the request hash when the result is being recorded
+func setResultKey(w http.ResponseWriter, key string) {
+	if rw, ok := w.(*resultWriter); ok {
+		rw.result.Key = key
+	}
+}
+
+// setOutcome records the cache outcome when the result is being recorded.
+// Requests are misses unless marked otherwise.
+func setOutcome(w http.ResponseWriter, outcome Outcome) {
+	if rw, ok := w.(*resultWriter); ok {
+		rw.result.Outcome = outcome
+	}
+}
@@ -0,0 +1,87 @@
+package microcache
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// OnRequestComplete reports the outcome, key, status and size of each request
+func TestOnRequestComplete(t *testing.T) {
+	var mutex sync.Mutex
+	var results []RequestResult
+	clock := &fakeClock{now: time.Now()}
+	cache := newMicrocache(Config{
+		TTL:                  30 * time.Second,
+		StaleWhileRevalidate: 30 * time.Second,
+		Clock:                clock,
+		Driver:               NewDriverLRU(10),
+		OnRequestComplete: func(res RequestResult) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			results = append(results, res)
+		},
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{
+		"/",
+		"/",
+	})
+	clock.add(45 * time.Second)
+	getResponse(handler, "/")
+	cache.Stop()
+	mutex.Lock()
+	defer mutex.Unlock()
+	var outcomes []Outcome
+	for _, res := range results {
+		outcomes = append(outcomes, res.Outcome)
+		if res.Status != 200 || res.Size != 5 || res.Request == nil {
+			t.Fatalf("Result not correct %+v", res)
+		}
+	}
+	expected := []Outcome{OutcomeMiss, OutcomeHit, OutcomeStale}
+	if !reflect.DeepEqual(outcomes, expected) {
+		t.Fatalf("Outcomes not correct %v != %v", outcomes, expected)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	if results[0].Key != getRequestHash(cache, r) || results[0].Key != results[2].Key {
+		t.Fatalf("Key not correct %q", results[0].Key)
+	}
+}
+
+// LabelFunc should break down outcomes by label
+func TestLabelFunc(t *testing.T) {
+	var stats Stats
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(s Stats) { stats = s }}
+	cache := newMicrocache(Config{
+		TTL:     30 * time.Second,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+		LabelFunc: func(r *http.Request) string {
+			return strings.Split(r.URL.Path, "/")[1]
+		},
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{
+		"/users/1",
+		"/users/1",
+		"/users/2",
+		"/posts/1",
+	})
+	testMonitor.Log(Stats{})
+	expected := map[string]LabelStats{
+		"users": {Hits: 1, Misses: 2},
+		"posts": {Misses: 1},
+	}
+	if !reflect.DeepEqual(stats.ByLabel, expected) {
+		t.Fatalf("ByLabel not correct %v != %v", stats.ByLabel, expected)
+	}
+	if stats.Events[EventRequest] != 4 {
+		t.Fatalf("Expected 4 request events, got %d", stats.Events[EventRequest])
+	}
+}
@@ -0,0 +1,65 @@
+package microcache
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryBackend reports whether a failed backend request should be retried and
+// prepares the backend response and request for the next attempt. Only 5xx
+// responses are retried. Timeouts are never retried since the timed out handler
+// continues to run. Requests with unbuffered bodies, canceled requests and responses
+// already streamed to the client are never retried.
+//
+// held reports whether the caller still holds its MaxBackendConcurrency slot, which
+// is given up during backoff and may not be reacquired.
+func (m *microcache) retryBackend(
+	r *http.Request,
+	beres *Response,
+	tee *teeWriter,
+	timedOut bool,
+	attempt int,
+	background bool,
+) (retry, held bool) {
+	if attempt >= m.BackendRetries || timedOut || !(beres.headerWritten && beres.status >= 500) {
+		return false, true
+	}
+	if r.Context().Err() != nil || !replayable(r) || (tee != nil && tee.started) {
+		return false, true
+	}
+	if !m.retryBackoff(r, attempt, background) {
+		return false, false
+	}
+	if hasBody(r) {
+		body, err := r.GetBody()
+		if err != nil {
+			return false, true
+		}
+		r.Body = body
+	}
+	m.event(EventBackendRetry, Labels{"path": r.URL.Path, "attempt": strconv.Itoa(attempt + 1)})
+	m.logDebug("microcache backend retry", "path", r.URL.Path, "attempt", attempt+1)
+	*beres = Response{header: http.Header{}, body: beres.body[:0]}
+	return true, true
+}
+
+// retryBackoff waits BackendRetryBackoff, doubling with each attempt. The backend
+// slot is released while waiting so that backoff does not starve other requests
+// under MaxBackendConcurrency. Returns false if the request was canceled or the slot
+// could not be reacquired, in which case no slot is held.
+func (m *microcache) retryBackoff(r *http.Request, attempt int, background bool) bool {
+	backoff := m.BackendRetryBackoff << uint(attempt)
+	if backoff <= 0 {
+		return true
+	}
+	m.releaseBackend()
+	t := time.NewTimer(backoff)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-r.Context().Done():
+		return false
+	}
+	return m.acquireBackend(r, background)
+}
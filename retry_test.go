@@ -0,0 +1,97 @@
+package microcache
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// BackendRetries should retry transient backend failures
+func TestBackendRetries(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:                 30 * time.Second,
+		BackendRetries:      2,
+		BackendRetryBackoff: time.Millisecond,
+		Monitor:             testMonitor,
+		Driver:              NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int64
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := atomic.AddInt64(&calls, 1); r.URL.Path == "/down" || n == 1 {
+			http.Error(w, "fail", 500)
+			return
+		}
+		w.Write([]byte("done\n"))
+	}))
+	if w := getResponse(handler, "/"); w.Code != 200 || w.Body.String() != "done\n" {
+		t.Fatalf("Expected retry to succeed, got %d %q", w.Code, w.Body.String())
+	}
+	if w := getResponse(handler, "/"); w.Code != 200 || testMonitor.getHits() != 1 {
+		t.Fatalf("Retried response should be cached %s", dumpMonitor(testMonitor))
+	}
+	if w := getResponse(handler, "/down"); w.Code != 500 {
+		t.Fatalf("Expected 500 after retries, got %d", w.Code)
+	}
+	if atomic.LoadInt64(&calls) != 5 || testMonitor.getEvents(EventBackendRetry) != 3 {
+		t.Fatalf("Expected 5 backend calls and 3 retries, got %d and %d", calls, testMonitor.getEvents(EventBackendRetry))
+	}
+}
+
+// Timeouts are not retried since the timed out handler continues to run
+func TestBackendRetriesTimeout(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		Timeout:        10 * time.Millisecond,
+		BackendRetries: 2,
+		Monitor:        testMonitor,
+		Driver:         NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int64
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		time.Sleep(30 * time.Millisecond)
+	}))
+	getResponse(handler, "/")
+	time.Sleep(40 * time.Millisecond)
+	if atomic.LoadInt64(&calls) != 1 || testMonitor.getEvents(EventBackendRetry) != 0 {
+		t.Fatalf("Expected 1 backend call and no retries, got %d and %d", calls, testMonitor.getEvents(EventBackendRetry))
+	}
+}
+
+// The backend slot is released during backoff
+func TestBackendRetryBackoffConcurrency(t *testing.T) {
+	cache := MustNew(Config{
+		BackendRetries:        1,
+		BackendRetryBackoff:   50 * time.Millisecond,
+		MaxBackendConcurrency: 1,
+		MaxBackendWait:        10 * time.Millisecond,
+		Driver:                NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int64
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" && atomic.AddInt64(&calls, 1) == 1 {
+			http.Error(w, "fail", 500)
+			return
+		}
+		w.Write([]byte("done\n"))
+	}))
+	done := make(chan int)
+	go func() {
+		done <- getResponse(handler, "/down").Code
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if w := getResponse(handler, "/"); w.Code != 200 {
+		t.Fatalf("Expected slot to be available during backoff, got %d", w.Code)
+	}
+	if code := <-done; code != 200 {
+		t.Fatalf("Expected retry to succeed, got %d", code)
+	}
+	if w := getResponse(handler, "/"); w.Code != 200 {
+		t.Fatalf("Expected slot to be released, got %d", w.Code)
+	}
+}
@@ -0,0 +1,26 @@
+package microcache
+
+import (
+	"net/http"
+
+	"github.com/cespare/xxhash"
+)
+
+// inRollout reports whether a request falls within RolloutPercent. Requests are
+// assigned to one of 100 buckets by a hash of the rollout key so that a key is
+// consistently cached or not.
+func (m *microcache) inRollout(r *http.Request, reqHash string) bool {
+	if m.RolloutPercent <= 0 || m.RolloutPercent >= 100 {
+		return true
+	}
+	key := reqHash
+	if m.RolloutKeyFunc != nil {
+		key = m.RolloutKeyFunc(r)
+	}
+	return rolloutBucket(key) < m.RolloutPercent
+}
+
+// rolloutBucket returns the rollout bucket of a key in the range [0, 100)
+func rolloutBucket(key string) int {
+	return int(xxhash.Sum64String(key) % 100)
+}
@@ -0,0 +1,57 @@
+package microcache
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// RolloutPercent caches a deterministic fraction of keys
+func TestRolloutPercent(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:            30 * time.Second,
+		RolloutPercent: 25,
+		Monitor:        testMonitor,
+		Driver:         NewDriverLRU(1000),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	var urls []string
+	for i := 0; i < 400; i++ {
+		urls = append(urls, fmt.Sprintf("/%d", i))
+	}
+	batchGet(handler, urls)
+	batchGet(handler, urls)
+	if hits := testMonitor.getHits(); hits < 60 || hits > 140 {
+		t.Fatalf("Rollout fraction not respected %s", dumpMonitor(testMonitor))
+	}
+	hits := testMonitor.getHits()
+	batchGet(handler, urls)
+	if testMonitor.getHits() != 2*hits {
+		t.Fatalf("Rollout not deterministic %s", dumpMonitor(testMonitor))
+	}
+}
+
+// RolloutKeyFunc buckets requests by a custom key
+func TestRolloutKeyFunc(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	var key string
+	for i := 0; rolloutBucket(key) >= 50; i++ {
+		key = fmt.Sprintf("user%d", i)
+	}
+	cache := MustNew(Config{
+		TTL:            30 * time.Second,
+		RolloutPercent: 50,
+		RolloutKeyFunc: func(r *http.Request) string { return key },
+		Monitor:        testMonitor,
+		Driver:         NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/a", "/a", "/b", "/b"})
+	if testMonitor.getHits() != 2 {
+		t.Fatalf("RolloutKeyFunc not respected %s", dumpMonitor(testMonitor))
+	}
+}
@@ -0,0 +1,50 @@
+package microcache
+
+import (
+	"context"
+	"net/http"
+)
+
+// Route predeclares the request options of a known endpoint. Request options are
+// otherwise learned from the first backend response to each request so, following
+// a restart, per-route vary and ttl are not honored until the backend responds.
+type Route struct {
+	// Method is the request method
+	// Default: GET
+	Method string
+
+	// URL is the request path including any query string hashed by HashQuery
+	//   /products?page=1
+	URL string
+
+	// Header contains the microcache-* response headers (and any other response
+	// headers evaluated by request options, ie. Vary or Content-Type) sent by the route
+	//   http.Header{"Microcache-Vary": {"Accept-Language"}, "Microcache-Ttl": {"30s"}}
+	Header http.Header
+}
+
+// seedRoutes stores request options for predeclared routes which have none. Request
+// hashes are computed for requests carrying no headers, so routes are only seeded for
+// requests having no value for the headers in Config.Vary.
+func (m *microcache) seedRoutes(routes []Route) {
+	for _, route := range routes {
+		method := route.Method
+		if method == "" {
+			method = "GET"
+		}
+		r, err := http.NewRequest(method, route.URL, nil)
+		if err != nil {
+			m.logWarn("microcache invalid route", "url", route.URL, "error", err)
+			continue
+		}
+		reqHash := m.requestHash(r, "", false)
+		if req, err := m.getRequestOpts(context.Background(), reqHash); err == nil && req.found {
+			continue
+		}
+		header := route.Header
+		if header == nil {
+			header = http.Header{}
+		}
+		m.setRequestOpts(reqHash, buildRequestOpts(m, Response{header: header}, r))
+	}
+}
@@ -0,0 +1,30 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// PredeclaredRoutes should apply request options before the first backend response
+func TestPredeclaredRoutes(t *testing.T) {
+	cache := newMicrocache(Config{
+		TTL:    30 * time.Second,
+		Driver: NewDriverLRU(10),
+		PredeclaredRoutes: []Route{
+			{URL: "/slow", Header: http.Header{"Microcache-Timeout": {"10ms"}}},
+			{URL: "/search?q=a", Header: http.Header{"Microcache-Vary": {"accept-language"}}},
+			{URL: "%"},
+		},
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(slowSuccessHandler))
+	if w := getResponse(handler, "/slow"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Predeclared timeout not respected on first request, got %d", w.Code)
+	}
+	r, _ := http.NewRequest("GET", "/search?q=a", nil)
+	req := cache.Driver.GetRequestOpts(getRequestHash(cache, r))
+	if !req.found || len(req.vary) != 1 || req.vary[0] != "Accept-Language" {
+		t.Fatalf("Predeclared vary not seeded %+v", req)
+	}
+}
@@ -0,0 +1,73 @@
+package microcache
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// staleWarning is the RFC 7234 warning sent with stale responses
+const staleWarning = `110 - "Response is Stale"`
+
+// setStaleHeaders marks a stale response with Warning and Cache-Status headers
+// describing how long ago the object expired and why it was served
+//
+//	Warning: 110 - "Response is Stale"
+//	Cache-Status: microcache; hit; ttl=-12; detail=stale-while-revalidate
+//
+// Detail is one of stale-while-revalidate, overload, hedge, maintenance, error, timeout,
+// panic or canceled.
+// Any Cache-Status entries from caches nearer the origin are retained in order.
+func (m *microcache) setStaleHeaders(w http.ResponseWriter, obj Response, detail string) {
+	if !m.StaleWarning {
+		return
+	}
+	staleAge := m.now().Sub(obj.expires)
+	if staleAge < 0 {
+		staleAge = 0
+	}
+	h := w.Header()
+	h.Add("Warning", staleWarning)
+	status := "microcache; hit; ttl=-" + strconv.FormatInt(int64(staleAge/time.Second), 10) +
+		"; detail=" + detail
+	h["Cache-Status"] = append(append([]string(nil), obj.header["Cache-Status"]...), status)
+}
+
+// StalePolicy determines which failed backend requests may be replaced by a stale
+// response during the stale-if-error grace period. Policies may be combined.
+type StalePolicy int
+
+const (
+	// StaleOn5xx serves stale in place of 5xx responses and recovered handler panics
+	StaleOn5xx StalePolicy = 1 << iota
+
+	// StaleOn4xx serves stale in place of 4xx responses
+	StaleOn4xx
+
+	// StaleOnTimeout serves stale in place of backend timeouts
+	StaleOnTimeout
+)
+
+// staleOnError reports whether a failed backend request may be replaced by a stale
+// response. Status codes listed in StaleIfErrorStatus take the place of StaleOn5xx and
+// StaleOn4xx. Canceled requests always qualify since the client is no longer waiting.
+func (m *microcache) staleOnError(status int, timedOut, canceled bool) bool {
+	switch {
+	case canceled:
+		return true
+	case timedOut:
+		return m.StaleIfErrorPolicy&StaleOnTimeout != 0
+	case len(m.StaleIfErrorStatus) > 0:
+		for _, s := range m.StaleIfErrorStatus {
+			if s == status {
+				return true
+			}
+		}
+		return false
+	case status >= 500:
+		return m.StaleIfErrorPolicy&StaleOn5xx != 0
+	case status >= 400:
+		return m.StaleIfErrorPolicy&StaleOn4xx != 0
+	}
+	return false
+}
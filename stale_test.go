@@ -0,0 +1,99 @@
+package microcache
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// StaleWarning marks stale responses with Warning and Cache-Status headers
+func TestStaleWarning(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	cache := MustNew(Config{
+		TTL:                  30 * time.Second,
+		StaleWhileRevalidate: 30 * time.Second,
+		StaleIfError:         600 * time.Second,
+		StaleWarning:         true,
+		Clock:                clock,
+		Driver:               NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(failureHandler))
+	getResponse(handler, "/")
+	clock.add(10 * time.Second)
+	w := getResponse(handler, "/")
+	if w.Header().Get("Warning") != "" || w.Header().Get("Cache-Status") != "" {
+		t.Fatal("Fresh response marked stale")
+	}
+	clock.add(32 * time.Second)
+	w = getResponse(handler, "/?fail=1")
+	if w.Header().Get("Warning") != staleWarning {
+		t.Fatalf("Warning not correct %q", w.Header().Get("Warning"))
+	}
+	expected := []string{"microcache; hit; ttl=-12; detail=stale-while-revalidate"}
+	if !reflect.DeepEqual(w.Header()["Cache-Status"], expected) {
+		t.Fatalf("Cache-Status not correct %v", w.Header()["Cache-Status"])
+	}
+}
+
+// Cache-Status entries from upstream caches are retained
+func TestStaleWarningUpstream(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	cache := MustNew(Config{
+		TTL:          30 * time.Second,
+		StaleIfError: 600 * time.Second,
+		StaleWarning: true,
+		Clock:        clock,
+		Driver:       NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Status", "origin; fwd=uri-miss")
+		failureHandler(w, r)
+	}))
+	getResponse(handler, "/")
+	clock.add(100 * time.Second)
+	w := getResponse(handler, "/?fail=1")
+	expected := []string{"origin; fwd=uri-miss", "microcache; hit; ttl=-70; detail=error"}
+	if !reflect.DeepEqual(w.Header()["Cache-Status"], expected) {
+		t.Fatalf("Cache-Status not correct %v", w.Header()["Cache-Status"])
+	}
+}
+
+// StaleIfErrorPolicy and StaleIfErrorStatus determine which failures are served stale
+func TestStaleIfErrorPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   Config
+		stale map[int]bool
+	}{
+		{Config{}, map[int]bool{500: true, 503: true, 429: false, 401: false}},
+		{Config{StaleIfErrorPolicy: StaleOn4xx}, map[int]bool{500: false, 429: true, 401: true}},
+		{Config{StaleIfErrorStatus: []int{429, 503}}, map[int]bool{500: false, 503: true, 429: true, 401: false}},
+	} {
+		tc.cfg.TTL = 30 * time.Second
+		tc.cfg.StaleIfError = 600 * time.Second
+		tc.cfg.QueryIgnore = []string{"status"}
+		tc.cfg.Exposed = true
+		tc.cfg.Driver = NewDriverLRU(10)
+		cache := MustNew(tc.cfg)
+		handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s := r.URL.Query().Get("status"); s != "" {
+				code, _ := strconv.Atoi(s)
+				w.WriteHeader(code)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		getResponse(handler, "/")
+		cache.offsetIncr(30 * time.Second)
+		for status, stale := range tc.stale {
+			w := getResponse(handler, "/?status="+strconv.Itoa(status))
+			if (w.Header().Get("microcache") == "STALE") != stale {
+				t.Fatalf("%+v: expected stale %v for %d, got %d", tc.cfg.StaleIfErrorPolicy, stale, status, w.Code)
+			}
+		}
+		cache.Stop()
+	}
+}
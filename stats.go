@@ -0,0 +1,106 @@
+package microcache
+
+import (
+	"sync/atomic"
+)
+
+// counters are cumulative totals reported by Stats
+type counters struct {
+	hits         int64
+	misses       int64
+	stales       int64
+	backend      int64
+	errors       int64
+	timeouts     int64
+	driverErrors int64
+	collapsing   int64
+}
+
+// Stats returns counters accumulated since the cache was created along with the
+// current size of the cache. Unlike Monitor, it is available on demand without a
+// Monitor and without waiting for the interval, ie. for use in health or metrics
+// endpoints. Rejected is the driver's total. TopKeys and counters only reported by
+// MonitorFunc are not included.
+func (m *microcache) Stats() Stats {
+	stats := Stats{
+		Size:         m.Driver.GetSize(),
+		Hits:         int(atomic.LoadInt64(&m.counters.hits)),
+		Misses:       int(atomic.LoadInt64(&m.counters.misses)),
+		Stales:       int(atomic.LoadInt64(&m.counters.stales)),
+		Backend:      int(atomic.LoadInt64(&m.counters.backend)),
+		Errors:       int(atomic.LoadInt64(&m.counters.errors)),
+		Timeouts:     int(atomic.LoadInt64(&m.counters.timeouts)),
+		DriverErrors: int(atomic.LoadInt64(&m.counters.driverErrors)),
+	}
+	if d, ok := m.Driver.(DriverSizeBytes); ok {
+		stats.Bytes = d.GetSizeBytes()
+	}
+	if d, ok := m.Driver.(DriverRejections); ok {
+		stats.Rejected = d.GetRejected()
+	}
+	m.setGauges(&stats)
+	return stats
+}
+
+// setGauges reports the current size of internal bookkeeping so that leaks, ie.
+// revalidations stuck on a hung backend, can be detected
+func (m *microcache) setGauges(stats *Stats) {
+	stats.Collapsing = int(atomic.LoadInt64(&m.counters.collapsing))
+	m.revalidateMutex.Lock()
+	stats.Revalidating = len(m.revalidating)
+	m.revalidateMutex.Unlock()
+	stats.RevalidateQueued = len(m.revalidateQueue)
+}
+
+// countHit records a cache hit
+func (m *microcache) countHit() {
+	atomic.AddInt64(&m.counters.hits, 1)
+	if m.Monitor != nil {
+		m.Monitor.Hit()
+	}
+}
+
+// countMiss records a cache miss
+func (m *microcache) countMiss() {
+	atomic.AddInt64(&m.counters.misses, 1)
+	if m.Monitor != nil {
+		m.Monitor.Miss()
+	}
+}
+
+// countStale records a stale response
+func (m *microcache) countStale() {
+	atomic.AddInt64(&m.counters.stales, 1)
+	if m.Monitor != nil {
+		m.Monitor.Stale()
+	}
+}
+
+// countBackend records a backend request
+func (m *microcache) countBackend() {
+	atomic.AddInt64(&m.counters.backend, 1)
+	if m.Monitor != nil {
+		m.Monitor.Backend()
+	}
+}
+
+// countError records a backend error response
+func (m *microcache) countError() {
+	atomic.AddInt64(&m.counters.errors, 1)
+	if m.Monitor != nil {
+		m.Monitor.Error()
+	}
+}
+
+// countTimeout records a backend timeout. Monitors are notified by EventTimeout.
+func (m *microcache) countTimeout() {
+	atomic.AddInt64(&m.counters.timeouts, 1)
+}
+
+// countDriverError records a driver or compressor failure
+func (m *microcache) countDriverError() {
+	atomic.AddInt64(&m.counters.driverErrors, 1)
+	if m.Monitor != nil {
+		m.Monitor.DriverError()
+	}
+}
@@ -0,0 +1,71 @@
+package microcache
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Stats should report cumulative counters without a Monitor
+func TestStats(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:    30 * time.Second,
+		Driver: NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/", "/", "/", "/a"})
+	stats := cache.Stats()
+	if stats.Size != 2 || stats.Hits != 2 || stats.Misses != 2 || stats.Backend != 2 {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	batchGet(handler, []string{"/"})
+	if stats = cache.Stats(); stats.Hits != 3 {
+		t.Fatalf("Stats should be cumulative %+v", stats)
+	}
+}
+
+// Stats should report collapsed requests and revalidations in flight
+func TestStatsGauges(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:                  30 * time.Second,
+		StaleWhileRevalidate: 30 * time.Second,
+		CollapsedForwarding:  true,
+		Driver:               NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	release := make(chan struct{})
+	var blocking int32
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&blocking) == 1 {
+			<-release
+		}
+		w.Write([]byte("done\n"))
+	}))
+	batchGet(handler, []string{"/"})
+	atomic.StoreInt32(&blocking, 1)
+
+	// collapsed requests
+	for i := 0; i < 2; i++ {
+		go getResponse(handler, "/a")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if stats := cache.Stats(); stats.Collapsing != 2 {
+		t.Fatalf("Expected 2 collapsing requests, got %+v", stats)
+	}
+
+	// stuck revalidation
+	cache.offsetIncr(31 * time.Second)
+	batchGet(handler, []string{"/"})
+	time.Sleep(20 * time.Millisecond)
+	if stats := cache.Stats(); stats.Revalidating != 1 {
+		t.Fatalf("Expected 1 revalidation in flight, got %+v", stats)
+	}
+
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	if stats := cache.Stats(); stats.Collapsing != 0 || stats.Revalidating != 0 {
+		t.Fatalf("Expected gauges to drain, got %+v", stats)
+	}
+}
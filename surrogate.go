@@ -0,0 +1,94 @@
+package microcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// surrogateOptions are the directives of a Surrogate-Control response header
+type surrogateOptions struct {
+	maxAge               time.Duration
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	noStore              bool
+}
+
+// parseSurrogateControl parses the Surrogate-Control header.
+// Unknown directives and invalid values are ignored.
+// Surrogate-Control: max-age=60, stale-while-revalidate=30, stale-if-error=3600
+func parseSurrogateControl(h http.Header) (opts surrogateOptions, ok bool) {
+	for _, v := range h["Surrogate-Control"] {
+		for _, directive := range strings.Split(v, ",") {
+			name, value := strings.TrimSpace(directive), ""
+			if i := strings.Index(name, "="); i >= 0 {
+				name, value = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+			}
+			var d *time.Duration
+			switch strings.ToLower(name) {
+			case "no-store":
+				opts.noStore = true
+				ok = true
+				continue
+			case "max-age":
+				d = &opts.maxAge
+			case "stale-while-revalidate":
+				d = &opts.staleWhileRevalidate
+			case "stale-if-error":
+				d = &opts.staleIfError
+			default:
+				continue
+			}
+			if parsed, err := ParseDuration(value); err == nil {
+				*d = parsed
+				ok = true
+			}
+		}
+	}
+	return
+}
+
+// applySurrogateControl applies Surrogate-Control directives to request options.
+// microcache-* headers take precedence since they are applied afterward.
+func (m *microcache) applySurrogateControl(req *RequestOpts, h http.Header) {
+	if !m.SurrogateControl {
+		return
+	}
+	opts, ok := parseSurrogateControl(h)
+	if !ok {
+		return
+	}
+	if opts.noStore {
+		req.nocache = true
+		return
+	}
+	if opts.maxAge > 0 {
+		req.ttl = m.clampTTL(opts.maxAge)
+		req.nocache = false
+	}
+	if opts.staleWhileRevalidate > 0 {
+		req.staleWhileRevalidate = opts.staleWhileRevalidate
+	}
+	if opts.staleIfError > 0 {
+		req.staleIfError = opts.staleIfError
+	}
+}
+
+// stripSurrogateControl removes the backend's Surrogate-Control header which is
+// intended for the microcache alone
+func (m *microcache) stripSurrogateControl(h http.Header) {
+	if m.SurrogateControl {
+		delete(h, "Surrogate-Control")
+	}
+}
+
+// setSurrogateControl sets a Surrogate-Control header describing the remaining freshness
+// of obj for an edge cache in front of the microcache. Cache-Control is left for browsers.
+func (m *microcache) setSurrogateControl(w http.ResponseWriter, obj Response) {
+	if !m.SetSurrogateControl || !downstreamCacheable(obj) {
+		return
+	}
+	maxAge, _ := m.downstreamFreshness(w, obj)
+	w.Header().Set("Surrogate-Control", "max-age="+strconv.FormatInt(maxAge, 10))
+}
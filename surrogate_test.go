@@ -0,0 +1,94 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// SurrogateControl determines ttl and is stripped from client responses
+func TestSurrogateControl(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	clock := &fakeClock{now: time.Now()}
+	cache := MustNew(Config{
+		Nocache:          true,
+		TTL:              30 * time.Second,
+		SurrogateControl: true,
+		Clock:            clock,
+		Monitor:          testMonitor,
+		Driver:           NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=5")
+		switch r.URL.Path {
+		case "/nostore":
+			w.Header().Set("Surrogate-Control", "no-store")
+		default:
+			w.Header().Set("Surrogate-Control", "max-age=60")
+		}
+		noopSuccessHandler(w, r)
+	}))
+	w := getResponse(handler, "/")
+	if _, ok := w.Header()["Surrogate-Control"]; ok {
+		t.Fatal("Surrogate-Control not stripped from miss")
+	}
+	if w.Header().Get("Cache-Control") != "max-age=5" {
+		t.Fatalf("Cache-Control not preserved %q", w.Header().Get("Cache-Control"))
+	}
+	clock.add(45 * time.Second)
+	w = getResponse(handler, "/")
+	if _, ok := w.Header()["Surrogate-Control"]; ok {
+		t.Fatal("Surrogate-Control not stripped from hit")
+	}
+	batchGet(handler, []string{
+		"/nostore",
+		"/nostore",
+	})
+	if testMonitor.getHits() != 1 || testMonitor.getMisses() != 3 {
+		t.Fatalf("Surrogate-Control not respected %s", dumpMonitor(testMonitor))
+	}
+}
+
+// SetSurrogateControl emits freshness for edge caches
+func TestSetSurrogateControl(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	cache := MustNew(Config{
+		TTL:                 30 * time.Second,
+		SurrogateControl:    true,
+		SetSurrogateControl: true,
+		SuppressAgeHeader:   true,
+		Clock:               clock,
+		Driver:              NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=5")
+		w.Header().Set("Surrogate-Control", "max-age=60")
+		noopSuccessHandler(w, r)
+	}))
+	w := getResponse(handler, "/")
+	if v := w.Header()["Surrogate-Control"]; len(v) != 1 || v[0] != "max-age=60" {
+		t.Fatalf("Miss Surrogate-Control not correct %v", v)
+	}
+	clock.add(20 * time.Second)
+	w = getResponse(handler, "/")
+	if v := w.Header()["Surrogate-Control"]; len(v) != 1 || v[0] != "max-age=40" {
+		t.Fatalf("Hit Surrogate-Control not correct %v", v)
+	}
+	if w.Header().Get("Cache-Control") != "max-age=5" {
+		t.Fatalf("Cache-Control not preserved %q", w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestParseSurrogateControl(t *testing.T) {
+	h := http.Header{"Surrogate-Control": {`max-age=60, stale-while-revalidate="30"`, "stale-if-error=1h, content=ESI/1.0, max-age=x"}}
+	opts, ok := parseSurrogateControl(h)
+	if !ok || opts.maxAge != time.Minute || opts.staleWhileRevalidate != 30*time.Second ||
+		opts.staleIfError != time.Hour || opts.noStore {
+		t.Fatalf("Surrogate-Control not parsed %+v", opts)
+	}
+	if _, ok := parseSurrogateControl(http.Header{}); ok {
+		t.Fatal("Missing Surrogate-Control parsed")
+	}
+}
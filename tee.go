@@ -0,0 +1,71 @@
+package microcache
+
+import (
+	"net/http"
+)
+
+// teeWriter streams a backend response to the client while capturing it for the cache
+type teeWriter struct {
+	res          *Response
+	w            http.ResponseWriter
+	exposedName  string
+	exposedValue string
+	surrogate    bool
+	started      bool
+	err          error
+}
+
+// streamMiss reports whether a miss may be streamed to the client as it is captured.
+// Responses are buffered when a timeout applies or a cached object exists since the
+// backend response may yet be replaced by a timeout or stale response.
+func (m *microcache) streamMiss(req RequestOpts, obj Response, background bool) bool {
+	return m.StreamMisses && !background && !obj.found && m.getTimeout(req) <= 0
+}
+
+func (t *teeWriter) Header() http.Header {
+	return t.res.header
+}
+
+func (t *teeWriter) WriteHeader(code int) {
+	if t.started {
+		return
+	}
+	t.res.WriteHeader(code)
+	t.start()
+}
+
+// Write captures the body and forwards it to the client.
+// Client write errors are not returned so that the backend completes the response
+// and a truncated body is never cached.
+func (t *teeWriter) Write(b []byte) (int, error) {
+	t.start()
+	t.res.Write(b)
+	if t.err == nil {
+		_, t.err = t.w.Write(b)
+	}
+	return len(b), nil
+}
+
+// Flush flushes buffered data to the client
+func (t *teeWriter) Flush() {
+	t.start()
+	if f, ok := t.w.(http.Flusher); ok && t.err == nil {
+		f.Flush()
+	}
+}
+
+// start sends the response header to the client
+func (t *teeWriter) start() {
+	if t.started {
+		return
+	}
+	t.started = true
+	if t.exposedName != "" {
+		t.w.Header().Set(t.exposedName, t.exposedValue)
+	}
+	t.res.sendHeader(t.w)
+	// Surrogate-Control is retained in the captured response until request options are built
+	if t.surrogate {
+		delete(t.w.Header(), "Surrogate-Control")
+	}
+}
@@ -0,0 +1,105 @@
+package microcache
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// StreamMisses writes the response to the client before the backend completes
+func TestStreamMisses(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:          30 * time.Second,
+		StreamMisses: true,
+		Exposed:      true,
+		Driver:       NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	release := make(chan struct{})
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("first "))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second"))
+	}))
+	w := &streamWriter{header: http.Header{}, written: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		r, _ := http.NewRequest("GET", "/", nil)
+		handler.ServeHTTP(w, r)
+		close(done)
+	}()
+	select {
+	case <-w.written:
+	case <-time.After(time.Second):
+		t.Fatal("Response should be streamed before the backend completes")
+	}
+	close(release)
+	<-done
+	if w.body() != "first second" || !w.flushed {
+		t.Fatalf("Unexpected streamed response %q (flushed: %v)", w.body(), w.flushed)
+	}
+	if w.header.Get("microcache") != "MISS" || w.header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("Streamed response missing headers %v", w.header)
+	}
+	r := getResponse(handler, "/")
+	if r.Header().Get("microcache") != "HIT" || r.Body.String() != "first second" {
+		t.Fatalf("Streamed response should be cached in full, got %q", r.Body.String())
+	}
+}
+
+// Misses are buffered when a timeout applies
+func TestStreamMissesTimeout(t *testing.T) {
+	cache := MustNew(Config{
+		TTL:          30 * time.Second,
+		StreamMisses: true,
+		Timeout:      10 * time.Millisecond,
+		Driver:       NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		time.Sleep(50 * time.Millisecond)
+	}))
+	r := getResponse(handler, "/")
+	if r.Code != http.StatusServiceUnavailable || bytes.Contains(r.Body.Bytes(), []byte("partial")) {
+		t.Fatalf("Timed out response should not be streamed, got %d %q", r.Code, r.Body.String())
+	}
+}
+
+type streamWriter struct {
+	header  http.Header
+	buf     bytes.Buffer
+	mutex   sync.Mutex
+	once    sync.Once
+	written chan struct{}
+	flushed bool
+}
+
+func (w *streamWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *streamWriter) WriteHeader(int) {}
+
+func (w *streamWriter) Write(b []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	defer w.once.Do(func() { close(w.written) })
+	return w.buf.Write(b)
+}
+
+func (w *streamWriter) Flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.flushed = true
+}
+
+func (w *streamWriter) body() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.buf.String()
+}
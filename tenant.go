@@ -0,0 +1,36 @@
+package microcache
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// tenantKey returns the cache key namespace for the request's tenant.
+// Purging a tenant increments its generation so all previously cached objects
+// become unreachable and are eventually evicted by the driver.
+func (m *microcache) tenantKey(r *http.Request) string {
+	if m.TenantKeyFunc == nil {
+		return ""
+	}
+	id := m.TenantKeyFunc(r)
+	m.tenantMutex.RLock()
+	gen := m.tenants[id]
+	m.tenantMutex.RUnlock()
+	return "tenant:" + strconv.Itoa(len(id)) + ":" + id + ":" + strconv.FormatUint(gen, 10) + "&"
+}
+
+// PurgeTenant invalidates all cached objects belonging to a tenant
+// Has no effect unless TenantKeyFunc is configured
+// The purge is broadcast to peers if an Invalidator is configured
+func (m *microcache) PurgeTenant(id string) {
+	m.purgeTenant(id)
+	m.publish(invalidation{Type: invalidateTenant, Tenant: id})
+}
+
+// purgeTenant increments a tenant's generation
+func (m *microcache) purgeTenant(id string) {
+	m.tenantMutex.Lock()
+	m.tenants[id]++
+	m.tenantMutex.Unlock()
+	m.logDebug("microcache purge tenant", "tenant", id)
+}
@@ -0,0 +1,149 @@
+package microcache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// timeoutHandler is adapted from http.TimeoutHandler.
+// It differs in that the response rendered upon timeout is delegated to onTimeout
+// so that timeouts can be customized and reported separately from backend errors.
+type timeoutHandler struct {
+	handler   http.Handler
+	timeout   time.Duration
+	onTimeout func(http.ResponseWriter, *http.Request)
+}
+
+func (h *timeoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if foregroundOnly(r) {
+		// The handler must not outlive the request
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	ctx, cancelCtx := context.WithTimeout(r.Context(), h.timeout)
+	defer cancelCtx()
+	r = r.WithContext(ctx)
+	done := make(chan struct{})
+	tw := &timeoutWriter{
+		header: http.Header{},
+	}
+	panicChan := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicChan <- p
+			}
+		}()
+		h.handler.ServeHTTP(tw, r)
+		close(done)
+	}()
+	select {
+	case p := <-panicChan:
+		panic(p)
+	case <-done:
+		tw.mutex.Lock()
+		defer tw.mutex.Unlock()
+		dst := w.Header()
+		for k, vv := range tw.header {
+			dst[k] = vv
+		}
+		if !tw.wroteHeader {
+			tw.code = http.StatusOK
+		}
+		w.WriteHeader(tw.code)
+		w.Write(tw.buf.Bytes())
+	case <-ctx.Done():
+		tw.mutex.Lock()
+		defer tw.mutex.Unlock()
+		switch err := ctx.Err(); err {
+		case context.DeadlineExceeded:
+			h.onTimeout(w, r)
+			tw.err = http.ErrHandlerTimeout
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			tw.err = err
+		}
+	}
+}
+
+// timeoutWriter buffers the backend response until it completes or times out
+type timeoutWriter struct {
+	header      http.Header
+	buf         bytes.Buffer
+	mutex       sync.Mutex
+	err         error
+	wroteHeader bool
+	code        int
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.err != nil {
+		return 0, tw.err
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	if tw.err != nil || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.code = code
+}
+
+// withTimeout wraps a handler with a timeout if a timeout applies to the request
+func (m *microcache) withTimeout(h http.Handler, req RequestOpts) http.Handler {
+	return m.withTimeoutFunc(h, req, m.handleTimeout)
+}
+
+// withTimeoutFunc wraps a handler with a timeout calling onTimeout upon expiration
+func (m *microcache) withTimeoutFunc(
+	h http.Handler,
+	req RequestOpts,
+	onTimeout func(http.ResponseWriter, *http.Request),
+) http.Handler {
+	timeout := m.getTimeout(req)
+	if timeout <= 0 {
+		return h
+	}
+	return &timeoutHandler{h, timeout, onTimeout}
+}
+
+// getTimeout returns the request specific backend timeout if set
+func (m *microcache) getTimeout(req RequestOpts) time.Duration {
+	if req.timeout > 0 {
+		return req.timeout
+	}
+	return m.Timeout
+}
+
+// handleTimeout reports a backend timeout and renders the timeout response
+func (m *microcache) handleTimeout(w http.ResponseWriter, r *http.Request) {
+	m.countTimeout()
+	m.event(EventTimeout, Labels{"path": r.URL.Path})
+	m.logWarn("microcache backend timeout", "path", r.URL.Path)
+	if m.TimeoutResponse != nil {
+		m.TimeoutResponse.ServeHTTP(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte("Timed out"))
+}
@@ -0,0 +1,5 @@
+module github.com/kevburnsjr/microcache/tools
+
+go 1.13
+
+require github.com/golang/snappy v0.0.1
@@ -0,0 +1,110 @@
+package microcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Transport is an http.RoundTripper which caches responses to outgoing requests.
+// The same ttl, stale-while-revalidate, stale-if-error and collapsed forwarding
+// behavior applied by Middleware is applied to client requests. Drivers, compressors
+// and monitors may be shared with server side caches.
+//
+//	mx := microcache.MustNew(microcache.Config{TTL: 10 * time.Second})
+//	client := &http.Client{Transport: &microcache.Transport{Cache: mx}}
+//
+// Network errors are treated as 502 Bad Gateway responses so that stale-if-error
+// applies. The error is returned if no stale response is available.
+type Transport struct {
+	// Cache is the microcache used to store responses
+	Cache Microcache
+
+	// Transport is the underlying RoundTripper used to make requests
+	// Default: http.DefaultTransport
+	Transport http.RoundTripper
+
+	// handler is the cache middleware, built on first use. Cache and Transport must
+	// not be modified after the first request.
+	once    sync.Once
+	handler http.Handler
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.once.Do(func() {
+		rt := roundTripHandler{transport: t.Transport}
+		if rt.transport == nil {
+			rt.transport = http.DefaultTransport
+		}
+		t.handler = t.Cache.Middleware(rt)
+	})
+	rtErr := &roundTripError{}
+	res := Response{header: http.Header{}}
+	t.handler.ServeHTTP(&res, r.WithContext(context.WithValue(r.Context(), roundTripErrorKey{}, rtErr)))
+	if err := rtErr.get(); err != nil && res.status == http.StatusBadGateway {
+		return nil, err
+	}
+	if !res.headerWritten {
+		res.status = http.StatusOK
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(res.status) + " " + http.StatusText(res.status),
+		StatusCode:    res.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        res.header,
+		Body:          ioutil.NopCloser(bytes.NewReader(res.body)),
+		ContentLength: int64(len(res.body)),
+		Request:       r,
+	}, nil
+}
+
+// roundTripErrorKey is the request context key of the roundTripError of a RoundTrip
+type roundTripErrorKey struct{}
+
+// roundTripError records the network error of a RoundTrip, if any. Background
+// revalidations may record errors after RoundTrip returns.
+type roundTripError struct {
+	mutex sync.Mutex
+	err   error
+}
+
+func (e *roundTripError) set(err error) {
+	e.mutex.Lock()
+	e.err = err
+	e.mutex.Unlock()
+}
+
+func (e *roundTripError) get() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.err
+}
+
+// roundTripHandler adapts a RoundTripper to an http.Handler
+type roundTripHandler struct {
+	transport http.RoundTripper
+}
+
+func (h roundTripHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	res, err := h.transport.RoundTrip(r)
+	if err != nil {
+		if e, ok := r.Context().Value(roundTripErrorKey{}).(*roundTripError); ok {
+			e.set(err)
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, res.Body)
+}
@@ -0,0 +1,114 @@
+package microcache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Transport caches client responses
+func TestTransport(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:          30 * time.Second,
+		StaleIfError: 30 * time.Second,
+		Monitor:      testMonitor,
+		Driver:       NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("x-calls", fmt.Sprintf("%d", calls))
+		w.Write([]byte("ok"))
+	}))
+	client := &http.Client{Transport: &Transport{Cache: cache}}
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(server.URL + "/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != 200 || string(body) != "ok" || res.Header.Get("x-calls") != "1" {
+			t.Fatalf("Unexpected response %d %s", res.StatusCode, body)
+		}
+	}
+
+	// Requests to other hosts do not collide
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("other"))
+	}))
+	defer server2.Close()
+	res, err := client.Get(server2.URL + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "other" {
+		t.Fatalf("Transport should key responses by host, got %s", body)
+	}
+
+	// Network errors serve stale
+	server.Close()
+	cache.offsetIncr(31 * time.Second)
+	res, err = client.Get(server.URL + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 || testMonitor.getStales() != 1 {
+		t.Fatalf("Transport should serve stale on network error %s", dumpMonitor(testMonitor))
+	}
+
+	// Network errors are returned without stale
+	if _, err = client.Get(server.URL + "/b"); err == nil {
+		t.Fatal("Transport should return network errors")
+	}
+}
+
+// middlewareCounter counts Middleware calls
+type middlewareCounter struct {
+	Microcache
+	calls int32
+}
+
+func (c *middlewareCounter) Middleware(h http.Handler) http.Handler {
+	atomic.AddInt32(&c.calls, 1)
+	return c.Microcache.Middleware(h)
+}
+
+// Transport builds the middleware once for all requests
+func TestTransportMiddlewareOnce(t *testing.T) {
+	cache := &middlewareCounter{Microcache: MustNew(Config{
+		TTL:    30 * time.Second,
+		Driver: NewDriverLRU(10),
+	})}
+	defer cache.Stop()
+	server := httptest.NewServer(http.HandlerFunc(noopSuccessHandler))
+	defer server.Close()
+	client := &http.Client{Transport: &Transport{Cache: cache}}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := client.Get(fmt.Sprintf("%s/%d", server.URL, i%3))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			res.Body.Close()
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&cache.calls); n != 1 {
+		t.Fatalf("Expected middleware to be built once, got %d", n)
+	}
+}
@@ -0,0 +1,26 @@
+package microcache
+
+import (
+	"net/http"
+	"time"
+)
+
+// TTLRemaining returns the time remaining until the cached response for a request
+// expires, ie. for emitting Expires headers or scheduling preemptive refreshes.
+// Returns false if no response is cached for the request. Responses which have
+// expired but may still be served stale return zero.
+func (m *microcache) TTLRemaining(r *http.Request) (time.Duration, bool) {
+	reqHash := getRequestHash(m, r)
+	req, err := m.getRequestOpts(r.Context(), reqHash)
+	if err != nil || !req.found {
+		return 0, false
+	}
+	_, obj, err := m.fetchObject(r, reqHash, req)
+	if err != nil || !obj.found {
+		return 0, false
+	}
+	if remaining := obj.expires.Sub(m.now()); remaining > 0 {
+		return remaining, true
+	}
+	return 0, true
+}
@@ -0,0 +1,42 @@
+package microcache
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Status returns the response status code
+func (res *Response) Status() int {
+	return res.status
+}
+
+// Body returns the response body. It must not be modified.
+func (res *Response) Body() []byte {
+	return res.body
+}
+
+// ValidResponse is the default Config.ValidateResponse. It rejects responses likely
+// truncated by a flaky backend:
+//   - a Content-Length header which does not match the body length
+//   - an empty 200 response declaring a Content-Type
+func ValidResponse(res Response) bool {
+	if cl := res.Header().Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil && n != len(res.Body()) {
+			return false
+		}
+	}
+	if res.Status() == http.StatusOK && len(res.Body()) == 0 && res.Header().Get("Content-Type") != "" {
+		return false
+	}
+	return true
+}
+
+// validate reports whether a backend response may be cached
+func (m *microcache) validate(r *http.Request, res Response) bool {
+	if m.ValidateResponse(res) {
+		return true
+	}
+	m.event(EventInvalidResponse, Labels{"path": r.URL.Path, "status": statusClass(res.status)})
+	m.logWarn("microcache invalid response not cached", "path", r.URL.Path, "status", res.status)
+	return false
+}
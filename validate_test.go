@@ -0,0 +1,55 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestValidResponse(t *testing.T) {
+	for i, c := range []struct {
+		status int
+		header http.Header
+		body   string
+		valid  bool
+	}{
+		{200, http.Header{}, "ok", true},
+		{200, http.Header{}, "", true},
+		{204, http.Header{"Content-Type": {"text/plain"}}, "", true},
+		{200, http.Header{"Content-Type": {"text/plain"}}, "", false},
+		{200, http.Header{"Content-Length": {"2"}}, "ok", true},
+		{200, http.Header{"Content-Length": {"10"}}, "ok", false},
+		{301, http.Header{"Content-Length": {"0"}}, "", true},
+	} {
+		res := Response{status: c.status, header: c.header, body: []byte(c.body)}
+		if ValidResponse(res) != c.valid {
+			t.Fatalf("Case %d: expected valid %v", i+1, c.valid)
+		}
+	}
+}
+
+// Responses rejected by ValidateResponse are served but not cached
+func TestValidateResponse(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:     30 * time.Second,
+		Monitor: testMonitor,
+		Driver:  NewDriverLRU(10),
+		ValidateResponse: func(res Response) bool {
+			return string(res.Body()) != "partial"
+		},
+	})
+	defer cache.Stop()
+	body := "partial"
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	if r := getResponse(handler, "/"); r.Body.String() != "partial" {
+		t.Fatal("Invalid response should be served")
+	}
+	body = "complete"
+	getResponse(handler, "/")
+	if r := getResponse(handler, "/"); r.Body.String() != "complete" || testMonitor.getHits() != 1 {
+		t.Fatal("Invalid response should not be cached", dumpMonitor(testMonitor))
+	}
+}
@@ -0,0 +1,54 @@
+package microcache
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// variantsSize is the number of request hashes whose variants are tracked
+const variantsSize = 1e4
+
+// admitVariant reports whether a new object may be stored for a request hash without
+// exceeding MaxVariantsPerKey. Variants are tracked until they may no longer be served,
+// including any stale grace period, so that expired variants make room for new ones.
+// Variants are tracked per version of the request options so that objects made
+// unreachable by PurgeOnWrite no longer count toward the limit.
+func (m *microcache) admitVariant(r *http.Request, reqHash, objHash string, req RequestOpts) bool {
+	if m.variants == nil {
+		return true
+	}
+	now := m.now()
+	expires := now.Add(req.ttl)
+	if req.immutable {
+		expires = immutableExpires
+	} else if req.staleWhileRevalidate > req.staleIfError {
+		expires = expires.Add(req.staleWhileRevalidate)
+	} else {
+		expires = expires.Add(req.staleIfError)
+	}
+	key := reqHash + ":" + strconv.FormatInt(req.version, 36)
+	m.variantMutex.Lock()
+	defer m.variantMutex.Unlock()
+	var set map[string]time.Time
+	if v, ok := m.variants.Get(key); ok {
+		set = v.(map[string]time.Time)
+	} else {
+		set = map[string]time.Time{}
+		m.variants.Add(key, set)
+	}
+	if _, ok := set[objHash]; !ok && len(set) >= m.MaxVariantsPerKey {
+		for hash, exp := range set {
+			if !now.Before(exp) {
+				delete(set, hash)
+			}
+		}
+	}
+	if _, ok := set[objHash]; ok || len(set) < m.MaxVariantsPerKey {
+		set[objHash] = expires
+		return true
+	}
+	m.event(EventVariantLimit, Labels{"path": r.URL.Path})
+	m.logDebug("microcache variant limit", "path", r.URL.Path, "variants", len(set))
+	return false
+}
@@ -0,0 +1,80 @@
+package microcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// MaxVariantsPerKey should serve excess variants uncached until variants expire
+func TestMaxVariantsPerKey(t *testing.T) {
+	var stats Stats
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(s Stats) { stats = s }}
+	cache := MustNew(Config{
+		TTL:               30 * time.Second,
+		MaxVariantsPerKey: 2,
+		Monitor:           testMonitor,
+		Driver:            NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte("done\n"))
+	}))
+	get := func(lang string) {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", lang)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	for _, lang := range []string{"en", "fr", "de", "en", "fr", "de"} {
+		get(lang)
+	}
+	if testMonitor.getHits() != 2 || testMonitor.getBackends() != 4 {
+		t.Fatal("MaxVariantsPerKey not respected", dumpMonitor(testMonitor))
+	}
+	testMonitor.Log(Stats{})
+	if stats.VariantsRejected != 2 {
+		t.Fatalf("Expected 2 rejected variants, got %d", stats.VariantsRejected)
+	}
+
+	// expired variants make room for new variants
+	cache.offsetIncr(31 * time.Second)
+	get("de")
+	get("de")
+	if testMonitor.getHits() != 1 || testMonitor.getBackends() != 1 {
+		t.Fatal("Expired variants should be forgotten", dumpMonitor(testMonitor))
+	}
+}
+
+// MaxVariantsPerKey should not count variants made unreachable by PurgeOnWrite
+func TestMaxVariantsPerKeyPurgeOnWrite(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := MustNew(Config{
+		TTL:               30 * time.Second,
+		StaleIfError:      time.Hour,
+		PurgeOnWrite:      true,
+		MaxVariantsPerKey: 2,
+		Monitor:           testMonitor,
+		Driver:            NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte("done\n"))
+	}))
+	get := func(method, lang string) {
+		r, _ := http.NewRequest(method, "/", nil)
+		r.Header.Set("Accept-Language", lang)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	get("GET", "en")
+	get("GET", "fr")
+	get("POST", "en")
+	for _, lang := range []string{"de", "es", "de", "es"} {
+		get("GET", lang)
+	}
+	if testMonitor.getHits() != 2 || testMonitor.getEvents(EventVariantLimit) != 0 {
+		t.Fatal("Purged variants should not count toward MaxVariantsPerKey", dumpMonitor(testMonitor))
+	}
+}
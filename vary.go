@@ -0,0 +1,92 @@
+package microcache
+
+import (
+	"net/http"
+	"strings"
+)
+
+// varyValue returns the value of a request header used for vary hashing,
+// transformed by the configured normalizer if one exists
+func (m *microcache) varyValue(r *http.Request, header string) string {
+	value := r.Header.Get(header)
+	if normalize, ok := m.VaryNormalizers[http.CanonicalHeaderKey(header)]; ok {
+		return normalize(value)
+	}
+	return value
+}
+
+// varyAll reports whether response headers include Vary: * in which case the
+// response must not be reused for any other request (RFC 7231 §7.1.4)
+func varyAll(header http.Header) bool {
+	for _, hdr := range header["Vary"] {
+		for _, v := range strings.Split(hdr, ",") {
+			if strings.TrimSpace(v) == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// appendVary appends header names in canonical form, omitting blanks and duplicates
+// so that differently cased names never produce divergent object hashes
+func appendVary(vary []string, headers ...string) []string {
+	for _, header := range headers {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if header == "" || containsHeader(vary, header) {
+			continue
+		}
+		vary = append(vary, header)
+	}
+	return vary
+}
+
+func containsHeader(headers []string, header string) bool {
+	for _, h := range headers {
+		if h == header {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptEncodings lists supported content codings in order of preference
+var acceptEncodings = []string{"br", "gzip", "deflate"}
+
+// NormalizeAcceptEncoding collapses an Accept-Encoding header value to the single
+// most preferred coding accepted by the client (br, gzip or deflate) or identity.
+// Client preference order and q-values other than q=0 are ignored so this assumes
+// the backend also prefers br over gzip over deflate.
+//
+//	VaryNormalizers: map[string]func(string) string{
+//		"Accept-Encoding": microcache.NormalizeAcceptEncoding,
+//	}
+func NormalizeAcceptEncoding(value string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(value, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+		accepted[coding] = true
+		for _, param := range params[1:] {
+			param = strings.ReplaceAll(strings.TrimSpace(param), " ", "")
+			if q := strings.TrimPrefix(param, "q="); q != param {
+				accepted[coding] = strings.Trim(q, "0.") != ""
+			}
+		}
+	}
+	for _, coding := range acceptEncodings {
+		if ok, listed := accepted[coding]; listed {
+			if ok {
+				return coding
+			}
+			continue
+		}
+		if accepted["*"] {
+			return coding
+		}
+	}
+	return "identity"
+}
@@ -0,0 +1,65 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Accept-Encoding collapses to the most preferred accepted coding
+func TestNormalizeAcceptEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                              "identity",
+		"identity":                      "identity",
+		"gzip":                          "gzip",
+		"deflate, gzip":                 "gzip",
+		"gzip, deflate, br":             "br",
+		"br;q=1.0, gzip;q=0.8, *;q=0.1": "br",
+		"GZIP, BR;q=0":                  "gzip",
+		"br;q=0.0, gzip;q=0.000":        "identity",
+		"*":                             "br",
+		"*, br;q=0":                     "gzip",
+		"compress, x-custom":            "identity",
+	}
+	for value, expected := range cases {
+		if res := NormalizeAcceptEncoding(value); res != expected {
+			t.Fatalf("NormalizeAcceptEncoding(%q) = %q, expected %q", value, res, expected)
+		}
+	}
+}
+
+// Accept-Encoding is normalized only if NormalizeAcceptEncoding is configured
+func TestVaryAcceptEncoding(t *testing.T) {
+	for _, normalize := range []bool{false, true} {
+		config := Config{
+			TTL:     30 * time.Second,
+			Driver:  NewDriverLRU(10),
+			Vary:    []string{"accept-encoding"},
+			Exposed: true,
+		}
+		if normalize {
+			config.VaryNormalizers = map[string]func(string) string{
+				"Accept-Encoding": NormalizeAcceptEncoding,
+			}
+		}
+		cache := MustNew(config)
+		handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+		cases := []struct {
+			value string
+			hit   bool
+		}{
+			{"gzip, deflate", false},
+			{"deflate, gzip", normalize},
+			{"gzip, deflate, br", false},
+			{"br, gzip", normalize},
+			{"br, gzip", true},
+		}
+		for i, c := range cases {
+			r := getResponseWithHeader(handler, "/", http.Header{"Accept-Encoding": []string{c.value}})
+			if c.hit != (r.Header().Get("microcache") == "HIT") {
+				t.Fatalf("Hit should have been %v for case %d (normalize %v)", c.hit, i+1, normalize)
+			}
+		}
+		cache.Stop()
+	}
+}
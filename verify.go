@@ -0,0 +1,42 @@
+package microcache
+
+import (
+	"math/rand"
+	"net/http"
+)
+
+// verify re-fetches a sampled cache hit from the backend in the background and
+// compares the backend response to the cached object, reporting any divergence.
+// Verification requests never wait for a backend slot.
+func (m *microcache) verify(h http.Handler, r *http.Request, req RequestOpts, obj Response) {
+	if m.VerifySampleRate <= 0 || !replayable(r) || rand.Float64() >= m.VerifySampleRate {
+		return
+	}
+	br, cancel := newBackgroundRequest(r, m.RevalidateTimeout)
+	if br.Method == "HEAD" {
+		br = headAsGet(br)
+	}
+	go func() {
+		defer cancel()
+		if !m.acquireBackend(br, true) {
+			return
+		}
+		res := Response{header: http.Header{}}
+		m.withTimeout(h, req).ServeHTTP(&res, br)
+		m.releaseBackend()
+		if !res.headerWritten {
+			res.status = http.StatusOK
+		}
+		result := "match"
+		if res.status != obj.status {
+			result = "status"
+		} else if bodyChanged(res, obj) {
+			result = "body"
+		}
+		m.event(EventVerify, Labels{"path": r.URL.Path, "result": result})
+		if result != "match" {
+			m.logWarn("microcache verification mismatch", "path", r.URL.Path, "result", result,
+				"cached", obj.status, "backend", res.status)
+		}
+	}()
+}
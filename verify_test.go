@@ -0,0 +1,39 @@
+package microcache
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// VerifySampleRate compares sampled hits to backend responses
+func TestVerify(t *testing.T) {
+	var stats Stats
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(s Stats) {
+		stats = s
+	}}
+	var version int64
+	cache := MustNew(Config{
+		TTL:              30 * time.Second,
+		VerifySampleRate: 1,
+		Monitor:          testMonitor,
+		Driver:           NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/changed" && atomic.LoadInt64(&version) > 0 {
+			w.Write([]byte("v2"))
+			return
+		}
+		w.Write([]byte("v1"))
+	}))
+	batchGet(handler, []string{"/", "/changed"})
+	atomic.StoreInt64(&version, 1)
+	batchGet(handler, []string{"/", "/changed"})
+	time.Sleep(20 * time.Millisecond)
+	testMonitor.Log(Stats{})
+	if stats.Verified != 2 || stats.VerifyMismatches != 1 {
+		t.Fatalf("Verification not reported %d/%d", stats.VerifyMismatches, stats.Verified)
+	}
+}
@@ -0,0 +1,110 @@
+package microcache
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// warmEntry is a recently hit key retained for background warming
+type warmEntry struct {
+	h   http.Handler
+	r   *http.Request
+	hit int32
+}
+
+// markWarm records a hit so that the key is kept warm by the warmer.
+// Requests having bodies which are not buffered can not be replayed and are ignored.
+func (m *microcache) markWarm(h http.Handler, r *http.Request, reqHash string) {
+	if m.warm == nil || !replayable(r) {
+		return
+	}
+	if v, ok := m.warm.Get(reqHash); ok {
+		atomic.StoreInt32(&v.(*warmEntry).hit, 1)
+		return
+	}
+	br, _ := newBackgroundRequest(r, 0)
+	m.warm.Add(reqHash, &warmEntry{h: h, r: br, hit: 1})
+}
+
+// warmCycle refreshes each key hit since the previous cycle whose object will expire
+// before the next cycle. Keys not hit since the previous cycle are forgotten.
+// Refreshes are spaced to respect WarmRate.
+func (m *microcache) warmCycle(done chan struct{}) {
+	var refreshed int
+	for _, reqHash := range m.warm.Keys() {
+		v, ok := m.warm.Peek(reqHash)
+		if !ok {
+			continue
+		}
+		e := v.(*warmEntry)
+		if atomic.SwapInt32(&e.hit, 0) == 0 {
+			m.warm.Remove(reqHash)
+			continue
+		}
+		if m.WarmRate > 0 && refreshed > 0 {
+			select {
+			case <-time.After(time.Second / time.Duration(m.WarmRate)):
+			case <-done:
+				return
+			}
+		}
+		if m.warmKey(e, reqHash) {
+			refreshed++
+		}
+	}
+}
+
+// warmKey revalidates a key in the background if its object is missing or will expire
+// before the next cycle
+func (m *microcache) warmKey(e *warmEntry, reqHash string) bool {
+	req, err := m.getRequestOpts(e.r.Context(), reqHash)
+	if err != nil {
+		m.driverError("GetRequestOpts", err)
+		return false
+	}
+	if !req.found || req.nocache {
+		return false
+	}
+	objHash, obj, err := m.fetchObject(e.r, reqHash, req)
+	if err != nil {
+		m.driverError("Get", err)
+		return false
+	}
+	if obj.found && obj.expires.After(m.now().Add(m.WarmInterval)) {
+		return false
+	}
+	m.event(EventWarm, Labels{"path": e.r.URL.Path})
+	m.logDebug("microcache warm", "path", e.r.URL.Path)
+	m.revalidate(e.h, &Response{header: http.Header{}}, e.r, reqHash, req, objHash, obj)
+	return true
+}
+
+// startWarmer periodically refreshes hot keys if WarmKeys is set
+func (m *microcache) startWarmer() {
+	if m.warm == nil || m.warmDone != nil {
+		return
+	}
+	m.warmDone = make(chan struct{})
+	go func(done chan struct{}) {
+		ticker := time.NewTicker(m.WarmInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.warmCycle(done)
+			case <-done:
+				return
+			}
+		}
+	}(m.warmDone)
+}
+
+// stopWarmer stops the warmer
+func (m *microcache) stopWarmer() {
+	if m.warmDone == nil {
+		return
+	}
+	close(m.warmDone)
+	m.warmDone = nil
+}
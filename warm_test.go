@@ -0,0 +1,55 @@
+package microcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// WarmKeys should revalidate hot keys nearing expiration and forget cold keys
+func TestWarmKeys(t *testing.T) {
+	testMonitor := &monitorFunc{interval: 100 * time.Second, logFunc: func(Stats) {}}
+	cache := newMicrocache(Config{
+		TTL:          30 * time.Second,
+		WarmKeys:     10,
+		WarmInterval: 10 * time.Second,
+		Monitor:      testMonitor,
+		Driver:       NewDriverLRU(10),
+	})
+	defer cache.Stop()
+	handler := cache.Middleware(http.HandlerFunc(noopSuccessHandler))
+	batchGet(handler, []string{"/", "/", "/cold"})
+	if cache.warm.Len() != 1 {
+		t.Fatalf("Expected 1 warm key, got %d", cache.warm.Len())
+	}
+
+	// fresh beyond the next cycle
+	cache.warmCycle(nil)
+	time.Sleep(10 * time.Millisecond)
+	if testMonitor.getBackends() != 2 {
+		t.Fatal("Warmer should not refresh objects fresh beyond the next cycle", dumpMonitor(testMonitor))
+	}
+
+	// expiring before the next cycle
+	batchGet(handler, []string{"/"})
+	cache.offsetIncr(25 * time.Second)
+	cache.warmCycle(nil)
+	time.Sleep(10 * time.Millisecond)
+	if testMonitor.getBackends() != 3 || testMonitor.getEvents(EventWarm) != 1 {
+		t.Fatal("Warmer did not refresh hot key", dumpMonitor(testMonitor))
+	}
+
+	// still a hit after original expiration
+	cache.offsetIncr(10 * time.Second)
+	batchGet(handler, []string{"/"})
+	if testMonitor.getHits() != 3 || testMonitor.getBackends() != 3 {
+		t.Fatal("Warmed key should be a hit", dumpMonitor(testMonitor))
+	}
+
+	// keys not hit during a cycle are forgotten
+	cache.warmCycle(nil)
+	cache.warmCycle(nil)
+	if cache.warm.Len() != 0 {
+		t.Fatalf("Expected cold key to be forgotten, got %d", cache.warm.Len())
+	}
+}
@@ -0,0 +1,31 @@
+package microcache
+
+// startWorkers starts the background revalidation workers if configured
+func (m *microcache) startWorkers() {
+	if m.revalidateQueue == nil || m.workersDone != nil {
+		return
+	}
+	m.workersDone = make(chan struct{})
+	for i := 0; i < m.RevalidateWorkers; i++ {
+		go func(queue chan func(), done chan struct{}) {
+			for {
+				select {
+				case job := <-queue:
+					job()
+				case <-done:
+					return
+				}
+			}
+		}(m.revalidateQueue, m.workersDone)
+	}
+}
+
+// stopWorkers stops the background revalidation workers.
+// Revalidations in progress are allowed to complete.
+func (m *microcache) stopWorkers() {
+	if m.workersDone == nil {
+		return
+	}
+	close(m.workersDone)
+	m.workersDone = nil
+}